@@ -0,0 +1,115 @@
+// Package audit records the operations the launcher performs on production nodes.
+//
+// The trail is a JSON lines file. Every line is one Entry, entries are only ever appended.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one recorded action.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// User is the local user that ran the launcher.
+	User string `json:"user"`
+	// Operation groups the entries of one command run, e.g. `node rollback`.
+	Operation string `json:"operation"`
+	// Target is the node or container acted on.
+	Target string `json:"target"`
+	// Action is the step, e.g. `backup` or `restart`.
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+	// Error is set when the action failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Trail appends entries to an audit file.
+type Trail struct {
+	mu   sync.Mutex
+	path string
+	user string
+}
+
+// DefaultPath returns `~/.kira2/audit.jsonl`.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "kira2-audit.jsonl"
+	}
+	return filepath.Join(home, ".kira2", "audit.jsonl")
+}
+
+// Open returns a Trail appending to path. The file and its directory are created when missing.
+func Open(path string) (*Trail, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit trail %s: %w", path, err)
+	}
+	f.Close()
+
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	return &Trail{path: path, user: name}, nil
+}
+
+// Path is the file the trail appends to.
+func (t *Trail) Path() string {
+	return t.path
+}
+
+// Record appends an entry. Time and User are filled in.
+func (t *Trail) Record(e Entry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e.Time = time.Now().UTC()
+	e.User = t.user
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit trail %s: %w", t.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit trail %s: %w", t.path, err)
+	}
+
+	return nil
+}
+
+// Operation returns a recorder for the actions of one operation on target.
+func (t *Trail) Operation(operation, target string) *Recorder {
+	return &Recorder{trail: t, operation: operation, target: target}
+}
+
+// Recorder records the actions of one operation.
+type Recorder struct {
+	trail     *Trail
+	operation string
+	target    string
+}
+
+// Record appends an action with its outcome. err is the outcome of the action, not of the write.
+func (r *Recorder) Record(action, detail string, err error) error {
+	e := Entry{Operation: r.operation, Target: r.target, Action: action, Detail: detail}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return r.trail.Record(e)
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/gov"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "audit"
+	short = "Report the on-chain state of a network"
+	long  = "Collect and report on-chain state through sekaid in a node container"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Audit returns a cobra.Command grouping the audit subcommands.
+func Audit() *cobra.Command {
+	log.Debugln("Adding `audit` command...")
+	auditCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	auditCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(auditCmd.PersistentFlags(), "docker-config", "docker_config")
+	auditCmd.PersistentFlags().String("container", types.DefaultSekaiContainer, "Node container running sekaid")
+	config.Bind(auditCmd.PersistentFlags(), "container", "container")
+	auditCmd.PersistentFlags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(auditCmd.PersistentFlags(), "home", "sekai_home")
+
+	auditCmd.AddCommand(govReport())
+
+	return auditCmd
+}
+
+// govOutput is the result of `audit gov`: the report, and its drift when compared against a
+// baseline. Drift is empty but present when nothing changed.
+type govOutput struct {
+	*gov.Report
+	Drift *[]gov.Change `json:"drift,omitempty"`
+}
+
+func govReport() *cobra.Command {
+	govCmd := &cobra.Command{
+		Use:   "gov",
+		Short: "Report network properties, roles, permissions, councilors and execution fees",
+		Long: `Query the customgov module at the latest height and print one normalized report of the network
+properties, roles, permissions with their whitelisted and blacklisted addresses, governance members,
+councilors and execution fees. The text output is Markdown, --output=json or yaml the structured report.
+Save a report with --save-baseline and compare later reports against it with --baseline to see
+governance drift. --fail-on-drift exits with an error when anything changed`,
+		Example: `audit gov --baseline=gov-baseline.json --fail-on-drift
+audit gov --output=json --out=gov-report.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			out, _ := cmd.Flags().GetString("out")
+			baselinePath, _ := cmd.Flags().GetString("baseline")
+			savePath, _ := cmd.Flags().GetString("save-baseline")
+			failOnDrift, _ := cmd.Flags().GetBool("fail-on-drift")
+
+			if failOnDrift && baselinePath == "" {
+				return fmt.Errorf("--fail-on-drift needs a --baseline")
+			}
+			var baseline *gov.Report
+			if baselinePath != "" {
+				var err error
+				if baseline, err = gov.LoadReport(baselinePath); err != nil {
+					return err
+				}
+			}
+
+			dm, err := docker.NewDockerManagerFromFile(cfg.DockerConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			report, err := gov.Collect(ctx, sekai.NewCLI(dm, cfg.Container, cfg.SekaiHome))
+			if err != nil {
+				return err
+			}
+			var drift []gov.Change
+			if baseline != nil {
+				if baseline.ChainID != report.ChainID {
+					log.Warnf("Baseline is of chain %s, the report of chain %s", baseline.ChainID, report.ChainID)
+				}
+				drift = gov.Diff(baseline, report)
+			}
+
+			if savePath != "" {
+				data, err := report.JSON()
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(savePath, data, 0644); err != nil {
+					return fmt.Errorf("failed to save baseline %s: %w", savePath, err)
+				}
+				log.Infof("Baseline saved to %s", savePath)
+			}
+
+			result := govOutput{Report: report}
+			if baseline != nil {
+				result.Drift = &drift
+			}
+			if out == "" {
+				if err := output.Print(cmd, result, report.Markdown(drift)); err != nil {
+					return err
+				}
+			} else if err := writeReport(out, output.FormatOf(cmd), result, report.Markdown(drift)); err != nil {
+				return err
+			}
+
+			if failOnDrift && len(drift) > 0 {
+				return fmt.Errorf("governance drifted from %s in %d values", baselinePath, len(drift))
+			}
+			return nil
+		},
+	}
+	govCmd.Flags().StringP("out", "o", "", "File to write the report to instead of stdout")
+	govCmd.Flags().String("baseline", "", "JSON report to compare the current state against")
+	govCmd.Flags().String("save-baseline", "", "Save the report as JSON to this file, to be used as --baseline later")
+	govCmd.Flags().Bool("fail-on-drift", false, "Exit with an error when the state differs from --baseline")
+
+	return govCmd
+}
+
+// writeReport renders the report to the file path in format.
+func writeReport(path string, format output.Format, result govOutput, markdown string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report %s: %w", path, err)
+	}
+	if err := output.Write(f, format, result, markdown); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	log.Infof("Report saved to %s", path)
+	return nil
+}
@@ -5,10 +5,26 @@ import (
 	"os"
 	"strings"
 
+	"github.com/mrlutik/kira2.0/internal/cli/audit"
+	cliconfig "github.com/mrlutik/kira2.0/internal/cli/config"
+	"github.com/mrlutik/kira2.0/internal/cli/custody"
+	"github.com/mrlutik/kira2.0/internal/cli/daemon"
 	"github.com/mrlutik/kira2.0/internal/cli/deploy"
+	"github.com/mrlutik/kira2.0/internal/cli/genesis"
+	"github.com/mrlutik/kira2.0/internal/cli/gov"
+	"github.com/mrlutik/kira2.0/internal/cli/identity"
 	"github.com/mrlutik/kira2.0/internal/cli/keys"
+	"github.com/mrlutik/kira2.0/internal/cli/logs"
+	"github.com/mrlutik/kira2.0/internal/cli/node"
+	"github.com/mrlutik/kira2.0/internal/cli/stack"
+	"github.com/mrlutik/kira2.0/internal/cli/testnet"
+	"github.com/mrlutik/kira2.0/internal/cli/tokens"
+	"github.com/mrlutik/kira2.0/internal/cli/upgrade"
 	"github.com/mrlutik/kira2.0/internal/cli/version"
+	"github.com/mrlutik/kira2.0/internal/config"
 	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
 	"github.com/spf13/cobra"
 )
 
@@ -20,17 +36,33 @@ const (
 
 var log = logging.Log
 
+func init() {
+	// The sekaid home is shared by the commands of most groups.
+	config.Register("sekai_home", func() string { return sekai.DefaultHome }, nil)
+	config.Register("output", func() string { return string(output.Text) }, func(value string) error {
+		_, err := output.ParseFormat(value)
+		return err
+	})
+}
+
 func NewCLI(cmds []*cobra.Command) *cobra.Command {
 	log.Debug("Creating new CLI...")
 	rootCmd := &cobra.Command{
 		Use:   use,
 		Short: short,
 		Long:  long,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			logLevel, _ := cmd.Flags().GetString("log-level")
-			if logLevel != "" {
-				logging.SetLevel(logLevel)
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Resolve(cmd)
+			if err != nil {
+				return err
+			}
+			format, err := output.ParseFormat(cfg.Output)
+			if err != nil {
+				return err
 			}
+			logging.SetLevel(cfg.LogLevel)
+			cmd.SetContext(output.NewContext(config.NewContext(cmd.Context(), cfg), format))
+			return nil
 		},
 	}
 	for _, cmd := range cmds {
@@ -38,11 +70,15 @@ func NewCLI(cmds []*cobra.Command) *cobra.Command {
 	}
 	rootCmd.PersistentFlags().Bool("verbose", false, "Verbosity level. Default: `false` ")
 	rootCmd.PersistentFlags().String("log-level", "panic", fmt.Sprintf("Messages with this level and above will be logged. Valid levels are: %s", strings.Join(logging.ValidLogLevels, ", ")))
+	output.AddFlag(rootCmd)
+	config.AddFlag(rootCmd)
+	config.Bind(rootCmd.PersistentFlags(), "log-level", "log_level")
+	config.Bind(rootCmd.PersistentFlags(), "output", "output")
 	return rootCmd
 }
 
 func Start() {
-	cmds := []*cobra.Command{version.Version(), deploy.Node(), keys.Generate()}
+	cmds := []*cobra.Command{version.Version(), deploy.Node(), keys.Generate(), logs.Logs(), daemon.Daemon(), stack.Up(), stack.Down(), genesis.Genesis(), node.Node(), upgrade.Upgrade(), testnet.Testnet(), custody.Custody(), gov.Gov(), audit.Audit(), tokens.Tokens(), identity.Identity(), cliconfig.Config()}
 	c := NewCLI(cmds)
 	if err := c.Execute(); err != nil {
 		log.Errorf("Failed to execute command %v\n", err)
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "config"
+	short = "Show the launcher settings and where they come from"
+	long  = `The settings shared by the commands are taken from, in order of precedence: the flags given on the
+command line, the KIRA2_* environment variables, the config file (~/.config/kira2/config.yaml unless
+--config or KIRA2_CONFIG name another) and the built-in defaults. They are validated before every command`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Config returns a cobra.Command grouping the config subcommands.
+func Config() *cobra.Command {
+	log.Debugln("Adding `config` command...")
+	configCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+
+	configCmd.AddCommand(show())
+
+	return configCmd
+}
+
+// Shown is the result of config show.
+type Shown struct {
+	File     string         `json:"file,omitempty"`
+	Settings []config.Entry `json:"settings"`
+}
+
+func show() *cobra.Command {
+	return &cobra.Command{
+		Use:     "show",
+		Short:   "Print the effective settings and the source of each value",
+		Example: "KIRA2_CONTAINER=validator config show --output=yaml",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			shown := Shown{File: cfg.File, Settings: cfg.Entries()}
+			return output.Print(cmd, shown, config.FormatEntries(cfg))
+		},
+	}
+}
@@ -0,0 +1,449 @@
+package custody
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moby/term"
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/custody"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "custody"
+	short = "Keep validator, node and operator keys encrypted on this machine"
+	long  = `Generate or import the priv_validator_key.json, node_key.json and operator mnemonic of a sekai
+node into a key set. Key sets are stored in --dir encrypted with a passphrase and only leave this
+machine when a node is deployed with --keys. The fingerprints of the keys are kept unencrypted
+next to them and every key added to a set is recorded in the audit trail`
+
+	// PassphraseEnv is the environment variable the passphrase is read from when no file is given.
+	PassphraseEnv = "KIRA2_KEYS_PASSPHRASE"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+func init() {
+	config.Register("keys_dir", custody.DefaultDir, nil)
+	config.Register("audit_log", audit.DefaultPath, nil)
+}
+
+// Custody returns a cobra.Command grouping the custody subcommands.
+func Custody() *cobra.Command {
+	log.Debugln("Adding `custody` command...")
+	custodyCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	custodyCmd.PersistentFlags().String("dir", custody.DefaultDir(), "Directory of the key sets")
+	config.Bind(custodyCmd.PersistentFlags(), "dir", "keys_dir")
+	custodyCmd.PersistentFlags().String("audit-log", audit.DefaultPath(), "Path of the audit trail")
+	config.Bind(custodyCmd.PersistentFlags(), "audit-log", "audit_log")
+
+	custodyCmd.AddCommand(generate(), importKeys(), list(), release())
+
+	return custodyCmd
+}
+
+// AddPassphraseFlags adds the flags Passphrase reads.
+func AddPassphraseFlags(cmd *cobra.Command) {
+	cmd.Flags().String("passphrase-file", "", "File holding the passphrase of the key set. $"+PassphraseEnv+" or a prompt is used when empty")
+}
+
+// Passphrase returns the passphrase of a key set from --passphrase-file, $KIRA2_KEYS_PASSPHRASE
+// or a prompt on the terminal, in that order. confirm asks twice when prompting, for new keys.
+func Passphrase(cmd *cobra.Command, confirm bool) (string, error) {
+	if path, _ := cmd.Flags().GetString("passphrase-file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := prompt("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := prompt("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// prompt reads a line from the terminal without echoing it.
+func prompt(label string) (string, error) {
+	fd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		return "", fmt.Errorf("no passphrase given: use --passphrase-file or $%s", PassphraseEnv)
+	}
+	state, err := term.SaveState(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read terminal state: %w", err)
+	}
+	if err := term.DisableEcho(fd, state); err != nil {
+		return "", fmt.Errorf("failed to disable terminal echo: %w", err)
+	}
+	defer term.RestoreTerminal(fd, state)
+
+	fmt.Fprint(os.Stderr, label)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// put adds a key to a set and records it in the audit trail. It returns the record as stored.
+func put(cmd *cobra.Command, store *custody.Store, set string, secret []byte, rec custody.Record, passphrase string) (custody.Record, error) {
+	trail, err := audit.Open(config.FromCommand(cmd).AuditLog)
+	if err != nil {
+		return rec, err
+	}
+	rec.Created = time.Now().UTC()
+
+	err = store.Put(set, secret, rec, passphrase)
+	detail := fmt.Sprintf("%s %s, address %s", rec.Source, rec.Fingerprint, rec.Address)
+	if recErr := trail.Operation("custody "+rec.Source, set).Record("add "+string(rec.Kind), detail, err); recErr != nil {
+		return rec, recErr
+	}
+	return rec, err
+}
+
+// Added is the result of custody generate and import.
+type Added struct {
+	Set   string           `json:"set"`
+	Added []custody.Record `json:"added"`
+	// Kept are the keys the set already held, generate leaves them as they are.
+	Kept []custody.Record `json:"kept,omitempty"`
+}
+
+// Text returns a line per added and kept key.
+func (a *Added) Text() string {
+	var b strings.Builder
+	for _, r := range a.Added {
+		fmt.Fprintf(&b, "Added %s %s %s to set %s\n", r.Kind, r.Fingerprint, r.Address, a.Set)
+	}
+	for _, r := range a.Kept {
+		fmt.Fprintf(&b, "Kept %s %s %s of set %s\n", r.Kind, r.Fingerprint, r.Address, a.Set)
+	}
+	return b.String()
+}
+
+func generate() *cobra.Command {
+	generateCmd := &cobra.Command{
+		Use:   "generate <set>",
+		Short: "Generate the keys of a node into a key set",
+		Long: `Generate a validator key and a node key, and an operator mnemonic with sekaid in a throwaway
+container on the local Docker daemon. Keys the set already holds are kept`,
+		Example: "custody generate validator-1",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			set := args[0]
+			dir := config.FromCommand(cmd).KeysDir
+			sekaiVersion, _ := cmd.Flags().GetString("sekai")
+			withOperator, _ := cmd.Flags().GetBool("operator")
+
+			store := custody.NewStore(dir)
+			records, err := store.Records(set)
+			if err != nil {
+				return err
+			}
+			held := map[custody.Kind]bool{}
+			added := &Added{Set: set, Added: []custody.Record{}, Kept: records}
+			for _, r := range records {
+				held[r.Kind] = true
+			}
+
+			passphrase, err := Passphrase(cmd, len(records) == 0)
+			if err != nil {
+				return err
+			}
+			if len(records) > 0 {
+				// The set has to stay readable with one passphrase.
+				if _, err := store.Open(set, passphrase); err != nil {
+					return err
+				}
+			}
+
+			generators := map[custody.Kind]func() ([]byte, error){
+				custody.ValidatorKey: custody.GenerateValidatorKey,
+				custody.NodeKey:      custody.GenerateNodeKey,
+			}
+			for _, kind := range []custody.Kind{custody.ValidatorKey, custody.NodeKey} {
+				if held[kind] {
+					continue
+				}
+				secret, err := generators[kind]()
+				if err != nil {
+					return err
+				}
+				rec, err := custody.Inspect(kind, secret)
+				if err != nil {
+					return err
+				}
+				rec.Source = custody.SourceGenerated
+				if rec, err = put(cmd, store, set, secret, rec, passphrase); err != nil {
+					return err
+				}
+				added.Added = append(added.Added, rec)
+			}
+
+			if !withOperator || held[custody.OperatorKey] {
+				return output.Print(cmd, added, added.Text())
+			}
+			dm, err := docker.NewDockerManagerFromFile("")
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+			image := types.SekaiImage + ":" + sekaiVersion
+			if err := dm.PullImage(context.Background(), image); err != nil {
+				return err
+			}
+			mnemonic, rec, err := custody.Operator(context.Background(), dm, image, "")
+			if err != nil {
+				return err
+			}
+			rec.Source = custody.SourceGenerated
+			if rec, err = put(cmd, store, set, []byte(mnemonic), rec, passphrase); err != nil {
+				return err
+			}
+			added.Added = append(added.Added, rec)
+			return output.Print(cmd, added, added.Text())
+		},
+	}
+	generateCmd.Flags().Bool("operator", true, "Generate an operator key, needs the local Docker daemon")
+	generateCmd.Flags().String("sekai", types.DefaultSekaiVersion, "Version of sekai deriving the operator key")
+	AddPassphraseFlags(generateCmd)
+
+	return generateCmd
+}
+
+func importKeys() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import <set>",
+		Short: "Import existing keys of a node into a key set",
+		Long: `Import a priv_validator_key.json, a node_key.json and an operator mnemonic into a key set. The operator
+account is derived with sekaid in a throwaway container on the local Docker daemon. Delete the
+imported files afterwards, the key set is their only copy the launcher needs`,
+		Example: "custody import validator-1 --validator-key=priv_validator_key.json --node-key=node_key.json --operator-mnemonic=mnemonic.txt",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			set := args[0]
+			dir := config.FromCommand(cmd).KeysDir
+			sekaiVersion, _ := cmd.Flags().GetString("sekai")
+			files := map[custody.Kind]string{}
+			files[custody.ValidatorKey], _ = cmd.Flags().GetString("validator-key")
+			files[custody.NodeKey], _ = cmd.Flags().GetString("node-key")
+			files[custody.OperatorKey], _ = cmd.Flags().GetString("operator-mnemonic")
+
+			secrets := map[custody.Kind][]byte{}
+			for kind, path := range files {
+				if path == "" {
+					continue
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read %s key: %w", kind, err)
+				}
+				secrets[kind] = data
+			}
+			if len(secrets) == 0 {
+				return fmt.Errorf("nothing to import, give at least one of --validator-key, --node-key or --operator-mnemonic")
+			}
+
+			store := custody.NewStore(dir)
+			records, err := store.Records(set)
+			if err != nil {
+				return err
+			}
+			passphrase, err := Passphrase(cmd, len(records) == 0)
+			if err != nil {
+				return err
+			}
+			if len(records) > 0 {
+				if _, err := store.Open(set, passphrase); err != nil {
+					return err
+				}
+			}
+
+			added := &Added{Set: set, Added: []custody.Record{}}
+			for _, kind := range custody.Kinds {
+				secret, ok := secrets[kind]
+				if !ok {
+					continue
+				}
+				var rec custody.Record
+				if kind == custody.OperatorKey {
+					dm, err := docker.NewDockerManagerFromFile("")
+					if err != nil {
+						return fmt.Errorf("failed to create docker manager: %w", err)
+					}
+					image := types.SekaiImage + ":" + sekaiVersion
+					if err := dm.PullImage(context.Background(), image); err != nil {
+						return err
+					}
+					mnemonic := strings.Join(strings.Fields(string(secret)), " ")
+					if _, rec, err = custody.Operator(context.Background(), dm, image, mnemonic); err != nil {
+						return err
+					}
+					secret = []byte(mnemonic)
+				} else if rec, err = custody.Inspect(kind, secret); err != nil {
+					return err
+				}
+				rec.Source = custody.SourceImported
+				if rec, err = put(cmd, store, set, secret, rec, passphrase); err != nil {
+					return err
+				}
+				added.Added = append(added.Added, rec)
+			}
+
+			return output.Print(cmd, added, added.Text())
+		},
+	}
+	importCmd.Flags().String("validator-key", "", "Path to a priv_validator_key.json")
+	importCmd.Flags().String("node-key", "", "Path to a node_key.json")
+	importCmd.Flags().String("operator-mnemonic", "", "Path to a file holding the operator mnemonic")
+	importCmd.Flags().String("sekai", types.DefaultSekaiVersion, "Version of sekai deriving the operator key")
+	AddPassphraseFlags(importCmd)
+
+	return importCmd
+}
+
+// Set is a key set as listed by custody list.
+type Set struct {
+	Name        string           `json:"name"`
+	Keys        []custody.Record `json:"keys"`
+	SigningLock *custody.Lock    `json:"signing_lock,omitempty"`
+}
+
+func list() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:     "list [set]",
+		Short:   "List key sets and the fingerprints of their keys",
+		Long:    "List the key sets, or only the given one, with the fingerprint and address of every key. No passphrase is needed",
+		Example: "custody list validator-1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := custody.NewStore(config.FromCommand(cmd).KeysDir)
+
+			sets := args
+			if len(sets) == 0 {
+				var err error
+				if sets, err = store.Sets(); err != nil {
+					return err
+				}
+			}
+			var (
+				listed = []Set{}
+				text   strings.Builder
+			)
+			for _, set := range sets {
+				records, err := store.Records(set)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(&text, set)
+				for _, r := range records {
+					fmt.Fprintf(&text, "  %-18s %s  %s  %s %s\n", r.Kind, r.Fingerprint, r.Address, r.Source, r.Created.Format("2006-01-02"))
+				}
+				lock, err := store.SigningLock(set)
+				if err != nil {
+					return err
+				}
+				switch {
+				case lock == nil:
+				case lock.Released != nil:
+					fmt.Fprintf(&text, "  signing lock released %s\n", lock.Released.Format(time.RFC3339))
+				default:
+					fmt.Fprintf(&text, "  signing lock held by %s since %s\n", lock.Holder, lock.Acquired.Format(time.RFC3339))
+				}
+				listed = append(listed, Set{Name: set, Keys: records, SigningLock: lock})
+			}
+			return output.Print(cmd, listed, text.String())
+		},
+	}
+
+	return listCmd
+}
+
+// Released is the result of custody release: the released signing lock of a set.
+type Released struct {
+	Set string `json:"set"`
+	*custody.Lock
+}
+
+func release() *cobra.Command {
+	releaseCmd := &cobra.Command{
+		Use:   "release <set>",
+		Short: "Release the signing lock of a validator key whose node is gone",
+		Long: `Release the signing lock of the validator key of a set without reaching the node holding it, so the
+key can be deployed elsewhere without --move-from. Only do this once the node is confirmed down for
+good: a node that comes back with the key double signs. Pass the priv_validator_state.json of the
+node with --state when it could still be copied, the next node then refuses to sign behind it`,
+		Example: "custody release validator-1 --state=priv_validator_state.json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			set := args[0]
+			cfg := config.FromCommand(cmd)
+			statePath, _ := cmd.Flags().GetString("state")
+
+			var state *custody.SignState
+			if statePath != "" {
+				data, err := os.ReadFile(statePath)
+				if err != nil {
+					return fmt.Errorf("failed to read sign state: %w", err)
+				}
+				if state, err = custody.ParseSignState(data); err != nil {
+					return err
+				}
+			}
+			trail, err := audit.Open(cfg.AuditLog)
+			if err != nil {
+				return err
+			}
+
+			lock, err := custody.NewStore(cfg.KeysDir).ReleaseSigningLock(set, state)
+			detail := ""
+			if lock != nil {
+				detail = "held by " + lock.Holder.String()
+				if lock.State != nil {
+					detail += ", last signed " + lock.State.String()
+				}
+			}
+			if recErr := trail.Operation("custody release", set).Record("release signing lock", detail, err); recErr != nil {
+				return recErr
+			}
+			if err != nil {
+				return err
+			}
+			text := fmt.Sprintf("Released signing lock of validator key %s of set %s, %s\n", lock.Fingerprint, set, detail)
+			return output.Print(cmd, &Released{Set: set, Lock: lock}, text)
+		},
+	}
+	releaseCmd.Flags().String("state", "", "Path to the last priv_validator_state.json of the node holding the lock")
+
+	return releaseCmd
+}
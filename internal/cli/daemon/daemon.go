@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "daemon"
+	short = "Inspect the Docker daemon the launcher talks to"
+	long  = "Inspect the local or remote Docker daemon the launcher uses to run node containers"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Daemon returns a cobra.Command grouping the Docker daemon subcommands.
+func Daemon() *cobra.Command {
+	log.Debugln("Adding `daemon` command...")
+	daemonCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	daemonCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(daemonCmd.PersistentFlags(), "docker-config", "docker_config")
+
+	daemonCmd.AddCommand(check())
+
+	return daemonCmd
+}
+
+func check() *cobra.Command {
+	checkCmd := &cobra.Command{
+		Use:     "check",
+		Short:   "Check that the Docker daemon can run the node containers",
+		Long:    "Report the daemon version, API version, storage driver, cgroup version, rootless mode, free disk in the Docker root and the features node specs need. Fails when the daemon is incompatible",
+		Example: "daemon check --spec=nodes.yaml --output=json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath := config.FromCommand(cmd).DockerConfig
+			specPath, _ := cmd.Flags().GetString("spec")
+
+			var specs []docker.NodeSpec
+			if specPath != "" {
+				f, err := os.Open(specPath)
+				if err != nil {
+					return fmt.Errorf("failed to open node specs %s: %w", specPath, err)
+				}
+				defer f.Close()
+				if specs, err = docker.LoadNodeSpecs(f); err != nil {
+					return err
+				}
+			}
+
+			dm, err := docker.NewDockerManagerFromFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			report, err := dm.CheckCompatibility(context.Background(), specs)
+			if err != nil {
+				return err
+			}
+
+			if err := output.Print(cmd, report, report.String()); err != nil {
+				return err
+			}
+
+			if !report.Compatible {
+				return fmt.Errorf("docker daemon %s is not compatible: %d problem(s) found", report.ServerVersion, len(report.Problems))
+			}
+			return nil
+		},
+	}
+	checkCmd.Flags().String("spec", "", "Path to a YAML node spec file whose requirements should be checked")
+
+	return checkCmd
+}
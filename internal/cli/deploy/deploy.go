@@ -3,9 +3,11 @@ package deploy
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"sync"
 
 	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 )
@@ -24,12 +26,25 @@ var (
 func Node() *cobra.Command {
 	log.Debugln("Adding `deploy` command...")
 	nodeCmd := &cobra.Command{
-		Use:     use,
-		Short:   short,
-		Long:    long,
-		Args:    cobra.ExactArgs(1),
-		Example: "deploy 127.0.0.1 --priv-key=path/to/priv-key --pub-key=path/to/pub-key --interx=v0.3.16 --sekai=v0.3.46",
+		Use:   use,
+		Short: short,
+		Long:  long,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if join, _ := cmd.Flags().GetString("join"); join != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		Example: `deploy 127.0.0.1 --priv-key=path/to/priv-key --pub-key=path/to/pub-key --interx=v0.3.16 --sekai=v0.3.46
+deploy --join=http://10.0.0.1:26657 --genesis=genesis.json --genesis-sha256=4f1c... --sekai=v0.3.46 --interx=v0.3.16`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if join, _ := cmd.Flags().GetString("join"); join != "" {
+				if err := joinNetwork(cmd, join); err != nil {
+					log.Fatalf("Failed to join %s: %v", join, err)
+				}
+				return
+			}
+
 			privKey, _ := cmd.Flags().GetString("priv-key")
 			pubKey, _ := cmd.Flags().GetString("pub-key")
 
@@ -47,12 +62,14 @@ func Node() *cobra.Command {
 				log.Fatalf("Failed to forbid root login: %v", err)
 			}
 
-			osAndHardwareInfo, err := checkOSAndHardware(client)
+			host, err := checkOSAndHardware(client)
 			if err != nil {
 				log.Fatalf("Failed to check OS and hardware: %v", err)
 			}
-			log.Println(osAndHardwareInfo)
-
+			host.Address = args[0]
+			if err := output.Print(cmd, host, host.String()); err != nil {
+				log.Fatalf("Failed to print host info: %v", err)
+			}
 		},
 	}
 	for _, node := range nodes {
@@ -60,6 +77,7 @@ func Node() *cobra.Command {
 	}
 	nodeCmd.PersistentFlags().String("priv-key", "", "Path to private key")
 	nodeCmd.PersistentFlags().String("pub-key", "", "Path to pub key") // !Can be generated from private
+	addJoinFlags(nodeCmd)
 
 	return nodeCmd
 }
@@ -112,11 +130,45 @@ func forbidRootLogin(client *ssh.Client) error {
 
 	return nil
 }
-func checkOSAndHardware(client *ssh.Client) (string, error) {
+
+// HostInfo is the operating system and hardware of a host deploy prepared.
+type HostInfo struct {
+	Address string `json:"address"`
+	OS      string `json:"os"`
+	// Hardware is the output of every hardware command that succeeded, by command.
+	Hardware map[string]string `json:"hardware"`
+}
+
+// String returns the OS and the hardware command outputs in a fixed order.
+func (h *HostInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "OS: %s\nHardware Info:\n", h.OS)
+	for _, command := range hardwareCommands {
+		if out, ok := h.Hardware[command]; ok {
+			b.WriteString(out + "\n")
+		}
+	}
+	return b.String()
+}
+
+// hardwareCommands are run on the host to describe its hardware.
+var hardwareCommands = []string{
+	"lscpu",
+	"lspci",
+	"lshw",
+	"lsscsi",
+	"lsusb",
+	"df",
+	"free",
+	"dmidecode",
+	"hdparm",
+}
+
+func checkOSAndHardware(client *ssh.Client) (*HostInfo, error) {
 	// Check the operating system
 	session, err := client.NewSession()
 	if err != nil {
-		return "", fmt.Errorf("Failed to create session: %v", err)
+		return nil, fmt.Errorf("Failed to create session: %v", err)
 	}
 	defer session.Close()
 
@@ -126,26 +178,14 @@ func checkOSAndHardware(client *ssh.Client) (string, error) {
 	} else if output, err := session.Output("cmd /c ver"); err == nil {
 		os = string(output)
 	} else {
-		return "", fmt.Errorf("Failed to determine operating system: %v", err)
+		return nil, fmt.Errorf("Failed to determine operating system: %v", err)
 	}
 
 	// Check hardware resources
-	hardwareCommands := []string{
-		"lscpu",
-		"lspci",
-		"lshw",
-		"lsscsi",
-		"lsusb",
-		"df",
-		"free",
-		"dmidecode",
-		"hdparm",
-	}
-
 	var (
-		hardwareInfo string
-		mutex        sync.Mutex
-		wg           sync.WaitGroup
+		hardware = map[string]string{}
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
 	)
 
 	for _, cmd := range hardwareCommands {
@@ -160,7 +200,7 @@ func checkOSAndHardware(client *ssh.Client) (string, error) {
 			defer session.Close()
 			if output, err := session.Output(command); err == nil {
 				mutex.Lock()
-				hardwareInfo += string(output) + "\n"
+				hardware[command] = string(output)
 				mutex.Unlock()
 			} else {
 				log.Printf("Failed to execute command %s: %v", command, err)
@@ -170,5 +210,5 @@ func checkOSAndHardware(client *ssh.Client) (string, error) {
 
 	wg.Wait()
 
-	return fmt.Sprintf("OS: %s\nHardware Info:\n%s", os, hardwareInfo), nil
+	return &HostInfo{OS: strings.TrimSpace(os), Hardware: hardware}, nil
 }
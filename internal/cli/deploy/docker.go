@@ -7,30 +7,27 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func installDocker(client *ssh.Client) error {
+// installDocker installs Docker on the remote machine unless it is there already and returns
+// its version, for the caller to print with the deploy result.
+func installDocker(client *ssh.Client) (string, error) {
+	if version, err := checkDocker(client); err == nil {
+		log.Debugf("Docker is already installed: %s", version)
+		return version, nil
+	}
+
 	session, err := client.NewSession()
 	if err != nil {
-		log.Errorln("Failed to create session: ", err)
-		return fmt.Errorf("Failed to create session: %v", err)
+		return "", fmt.Errorf("Failed to create session: %v", err)
 	}
 	defer session.Close()
 
-	// Check if Docker is already installed
-	_, err = session.Output("docker -v")
-	if err == nil {
-		log.Println("Docker is already installed")
-		return nil
-	}
-
 	// Install Docker
 	installCmd := "curl -fsSL https://get.docker.com -o get-docker.sh && sh get-docker.sh"
-	_, err = session.Output(installCmd)
-	if err != nil {
-		log.Errorln("Failed to install Docker: ", err)
-		return fmt.Errorf("Failed to install Docker: %v", err)
+	if _, err := session.Output(installCmd); err != nil {
+		return "", fmt.Errorf("Failed to install Docker: %v", err)
 	}
 
-	return nil
+	return checkDocker(client)
 }
 
 // checkDocker checks if Docker is installed on the remote machine and returns its version or an error.
@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	clicustody "github.com/mrlutik/kira2.0/internal/cli/custody"
+	clistack "github.com/mrlutik/kira2.0/internal/cli/stack"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/custody"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/stack"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+func addJoinFlags(cmd *cobra.Command) {
+	defaults := stack.DefaultConfig()
+	cmd.Flags().String("join", "", "RPC address or seed (<node-id>@<host>:26656) of an existing network to join instead of deploying to a host")
+	cmd.Flags().String("genesis-sha256", "", "Expected SHA-256 of the --genesis file as published by the network, required with --join")
+	cmd.Flags().String("genesis", "", "Genesis file of the network, required with --join. It is written to the node as is once its hash is verified and it matches the genesis the network serves")
+	cmd.Flags().Int("max-peers", 10, "Maximum number of persistent peers taken from the network")
+	cmd.Flags().Duration("sync-timeout", node.DefaultReadiness().SyncTimeout, "How long the node gets to catch up with the network")
+	cmd.Flags().Int("min-peers", node.DefaultReadiness().MinPeers, "Number of peers the node needs before it counts as ready")
+	cmd.Flags().String("moniker", "KIRA NODE", "Moniker of the joining node")
+	cmd.Flags().String("name", defaults.Name, "Name of the stack, prefixing its containers, network and volumes")
+	clistack.AddPortFlags(cmd)
+	cmd.Flags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(cmd.Flags(), "docker-config", "docker_config")
+	cmd.Flags().String("keys", "", "Key set from `custody` to push into the node home instead of the keys sekaid init generates")
+	cmd.Flags().String("keys-dir", custody.DefaultDir(), "Directory of the key sets")
+	config.Bind(cmd.Flags(), "keys-dir", "keys_dir")
+	cmd.Flags().String("audit-log", audit.DefaultPath(), "Path of the audit trail the pushed keys are recorded in")
+	config.Bind(cmd.Flags(), "audit-log", "audit_log")
+	cmd.Flags().String("inventory", "", "Inventory of the nodes that may run the validator key of --keys, none of them may run it while it is deployed")
+	cmd.Flags().String("move-from", "", "Inventory node the validator key of --keys moves from. It is stopped and its last signed state carried over")
+	clicustody.AddPassphraseFlags(cmd)
+}
+
+// Joined is the result of deploy --join.
+type Joined struct {
+	Stack       string `json:"stack"`
+	Target      string `json:"target"`
+	SekaiImage  string `json:"sekai_image"`
+	InterxImage string `json:"interx_image,omitempty"`
+}
+
+// joinNetwork starts a sekai full node that joins the network behind target, and interx in
+// front of it when --interx is set.
+func joinNetwork(cmd *cobra.Command, target string) error {
+	name, _ := cmd.Flags().GetString("name")
+	moniker, _ := cmd.Flags().GetString("moniker")
+	sekaiVersion, _ := cmd.Flags().GetString("sekai")
+	interxVersion, _ := cmd.Flags().GetString("interx")
+	genesisHash, _ := cmd.Flags().GetString("genesis-sha256")
+	genesisPath, _ := cmd.Flags().GetString("genesis")
+	maxPeers, _ := cmd.Flags().GetInt("max-peers")
+	syncTimeout, _ := cmd.Flags().GetDuration("sync-timeout")
+	minPeers, _ := cmd.Flags().GetInt("min-peers")
+	keySet, _ := cmd.Flags().GetString("keys")
+	settings := config.FromCommand(cmd)
+	inventoryPath, _ := cmd.Flags().GetString("inventory")
+	moveFrom, _ := cmd.Flags().GetString("move-from")
+
+	if genesisPath == "" || genesisHash == "" {
+		return fmt.Errorf("--genesis and --genesis-sha256 are required with --join")
+	}
+
+	cfg := stack.DefaultConfig()
+	cfg.Name = name
+	cfg.Moniker = moniker
+	clistack.Ports(cmd, &cfg)
+	if sekaiVersion != "" {
+		cfg.SekaiImage = types.SekaiImage + ":" + sekaiVersion
+	}
+	cfg.InterxImage = ""
+	if interxVersion != "" {
+		cfg.InterxImage = types.InterxImage + ":" + interxVersion
+	}
+
+	dm, err := docker.NewDockerManagerFromFile(settings.DockerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create docker manager: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	join := stack.JoinConfig{
+		Target:        target,
+		GenesisSHA256: genesisHash,
+		MaxPeers:      maxPeers,
+	}
+	if join.Genesis, err = os.ReadFile(genesisPath); err != nil {
+		return fmt.Errorf("failed to read genesis %s: %w", genesisPath, err)
+	}
+	if keySet != "" {
+		passphrase, err := clicustody.Passphrase(cmd, false)
+		if err != nil {
+			return err
+		}
+		store := custody.NewStore(settings.KeysDir)
+		if join.Keys, err = store.Open(keySet, passphrase); err != nil {
+			return err
+		}
+		join.Signing = custody.Signing{Store: store, MoveFrom: moveFrom}
+		if inventoryPath != "" {
+			inv, err := inventory.LoadFile(inventoryPath)
+			if err != nil {
+				return err
+			}
+			join.Signing.Known = inv.Nodes
+		} else if moveFrom != "" {
+			return fmt.Errorf("--move-from needs the --inventory holding the node")
+		}
+		if join.Trail, err = audit.Open(settings.AuditLog); err != nil {
+			return err
+		}
+	}
+
+	readiness := node.DefaultReadiness()
+	readiness.SyncTimeout = syncTimeout
+	readiness.MinPeers = minPeers
+
+	join.Readiness = readiness
+
+	if err := stack.Join(ctx, dm, cfg, join); err != nil {
+		return err
+	}
+
+	joined := Joined{Stack: cfg.Name, Target: target, SekaiImage: cfg.SekaiImage, InterxImage: cfg.InterxImage}
+	text := fmt.Sprintf("Stack %s joined %s with %s\n", joined.Stack, joined.Target, joined.SekaiImage)
+	if joined.InterxImage != "" {
+		text = fmt.Sprintf("Stack %s joined %s with %s and %s\n", joined.Stack, joined.Target, joined.SekaiImage, joined.InterxImage)
+	}
+	return output.Print(cmd, joined, text)
+}
@@ -29,15 +29,16 @@ func checkPkg(client *ssh.Client, packageName string) (string, error) {
 	return pkgVersion, nil
 }
 
-func installPkg(path string) error {
+// installPkg installs the package at path and returns the dpkg output, for the caller to
+// print with the deploy result.
+func installPkg(path string) (string, error) {
 	installCmd := exec.Command("dpkg", "-i", path)
 	output, err := installCmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("Failed to install package: %v", err)
+		return "", fmt.Errorf("Failed to install package: %v", err)
 	}
 
-	log.Println(string(output))
-	return nil
+	return string(output), nil
 }
 
 func downloadPkg(client *ssh.Client, url, path string) error {
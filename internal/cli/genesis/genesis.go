@@ -0,0 +1,225 @@
+package genesis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "genesis"
+	short = "Create and inspect sekai genesis files"
+	long  = "Create sekai genesis files from a declarative spec and inspect existing ones"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Genesis returns a cobra.Command grouping the genesis subcommands.
+func Genesis() *cobra.Command {
+	log.Debugln("Adding `genesis` command...")
+	genesisCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	genesisCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(genesisCmd.PersistentFlags(), "docker-config", "docker_config")
+
+	genesisCmd.AddCommand(newGenesis(), inspect(), diff())
+
+	return genesisCmd
+}
+
+// Written is the result of genesis new.
+type Written struct {
+	ChainID string `json:"chain_id"`
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256"`
+	// Keys are the keys created for the genesis accounts.
+	Keys []WrittenKey `json:"keys,omitempty"`
+}
+
+// WrittenKey is a key genesis new created. Its mnemonic is only written to a file.
+type WrittenKey struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Mnemonic string `json:"mnemonic_file"`
+}
+
+func newGenesis() *cobra.Command {
+	newCmd := &cobra.Command{
+		Use:   "new",
+		Short: "Create a genesis.json from a YAML spec",
+		Long: `Create a genesis.json from a YAML spec by running sekaid init, keys add, add-genesis-account and
+gentx-claim inside a sekai container. Without --container a temporary container is started from --image.
+The genesis is written to --out and its SHA-256 to <out>.sha256. The mnemonic of every key created for
+an account is written to <mnemonics>/<name>.mnemonic, readable by the owner only. Move them into
+custody with custody import --operator-mnemonic and delete the files`,
+		Example: "genesis new --spec=genesis.yaml --out=genesis.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			specPath, _ := cmd.Flags().GetString("spec")
+			out, _ := cmd.Flags().GetString("out")
+			containerName, _ := cmd.Flags().GetString("container")
+			image, _ := cmd.Flags().GetString("image")
+			mnemonics, _ := cmd.Flags().GetString("mnemonics")
+			if mnemonics == "" {
+				mnemonics = out + ".mnemonics"
+			}
+
+			f, err := os.Open(specPath)
+			if err != nil {
+				return fmt.Errorf("failed to open genesis spec %s: %w", specPath, err)
+			}
+			defer f.Close()
+			spec, err := genesis.LoadSpec(f)
+			if err != nil {
+				return err
+			}
+
+			dm, err := docker.NewDockerManagerFromFile(cfg.DockerConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if containerName == "" {
+				containerName = "kira-genesis-" + spec.ChainID
+				if err := dm.PullImage(ctx, image); err != nil {
+					return err
+				}
+				if err := dm.StartToolbox(ctx, containerName, image, nil); err != nil {
+					return err
+				}
+				defer func() {
+					if err := dm.RemoveContainer(context.Background(), containerName); err != nil {
+						log.Warnf("Failed to remove %s: %s", containerName, err)
+					}
+				}()
+			}
+
+			result, err := genesis.New(ctx, sekai.NewCLI(dm, containerName, cfg.SekaiHome), spec)
+			if err != nil {
+				return err
+			}
+			// The keys exist only in the keyring of the container, save their mnemonics first.
+			paths, err := result.WriteMnemonics(mnemonics)
+			if err != nil {
+				return err
+			}
+			if err := result.Write(out); err != nil {
+				return err
+			}
+
+			written := Written{ChainID: result.ChainID, Path: out, SHA256: result.SHA256}
+			text := fmt.Sprintf("%s  %s\n", written.SHA256, written.Path)
+			for i, key := range result.Keys {
+				written.Keys = append(written.Keys, WrittenKey{Name: key.Name, Address: key.Address, Mnemonic: paths[i]})
+				text += fmt.Sprintf("key %s %s, mnemonic in %s\n", key.Name, key.Address, paths[i])
+			}
+			return output.Print(cmd, written, text)
+		},
+	}
+	newCmd.Flags().String("spec", "", "Path to the YAML genesis spec")
+	newCmd.Flags().StringP("out", "o", "genesis.json", "Path to write the genesis to")
+	newCmd.Flags().String("mnemonics", "", "Directory to write the mnemonics of the created keys to, <out>.mnemonics when empty")
+	newCmd.Flags().String("container", "", "Running sekai container to build the genesis in. Its existing genesis is overwritten")
+	newCmd.Flags().String("image", types.SekaiImage+":"+types.DefaultSekaiVersion, "Sekai image for the temporary container")
+	newCmd.Flags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(newCmd.Flags(), "home", "sekai_home")
+	newCmd.MarkFlagRequired("spec")
+
+	return newCmd
+}
+
+func inspect() *cobra.Command {
+	inspectCmd := &cobra.Command{
+		Use:   "inspect <genesis.json>",
+		Short: "Validate a genesis.json and print its SHA-256",
+		Long: `Validate a sekai genesis.json before it is handed to sekaid start: chain-id format, duplicate accounts
+and balances, balances against the recorded supply and the consistency of the validator set.
+Fails when a problem is found or the hash does not match --sha256`,
+		Example: "genesis inspect genesis.json --sha256=4f1c...",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			expected, _ := cmd.Flags().GetString("sha256")
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read genesis %s: %w", args[0], err)
+			}
+			report, err := genesis.Inspect(data)
+			if err != nil {
+				return err
+			}
+
+			if err := output.Print(cmd, report, report.String()); err != nil {
+				return err
+			}
+
+			if expected != "" && !strings.EqualFold(expected, report.SHA256) {
+				return fmt.Errorf("genesis %s has sha256 %s, expected %s", args[0], report.SHA256, expected)
+			}
+			if !report.Valid {
+				return fmt.Errorf("genesis %s is not valid: %d problem(s) found", args[0], len(report.Problems))
+			}
+			return nil
+		},
+	}
+	inspectCmd.Flags().String("sha256", "", "Expected SHA-256 of the file")
+
+	return inspectCmd
+}
+
+func diff() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff <a.json> <b.json>",
+		Short: "Show the semantic differences between two genesis files",
+		Long: `Compare two genesis files value by value. Formatting, key order and the order of accounts,
+balances, validators and other entries with an identifying field are ignored`,
+		Example: "genesis diff ours.json theirs.json",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read genesis %s: %w", args[0], err)
+			}
+			b, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read genesis %s: %w", args[1], err)
+			}
+
+			changes, err := genesis.Diff(a, b)
+			if err != nil {
+				return err
+			}
+
+			if len(changes) == 0 {
+				return output.Print(cmd, changes, "Genesis files are semantically identical\n")
+			}
+			var text strings.Builder
+			for _, change := range changes {
+				fmt.Fprintln(&text, change)
+			}
+			fmt.Fprintf(&text, "%d change(s)\n", len(changes))
+			return output.Print(cmd, changes, text.String())
+		},
+	}
+
+	return diffCmd
+}
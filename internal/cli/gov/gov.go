@@ -0,0 +1,226 @@
+package gov
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/custody"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/gov"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "gov"
+	short = "Submit, vote on and watch governance proposals"
+	long  = `Build customgov proposals from YAML and broadcast them with sekaid inside a node container.
+Fees are taken from the execution fees and network properties of the chain and gas is estimated by
+simulating the transaction, unless --fees and --gas are set`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Gov returns a cobra.Command grouping the governance subcommands.
+func Gov() *cobra.Command {
+	log.Debugln("Adding `gov` command...")
+	govCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	govCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(govCmd.PersistentFlags(), "docker-config", "docker_config")
+	govCmd.PersistentFlags().String("container", types.DefaultSekaiContainer, "Node container running sekaid")
+	config.Bind(govCmd.PersistentFlags(), "container", "container")
+	govCmd.PersistentFlags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(govCmd.PersistentFlags(), "home", "sekai_home")
+
+	govCmd.AddCommand(submit(), vote(), watch(), proposalTypes())
+
+	return govCmd
+}
+
+func submit() *cobra.Command {
+	submitCmd := &cobra.Command{
+		Use:   "submit",
+		Short: "Submit the proposals of a YAML file",
+		Long: `Submit every proposal of a YAML file, in order, and print the transaction hash and the proposal ID
+assigned by the chain. All proposals are validated before the first one is broadcast.
+Run "gov types" for the proposal types and their parameters`,
+		Example: "gov submit -f proposals.yaml --from=operator",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+
+			proposals, err := gov.LoadProposalsFile(file)
+			if err != nil {
+				return err
+			}
+			cli, err := CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			var (
+				results []*gov.Submitted
+				text    strings.Builder
+			)
+			for _, p := range proposals {
+				submitted, err := gov.Submit(ctx, cli, p, TxOptionsFromFlags(cmd))
+				if err != nil {
+					return err
+				}
+				results = append(results, submitted)
+				fmt.Fprintf(&text, "Proposal %d %q submitted in %s at height %d (fees %s, gas used %d)\n",
+					submitted.ProposalID, submitted.Title, submitted.TxHash, submitted.Height, submitted.Fees, submitted.GasUsed)
+			}
+			return output.Print(cmd, results, text.String())
+		},
+	}
+	submitCmd.Flags().StringP("file", "f", "", "Path to the YAML file with the proposals")
+	submitCmd.MarkFlagRequired("file")
+	AddTxFlags(submitCmd)
+
+	return submitCmd
+}
+
+func vote() *cobra.Command {
+	voteCmd := &cobra.Command{
+		Use:     "vote <proposal-id> <yes|abstain|no|veto>",
+		Short:   "Vote on a proposal",
+		Example: "gov vote 12 yes --from=operator",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid proposal ID %q", args[0])
+			}
+			option, err := gov.ParseOption(args[1])
+			if err != nil {
+				return err
+			}
+			cli, err := CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			res, err := gov.Vote(ctx, cli, id, option, TxOptionsFromFlags(cmd))
+			if err != nil {
+				return err
+			}
+			return output.Print(cmd, res, fmt.Sprintf("Voted %s on proposal %d in %s at height %d\n", strings.ToLower(args[1]), id, res.TxHash, res.Height))
+		},
+	}
+	AddTxFlags(voteCmd)
+
+	return voteCmd
+}
+
+func watch() *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:   "watch <proposal-id>",
+		Short: "Follow the votes of a proposal until its final outcome",
+		Long: `Poll a proposal and print its result and vote tally whenever they change, until the proposal
+passed, was rejected or failed to reach quorum. Exits with an error unless the proposal passed.
+With --output=json or yaml only the final status is printed`,
+		Example: "gov watch 12 --interval=10s",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			interval, _ := cmd.Flags().GetDuration("interval")
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid proposal ID %q", args[0])
+			}
+			cli, err := CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			status, err := gov.Watch(ctx, cli, id, interval, func(s *gov.Status) {
+				if output.FormatOf(cmd) != output.Text {
+					return
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  proposal %d %q: %s, %s (voting ends %s)\n",
+					time.Now().Format(time.TimeOnly), s.ProposalID, s.Title, s.Result, s.Tally(), s.VotingEnd.Format(time.RFC3339))
+			})
+			if err != nil {
+				return err
+			}
+			if !status.Passed() {
+				return fmt.Errorf("proposal %d ended with %s %s", id, status.Result, status.ExecResult)
+			}
+			return output.Print(cmd, status, fmt.Sprintf("Proposal %d passed: %s\n", id, status.ExecResult))
+		},
+	}
+	watchCmd.Flags().Duration("interval", 10*time.Second, "How often the proposal is queried")
+
+	return watchCmd
+}
+
+func proposalTypes() *cobra.Command {
+	return &cobra.Command{
+		Use:   "types",
+		Short: "List the proposal types and their parameters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var text strings.Builder
+			for _, name := range gov.TypeNames() {
+				t := gov.Types[name]
+				params := append(append([]string{}, t.Args...), t.Flags...)
+				for _, optional := range t.Optional {
+					params = append(params, "["+optional+"]")
+				}
+				fmt.Fprintf(&text, "%-36s %s\n", name, strings.Join(params, " "))
+			}
+			return output.Print(cmd, gov.Types, text.String())
+		},
+	}
+}
+
+// AddTxFlags adds the signing, fee and gas flags of a transaction to cmd.
+func AddTxFlags(cmd *cobra.Command) {
+	cmd.Flags().String("from", custody.OperatorName, "Key in the node keyring signing the transaction")
+	cmd.Flags().String("fees", "", "Fees paid with the transaction, e.g. 100ukex. Estimated from the chain when empty")
+	cmd.Flags().Uint64("gas", 0, "Gas limit. Estimated by simulating the transaction when 0")
+	cmd.Flags().Float64("gas-adjustment", sekai.DefaultGasAdjustment, "Factor applied to the simulated gas")
+	cmd.Flags().Duration("tx-timeout", time.Minute, "How long a transaction gets to be committed")
+}
+
+// TxOptionsFromFlags returns the transaction options set by the flags of AddTxFlags.
+func TxOptionsFromFlags(cmd *cobra.Command) sekai.TxOptions {
+	opts := sekai.TxOptions{}
+	opts.From, _ = cmd.Flags().GetString("from")
+	opts.Fees, _ = cmd.Flags().GetString("fees")
+	opts.Gas, _ = cmd.Flags().GetUint64("gas")
+	opts.GasAdjustment, _ = cmd.Flags().GetFloat64("gas-adjustment")
+	opts.Timeout, _ = cmd.Flags().GetDuration("tx-timeout")
+	return opts
+}
+
+// CLIFromFlags returns the sekaid of the node set by the docker_config, container and
+// sekai_home settings, which the --docker-config, --container and --home flags override.
+func CLIFromFlags(cmd *cobra.Command) (*sekai.CLI, error) {
+	cfg := config.FromCommand(cmd)
+	dm, err := docker.NewDockerManagerFromFile(cfg.DockerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker manager: %w", err)
+	}
+	return sekai.NewCLI(dm, cfg.Container, cfg.SekaiHome), nil
+}
@@ -0,0 +1,405 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	govcli "github.com/mrlutik/kira2.0/internal/cli/gov"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/custody"
+	"github.com/mrlutik/kira2.0/internal/identity"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "identity"
+	short = "Manage the identity records of a validator"
+	long  = `Keep the customgov identity records of an address, like moniker, website and contact, in a local
+YAML file, compare it with the chain, submit only the changed records and track verify requests.
+Transactions are signed by --from in the keyring of the node container`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Identity returns a cobra.Command grouping the identity subcommands.
+func Identity() *cobra.Command {
+	log.Debugln("Adding `identity` command...")
+	identityCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	identityCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(identityCmd.PersistentFlags(), "docker-config", "docker_config")
+	identityCmd.PersistentFlags().String("container", types.DefaultSekaiContainer, "Node container running sekaid")
+	config.Bind(identityCmd.PersistentFlags(), "container", "container")
+	identityCmd.PersistentFlags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(identityCmd.PersistentFlags(), "home", "sekai_home")
+
+	identityCmd.AddCommand(pull(), diff(), apply(), verify(), requests(), cancel())
+
+	return identityCmd
+}
+
+// Pulled is the result of identity pull.
+type Pulled struct {
+	Address string `json:"address"`
+	Records int    `json:"records"`
+	File    string `json:"file"`
+}
+
+func pull() *cobra.Command {
+	pullCmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Write the identity records on chain to a YAML file",
+		Long: `Query the identity records of the address and write them to --file, to start managing records
+that were registered before. An existing file is only replaced with --force`,
+		Example: "identity pull -f identity.yaml --from=operator",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+			force, _ := cmd.Flags().GetBool("force")
+
+			if _, err := os.Stat(file); err == nil && !force {
+				return fmt.Errorf("%s already exists, use --force to replace it", file)
+			}
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			from, _ := cmd.Flags().GetString("from")
+			address, err := resolveAddress(ctx, cli, from, "")
+			if err != nil {
+				return err
+			}
+
+			records, err := identity.Records(ctx, cli, address)
+			if err != nil {
+				return err
+			}
+			if err := identity.FromChain(address, records).Save(file); err != nil {
+				return err
+			}
+			pulled := Pulled{Address: address, Records: len(records), File: file}
+			return output.Print(cmd, pulled, fmt.Sprintf("%d identity records of %s written to %s\n", pulled.Records, pulled.Address, pulled.File))
+		},
+	}
+	addFileFlag(pullCmd)
+	addFromFlag(pullCmd)
+	pullCmd.Flags().Bool("force", false, "Replace an existing file")
+
+	return pullCmd
+}
+
+// DiffResult is the result of identity diff.
+type DiffResult struct {
+	Address string                     `json:"address"`
+	Records map[string]identity.Record `json:"records"`
+	// Set are the records of the file that are new or changed, OnlyOnChain the records
+	// missing from the file.
+	Set         []identity.Change `json:"set"`
+	OnlyOnChain []identity.Change `json:"only_on_chain"`
+}
+
+func diff() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show how the identity records on chain differ from the YAML file",
+		Long: `Compare the records of --file with the chain: + records that are new, ~ records whose value
+changes and - records only on chain. Records on chain are also listed with their verifiers`,
+		Example: "identity diff -f identity.yaml",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			state, err := load(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			set, onlyOnChain := identity.Diff(state.file, state.records)
+
+			result := DiffResult{Address: state.address, Records: state.records, Set: set, OnlyOnChain: onlyOnChain}
+			text := identity.FormatRecords(state.records) + "\n"
+			if len(set) == 0 && len(onlyOnChain) == 0 {
+				text += fmt.Sprintf("Identity records of %s are up to date\n", state.address)
+			} else {
+				text += identity.FormatDiff(set, onlyOnChain)
+			}
+			return output.Print(cmd, result, text)
+		},
+	}
+	addFileFlag(diffCmd)
+	addFromFlag(diffCmd)
+
+	return diffCmd
+}
+
+// Applied is the result of identity apply. Registered and Removed are the transactions of
+// Set and Deleted, nil when there was nothing to send or with --dry-run.
+type Applied struct {
+	Address    string            `json:"address"`
+	Set        []identity.Change `json:"set"`
+	Deleted    []identity.Change `json:"deleted"`
+	Registered *sekai.TxResult   `json:"registered,omitempty"`
+	Removed    *sekai.TxResult   `json:"removed,omitempty"`
+}
+
+func apply() *cobra.Command {
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Register the new and changed identity records of the YAML file",
+		Long: `Register the records of --file that are missing on chain or have another value, all in one
+transaction. Unchanged records are not resubmitted, so they keep their verifications. Changing a record
+drops its verifications. Records only on chain are kept unless --prune deletes them`,
+		Example: "identity apply -f identity.yaml --from=operator --dry-run",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			prune, _ := cmd.Flags().GetBool("prune")
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			state, err := load(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			set, onlyOnChain := identity.Diff(state.file, state.records)
+			if !prune {
+				for _, c := range onlyOnChain {
+					log.Warnf("Identity record %s is only on chain, use --prune to delete it", c.Key)
+				}
+				onlyOnChain = nil
+			}
+			applied := Applied{Address: state.address, Set: set, Deleted: onlyOnChain}
+			if len(set) == 0 && len(onlyOnChain) == 0 {
+				return output.Print(cmd, applied, fmt.Sprintf("Identity records of %s are up to date\n", state.address))
+			}
+			text := identity.FormatDiff(set, onlyOnChain)
+			if dryRun {
+				return output.Print(cmd, applied, text)
+			}
+
+			opts := govcli.TxOptionsFromFlags(cmd)
+			if len(set) > 0 {
+				if applied.Registered, err = identity.Register(ctx, state.cli, set, opts); err != nil {
+					return err
+				}
+				text += fmt.Sprintf("Registered %d records in %s at height %d\n", len(set), applied.Registered.TxHash, applied.Registered.Height)
+			}
+			if len(onlyOnChain) > 0 {
+				keys := make([]string, len(onlyOnChain))
+				for i, c := range onlyOnChain {
+					keys[i] = c.Key
+				}
+				if applied.Removed, err = identity.Delete(ctx, state.cli, keys, opts); err != nil {
+					return err
+				}
+				text += fmt.Sprintf("Deleted %d records in %s at height %d\n", len(keys), applied.Removed.TxHash, applied.Removed.Height)
+			}
+			return output.Print(cmd, applied, text)
+		},
+	}
+	addFileFlag(applyCmd)
+	applyCmd.Flags().Bool("dry-run", false, "Only print the changes")
+	applyCmd.Flags().Bool("prune", false, "Delete the records that are on chain but not in the file")
+	govcli.AddTxFlags(applyCmd)
+
+	return applyCmd
+}
+
+// Requested is a verification requested by identity verify, TxHash is empty with --dry-run.
+type Requested struct {
+	identity.Pending
+	TxHash string `json:"txhash,omitempty"`
+}
+
+func verify() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Request the verifications of the YAML file",
+		Long: `Request every verification listed under verify in --file whose records are neither verified by
+the verifier yet nor part of a pending request to it. The records have to be applied first`,
+		Example: "identity verify -f identity.yaml --from=operator",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			state, err := load(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			pending, err := identity.Requests(ctx, state.cli, state.address)
+			if err != nil {
+				return err
+			}
+			unrequested, err := identity.Unrequested(state.file, state.records, pending)
+			if err != nil {
+				return err
+			}
+			requested := []Requested{}
+			if len(unrequested) == 0 {
+				return output.Print(cmd, requested, "All verifications are done or requested\n")
+			}
+
+			var text strings.Builder
+			for _, p := range unrequested {
+				if dryRun {
+					requested = append(requested, Requested{Pending: p})
+					fmt.Fprintf(&text, "Request verification of %s by %s with tip %s\n", strings.Join(p.Keys, ", "), p.Verifier, p.Tip)
+					continue
+				}
+				res, err := identity.RequestVerify(ctx, state.cli, p, govcli.TxOptionsFromFlags(cmd))
+				if err != nil {
+					return err
+				}
+				requested = append(requested, Requested{Pending: p, TxHash: res.TxHash})
+				fmt.Fprintf(&text, "Requested verification of %s by %s in %s\n", strings.Join(p.Keys, ", "), p.Verifier, res.TxHash)
+			}
+			return output.Print(cmd, requested, text.String())
+		},
+	}
+	addFileFlag(verifyCmd)
+	verifyCmd.Flags().Bool("dry-run", false, "Only print the requests")
+	govcli.AddTxFlags(verifyCmd)
+
+	return verifyCmd
+}
+
+func requests() *cobra.Command {
+	requestsCmd := &cobra.Command{
+		Use:     "requests",
+		Short:   "List the pending verify requests of the address",
+		Example: "identity requests --from=operator",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address, _ := cmd.Flags().GetString("address")
+			from, _ := cmd.Flags().GetString("from")
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			if address == "" {
+				if address, err = resolveAddress(ctx, cli, from, ""); err != nil {
+					return err
+				}
+			}
+
+			pending, err := identity.Requests(ctx, cli, address)
+			if err != nil {
+				return err
+			}
+			if len(pending) == 0 {
+				return output.Print(cmd, []identity.Request{}, fmt.Sprintf("No pending verify requests of %s\n", address))
+			}
+			records, err := identity.Records(ctx, cli, address)
+			if err != nil {
+				return err
+			}
+			return output.Print(cmd, pending, identity.FormatRequests(pending, records))
+		},
+	}
+	addFromFlag(requestsCmd)
+	requestsCmd.Flags().String("address", "", "Address whose requests are listed instead of the address of --from")
+
+	return requestsCmd
+}
+
+func cancel() *cobra.Command {
+	cancelCmd := &cobra.Command{
+		Use:     "cancel <request-id>",
+		Short:   "Cancel a pending verify request",
+		Example: "identity cancel 3 --from=operator",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid request ID %q", args[0])
+			}
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			res, err := identity.Cancel(ctx, cli, id, govcli.TxOptionsFromFlags(cmd))
+			if err != nil {
+				return err
+			}
+			return output.Print(cmd, res, fmt.Sprintf("Cancelled verify request %d in %s\n", id, res.TxHash))
+		},
+	}
+	govcli.AddTxFlags(cancelCmd)
+
+	return cancelCmd
+}
+
+// state is the identity file and the records on chain of its address.
+type state struct {
+	cli     *sekai.CLI
+	file    *identity.File
+	address string
+	records map[string]identity.Record
+}
+
+// load reads --file and queries the records of its address.
+func load(ctx context.Context, cmd *cobra.Command) (*state, error) {
+	path, _ := cmd.Flags().GetString("file")
+	f, err := identity.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := govcli.CLIFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	from, _ := cmd.Flags().GetString("from")
+
+	address, err := resolveAddress(ctx, cli, from, f.Address)
+	if err != nil {
+		return nil, err
+	}
+	records, err := identity.Records(ctx, cli, address)
+	if err != nil {
+		return nil, err
+	}
+	return &state{cli: cli, file: f, address: address, records: records}, nil
+}
+
+// resolveAddress returns the address of the --from key. A given address has to match it, so
+// records are never signed by another key than the one they belong to.
+func resolveAddress(ctx context.Context, cli *sekai.CLI, from, address string) (string, error) {
+	keyAddress, err := cli.KeyAddress(ctx, from)
+	if err != nil {
+		return "", err
+	}
+	if address != "" && address != keyAddress {
+		return "", fmt.Errorf("identity file is of %s, but key %s is %s", address, from, keyAddress)
+	}
+	return keyAddress, nil
+}
+
+func addFileFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "identity.yaml", "Path to the YAML file with the identity records")
+}
+
+func addFromFlag(cmd *cobra.Command) {
+	cmd.Flags().String("from", custody.OperatorName, "Key in the node keyring whose records are managed")
+}
@@ -12,12 +12,21 @@ import (
 	"path/filepath"
 
 	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
 	"github.com/spf13/cobra"
 )
 
 // log is the logger instance for this package.
 var log = logging.Log
 
+// KeyPair is the result of the keys command, the paths of the generated keys.
+type KeyPair struct {
+	Type       string `json:"type"`
+	Length     int    `json:"length"`
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
 // Generate returns a cobra.Command that generates RSA or ECDSA keys
 // with given length and output directory. The command's flags allow
 // specification of key type, key length, and output directory.
@@ -33,15 +42,27 @@ func Generate() *cobra.Command {
 			keyLength, _ := cmd.Flags().GetInt("length")
 			outDir, _ := cmd.Flags().GetString("out")
 
+			var err error
 			switch keyType {
 			case "rsa":
-				return generateRSA(keyLength, outDir)
+				err = generateRSA(keyLength, outDir)
 			case "ecdsa":
-				return generateECDSA(keyLength, outDir)
+				err = generateECDSA(keyLength, outDir)
 			default:
 				log.Errorf("invalid user input: %v\n", keyType)
 				return fmt.Errorf("invalid key type: %s", keyType)
 			}
+			if err != nil {
+				return err
+			}
+
+			pair := KeyPair{
+				Type:       keyType,
+				Length:     keyLength,
+				PrivateKey: filepath.Join(outDir, "private.pem"),
+				PublicKey:  filepath.Join(outDir, "public.pem"),
+			}
+			return output.Print(cmd, pair, fmt.Sprintf("Generated %s keys: %s, %s\n", pair.Type, pair.PrivateKey, pair.PublicKey))
 		},
 	}
 
@@ -0,0 +1,172 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "logs [node]"
+	short = "Show or follow the logs of a node container"
+	long  = "Show or follow the stdout and stderr logs of a node container on a local or remote Docker daemon"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Logs returns a cobra.Command that prints the logs of a single node container
+// and has an `export` subcommand that archives the logs of many nodes at once.
+func Logs() *cobra.Command {
+	log.Debugln("Adding `logs` command...")
+	logsCmd := &cobra.Command{
+		Use:     use,
+		Short:   short,
+		Long:    long,
+		Args:    cobra.ExactArgs(1),
+		Example: "logs kira-sekai --follow --tail=100 --since=10m --timestamps",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := logOptions(cmd)
+			follow, _ := cmd.Flags().GetBool("follow")
+			opts.Follow = follow
+
+			dm, err := dockerManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			return dm.StreamContainerLogs(ctx, args[0], opts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	addLogFlags(logsCmd)
+	logsCmd.Flags().BoolP("follow", "f", false, "Follow log output")
+	logsCmd.Flags().String("tail", "all", "Number of lines to show from the end of the logs")
+
+	logsCmd.AddCommand(export())
+
+	return logsCmd
+}
+
+func export() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:     "export [node...]",
+		Short:   "Export the logs of node containers into one archive",
+		Long:    "Export a time window of logs from the given nodes, or from every node container when none are given, into a single .tar.gz archive",
+		Example: "logs export --since=2023-06-04T10:00:00Z --until=2023-06-04T11:00:00Z --out=incident.tar.gz",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, _ := cmd.Flags().GetString("out")
+			opts := logOptions(cmd)
+			opts.Tail = "all"
+
+			dm, err := dockerManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			names := args
+			if len(names) == 0 {
+				containers, err := dm.ListNodeContainers(ctx)
+				if err != nil {
+					return err
+				}
+				for _, c := range containers {
+					if len(c.Names) > 0 {
+						names = append(names, strings.TrimPrefix(c.Names[0], "/"))
+					}
+				}
+			}
+			if len(names) == 0 {
+				return fmt.Errorf("no node containers found")
+			}
+
+			if err := writeArchive(ctx, dm, out, names, opts); err != nil {
+				return err
+			}
+
+			exported := Exported{Archive: out, Nodes: names, Since: opts.Since, Until: opts.Until}
+			return output.Print(cmd, exported, fmt.Sprintf("Exported logs of %d node(s) to %s\n", len(names), out))
+		},
+	}
+	addLogFlags(exportCmd)
+	exportCmd.Flags().StringP("out", "o", "kira-logs.tar.gz", "Path of the archive to write")
+
+	return exportCmd
+}
+
+// writeArchive exports the logs of names into the archive at out. A partial archive is removed
+// when the export fails.
+func writeArchive(ctx context.Context, dm *docker.DockerManager, out string, names []string, opts docker.LogOptions) error {
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive %s: %w", out, err)
+	}
+
+	err = dm.ExportLogs(ctx, names, opts, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write archive %s: %w", out, closeErr)
+	}
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+	return nil
+}
+
+// Exported is the result of logs export.
+type Exported struct {
+	Archive string   `json:"archive"`
+	Nodes   []string `json:"nodes"`
+	Since   string   `json:"since,omitempty"`
+	Until   string   `json:"until,omitempty"`
+}
+
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().String("since", "", "Show logs since timestamp (e.g. 2023-06-04T10:00:00Z) or relative (e.g. 42m)")
+	cmd.Flags().String("until", "", "Show logs before timestamp (e.g. 2023-06-04T10:00:00Z) or relative (e.g. 42m)")
+	cmd.Flags().BoolP("timestamps", "t", false, "Show timestamps")
+	cmd.Flags().Bool("stdout", true, "Show stdout of the container")
+	cmd.Flags().Bool("stderr", true, "Show stderr of the container")
+	cmd.Flags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(cmd.Flags(), "docker-config", "docker_config")
+}
+
+func logOptions(cmd *cobra.Command) docker.LogOptions {
+	tail, _ := cmd.Flags().GetString("tail")
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	timestamps, _ := cmd.Flags().GetBool("timestamps")
+	stdout, _ := cmd.Flags().GetBool("stdout")
+	stderr, _ := cmd.Flags().GetBool("stderr")
+
+	return docker.LogOptions{
+		Tail:       tail,
+		Since:      since,
+		Until:      until,
+		Timestamps: timestamps,
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+}
+
+func dockerManager(cmd *cobra.Command) (*docker.DockerManager, error) {
+	configPath := config.FromCommand(cmd).DockerConfig
+	dm, err := docker.NewDockerManagerFromFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker manager: %w", err)
+	}
+
+	return dm, nil
+}
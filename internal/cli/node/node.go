@@ -0,0 +1,459 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "node"
+	short = "Manage running sekai nodes"
+	long  = "Configure and inspect sekai nodes started by the launcher"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+func init() {
+	config.Register("audit_log", audit.DefaultPath, nil)
+}
+
+// Node returns a cobra.Command grouping the node subcommands.
+func Node() *cobra.Command {
+	log.Debugln("Adding `node` command...")
+	nodeCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	nodeCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(nodeCmd.PersistentFlags(), "docker-config", "docker_config")
+
+	nodeCmd.AddCommand(configure(), status(), restart(), export(), rollback())
+
+	return nodeCmd
+}
+
+func configure() *cobra.Command {
+	configureCmd := &cobra.Command{
+		Use:   "configure",
+		Short: "Patch config.toml and app.toml of a node from a role overlay",
+		Long: `Apply the config.toml and app.toml values of a node role from a YAML overlay file. Comments and
+layout of the files are kept. The diff of both files is printed, with --dry-run nothing is written.
+Files are edited in the node container, or in a local sekaid config directory with --dir.
+The resulting pruning is validated, checked against the disk of the node container and a warning is
+printed when the change needs a resync. Restart the node for the changes to take effect`,
+		Example: "node configure --overlay=roles.yaml --role=sentry --container=kira-sekai --dry-run",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			overlayPath, _ := cmd.Flags().GetString("overlay")
+			role, _ := cmd.Flags().GetString("role")
+			containerName, home := cfg.Container, cfg.SekaiHome
+			dir, _ := cmd.Flags().GetString("dir")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			force, _ := cmd.Flags().GetBool("force")
+
+			f, err := os.Open(overlayPath)
+			if err != nil {
+				return fmt.Errorf("failed to open config overlays %s: %w", overlayPath, err)
+			}
+			defer f.Close()
+			overlays, err := sekaiconfig.LoadOverlays(f)
+			if err != nil {
+				return err
+			}
+			overlay, ok := overlays[role]
+			if !ok {
+				return fmt.Errorf("role %s not found in %s, available roles: %v", role, overlayPath, sekaiconfig.Roles(overlays))
+			}
+
+			// files holds config.toml and app.toml, in that order.
+			var files []sekaiconfig.File
+			var dm *docker.DockerManager
+			if dir != "" {
+				for _, name := range []string{sekaiconfig.ConfigFile, sekaiconfig.AppFile} {
+					files = append(files, sekaiconfig.LocalFile{Path: filepath.Join(dir, name)})
+				}
+			} else {
+				if dm, err = docker.NewDockerManagerFromFile(cfg.DockerConfig); err != nil {
+					return fmt.Errorf("failed to create docker manager: %w", err)
+				}
+				for _, name := range []string{sekaiconfig.ConfigFile, sekaiconfig.AppFile} {
+					files = append(files, sekaiconfig.ContainerFile{DM: dm, Container: containerName, Path: path.Join(home, "config", name)})
+				}
+			}
+
+			ctx := context.Background()
+			patches := overlay.Patches()
+			var edits []*sekaiconfig.Edit
+			for _, file := range files {
+				edit, err := sekaiconfig.Prepare(ctx, file, patches)
+				if err != nil {
+					return err
+				}
+				edits = append(edits, edit)
+			}
+
+			var disk *pruningDisk
+			if dm != nil {
+				disk = &pruningDisk{dm: dm, container: containerName, dataDir: path.Join(home, "data")}
+			}
+			warnings, err := checkPruning(ctx, edits[1], disk, force)
+			if err != nil {
+				return err
+			}
+
+			configured := Configured{Role: role, DryRun: dryRun, Warnings: warnings}
+			var text strings.Builder
+			for _, warning := range warnings {
+				fmt.Fprintf(&text, "Warning: %s\n", warning)
+			}
+			for _, edit := range edits {
+				file := ConfiguredFile{Path: edit.File.String(), Changed: edit.Changed(), Diff: edit.Diff()}
+				text.WriteString(file.Diff)
+				if file.Changed && !dryRun {
+					if err := edit.Write(ctx); err != nil {
+						return err
+					}
+					file.Written = true
+					log.Infof("%s updated", edit.File)
+				} else if !file.Changed {
+					log.Infof("%s is up to date", edit.File)
+				}
+				configured.Files = append(configured.Files, file)
+			}
+			return output.Print(cmd, configured, text.String())
+		},
+	}
+	configureCmd.Flags().String("overlay", "", "Path to the YAML file with the config overlays of the node roles")
+	configureCmd.Flags().String("role", "", "Node role whose overlay is applied")
+	configureCmd.Flags().String("container", types.DefaultSekaiContainer, "Node container whose config is edited")
+	config.Bind(configureCmd.Flags(), "container", "container")
+	configureCmd.Flags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(configureCmd.Flags(), "home", "sekai_home")
+	configureCmd.Flags().String("dir", "", "Local sekaid config directory to edit instead of a container")
+	configureCmd.Flags().Bool("dry-run", false, "Only print the diff")
+	configureCmd.Flags().Bool("force", false, "Write the files even when the pruning does not fit the disk of the node")
+	configureCmd.MarkFlagRequired("overlay")
+	configureCmd.MarkFlagRequired("role")
+
+	return configureCmd
+}
+
+// Configured is the result of node configure.
+type Configured struct {
+	Role   string           `json:"role"`
+	DryRun bool             `json:"dry_run"`
+	Files  []ConfiguredFile `json:"files"`
+	// Warnings are the resync and disk notes of the pruning change.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ConfiguredFile is a config file node configure patched.
+type ConfiguredFile struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	// Written is set when the change was saved, never with --dry-run.
+	Written bool `json:"written"`
+	// Diff is the change in unified diff format, empty when the file is up to date.
+	Diff string `json:"diff,omitempty"`
+}
+
+// pruningDisk locates the data directory of a node container for the disk check.
+type pruningDisk struct {
+	dm        *docker.DockerManager
+	container string
+	dataDir   string
+}
+
+// checkPruning validates the pruning an app.toml edit results in and checks it against the
+// disk of the node. It returns the warnings for the result: a change that needs a resync, a
+// disk that cannot be measured and, with force, a disk that is too small, which is an error otherwise.
+func checkPruning(ctx context.Context, edit *sekaiconfig.Edit, disk *pruningDisk, force bool) ([]string, error) {
+	from, err := sekaiconfig.ReadPruning(edit.Old)
+	if err != nil {
+		return nil, err
+	}
+	to, err := sekaiconfig.ReadPruning(edit.New)
+	if err != nil {
+		return nil, err
+	}
+	if to.Strategy == "" {
+		return nil, nil
+	}
+	if err := to.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid pruning in %s: %w", edit.File, err)
+	}
+	warnings := sekaiconfig.ResyncWarnings(from, to)
+	if disk == nil {
+		return warnings, nil
+	}
+
+	space, err := disk.dm.DiskSpace(ctx, disk.container, disk.dataDir)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("pruning not checked against the disk of %s: %s", disk.container, err)), nil
+	}
+	dataBytes, err := disk.dm.DirSize(ctx, disk.container, disk.dataDir)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("pruning not checked against the disk of %s: %s", disk.container, err)), nil
+	}
+	problems, diskWarnings := sekaiconfig.CheckDisk(to, space, dataBytes)
+	if len(problems) > 0 && !force {
+		return nil, fmt.Errorf("pruning %s does not fit the disk of %s: %s", to, disk.container, strings.Join(problems, "; "))
+	}
+	for _, warning := range append(diskWarnings, problems...) {
+		warnings = append(warnings, fmt.Sprintf("%s: %s", disk.container, warning))
+	}
+
+	return warnings, nil
+}
+
+func status() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status [node...]",
+		Short: "Show height, sync state, peers and voting power of nodes",
+		Long: `Query the Tendermint RPC of one node, or of the nodes of an inventory, and show the latest height,
+whether it is catching up, its peer count, its voting power, the average block time and how far the
+latest block lags behind the local clock. Unlike ` + "`sekaid status`" + ` this works for remote nodes`,
+		Example: `node status --rpc=http://10.0.0.1:26657
+node status --inventory=inventory.yaml validator-1 sentry-1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rpc, _ := cmd.Flags().GetString("rpc")
+			inventoryPath, _ := cmd.Flags().GetString("inventory")
+
+			nodes := []inventory.Node{{Name: rpc, RPC: rpc}}
+			if inventoryPath != "" {
+				inv, err := inventory.LoadFile(inventoryPath)
+				if err != nil {
+					return err
+				}
+				if nodes, err = inv.Select(args...); err != nil {
+					return err
+				}
+			} else if len(args) > 0 {
+				return fmt.Errorf("node names need --inventory")
+			}
+
+			statuses := node.ProbeAll(context.Background(), nodes)
+			if err := output.Print(cmd, statuses, node.FormatStatuses(statuses)); err != nil {
+				return err
+			}
+
+			for _, s := range statuses {
+				if s.Error != "" {
+					return fmt.Errorf("node %s could not be queried", s.Name)
+				}
+			}
+			return nil
+		},
+	}
+	statusCmd.Flags().String("rpc", "http://localhost:26657", "RPC address of the node to query")
+	statusCmd.Flags().String("inventory", "", "Path to a YAML inventory, all its nodes are queried unless names are given")
+
+	return statusCmd
+}
+
+func restart() *cobra.Command {
+	restartCmd := &cobra.Command{
+		Use:   "restart [node...]",
+		Short: "Restart nodes one at a time, waiting for each to become ready",
+		Long: `Restart the sekai containers of the given inventory nodes, or of all of them, one after another.
+After each restart the node has to pass the readiness gates (synced, advancing, peers) before the
+next node is restarted. Stops at the first node that does not become ready`,
+		Example: "node restart --inventory=inventory.yaml sentry-1 sentry-2 --min-peers=3",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inventoryPath, _ := cmd.Flags().GetString("inventory")
+
+			inv, err := inventory.LoadFile(inventoryPath)
+			if err != nil {
+				return err
+			}
+			nodes, err := inv.Select(args...)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if err := node.RestartAll(ctx, nodes, ReadinessFromFlags(cmd), node.LogEvents); err != nil {
+				return err
+			}
+
+			restarted := Restarted{Status: node.ProbeAll(ctx, nodes)}
+			for _, n := range nodes {
+				restarted.Nodes = append(restarted.Nodes, n.Name)
+			}
+			text := fmt.Sprintf("Restarted %s\n\n%s", strings.Join(restarted.Nodes, ", "), node.FormatStatuses(restarted.Status))
+			return output.Print(cmd, restarted, text)
+		},
+	}
+	restartCmd.Flags().String("inventory", "", "Path to the YAML inventory")
+	restartCmd.MarkFlagRequired("inventory")
+	AddReadinessFlags(restartCmd)
+
+	return restartCmd
+}
+
+// Restarted is the result of node restart.
+type Restarted struct {
+	Nodes []string `json:"nodes"`
+	// Status is the state of the nodes once every one of them passed the readiness gates.
+	Status []*node.Status `json:"status"`
+}
+
+// File is a file written by a node command and its hash.
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+func export() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the state of a node, optionally as a new genesis",
+		Long: `Stop a node and run sekaid export on its data directory in a temporary container, then start the
+node again. The state is saved to --out/exported.json together with its SHA-256 and a metadata.json
+recording chain-id, height, app hash and image. With --new-genesis the state is also converted with
+sekaid new-genesis-from-exported into --out/new-genesis.json for a hard-fork style network restart`,
+		Example: "node export --container=kira-sekai --height=120000 --new-genesis --out=export-120000",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			opts := node.ExportOptions{Container: cfg.Container, Home: cfg.SekaiHome}
+			opts.Height, _ = cmd.Flags().GetInt64("height")
+			opts.ForZeroHeight, _ = cmd.Flags().GetBool("for-zero-height")
+			opts.NewGenesis, _ = cmd.Flags().GetBool("new-genesis")
+			opts.KeepStopped, _ = cmd.Flags().GetBool("keep-stopped")
+			opts.Dir, _ = cmd.Flags().GetString("out")
+
+			dm, err := docker.NewDockerManagerFromFile(cfg.DockerConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			export, err := node.ExportState(ctx, dm, opts)
+			if err != nil {
+				return err
+			}
+
+			files := []File{{Path: export.StatePath, SHA256: export.Metadata.SHA256}}
+			if export.NewGenesis != nil {
+				files = append(files, File{Path: export.NewGenesisPath, SHA256: export.NewGenesis.SHA256})
+			}
+			var text strings.Builder
+			for _, f := range files {
+				fmt.Fprintf(&text, "%s  %s\n", f.SHA256, f.Path)
+			}
+			return output.Print(cmd, files, text.String())
+		},
+	}
+	exportCmd.Flags().String("container", types.DefaultSekaiContainer, "Node container whose state is exported")
+	config.Bind(exportCmd.Flags(), "container", "container")
+	exportCmd.Flags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(exportCmd.Flags(), "home", "sekai_home")
+	exportCmd.Flags().Int64("height", 0, "Height to export, the latest committed height when 0")
+	exportCmd.Flags().Bool("for-zero-height", false, "Prepare the state to start a new chain at height zero")
+	exportCmd.Flags().Bool("new-genesis", false, "Also create a new genesis with sekaid new-genesis-from-exported")
+	exportCmd.Flags().Bool("keep-stopped", false, "Leave the node stopped after the export")
+	exportCmd.Flags().StringP("out", "o", "export", "Directory to save the export to")
+
+	return exportCmd
+}
+
+func rollback() *cobra.Command {
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back a node that halted with an app hash mismatch",
+		Long: `Run sekaid rollback on a node that persisted a wrong app hash. The command refuses to act unless the
+node is halted, i.e. stopped or not committing blocks, and its log reports an app hash mismatch.
+The data directory is backed up into a new volume first, then the state is rolled back by one height,
+the node is started and watched until it commits the rolled back block again.
+Every step is appended to the audit trail`,
+		Example: "node rollback --container=kira-sekai --rpc=http://localhost:26657 --dry-run",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.FromCommand(cmd)
+			opts := node.RollbackOptions{Container: cfg.Container, Home: cfg.SekaiHome}
+			opts.RPC, _ = cmd.Flags().GetString("rpc")
+			opts.HaltCheck, _ = cmd.Flags().GetDuration("halt-check")
+			opts.VerifyTimeout, _ = cmd.Flags().GetDuration("verify-timeout")
+			opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+			trail, err := audit.Open(cfg.AuditLog)
+			if err != nil {
+				return err
+			}
+			dm, err := docker.NewDockerManagerFromFile(cfg.DockerConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			result, err := node.Rollback(ctx, dm, opts, trail)
+			if err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return output.Print(cmd, result, fmt.Sprintf("Node %s can be rolled back: %s\n", opts.Container, result.Diagnosis.Mismatch))
+			}
+			return output.Print(cmd, result, fmt.Sprintf("Rolled back %s to height %d (app hash %s), now at height %d. Backup: %s. Audit trail: %s\n",
+				opts.Container, result.Height, result.AppHash, result.Reexecuted, result.Backup, trail.Path()))
+		},
+	}
+	rollbackCmd.Flags().String("container", types.DefaultSekaiContainer, "Node container to roll back")
+	config.Bind(rollbackCmd.Flags(), "container", "container")
+	rollbackCmd.Flags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(rollbackCmd.Flags(), "home", "sekai_home")
+	rollbackCmd.Flags().String("rpc", "http://localhost:26657", "RPC address of the node")
+	rollbackCmd.Flags().Duration("halt-check", 30*time.Second, "How long the height of a running node is watched to confirm it is halted")
+	rollbackCmd.Flags().Duration("verify-timeout", 10*time.Minute, "How long the node gets to commit the rolled back block again")
+	rollbackCmd.Flags().Bool("dry-run", false, "Only check that the node needs a rollback")
+	rollbackCmd.Flags().String("audit-log", audit.DefaultPath(), "Path of the audit trail")
+	config.Bind(rollbackCmd.Flags(), "audit-log", "audit_log")
+
+	return rollbackCmd
+}
+
+// AddReadinessFlags adds the flags of the readiness gates to cmd.
+func AddReadinessFlags(cmd *cobra.Command) {
+	defaults := node.DefaultReadiness()
+	cmd.Flags().Duration("sync-timeout", defaults.SyncTimeout, "How long a node gets to stop catching up")
+	cmd.Flags().Duration("advance-timeout", defaults.AdvanceTimeout, "How long a node gets to commit new blocks")
+	cmd.Flags().Int64("min-blocks", defaults.MinBlocks, "Number of new blocks a node has to commit")
+	cmd.Flags().Duration("peers-timeout", defaults.PeersTimeout, "How long a node gets to connect to enough peers")
+	cmd.Flags().Int("min-peers", defaults.MinPeers, "Number of peers a node needs")
+}
+
+// ReadinessFromFlags returns the readiness gates configured by the flags of AddReadinessFlags.
+func ReadinessFromFlags(cmd *cobra.Command) node.Readiness {
+	r := node.DefaultReadiness()
+	r.SyncTimeout, _ = cmd.Flags().GetDuration("sync-timeout")
+	r.AdvanceTimeout, _ = cmd.Flags().GetDuration("advance-timeout")
+	r.MinBlocks, _ = cmd.Flags().GetInt64("min-blocks")
+	r.PeersTimeout, _ = cmd.Flags().GetDuration("peers-timeout")
+	r.MinPeers, _ = cmd.Flags().GetInt("min-peers")
+	return r
+}
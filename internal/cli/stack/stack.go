@@ -0,0 +1,165 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/stack"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Up returns a cobra.Command that starts a local sekai validator and interx on the local Docker daemon.
+func Up() *cobra.Command {
+	log.Debugln("Adding `up` command...")
+	upCmd := &cobra.Command{
+		Use:     "up",
+		Short:   "Start a local KIRA network",
+		Long:    "Pull the images, create the network and volumes, initialise the chain and start a sekai validator and interx on this machine",
+		Example: "up --chain-id=localnet-1 --sekai=v0.3.46 --interx=v0.3.16",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, dm, err := setup(cmd)
+			if err != nil {
+				return err
+			}
+
+			chainID, _ := cmd.Flags().GetString("chain-id")
+			moniker, _ := cmd.Flags().GetString("moniker")
+			sekaiVersion, _ := cmd.Flags().GetString("sekai")
+			interxVersion, _ := cmd.Flags().GetString("interx")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			cfg.ChainID = chainID
+			cfg.Moniker = moniker
+			cfg.SekaiImage = types.SekaiImage + ":" + sekaiVersion
+			cfg.InterxImage = ""
+			if interxVersion != "" {
+				cfg.InterxImage = types.InterxImage + ":" + interxVersion
+			}
+			cfg.HealthTimeout = timeout
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if err := stack.Up(ctx, dm, cfg); err != nil {
+				return err
+			}
+
+			started := Started{Name: cfg.Name, ChainID: cfg.ChainID, Containers: []string{cfg.SekaiContainer()}, RPCPort: cfg.RPCPort}
+			if cfg.InterxImage != "" {
+				started.Containers = append(started.Containers, cfg.InterxContainer())
+				started.InterxPort = cfg.InterxPort
+			}
+			text := fmt.Sprintf("Stack %s of %s is up: %s, RPC on port %d\n", cfg.Name, cfg.ChainID, strings.Join(started.Containers, ", "), cfg.RPCPort)
+			return output.Print(cmd, started, text)
+		},
+	}
+	defaults := stack.DefaultConfig()
+	addStackFlags(upCmd)
+	AddPortFlags(upCmd)
+	upCmd.Flags().String("chain-id", defaults.ChainID, "Chain ID of the local network")
+	upCmd.Flags().String("moniker", defaults.Moniker, "Moniker of the local validator")
+	upCmd.Flags().String("sekai", types.DefaultSekaiVersion, "Version of sekai to run")
+	upCmd.Flags().String("interx", types.DefaultInterxVersion, "Version of interx to run, no interx is run when empty")
+	upCmd.Flags().Duration("timeout", defaults.HealthTimeout, "How long to wait for each node to become healthy")
+
+	return upCmd
+}
+
+// Down returns a cobra.Command that stops the local network started with `up`.
+func Down() *cobra.Command {
+	log.Debugln("Adding `down` command...")
+	downCmd := &cobra.Command{
+		Use:     "down",
+		Short:   "Stop the local KIRA network",
+		Long:    "Stop and remove the node containers started with `up`. With --wipe the volumes and network are removed too, deleting all chain state",
+		Example: "down --wipe",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, dm, err := setup(cmd)
+			if err != nil {
+				return err
+			}
+			wipe, _ := cmd.Flags().GetBool("wipe")
+
+			if err := stack.Down(context.Background(), dm, cfg, wipe); err != nil {
+				return err
+			}
+
+			text := fmt.Sprintf("Stack %s is down\n", cfg.Name)
+			if wipe {
+				text = fmt.Sprintf("Stack %s is down, its volumes and network are removed\n", cfg.Name)
+			}
+			return output.Print(cmd, Stopped{Name: cfg.Name, Wiped: wipe}, text)
+		},
+	}
+	addStackFlags(downCmd)
+	downCmd.Flags().Bool("wipe", false, "Remove the volumes and network as well, deleting all chain state")
+
+	return downCmd
+}
+
+// Started is the result of up.
+type Started struct {
+	Name       string   `json:"name"`
+	ChainID    string   `json:"chain_id"`
+	Containers []string `json:"containers"`
+	RPCPort    int      `json:"rpc_port"`
+	// InterxPort is zero when no interx is run.
+	InterxPort int `json:"interx_port,omitempty"`
+}
+
+// Stopped is the result of down.
+type Stopped struct {
+	Name string `json:"name"`
+	// Wiped is set when the volumes and network were removed with the containers.
+	Wiped bool `json:"wiped"`
+}
+
+func addStackFlags(cmd *cobra.Command) {
+	cmd.Flags().String("name", stack.DefaultConfig().Name, "Name of the stack, prefixing its containers, network and volumes")
+}
+
+// AddPortFlags adds the flags choosing the host ports the nodes of a stack publish.
+func AddPortFlags(cmd *cobra.Command) {
+	defaults := stack.DefaultConfig()
+	cmd.Flags().Int("p2p-port", defaults.P2PPort, "Host port publishing the P2P port of sekai")
+	cmd.Flags().Int("rpc-port", defaults.RPCPort, "Host port publishing the Tendermint RPC of sekai")
+	cmd.Flags().Int("grpc-port", defaults.GRPCPort, "Host port publishing the gRPC of sekai")
+	cmd.Flags().Int("interx-port", defaults.InterxPort, "Host port publishing the interx API")
+}
+
+// Ports sets the host ports of cfg from the flags added by AddPortFlags.
+func Ports(cmd *cobra.Command, cfg *stack.Config) {
+	cfg.P2PPort, _ = cmd.Flags().GetInt("p2p-port")
+	cfg.RPCPort, _ = cmd.Flags().GetInt("rpc-port")
+	cfg.GRPCPort, _ = cmd.Flags().GetInt("grpc-port")
+	cfg.InterxPort, _ = cmd.Flags().GetInt("interx-port")
+}
+
+func setup(cmd *cobra.Command) (stack.Config, *docker.DockerManager, error) {
+	name, _ := cmd.Flags().GetString("name")
+	cfg := stack.DefaultConfig()
+	cfg.Name = name
+	if cmd.Flags().Lookup("p2p-port") != nil {
+		Ports(cmd, &cfg)
+	}
+
+	dm, err := docker.NewDockerManagerFromConfig(docker.DockerConfig{})
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to create docker manager: %w", err)
+	}
+	if err := dm.VerifyDockerInstallation(cmd.Context()); err != nil {
+		return cfg, nil, err
+	}
+
+	return cfg, dm, nil
+}
@@ -0,0 +1,203 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	clinode "github.com/mrlutik/kira2.0/internal/cli/node"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/testnet"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "testnet"
+	short = "Run a multi-validator sekai network on this machine"
+	long  = `Create and destroy networks of several sekai validators and sentries on one Docker daemon,
+and kill, pause or resume single nodes of them for chaos testing`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Testnet returns a cobra.Command grouping the testnet subcommands.
+func Testnet() *cobra.Command {
+	log.Debugln("Adding `testnet` command...")
+	testnetCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	testnetCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(testnetCmd.PersistentFlags(), "docker-config", "docker_config")
+	testnetCmd.PersistentFlags().String("name", testnet.DefaultConfig().Name, "Name of the testnet, used for the network, volume and container names")
+
+	testnetCmd.AddCommand(create(), destroy(), fault(testnet.Kill), fault(testnet.Pause), fault(testnet.Resume))
+
+	return testnetCmd
+}
+
+func create() *cobra.Command {
+	defaults := testnet.DefaultConfig()
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create and start a testnet",
+		Long: `Generate node and operator keys for every node and a genesis with all validators claimed, then start
+every node as a container on the testnet network and wait until they are ready. Node i publishes P2P on
+--base-port+10*i, RPC on the port above and gRPC on the one above that. With --inventory the nodes
+are written to an inventory file for node status and node restart`,
+		Example: "testnet create --validators=4 --sentries=2 --inventory=testnet.yaml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := testnet.DefaultConfig()
+			cfg.Name, _ = cmd.Flags().GetString("name")
+			cfg.ChainID, _ = cmd.Flags().GetString("chain-id")
+			cfg.Validators, _ = cmd.Flags().GetInt("validators")
+			cfg.Sentries, _ = cmd.Flags().GetInt("sentries")
+			cfg.BasePort, _ = cmd.Flags().GetInt("base-port")
+			cfg.HealthTimeout, _ = cmd.Flags().GetDuration("timeout")
+			cfg.Readiness = clinode.ReadinessFromFlags(cmd)
+			sekaiVersion, _ := cmd.Flags().GetString("sekai")
+			cfg.SekaiImage = types.SekaiImage + ":" + sekaiVersion
+			inventoryPath, _ := cmd.Flags().GetString("inventory")
+			configPath := config.FromCommand(cmd).DockerConfig
+
+			dm, err := docker.NewDockerManagerFromFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if err := testnet.Create(ctx, dm, cfg); err != nil {
+				return err
+			}
+			inv := cfg.Inventory(dm)
+			if inventoryPath != "" {
+				for i := range inv.Nodes {
+					inv.Nodes[i].DockerConfig = configPath
+				}
+				if err := inv.WriteFile(inventoryPath); err != nil {
+					return err
+				}
+			}
+
+			created := Created{Name: cfg.Name, ChainID: cfg.ChainID, Inventory: inventoryPath}
+			var text strings.Builder
+			fmt.Fprintf(&text, "Testnet %s of %s is up:\n", cfg.Name, cfg.ChainID)
+			for _, n := range inv.Nodes {
+				created.Nodes = append(created.Nodes, CreatedNode{Name: n.Name, Role: n.Role, RPC: n.RPC, Container: n.Container})
+				fmt.Fprintf(&text, "  %-14s %-10s %s\n", n.Name, n.Role, n.RPC)
+			}
+			if inventoryPath != "" {
+				fmt.Fprintf(&text, "Inventory written to %s\n", inventoryPath)
+			}
+			return output.Print(cmd, created, text.String())
+		},
+	}
+	createCmd.Flags().String("chain-id", defaults.ChainID, "Chain ID of the testnet")
+	createCmd.Flags().Int("validators", defaults.Validators, "Number of validators")
+	createCmd.Flags().Int("sentries", defaults.Sentries, "Number of sentries, the validators only peer with them when there are any")
+	createCmd.Flags().Int("base-port", defaults.BasePort, "Host P2P port of the first node")
+	createCmd.Flags().String("sekai", types.DefaultSekaiVersion, "Version of sekai to run")
+	createCmd.Flags().Duration("timeout", defaults.HealthTimeout, "How long to wait for each node to become healthy")
+	createCmd.Flags().String("inventory", "", "Path to write an inventory of the testnet nodes to")
+	clinode.AddReadinessFlags(createCmd)
+
+	return createCmd
+}
+
+func destroy() *cobra.Command {
+	destroyCmd := &cobra.Command{
+		Use:     "destroy",
+		Short:   "Remove the containers, volumes and network of a testnet",
+		Long:    "Remove every container, volume and the network labelled with the testnet name. All chain state of the testnet is deleted",
+		Example: "testnet destroy --name=testnet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, _ := cmd.Flags().GetString("name")
+			configPath := config.FromCommand(cmd).DockerConfig
+
+			dm, err := docker.NewDockerManagerFromFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			if err := testnet.Destroy(context.Background(), dm, name); err != nil {
+				return err
+			}
+			return output.Print(cmd, Destroyed{Name: name}, fmt.Sprintf("Testnet %s is destroyed\n", name))
+		},
+	}
+
+	return destroyCmd
+}
+
+var faultShort = map[testnet.Fault]string{
+	testnet.Kill:   "Kill a testnet node with SIGKILL",
+	testnet.Pause:  "Freeze a testnet node",
+	testnet.Resume: "Unpause a frozen or start a killed testnet node",
+}
+
+func fault(f testnet.Fault) *cobra.Command {
+	faultCmd := &cobra.Command{
+		Use:     string(f) + " <node>",
+		Short:   faultShort[f],
+		Long:    faultShort[f] + ". Nodes are named validator-<i> and sentry-<i>",
+		Example: "testnet " + string(f) + " validator-2",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, _ := cmd.Flags().GetString("name")
+			configPath := config.FromCommand(cmd).DockerConfig
+
+			dm, err := docker.NewDockerManagerFromFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to create docker manager: %w", err)
+			}
+
+			if err := testnet.Inject(context.Background(), dm, name, args[0], f); err != nil {
+				return err
+			}
+			injected := Injected{Name: name, Node: args[0], Fault: string(f)}
+			return output.Print(cmd, injected, fmt.Sprintf("Applied %s to %s of testnet %s\n", f, args[0], name))
+		},
+	}
+
+	return faultCmd
+}
+
+// Created is the result of testnet create.
+type Created struct {
+	Name    string        `json:"name"`
+	ChainID string        `json:"chain_id"`
+	Nodes   []CreatedNode `json:"nodes"`
+	// Inventory is the path the inventory was written to, empty without --inventory.
+	Inventory string `json:"inventory,omitempty"`
+}
+
+// CreatedNode is a node of a created testnet.
+type CreatedNode struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	RPC       string `json:"rpc"`
+	Container string `json:"container"`
+}
+
+// Destroyed is the result of testnet destroy.
+type Destroyed struct {
+	Name string `json:"name"`
+}
+
+// Injected is the result of testnet kill, pause and resume.
+type Injected struct {
+	Name  string `json:"name"`
+	Node  string `json:"node"`
+	Fault string `json:"fault"`
+}
@@ -0,0 +1,214 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	govcli "github.com/mrlutik/kira2.0/internal/cli/gov"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/gov"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/tokens"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "tokens"
+	short = "Inspect token aliases, rates and black and white lists"
+	long  = `Query the tokens module through sekaid in a node container and propose new token aliases and rates
+from a token config file`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Tokens returns a cobra.Command grouping the tokens subcommands.
+func Tokens() *cobra.Command {
+	log.Debugln("Adding `tokens` command...")
+	tokensCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+	}
+	tokensCmd.PersistentFlags().String("docker-config", "", "Path to a JSON docker config for a remote daemon. Local daemon is used when empty")
+	config.Bind(tokensCmd.PersistentFlags(), "docker-config", "docker_config")
+	tokensCmd.PersistentFlags().String("container", types.DefaultSekaiContainer, "Node container running sekaid")
+	config.Bind(tokensCmd.PersistentFlags(), "container", "container")
+	tokensCmd.PersistentFlags().String("home", sekai.DefaultHome, "Sekaid home inside the container")
+	config.Bind(tokensCmd.PersistentFlags(), "home", "sekai_home")
+
+	tokensCmd.AddCommand(aliases(), rates(), blackWhites(), propose())
+
+	return tokensCmd
+}
+
+func aliases() *cobra.Command {
+	aliasesCmd := &cobra.Command{
+		Use:     "aliases [symbol...]",
+		Short:   "Show token aliases, all of them unless symbols are given",
+		Example: "tokens aliases KEX --output=json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			var list []tokens.Alias
+			if len(args) == 0 {
+				if list, err = tokens.Aliases(ctx, cli); err != nil {
+					return err
+				}
+			}
+			for _, symbol := range args {
+				alias, err := tokens.AliasOf(ctx, cli, symbol)
+				if err != nil {
+					return err
+				}
+				list = append(list, *alias)
+			}
+
+			return output.Print(cmd, list, tokens.FormatAliases(list))
+		},
+	}
+
+	return aliasesCmd
+}
+
+func rates() *cobra.Command {
+	ratesCmd := &cobra.Command{
+		Use:     "rates [denom...]",
+		Short:   "Show token rates, all of them unless denoms are given",
+		Example: "tokens rates ukex --output=yaml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			var list []tokens.Rate
+			if len(args) == 0 {
+				if list, err = tokens.Rates(ctx, cli); err != nil {
+					return err
+				}
+			}
+			for _, denom := range args {
+				rate, err := tokens.RateOf(ctx, cli, denom)
+				if err != nil {
+					return err
+				}
+				list = append(list, *rate)
+			}
+
+			return output.Print(cmd, list, tokens.FormatRates(list))
+		},
+	}
+
+	return ratesCmd
+}
+
+func blackWhites() *cobra.Command {
+	blackWhitesCmd := &cobra.Command{
+		Use:   "black-whites",
+		Short: "Show the whitelisted and blacklisted denoms",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			bw, err := tokens.QueryBlackWhites(context.Background(), cli)
+			if err != nil {
+				return err
+			}
+			return output.Print(cmd, bw, tokens.FormatBlackWhites(bw))
+		},
+	}
+
+	return blackWhitesCmd
+}
+
+// Proposed is a proposal of tokens propose with the arguments of its `sekaid tx`.
+// Submitted is nil with --dry-run.
+type Proposed struct {
+	Title     string         `json:"title"`
+	Args      []string       `json:"args"`
+	Submitted *gov.Submitted `json:"submitted,omitempty"`
+}
+
+func propose() *cobra.Command {
+	proposeCmd := &cobra.Command{
+		Use:   "propose",
+		Short: "Propose the token aliases and rates of a token config file",
+		Long: `Compare the aliases and rates of a token config file with the chain and submit one governance
+proposal for every entry that is missing or differs. Entries the chain already has are skipped.
+--dry-run prints the proposals without submitting them, follow submitted ones with "gov watch"`,
+		Example: "tokens propose -f tokens.yaml --from=operator",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			cfg, err := tokens.LoadConfigFile(file)
+			if err != nil {
+				return err
+			}
+			cli, err := govcli.CLIFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			aliases, err := tokens.Aliases(ctx, cli)
+			if err != nil {
+				return err
+			}
+			rates, err := tokens.Rates(ctx, cli)
+			if err != nil {
+				return err
+			}
+			proposed := []Proposed{}
+			proposals := cfg.Proposals(aliases, rates)
+			if len(proposals) == 0 {
+				return output.Print(cmd, proposed, "Aliases and rates are up to date\n")
+			}
+			for _, p := range proposals {
+				if err := p.Validate(); err != nil {
+					return err
+				}
+			}
+
+			var text strings.Builder
+			for _, p := range proposals {
+				if dryRun {
+					proposed = append(proposed, Proposed{Title: p.Title, Args: p.Args()})
+					fmt.Fprintf(&text, "%s: sekaid tx %s\n", p.Title, strings.Join(p.Args(), " "))
+					continue
+				}
+				submitted, err := gov.Submit(ctx, cli, p, govcli.TxOptionsFromFlags(cmd))
+				if err != nil {
+					return err
+				}
+				proposed = append(proposed, Proposed{Title: p.Title, Args: p.Args(), Submitted: submitted})
+				fmt.Fprintf(&text, "Proposal %d %q submitted in %s at height %d\n", submitted.ProposalID, submitted.Title, submitted.TxHash, submitted.Height)
+			}
+			return output.Print(cmd, proposed, text.String())
+		},
+	}
+	proposeCmd.Flags().StringP("file", "f", "", "Path to the token config file")
+	proposeCmd.Flags().Bool("dry-run", false, "Only print the proposals")
+	proposeCmd.MarkFlagRequired("file")
+	govcli.AddTxFlags(proposeCmd)
+
+	return proposeCmd
+}
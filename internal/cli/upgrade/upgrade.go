@@ -0,0 +1,101 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	clinode "github.com/mrlutik/kira2.0/internal/cli/node"
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"github.com/mrlutik/kira2.0/internal/upgrade"
+	"github.com/spf13/cobra"
+)
+
+const (
+	use   = "upgrade [node...]"
+	short = "Upgrade sekai on the nodes of a network at a halt height"
+	long  = `Upgrade the sekai nodes of an inventory, or the given ones, to a new sekai image at a coordinated halt height.
+Every node halts after --halt-height, its data directory is snapshotted into a new volume, the container is
+recreated from the new image and started again. The upgrade succeeds once the nodes pass the readiness gates,
+which requires new blocks. Otherwise every node is restored from its snapshot and started with the old image`
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Upgrade returns a cobra.Command that runs a coordinated upgrade of the inventory nodes.
+func Upgrade() *cobra.Command {
+	log.Debugln("Adding `upgrade` command...")
+	upgradeCmd := &cobra.Command{
+		Use:     use,
+		Short:   short,
+		Long:    long,
+		Example: "upgrade --inventory=inventory.yaml --halt-height=120000 --sekai=v0.3.47",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inventoryPath, _ := cmd.Flags().GetString("inventory")
+			haltHeight, _ := cmd.Flags().GetInt64("halt-height")
+			sekaiVersion, _ := cmd.Flags().GetString("sekai")
+			home := config.FromCommand(cmd).SekaiHome
+			haltTimeout, _ := cmd.Flags().GetDuration("halt-timeout")
+
+			inv, err := inventory.LoadFile(inventoryPath)
+			if err != nil {
+				return err
+			}
+			nodes, err := inv.Select(args...)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			plan := upgrade.Plan{
+				HaltHeight:  haltHeight,
+				Image:       types.SekaiImage + ":" + sekaiVersion,
+				Home:        home,
+				HaltTimeout: haltTimeout,
+				Readiness:   clinode.ReadinessFromFlags(cmd),
+			}
+			if err := upgrade.Run(ctx, nodes, plan); err != nil {
+				return err
+			}
+
+			upgraded := Upgraded{HaltHeight: plan.HaltHeight, Image: plan.Image}
+			for _, n := range nodes {
+				upgraded.Nodes = append(upgraded.Nodes, n.Name)
+			}
+			text := fmt.Sprintf("Upgraded %s to %s at height %d\n", strings.Join(upgraded.Nodes, ", "), plan.Image, plan.HaltHeight)
+			return output.Print(cmd, upgraded, text)
+		},
+	}
+	upgradeCmd.Flags().String("inventory", "", "Path to the YAML inventory")
+	upgradeCmd.Flags().Int64("halt-height", 0, "Last height committed by the old version")
+	upgradeCmd.Flags().String("sekai", "", "Version of sekai to upgrade to")
+	upgradeCmd.Flags().String("home", sekai.DefaultHome, "Sekaid home inside the node containers")
+	config.Bind(upgradeCmd.Flags(), "home", "sekai_home")
+	upgradeCmd.Flags().Duration("halt-timeout", 24*time.Hour, "How long the network gets to reach the halt height")
+	upgradeCmd.MarkFlagRequired("inventory")
+	upgradeCmd.MarkFlagRequired("halt-height")
+	upgradeCmd.MarkFlagRequired("sekai")
+	clinode.AddReadinessFlags(upgradeCmd)
+
+	return upgradeCmd
+}
+
+// Upgraded is the result of upgrade.
+type Upgraded struct {
+	Nodes      []string `json:"nodes"`
+	HaltHeight int64    `json:"halt_height"`
+	// Image is the sekai image the nodes run now.
+	Image string `json:"image"`
+}
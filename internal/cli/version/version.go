@@ -2,9 +2,9 @@ package version
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/output"
 	"github.com/mrlutik/kira2.0/internal/types"
 	"github.com/spf13/cobra"
 )
@@ -20,14 +20,20 @@ var (
 	log                        = logging.Log
 )
 
+// Info is the result of the version command.
+type Info struct {
+	Version string `json:"version"`
+}
+
 func Version() *cobra.Command {
 	log.Debugln("Adding `version` command...")
 	versionCmd := &cobra.Command{
 		Use:   "version",
 		Short: short,
 		Long:  long,
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Fprintf(os.Stdout, "%v\n", KiraLauncherVersion)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := Info{Version: KiraLauncherVersion}
+			return output.Print(cmd, info, fmt.Sprintf("%v\n", info.Version))
 		},
 	}
 	return versionCmd
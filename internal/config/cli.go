@@ -1,5 +0,0 @@
-package config
-
-type CLI struct {
-	use string
-}
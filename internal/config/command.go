@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// fileFlag is the root flag naming the config file.
+const fileFlag = "config"
+
+// settingAnnotation is the flag annotation holding the key of the setting a flag is bound to.
+const settingAnnotation = "kira2_setting"
+
+type contextKey struct{}
+
+// AddFlag adds the --config flag to the root command.
+func AddFlag(root *cobra.Command) {
+	root.PersistentFlags().String(fileFlag, "", fmt.Sprintf("Path to the config file, %s or %s when empty", EnvFile, DefaultFile()))
+}
+
+// Resolve merges the defaults, the config file, the environment and the flags given to cmd
+// and validates the result.
+func Resolve(cmd *cobra.Command) (*Config, error) {
+	c := Default()
+
+	path, optional := DefaultFile(), true
+	if f := cmd.Flags().Lookup(fileFlag); f != nil && f.Changed {
+		path, optional = f.Value.String(), false
+	} else if env, ok := os.LookupEnv(EnvFile); ok && env != "" {
+		path, optional = env, false
+	}
+	if err := c.LoadFile(path, optional); err != nil {
+		return nil, err
+	}
+
+	c.LoadEnv()
+
+	for _, s := range Settings {
+		if f := boundFlag(cmd, s); f != nil && f.Changed {
+			c.Set(s, f.Name, f.Value.String())
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	// Only the commands connecting to Docker read the docker config, a stale path must not
+	// break the others.
+	if s, _ := lookup("docker_config"); boundFlag(cmd, s) != nil {
+		if err := c.CheckDockerConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Bind binds the flag name of flags to the setting key: a given flag sets the setting. Commands
+// read bound settings from the Config of FromCommand, not from the flag, which only holds what
+// was given on the command line. Flags that are not bound are left alone, whatever their name,
+// e.g. `genesis new --container` names a container to build in and is empty unless given.
+func Bind(flags *pflag.FlagSet, name, key string) {
+	flags.SetAnnotation(name, settingAnnotation, []string{key})
+}
+
+// boundFlag returns the flag of cmd bound to s, nil when cmd has none.
+func boundFlag(cmd *cobra.Command, s Setting) *pflag.Flag {
+	var bound *pflag.Flag
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if keys := f.Annotations[settingAnnotation]; len(keys) > 0 && keys[0] == s.Key {
+			bound = f
+		}
+	})
+	return bound
+}
+
+// NewContext returns a copy of ctx carrying c.
+func NewContext(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromCommand returns the config resolved for cmd before it ran, the defaults when there is none.
+func FromCommand(cmd *cobra.Command) *Config {
+	if ctx := cmd.Context(); ctx != nil {
+		if c, ok := ctx.Value(contextKey{}).(*Config); ok {
+			return c
+		}
+	}
+	return Default()
+}
@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	// The defaults the command packages of the launcher register.
+	config.Register("output", func() string { return "text" }, func(value string) error {
+		if value != "text" && value != "json" {
+			return fmt.Errorf("invalid output format %q", value)
+		}
+		return nil
+	})
+	config.Register("sekai_home", func() string { return "/sekai" }, nil)
+	config.Register("keys_dir", func() string { return "keys" }, nil)
+	config.Register("audit_log", func() string { return "audit.jsonl" }, nil)
+}
+
+// newRoot returns a root command like the launcher's with a `node configure` command binding
+// --container and a `genesis new` command whose --container is not bound. run is set to the
+// config each command runs with.
+func newRoot(run **config.Config) *cobra.Command {
+	record := func(cmd *cobra.Command, args []string) error {
+		*run = config.FromCommand(cmd)
+		return nil
+	}
+	root := &cobra.Command{
+		Use: "kira2_launcher",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Resolve(cmd)
+			if err != nil {
+				return err
+			}
+			cmd.SetContext(config.NewContext(cmd.Context(), cfg))
+			return nil
+		},
+	}
+	config.AddFlag(root)
+
+	node := &cobra.Command{Use: "node"}
+	node.PersistentFlags().String("docker-config", "", "")
+	config.Bind(node.PersistentFlags(), "docker-config", "docker_config")
+	configure := &cobra.Command{Use: "configure", RunE: record}
+	configure.Flags().String("container", "kira-sekai", "")
+	config.Bind(configure.Flags(), "container", "container")
+	node.AddCommand(configure)
+
+	genesis := &cobra.Command{Use: "genesis"}
+	newGenesis := &cobra.Command{Use: "new", RunE: record}
+	newGenesis.Flags().String("container", "", "")
+	genesis.AddCommand(newGenesis)
+
+	version := &cobra.Command{Use: "version", RunE: record}
+
+	root.AddCommand(node, genesis, version)
+	return root
+}
+
+func TestResolveBinding(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("container: validator-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		env       map[string]string
+		container string
+		source    config.Kind
+		flag      string
+		err       string
+	}{
+		{name: "default", args: []string{"node", "configure"}, container: "kira-sekai", source: config.KindDefault, flag: "kira-sekai"},
+		{name: "file", args: []string{"--config", file, "node", "configure"}, container: "validator-file", source: config.KindFile, flag: "kira-sekai"},
+		{name: "env over file", args: []string{"--config", file, "node", "configure"}, env: map[string]string{"KIRA2_CONTAINER": "validator-env"}, container: "validator-env", source: config.KindEnv, flag: "kira-sekai"},
+		{name: "flag over env", args: []string{"node", "configure", "--container", "validator-flag"}, env: map[string]string{"KIRA2_CONTAINER": "validator-env"}, container: "validator-flag", source: config.KindFlag, flag: "validator-flag"},
+		{name: "unbound flag keeps its default", args: []string{"genesis", "new"}, env: map[string]string{"KIRA2_CONTAINER": "validator-env"}, container: "validator-env", source: config.KindEnv, flag: ""},
+		{name: "unbound flag does not set the setting", args: []string{"genesis", "new", "--container", "builder"}, container: "kira-sekai", source: config.KindDefault, flag: "builder"},
+		{name: "stale docker config without docker", args: []string{"version"}, env: map[string]string{"KIRA2_DOCKER_CONFIG": filepath.Join(dir, "missing.json")}, container: "kira-sekai", source: config.KindDefault},
+		{name: "registered check", args: []string{"version"}, env: map[string]string{"KIRA2_OUTPUT": "xml"}, err: `invalid output format "xml", from env KIRA2_OUTPUT`},
+		{name: "stale docker config with docker", args: []string{"node", "configure"}, env: map[string]string{"KIRA2_DOCKER_CONFIG": filepath.Join(dir, "missing.json")}, err: "docker_config from env KIRA2_DOCKER_CONFIG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var cfg *config.Config
+			root := newRoot(&cfg)
+			root.SetArgs(tt.args)
+			root.SilenceUsage, root.SilenceErrors = true, true
+			cmd, err := root.ExecuteC()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Execute(%v) = %v, want error containing %q", tt.args, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute(%v) error: %v", tt.args, err)
+			}
+			if cfg.Container != tt.container || cfg.Sources["container"].Kind != tt.source {
+				t.Fatalf("container = %s from %s, want %s from %s", cfg.Container, cfg.Sources["container"], tt.container, tt.source)
+			}
+			if f := cmd.Flags().Lookup("container"); f != nil && f.Value.String() != tt.flag {
+				t.Fatalf("--container = %q, want %q", f.Value.String(), tt.flag)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// Package config resolves the settings shared by the launcher commands.
+//
+// Every setting is taken from the first of these sources that sets it:
+//
+//  1. a flag given on the command line, e.g. --docker-config
+//  2. an environment variable, KIRA2_ and the upper case key, e.g. KIRA2_DOCKER_CONFIG
+//  3. the config file, ~/.config/kira2/config.yaml unless --config or KIRA2_CONFIG name another
+//  4. the built-in default
+//
+// The config file holds the keys of the settings:
+//
+//	log_level: info
+//	output: text
+//	docker_config: /etc/kira2/docker.json
+//	container: kira-sekai
+//	sekai_home: /sekai
+//	keys_dir: /var/lib/kira2/keys
+//	audit_log: /var/log/kira2/audit.jsonl
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables of the settings.
+const EnvPrefix = "KIRA2_"
+
+// EnvFile is the environment variable naming the config file.
+const EnvFile = EnvPrefix + "CONFIG"
+
+// Config are the settings shared by the launcher commands.
+type Config struct {
+	LogLevel string `json:"log_level"`
+	Output   string `json:"output"`
+	// DockerConfig is the path to the JSON docker config of a remote daemon, the local daemon
+	// is used when empty.
+	DockerConfig string `json:"docker_config"`
+	// Container is the node container running sekaid.
+	Container string `json:"container"`
+	// SekaiHome is the sekaid home inside the container.
+	SekaiHome string `json:"sekai_home"`
+	KeysDir   string `json:"keys_dir"`
+	AuditLog  string `json:"audit_log"`
+
+	// File is the config file that was read, empty when there was none.
+	File string `json:"file,omitempty"`
+	// Sources says where each setting came from, by key.
+	Sources map[string]Source `json:"sources"`
+}
+
+// Kind is a kind of source of a setting, in increasing precedence.
+type Kind string
+
+const (
+	KindDefault Kind = "default"
+	KindFile    Kind = "file"
+	KindEnv     Kind = "env"
+	KindFlag    Kind = "flag"
+)
+
+// Source is where the value of a setting came from.
+type Source struct {
+	Kind Kind `json:"kind"`
+	// Name is the config file, the environment variable or the flag, empty for defaults.
+	Name string `json:"name,omitempty"`
+}
+
+func (s Source) String() string {
+	switch s.Kind {
+	case KindFile:
+		return "file " + s.Name
+	case KindEnv:
+		return "env " + s.Name
+	case KindFlag:
+		return "flag --" + s.Name
+	}
+	return string(s.Kind)
+}
+
+// Setting describes one setting of Config.
+type Setting struct {
+	// Key is the name of the setting in the config file.
+	Key     string
+	Default func() string
+	// check validates a value, nil when any value goes.
+	check func(value string) error
+	field func(c *Config) *string
+}
+
+// Env returns the environment variable of the setting.
+func (s Setting) Env() string {
+	return EnvPrefix + strings.ToUpper(s.Key)
+}
+
+// Settings are the settings of Config in the order they are shown. The defaults of output,
+// sekai_home, keys_dir and audit_log are registered by the command packages using them.
+var Settings = []Setting{
+	{Key: "log_level", Default: constant("panic"), field: func(c *Config) *string { return &c.LogLevel }},
+	{Key: "output", Default: constant(""), field: func(c *Config) *string { return &c.Output }},
+	{Key: "docker_config", Default: constant(""), field: func(c *Config) *string { return &c.DockerConfig }},
+	{Key: "container", Default: constant(types.DefaultSekaiContainer), field: func(c *Config) *string { return &c.Container }},
+	{Key: "sekai_home", Default: constant(""), field: func(c *Config) *string { return &c.SekaiHome }},
+	{Key: "keys_dir", Default: constant(""), field: func(c *Config) *string { return &c.KeysDir }},
+	{Key: "audit_log", Default: constant(""), field: func(c *Config) *string { return &c.AuditLog }},
+}
+
+func constant(value string) func() string {
+	return func() string { return value }
+}
+
+// Register sets the default of the setting key and check, when not nil, validates its values.
+// The packages a setting belongs to register it from init, e.g. the custody commands register
+// the default keys_dir, so this package does not depend on them.
+func Register(key string, def func() string, check func(value string) error) {
+	for i := range Settings {
+		if Settings[i].Key == key {
+			Settings[i].Default = def
+			Settings[i].check = check
+			return
+		}
+	}
+	panic("config: register of unknown setting " + key)
+}
+
+// Value returns the value of the setting s in c.
+func (c *Config) Value(s Setting) string {
+	return *s.field(c)
+}
+
+// DefaultFile returns ~/.config/kira2/config.yaml.
+func DefaultFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "kira2-config.yaml"
+	}
+	return filepath.Join(home, ".config", "kira2", "config.yaml")
+}
+
+// Default returns the config with the built-in default of every setting.
+func Default() *Config {
+	c := &Config{Sources: map[string]Source{}}
+	for _, s := range Settings {
+		*s.field(c) = s.Default()
+		c.Sources[s.Key] = Source{Kind: KindDefault}
+	}
+	return c
+}
+
+// LoadFile applies the settings of the YAML config file at path. A missing file is an error
+// unless optional is set.
+func (c *Config) LoadFile(path string, optional bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && optional {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to decode config %s: %w", path, err)
+	}
+	for _, key := range sortedKeys(values) {
+		s, ok := lookup(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %s in config %s", key, path)
+		}
+		c.set(s, values[key], Source{Kind: KindFile, Name: path})
+	}
+	c.File = path
+
+	return nil
+}
+
+// LoadEnv applies the settings set in the environment.
+func (c *Config) LoadEnv() {
+	for _, s := range Settings {
+		if value, ok := os.LookupEnv(s.Env()); ok {
+			c.set(s, value, Source{Kind: KindEnv, Name: s.Env()})
+		}
+	}
+}
+
+// Set applies a setting given by the flag named flag.
+func (c *Config) Set(s Setting, flag, value string) {
+	c.set(s, value, Source{Kind: KindFlag, Name: flag})
+}
+
+func (c *Config) set(s Setting, value string, source Source) {
+	*s.field(c) = value
+	c.Sources[s.Key] = source
+}
+
+// Validate checks the values of the settings.
+func (c *Config) Validate() error {
+	if !contains(logging.ValidLogLevels, c.LogLevel) {
+		return fmt.Errorf("invalid log_level %q from %s, expected one of: %s", c.LogLevel, c.Sources["log_level"], strings.Join(logging.ValidLogLevels, ", "))
+	}
+	for _, s := range Settings {
+		if s.check == nil {
+			continue
+		}
+		if err := s.check(c.Value(s)); err != nil {
+			return fmt.Errorf("%w, from %s", err, c.Sources[s.Key])
+		}
+	}
+	if c.Container == "" {
+		return fmt.Errorf("container from %s is empty", c.Sources["container"])
+	}
+	if !strings.HasPrefix(c.SekaiHome, "/") {
+		return fmt.Errorf("sekai_home %q from %s is not an absolute path", c.SekaiHome, c.Sources["sekai_home"])
+	}
+	if c.KeysDir == "" {
+		return fmt.Errorf("keys_dir from %s is empty", c.Sources["keys_dir"])
+	}
+	if c.AuditLog == "" {
+		return fmt.Errorf("audit_log from %s is empty", c.Sources["audit_log"])
+	}
+
+	return nil
+}
+
+// CheckDockerConfig checks that the docker config file exists when one is set. Resolve runs it
+// for the commands with a flag bound to docker_config.
+func (c *Config) CheckDockerConfig() error {
+	if c.DockerConfig == "" {
+		return nil
+	}
+	if _, err := os.Stat(c.DockerConfig); err != nil {
+		return fmt.Errorf("docker_config from %s: %w", c.Sources["docker_config"], err)
+	}
+	return nil
+}
+
+func lookup(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Entry is a setting with its value and source, as shown by `config show`.
+type Entry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+	Env    string `json:"env"`
+}
+
+// Entries returns the settings of c in the order of Settings.
+func (c *Config) Entries() []Entry {
+	entries := make([]Entry, len(Settings))
+	for i, s := range Settings {
+		entries[i] = Entry{Key: s.Key, Value: c.Value(s), Source: c.Sources[s.Key], Env: s.Env()}
+	}
+	return entries
+}
+
+// FormatEntries returns a table of the settings of c and where they came from.
+func FormatEntries(c *Config) string {
+	var b strings.Builder
+	file := c.File
+	if file == "" {
+		file = "none"
+	}
+	fmt.Fprintf(&b, "Config file: %s\n\n", file)
+	fmt.Fprintf(&b, "%-14s %-40s %s\n", "KEY", "VALUE", "SOURCE")
+	for _, e := range c.Entries() {
+		value := e.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(&b, "%-14s %-40s %s\n", e.Key, value, e.Source)
+	}
+	return b.String()
+}
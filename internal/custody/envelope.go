@@ -0,0 +1,125 @@
+// Package custody keeps the keys of sekai nodes on the launcher machine.
+//
+// Validator keys, node keys and operator mnemonics are generated or imported locally and stored
+// encrypted with a passphrase. They only leave the launcher machine when a node is deployed.
+package custody
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+const (
+	envelopeVersion = 1
+	kdfScrypt       = "scrypt"
+	cipherChaCha    = "chacha20poly1305"
+
+	scryptR  = 8
+	scryptP  = 1
+	saltSize = 16
+
+	// MinPassphrase is the minimum length of a passphrase.
+	MinPassphrase = 12
+)
+
+// scryptLogN is the scrypt work factor of new envelopes, 2^17 takes about half a second and
+// 128 MiB. Tests lower it.
+var scryptLogN = 17
+
+// envelope is the encrypted form of a key as stored on disk. The key encrypting the payload
+// is derived from the passphrase with scrypt, the parameters are stored next to the
+// ciphertext so they can be raised later without breaking existing files.
+type envelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	LogN       int    `json:"log_n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// seal encrypts plaintext with passphrase. The kind of the key is authenticated with it, so
+// an envelope cannot be swapped for the envelope of another kind of key.
+func seal(kind Kind, plaintext []byte, passphrase string) ([]byte, error) {
+	env := envelope{
+		Version: envelopeVersion,
+		KDF:     kdfScrypt,
+		Salt:    make([]byte, saltSize),
+		LogN:    scryptLogN,
+		R:       scryptR,
+		P:       scryptP,
+		Cipher:  cipherChaCha,
+		Nonce:   make([]byte, chacha20poly1305.NonceSizeX),
+	}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	aead, err := env.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, additionalData(kind))
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// open decrypts an envelope written by seal.
+func open(kind Kind, data []byte, passphrase string) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+	if env.Version != envelopeVersion || env.KDF != kdfScrypt || env.Cipher != cipherChaCha {
+		return nil, fmt.Errorf("unsupported envelope version %d (%s, %s)", env.Version, env.KDF, env.Cipher)
+	}
+	if env.LogN < 10 || env.LogN > 22 {
+		return nil, fmt.Errorf("envelope scrypt work factor 2^%d is out of range", env.LogN)
+	}
+
+	aead, err := env.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("envelope nonce has %d bytes, expected %d", len(env.Nonce), aead.NonceSize())
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, additionalData(kind))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted %s", kind)
+	}
+
+	return plaintext, nil
+}
+
+func (env envelope) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), env.Salt, 1<<env.LogN, env.R, env.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func additionalData(kind Kind) []byte {
+	return []byte(fmt.Sprintf("kira2-custody/v%d %s", envelopeVersion, kind))
+}
@@ -0,0 +1,73 @@
+package custody
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+const passphrase = "correct horse battery"
+
+func TestMain(m *testing.M) {
+	// The lowest work factor open accepts, the default makes every envelope take half a second.
+	scryptLogN = 10
+	os.Exit(m.Run())
+}
+
+func TestEnvelope(t *testing.T) {
+	secret := []byte(`{"priv_key":{"type":"tendermint/PrivKeyEd25519","value":"c2VjcmV0"}}`)
+	sealed, err := seal(NodeKey, secret, passphrase)
+	if err != nil {
+		t.Fatalf("seal() error: %v", err)
+	}
+	if strings.Contains(string(sealed), "c2VjcmV0") {
+		t.Fatal("envelope holds the secret in the clear")
+	}
+
+	tests := []struct {
+		name       string
+		kind       Kind
+		passphrase string
+		modify     func(env *envelope)
+		err        string
+	}{
+		{name: "round trip", kind: NodeKey, passphrase: passphrase},
+		{name: "wrong passphrase", kind: NodeKey, passphrase: "wrong horse battery", err: "wrong passphrase or corrupted node_key"},
+		{name: "other kind", kind: ValidatorKey, passphrase: passphrase, err: "wrong passphrase or corrupted priv_validator_key"},
+		{name: "tampered ciphertext", kind: NodeKey, passphrase: passphrase, modify: func(env *envelope) { env.Ciphertext[0] ^= 1 }, err: "wrong passphrase or corrupted"},
+		{name: "unknown version", kind: NodeKey, passphrase: passphrase, modify: func(env *envelope) { env.Version = 2 }, err: "unsupported envelope version 2"},
+		{name: "work factor out of range", kind: NodeKey, passphrase: passphrase, modify: func(env *envelope) { env.LogN = 30 }, err: "out of range"},
+		{name: "short nonce", kind: NodeKey, passphrase: passphrase, modify: func(env *envelope) { env.Nonce = env.Nonce[:12] }, err: "envelope nonce has 12 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := sealed
+			if tt.modify != nil {
+				var env envelope
+				if err := json.Unmarshal(sealed, &env); err != nil {
+					t.Fatal(err)
+				}
+				tt.modify(&env)
+				if data, err = json.Marshal(env); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			plaintext, err := open(tt.kind, data, tt.passphrase)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("open() = %q, %v, want error containing %q", plaintext, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("open() error: %v", err)
+			}
+			if string(plaintext) != string(secret) {
+				t.Fatalf("open() = %q, want %q", plaintext, secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of a key held in custody.
+type Kind string
+
+const (
+	// ValidatorKey is priv_validator_key.json, the consensus key signing blocks.
+	ValidatorKey Kind = "priv_validator_key"
+	// NodeKey is node_key.json, the key identifying the node to its peers.
+	NodeKey Kind = "node_key"
+	// OperatorKey is the mnemonic of the account operating the validator.
+	OperatorKey Kind = "operator"
+)
+
+// Kinds are all kinds of keys, in the order they are pushed.
+var Kinds = []Kind{ValidatorKey, NodeKey, OperatorKey}
+
+// Key sources recorded in a Record.
+const (
+	SourceGenerated = "generated"
+	SourceImported  = "imported"
+)
+
+const (
+	typePubKeyEd25519  = "tendermint/PubKeyEd25519"
+	typePrivKeyEd25519 = "tendermint/PrivKeyEd25519"
+)
+
+// Record is the public part of a key in custody. It is stored unencrypted so the keys can be
+// audited without the passphrase.
+type Record struct {
+	Kind Kind `json:"kind"`
+	// Fingerprint is `sha256:<hex>` of the public key.
+	Fingerprint string `json:"fingerprint"`
+	// Address is the validator address, the node ID or the operator account address.
+	Address string `json:"address"`
+	// PubKey is the base64 public key.
+	PubKey  string    `json:"pub_key"`
+	Source  string    `json:"source"`
+	Created time.Time `json:"created"`
+}
+
+// tmKey is an amino JSON key of Tendermint.
+type tmKey struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// privValidatorKey is the layout of priv_validator_key.json.
+type privValidatorKey struct {
+	Address string `json:"address"`
+	PubKey  tmKey  `json:"pub_key"`
+	PrivKey tmKey  `json:"priv_key"`
+}
+
+// nodeKey is the layout of node_key.json.
+type nodeKey struct {
+	PrivKey tmKey `json:"priv_key"`
+}
+
+// GenerateValidatorKey returns a new priv_validator_key.json.
+func GenerateValidatorKey() ([]byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate validator key: %w", err)
+	}
+
+	return json.MarshalIndent(privValidatorKey{
+		Address: strings.ToUpper(hex.EncodeToString(tmAddress(pub))),
+		PubKey:  tmKey{Type: typePubKeyEd25519, Value: base64.StdEncoding.EncodeToString(pub)},
+		PrivKey: tmKey{Type: typePrivKeyEd25519, Value: base64.StdEncoding.EncodeToString(priv)},
+	}, "", "  ")
+}
+
+// GenerateNodeKey returns a new node_key.json.
+func GenerateNodeKey() ([]byte, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %w", err)
+	}
+
+	return json.Marshal(nodeKey{PrivKey: tmKey{Type: typePrivKeyEd25519, Value: base64.StdEncoding.EncodeToString(priv)}})
+}
+
+// Inspect validates a priv_validator_key.json or node_key.json and returns its record.
+// Source and Created are left empty.
+func Inspect(kind Kind, data []byte) (Record, error) {
+	switch kind {
+	case ValidatorKey:
+		var key privValidatorKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return Record{}, fmt.Errorf("failed to decode %s: %w", kind, err)
+		}
+		pub, err := ed25519Public(key.PrivKey)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid %s: %w", kind, err)
+		}
+		if key.PubKey.Value != base64.StdEncoding.EncodeToString(pub) {
+			return Record{}, fmt.Errorf("invalid %s: public key does not belong to the private key", kind)
+		}
+		address := strings.ToUpper(hex.EncodeToString(tmAddress(pub)))
+		if !strings.EqualFold(key.Address, address) {
+			return Record{}, fmt.Errorf("invalid %s: address %s does not match the public key, expected %s", kind, key.Address, address)
+		}
+		return Record{Kind: kind, Fingerprint: Fingerprint(pub), Address: address, PubKey: key.PubKey.Value}, nil
+	case NodeKey:
+		var key nodeKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return Record{}, fmt.Errorf("failed to decode %s: %w", kind, err)
+		}
+		pub, err := ed25519Public(key.PrivKey)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid %s: %w", kind, err)
+		}
+		return Record{
+			Kind:        kind,
+			Fingerprint: Fingerprint(pub),
+			Address:     hex.EncodeToString(tmAddress(pub)),
+			PubKey:      base64.StdEncoding.EncodeToString(pub),
+		}, nil
+	default:
+		return Record{}, fmt.Errorf("%s keys cannot be inspected offline", kind)
+	}
+}
+
+// Fingerprint returns `sha256:<hex>` of a public key.
+func Fingerprint(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// tmAddress is the Tendermint address of an ed25519 public key: the first 20 bytes of its
+// SHA-256. In lower case hex it is also the node ID.
+func tmAddress(pub ed25519.PublicKey) []byte {
+	sum := sha256.Sum256(pub)
+	return sum[:20]
+}
+
+// ed25519Public decodes an amino private key and returns its public half.
+func ed25519Public(key tmKey) (ed25519.PublicKey, error) {
+	if key.Type != typePrivKeyEd25519 {
+		return nil, fmt.Errorf("unsupported private key type %q", key.Type)
+	}
+	raw, err := base64.StdEncoding.DecodeString(key.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	if len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("private key has %d bytes, expected %d", len(raw), ed25519.PrivateKeySize)
+	}
+	priv := ed25519.PrivateKey(raw)
+	pub := priv.Public().(ed25519.PublicKey)
+	// The second half of an ed25519 private key is its public key, a mismatch means a damaged key.
+	if !bytes.Equal(pub, raw[32:]) {
+		return nil, fmt.Errorf("private key is damaged")
+	}
+
+	return pub, nil
+}
@@ -0,0 +1,124 @@
+package custody
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// OperatorName is the name of the operator key in the keyring of a node.
+const OperatorName = "operator"
+
+// operatorInfo is the output of `sekaid keys add --output=json`.
+type operatorInfo struct {
+	Name     string          `json:"name"`
+	Address  string          `json:"address"`
+	PubKey   json.RawMessage `json:"pubkey"`
+	Mnemonic string          `json:"mnemonic"`
+}
+
+// Operator derives the operator account of mnemonic with sekaid in a toolbox container on the
+// launcher's Docker daemon. An empty mnemonic generates a new one. The toolbox has no volume,
+// the keyring written in it is removed with it.
+// Returns the mnemonic and the record of the account.
+func Operator(ctx context.Context, dm *docker.DockerManager, image, mnemonic string) (string, Record, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", Record{}, fmt.Errorf("failed to generate toolbox name: %w", err)
+	}
+	toolbox := "kira2-custody-" + hex.EncodeToString(suffix)
+	if err := dm.StartToolbox(ctx, toolbox, image, nil); err != nil {
+		return "", Record{}, err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	info, err := addOperator(ctx, sekai.NewCLI(dm, toolbox, "/tmp/custody"), mnemonic)
+	if err != nil {
+		return "", Record{}, err
+	}
+	rec, err := info.record()
+	if err != nil {
+		return "", Record{}, err
+	}
+	if mnemonic == "" {
+		if info.Mnemonic == "" {
+			return "", Record{}, fmt.Errorf("`sekaid keys add` printed no mnemonic")
+		}
+		mnemonic = info.Mnemonic
+	}
+
+	return mnemonic, rec, nil
+}
+
+// addOperator adds the operator key to the keyring of the sekaid home of cli. With a mnemonic
+// the key is recovered from it: the mnemonic is written to a file only root can read, fed to
+// sekaid on stdin and removed again, so it never shows up in a process list.
+func addOperator(ctx context.Context, cli *sekai.CLI, mnemonic string) (*operatorInfo, error) {
+	args := []string{"sekaid", "keys", "add", OperatorName, "--keyring-backend=" + sekai.KeyringBackend, "--output=json", "--home=" + cli.Home}
+	cmd := args
+	if mnemonic != "" {
+		file := "/tmp/" + OperatorName + ".mnemonic"
+		if err := cli.DM.WriteFile(ctx, cli.Container, file, []byte(mnemonic+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		script := strings.Join(append(args, "--recover"), " ") + " < " + file + "; status=$?; rm -f " + file + "; exit $status"
+		cmd = []string{"/bin/sh", "-c", script}
+	}
+
+	res, err := cli.DM.Exec(ctx, cli.Container, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("`sekaid keys add` exited with code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	// Depending on the version sekaid prints the key to stdout or stderr.
+	for _, out := range []string{res.Stdout, res.Stderr} {
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+			var info operatorInfo
+			if err := json.Unmarshal([]byte(line), &info); err == nil && info.Address != "" {
+				return &info, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected output of `sekaid keys add`: %s", strings.TrimSpace(res.Stdout+res.Stderr))
+}
+
+// record returns the record of the operator account. The public key is printed either as an
+// object or as a JSON string holding the object.
+func (info *operatorInfo) record() (Record, error) {
+	raw := []byte(info.PubKey)
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = []byte(encoded)
+	}
+	var pubKey struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(raw, &pubKey); err != nil {
+		return Record{}, fmt.Errorf("failed to decode operator public key %s: %w", info.PubKey, err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(pubKey.Key)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to decode operator public key %s: %w", pubKey.Key, err)
+	}
+
+	return Record{Kind: OperatorKey, Fingerprint: Fingerprint(pub), Address: info.Address, PubKey: pubKey.Key}, nil
+}
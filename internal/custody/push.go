@@ -0,0 +1,129 @@
+package custody
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// keyFiles are the files of the Tendermint keys in the config directory of a sekaid home.
+var keyFiles = map[Kind]string{
+	ValidatorKey: "priv_validator_key.json",
+	NodeKey:      "node_key.json",
+}
+
+// Push writes the keys of a bundle into the sekaid home of cli. The key files are written
+// readable by their owner only, the operator key is recovered into the keyring. Keys already
+// in the home are only replaced when replace is set, which is meant for homes that were
+// just created by `sekaid init` with throwaway keys. Afterwards sekaid is asked for the
+// public keys it loads, and every key is recorded in rec with its fingerprint.
+func Push(ctx context.Context, cli *sekai.CLI, b *Bundle, replace bool, rec *audit.Recorder) error {
+	for _, kind := range Kinds {
+		r, ok := b.Record(kind)
+		if !ok {
+			continue
+		}
+		err := push(ctx, cli, kind, b.secrets[kind], r, replace)
+		detail := fmt.Sprintf("set %s, %s, address %s", b.Set, r.Fingerprint, r.Address)
+		if recErr := rec.Record("push "+string(kind), detail, err); recErr != nil {
+			return recErr
+		}
+		if err != nil {
+			return err
+		}
+		log.Infof("Pushed %s key %s of set %s", kind, r.Fingerprint, b.Set)
+	}
+
+	return nil
+}
+
+func push(ctx context.Context, cli *sekai.CLI, kind Kind, secret []byte, r Record, replace bool) error {
+	if kind == OperatorKey {
+		return pushOperator(ctx, cli, string(secret), r, replace)
+	}
+
+	path := cli.ConfigPath(keyFiles[kind])
+	exists, err := cli.FileExists(ctx, path)
+	if err != nil {
+		return err
+	}
+	if exists && !replace {
+		data, err := cli.DM.ReadFile(ctx, cli.Container, path)
+		if err != nil {
+			return err
+		}
+		current, err := Inspect(kind, data)
+		if err != nil {
+			return err
+		}
+		if current.Fingerprint != r.Fingerprint {
+			return fmt.Errorf("%s holds a different %s key (%s), refusing to replace it", cli.Container, kind, current.Fingerprint)
+		}
+	}
+	if err := cli.DM.WriteFile(ctx, cli.Container, path, secret, 0600); err != nil {
+		return err
+	}
+
+	return verify(ctx, cli, kind, r)
+}
+
+// verify checks that sekaid loads the pushed key.
+func verify(ctx context.Context, cli *sekai.CLI, kind Kind, r Record) error {
+	switch kind {
+	case ValidatorKey:
+		out, err := cli.Run(ctx, "tendermint", "show-validator")
+		if err != nil {
+			return err
+		}
+		var pubKey struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &pubKey); err != nil {
+			return fmt.Errorf("unexpected output of `sekaid tendermint show-validator`: %s", strings.TrimSpace(out))
+		}
+		if pubKey.Key != r.PubKey {
+			return fmt.Errorf("sekaid loads validator key %s, pushed was %s", pubKey.Key, r.PubKey)
+		}
+	case NodeKey:
+		out, err := cli.Run(ctx, "tendermint", "show-node-id")
+		if err != nil {
+			return err
+		}
+		if id := strings.TrimSpace(out); id != r.Address {
+			return fmt.Errorf("sekaid loads node ID %s, pushed was %s", id, r.Address)
+		}
+	}
+
+	return nil
+}
+
+// pushOperator recovers the operator key into the keyring unless it is there already.
+func pushOperator(ctx context.Context, cli *sekai.CLI, mnemonic string, r Record, replace bool) error {
+	out, err := cli.Run(ctx, "keys", "show", OperatorName, "--address", "--keyring-backend="+sekai.KeyringBackend)
+	if err == nil {
+		address := strings.TrimSpace(out)
+		if address == r.Address {
+			return nil
+		}
+		if !replace {
+			return fmt.Errorf("%s holds a different operator key (%s), refusing to replace it", cli.Container, address)
+		}
+		if _, err := cli.Run(ctx, "keys", "delete", OperatorName, "--yes", "--keyring-backend="+sekai.KeyringBackend); err != nil {
+			return err
+		}
+	}
+
+	info, err := addOperator(ctx, cli, mnemonic)
+	if err != nil {
+		return err
+	}
+	if info.Address != r.Address {
+		return fmt.Errorf("operator mnemonic recovers %s, recorded is %s", info.Address, r.Address)
+	}
+
+	return nil
+}
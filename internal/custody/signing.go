@@ -0,0 +1,409 @@
+package custody
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// lockFile holds the signing lock of the validator key of a set.
+const lockFile = "signing.lock"
+
+// rpcCheckTimeout limits how long a known node gets to answer whether it runs a key.
+const rpcCheckTimeout = 5 * time.Second
+
+// SignState is priv_validator_state.json, the last height, round and step a validator signed.
+// A validator must never sign at or below it again.
+type SignState struct {
+	Height    int64  `json:"height,string"`
+	Round     int32  `json:"round"`
+	Step      int8   `json:"step"`
+	Signature string `json:"signature,omitempty"`
+	SignBytes string `json:"signbytes,omitempty"`
+}
+
+// ParseSignState decodes a priv_validator_state.json.
+func ParseSignState(data []byte) (*SignState, error) {
+	var s SignState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode priv_validator_state.json: %w", err)
+	}
+	return &s, nil
+}
+
+// Before reports whether s was signed at an earlier height, round or step than o.
+func (s SignState) Before(o SignState) bool {
+	if s.Height != o.Height {
+		return s.Height < o.Height
+	}
+	if s.Round != o.Round {
+		return s.Round < o.Round
+	}
+	return s.Step < o.Step
+}
+
+func (s SignState) String() string {
+	return fmt.Sprintf("height %d round %d step %d", s.Height, s.Round, s.Step)
+}
+
+// later returns the later of two states, either may be nil.
+func later(a, b *SignState) *SignState {
+	if a == nil || (b != nil && a.Before(*b)) {
+		return b
+	}
+	return a
+}
+
+// Holder is the container running a validator key.
+type Holder struct {
+	Container string `json:"container"`
+	// Daemon is the host of the Docker daemon running the container.
+	Daemon string `json:"daemon"`
+}
+
+func (h Holder) String() string {
+	return h.Container + " on " + h.Daemon
+}
+
+// Lock records which node a validator key was deployed to. Only one node holds the lock of a
+// key, deploying the key elsewhere needs the holder to be stopped first.
+type Lock struct {
+	Fingerprint string    `json:"fingerprint"`
+	Holder      Holder    `json:"holder"`
+	Acquired    time.Time `json:"acquired"`
+	// Released is set once the holder is confirmed stopped, the key may then be deployed anywhere.
+	Released *time.Time `json:"released,omitempty"`
+	// State is the latest sign state of the key the launcher has seen.
+	State *SignState `json:"state,omitempty"`
+}
+
+// SigningLock returns the signing lock of a set, nil when its validator key was never deployed.
+func (s *Store) SigningLock(set string) (*Lock, error) {
+	dir, err := s.setDir(set)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, lockFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing lock of key set %s: %w", set, err)
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to decode signing lock of key set %s: %w", set, err)
+	}
+	return &lock, nil
+}
+
+func (s *Store) writeSigningLock(set string, lock *Lock) error {
+	dir, err := s.setDir(set)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode signing lock of key set %s: %w", set, err)
+	}
+	return writeFile(filepath.Join(dir, lockFile), data)
+}
+
+// ReleaseSigningLock releases the signing lock of a set without reaching its holder, for a
+// holder whose host is gone. The caller has to be sure it does not run any more. state is the
+// last sign state of the holder when it could still be copied by hand, it is kept when it is
+// later than the one the lock knows.
+func (s *Store) ReleaseSigningLock(set string, state *SignState) (*Lock, error) {
+	lock, err := s.SigningLock(set)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("validator key of set %s is not locked", set)
+	}
+
+	now := time.Now().UTC()
+	lock.Released = &now
+	lock.State = later(lock.State, state)
+	return lock, s.writeSigningLock(set, lock)
+}
+
+// Signing guards a validator key against being run by two nodes while it is deployed.
+type Signing struct {
+	Store *Store
+	// Target is the container the key is deployed to.
+	Target Holder
+	// Known are the nodes that may run the key. None of them but the target may run it.
+	Known []inventory.Node
+	// MoveFrom is the name of the known node the key moves away from. It is stopped and its
+	// sign state is carried over to the target.
+	MoveFrom string
+}
+
+// Deploy pushes the keys of b into the sekaid home of cli, see Push, under the signing lock
+// of the validator key:
+//   - a key locked by another node is only deployed when it moves from that node,
+//   - no known node but the one it moves from may run the key, checked over RPC and, for nodes
+//     whose RPC does not answer, on their containers,
+//   - once all of the above passed, the node it moves from is stopped and its
+//     priv_validator_state.json is carried over,
+//   - the target is refused when its last signed state is behind the latest one known.
+//
+// The lock is then taken by the target. Sets without a validator key are pushed as they are.
+func (s Signing) Deploy(ctx context.Context, cli *sekai.CLI, b *Bundle, replace bool, rec *audit.Recorder) error {
+	key, ok := b.Record(ValidatorKey)
+	if !ok {
+		return Push(ctx, cli, b, replace, rec)
+	}
+
+	state, err := s.check(ctx, b.Set, key, rec)
+	detail := fmt.Sprintf("set %s, %s", b.Set, key.Fingerprint)
+	if state != nil {
+		detail += ", last signed " + state.String()
+	}
+	if recErr := rec.Record("signing check", detail, err); recErr != nil {
+		return recErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := Push(ctx, cli, b, replace, rec); err != nil {
+		return err
+	}
+
+	state, err = carry(ctx, cli, state)
+	detail = "no sign state known"
+	if state != nil {
+		detail = state.String()
+	}
+	if recErr := rec.Record("carry sign state", detail, err); recErr != nil {
+		return recErr
+	}
+	if err != nil {
+		return err
+	}
+
+	lock := &Lock{Fingerprint: key.Fingerprint, Holder: s.Target, Acquired: time.Now().UTC(), State: state}
+	err = s.Store.writeSigningLock(b.Set, lock)
+	if recErr := rec.Record("signing lock", "held by "+s.Target.String(), err); recErr != nil {
+		return recErr
+	}
+	return err
+}
+
+// check verifies that the key may be deployed to the target and returns the latest sign
+// state of the key, nil when none is known. Every other check runs before the node the key
+// moves from is stopped, so a refused deploy leaves that node running.
+func (s Signing) check(ctx context.Context, set string, key Record, rec *audit.Recorder) (*SignState, error) {
+	lock, err := s.Store.SigningLock(set)
+	if err != nil {
+		return nil, err
+	}
+	var state *SignState
+	if lock != nil {
+		if lock.Fingerprint != key.Fingerprint {
+			return nil, fmt.Errorf("signing lock of set %s is for key %s, the set holds %s", set, lock.Fingerprint, key.Fingerprint)
+		}
+		state = lock.State
+	}
+
+	var source *inventory.Node
+	for i, n := range s.Known {
+		if n.Name == s.MoveFrom {
+			source = &s.Known[i]
+		}
+	}
+	if s.MoveFrom != "" && source == nil {
+		return nil, fmt.Errorf("node %s to move the key from is not in the inventory", s.MoveFrom)
+	}
+
+	var sourceHolder *Holder
+	var sourceDM *docker.DockerManager
+	for _, n := range s.Known {
+		dm, err := n.DockerManager()
+		if err != nil {
+			if source != nil && n.Name == source.Name {
+				return nil, err
+			}
+			dm = nil
+		}
+		if dm != nil {
+			holder := Holder{Container: n.ContainerName(), Daemon: dm.DaemonHostname()}
+			if holder == s.Target {
+				continue
+			}
+			if source != nil && n.Name == source.Name {
+				sourceHolder, sourceDM = &holder, dm
+				continue
+			}
+		}
+
+		runs, how, err := runsKey(ctx, n, dm, key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify that node %s does not run validator key %s: %w", n.Name, key.Fingerprint, err)
+		}
+		if runs {
+			return nil, fmt.Errorf("node %s runs validator key %s (%s), stop it or move the key with --move-from=%s", n.Name, key.Fingerprint, how, n.Name)
+		}
+	}
+
+	if lock != nil && lock.Released == nil && lock.Holder != s.Target && (sourceHolder == nil || *sourceHolder != lock.Holder) {
+		return nil, fmt.Errorf("validator key %s of set %s is locked by %s since %s: move it from that node with --move-from, or release the lock with `custody release` once it is confirmed down",
+			key.Fingerprint, set, lock.Holder, lock.Acquired.Format(time.RFC3339))
+	}
+
+	if sourceHolder != nil {
+		sourceState, err := stopSource(ctx, *source, sourceDM, key, rec)
+		if err != nil {
+			return nil, err
+		}
+		state = later(state, sourceState)
+	}
+
+	return state, nil
+}
+
+// runsKey reports whether a node runs a validator key and how that was found out. The RPC
+// is asked first, a node that does not answer is checked on its container. dm may be nil
+// when the node's Docker daemon is not reachable.
+func runsKey(ctx context.Context, n inventory.Node, dm *docker.DockerManager, key Record) (bool, string, error) {
+	rpcCtx, cancel := context.WithTimeout(ctx, rpcCheckTimeout)
+	status, rpcErr := tendermint.NewClient(n.RPC).Status(rpcCtx)
+	cancel()
+	if rpcErr == nil {
+		return status.ValidatorInfo.PubKey.Value == key.PubKey, "reported by its RPC", nil
+	}
+	if dm == nil {
+		return false, "", fmt.Errorf("RPC and Docker daemon unreachable: %w", rpcErr)
+	}
+
+	container := n.ContainerName()
+	exists, err := dm.ContainerExists(ctx, container)
+	if err != nil {
+		return false, "", err
+	}
+	if !exists {
+		return false, "", nil
+	}
+	running, err := dm.IsRunning(ctx, container)
+	if err != nil {
+		return false, "", err
+	}
+	data, err := dm.ReadFile(ctx, container, sekai.NewCLI(dm, container, "").ConfigPath(keyFiles[ValidatorKey]))
+	if docker.IsNotFound(err) {
+		// A container without a validator key cannot sign.
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	current, err := Inspect(ValidatorKey, data)
+	if err != nil {
+		return false, "", err
+	}
+	if current.Fingerprint != key.Fingerprint {
+		return false, "", nil
+	}
+	if !running {
+		log.Warnf("Stopped container %s of node %s holds validator key %s, do not start it again", container, n.Name, key.Fingerprint)
+		return false, "", nil
+	}
+	return true, "found in its running container " + container, nil
+}
+
+// stopSource stops the node a key moves from, confirms that it stopped signing and returns
+// its last sign state.
+func stopSource(ctx context.Context, n inventory.Node, dm *docker.DockerManager, key Record, rec *audit.Recorder) (*SignState, error) {
+	container := n.ContainerName()
+	running, err := dm.IsRunning(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		log.Infof("Stopping %s to move validator key %s away from it...", n.Name, key.Fingerprint)
+		err := dm.StopContainer(ctx, container, 30*time.Second)
+		if recErr := rec.Record("stop source", n.Name, err); recErr != nil {
+			return nil, recErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if runs, how, err := runsKey(ctx, n, dm, key); err != nil || runs {
+		if err == nil {
+			err = fmt.Errorf("it still runs the key (%s)", how)
+		}
+		return nil, fmt.Errorf("cannot confirm that node %s stopped signing: %w", n.Name, err)
+	}
+
+	cli := sekai.NewCLI(dm, container, "")
+	data, err := dm.ReadFile(ctx, container, cli.Home+"/data/priv_validator_state.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sign state of node %s: %w", n.Name, err)
+	}
+	state, err := ParseSignState(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Node %s last signed at %s", n.Name, state)
+
+	return state, nil
+}
+
+// carry writes state into the home of cli unless the home already holds a later one, and
+// returns the state the home ends up with. It fails when that state is behind state.
+func carry(ctx context.Context, cli *sekai.CLI, state *SignState) (*SignState, error) {
+	path := cli.Home + "/data/priv_validator_state.json"
+	current, err := readSignState(ctx, cli, path)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || (current != nil && !current.Before(*state)) {
+		return current, nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sign state: %w", err)
+	}
+	if _, err := cli.Shell(ctx, "mkdir -p "+cli.Home+"/data"); err != nil {
+		return nil, err
+	}
+	if err := cli.DM.WriteFile(ctx, cli.Container, path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	written, err := readSignState(ctx, cli, path)
+	if err != nil {
+		return nil, err
+	}
+	if written == nil || written.Before(*state) {
+		return nil, fmt.Errorf("last signed state of %s is behind %s, refusing to start it", cli.Container, state)
+	}
+	return written, nil
+}
+
+// readSignState returns the sign state at path, nil when the file does not exist.
+func readSignState(ctx context.Context, cli *sekai.CLI, path string) (*SignState, error) {
+	exists, err := cli.FileExists(ctx, path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	data, err := cli.DM.ReadFile(ctx, cli.Container, path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignState(data)
+}
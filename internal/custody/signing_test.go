@@ -0,0 +1,296 @@
+package custody
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+func TestSignStateBefore(t *testing.T) {
+	tests := []struct {
+		name   string
+		s, o   SignState
+		before bool
+	}{
+		{name: "lower height", s: SignState{Height: 9, Round: 5, Step: 3}, o: SignState{Height: 10}, before: true},
+		{name: "higher height", s: SignState{Height: 11}, o: SignState{Height: 10, Round: 5, Step: 3}},
+		{name: "lower round", s: SignState{Height: 10, Round: 0, Step: 3}, o: SignState{Height: 10, Round: 1}, before: true},
+		{name: "lower step", s: SignState{Height: 10, Round: 1, Step: 2}, o: SignState{Height: 10, Round: 1, Step: 3}, before: true},
+		{name: "equal", s: SignState{Height: 10, Round: 1, Step: 3}, o: SignState{Height: 10, Round: 1, Step: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.Before(tt.o); got != tt.before {
+				t.Fatalf("%s Before(%s) = %t, want %t", tt.s, tt.o, got, tt.before)
+			}
+		})
+	}
+}
+
+func TestParseSignState(t *testing.T) {
+	s, err := ParseSignState([]byte(`{"height":"120","round":1,"step":3,"signature":"c2ln"}`))
+	if err != nil {
+		t.Fatalf("ParseSignState() error: %v", err)
+	}
+	if *s != (SignState{Height: 120, Round: 1, Step: 3, Signature: "c2ln"}) {
+		t.Fatalf("ParseSignState() = %+v", s)
+	}
+}
+
+// validatorKey returns a new priv_validator_key.json and its record.
+func validatorKey(t *testing.T) ([]byte, Record) {
+	secret, err := GenerateValidatorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := Inspect(ValidatorKey, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, rec
+}
+
+// rpcRunning returns the address of a fake RPC of a node running the validator key pubKey.
+func rpcRunning(t *testing.T, pubKey string) string {
+	var n tmfake.Node
+	n.Status.ValidatorInfo.PubKey = tendermint.PubKey{Type: typePubKeyEd25519, Value: pubKey}
+	rpc := tmfake.NewServer(n)
+	t.Cleanup(rpc.Close)
+	return rpc.URL()
+}
+
+func TestSigningCheck(t *testing.T) {
+	// The Docker daemons of the known nodes are unreachable: a check touching one of them,
+	// e.g. to stop the node the key moves from, fails with a connection error.
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:1")
+	daemon := "127.0.0.1"
+	_, key := validatorKey(t)
+	_, other := validatorKey(t)
+	target := Holder{Container: "validator-2", Daemon: daemon}
+
+	tests := []struct {
+		name     string
+		lock     *Lock
+		known    []inventory.Node
+		moveFrom string
+		state    *SignState
+		err      string
+	}{
+		{name: "first deploy"},
+		{
+			name:  "other key running elsewhere",
+			known: []inventory.Node{{Name: "validator-1", Container: "validator-1", RPC: rpcRunning(t, other.PubKey)}},
+		},
+		{
+			name:  "redeploy to the holder",
+			lock:  &Lock{Fingerprint: key.Fingerprint, Holder: target, State: &SignState{Height: 100}},
+			known: []inventory.Node{{Name: "validator-2", Container: "validator-2", RPC: rpcRunning(t, key.PubKey)}},
+			state: &SignState{Height: 100},
+		},
+		{
+			name:  "released lock",
+			lock:  &Lock{Fingerprint: key.Fingerprint, Holder: Holder{Container: "validator-1", Daemon: daemon}, Released: &time.Time{}, State: &SignState{Height: 90}},
+			state: &SignState{Height: 90},
+		},
+		{
+			name: "lock of another key",
+			lock: &Lock{Fingerprint: other.Fingerprint, Holder: target},
+			err:  "signing lock of set validator is for key " + other.Fingerprint,
+		},
+		{
+			name: "locked by another node",
+			lock: &Lock{Fingerprint: key.Fingerprint, Holder: Holder{Container: "validator-1", Daemon: daemon}},
+			err:  "is locked by validator-1 on 127.0.0.1",
+		},
+		{
+			name:  "key running on another node",
+			known: []inventory.Node{{Name: "validator-1", Container: "validator-1", RPC: rpcRunning(t, key.PubKey)}},
+			err:   "node validator-1 runs validator key " + key.Fingerprint + " (reported by its RPC)",
+		},
+		{
+			name:     "move from a node that is not known",
+			moveFrom: "validator-9",
+			err:      "node validator-9 to move the key from is not in the inventory",
+		},
+		{
+			name: "refused move leaves the source running",
+			lock: &Lock{Fingerprint: key.Fingerprint, Holder: Holder{Container: "validator-1", Daemon: daemon}},
+			known: []inventory.Node{
+				{Name: "validator-1", Container: "validator-1", RPC: rpcRunning(t, key.PubKey)},
+				{Name: "validator-3", Container: "validator-3", RPC: rpcRunning(t, key.PubKey)},
+			},
+			moveFrom: "validator-1",
+			err:      "node validator-3 runs validator key",
+		},
+		{
+			name: "move stops the source last",
+			lock: &Lock{Fingerprint: key.Fingerprint, Holder: Holder{Container: "validator-1", Daemon: daemon}},
+			known: []inventory.Node{
+				{Name: "validator-1", Container: "validator-1", RPC: rpcRunning(t, key.PubKey)},
+				{Name: "validator-3", Container: "validator-3", RPC: rpcRunning(t, other.PubKey)},
+			},
+			moveFrom: "validator-1",
+			err:      "failed to inspect container validator-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Signing{Store: NewStore(t.TempDir()), Target: target, Known: tt.known, MoveFrom: tt.moveFrom}
+			if tt.lock != nil {
+				if err := os.MkdirAll(filepath.Join(s.Store.Dir, "validator"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Store.writeSigningLock("validator", tt.lock); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			state, err := s.check(context.Background(), "validator", key, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("check() = %v, %v, want error containing %q", state, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("check() error: %v", err)
+			}
+			if (state == nil) != (tt.state == nil) || (state != nil && *state != *tt.state) {
+				t.Fatalf("check() = %v, want %v", state, tt.state)
+			}
+		})
+	}
+}
+
+// newHome returns a running container with a sekaid home holding the files.
+func newHome(t *testing.T, files map[string]string) (*fake.Client, *sekai.CLI) {
+	f := fake.New()
+	f.AddImage("sekai")
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		if cmd[0] == "test" {
+			if _, ok := f.File(containerName, cmd[len(cmd)-1]); !ok {
+				return docker.ExecResult{ExitCode: 1}
+			}
+		}
+		return docker.ExecResult{}
+	}
+	dm := docker.NewDockerManagerWithClient(f)
+	if err := dm.StartToolbox(context.Background(), "validator-2", "sekai", nil); err != nil {
+		t.Fatalf("StartToolbox() error: %v", err)
+	}
+	for path, content := range files {
+		f.WriteFile("validator-2", path, []byte(content))
+	}
+	return f, sekai.NewCLI(dm, "validator-2", "/sekai")
+}
+
+func TestCarry(t *testing.T) {
+	const statePath = "/sekai/data/priv_validator_state.json"
+	tests := []struct {
+		name    string
+		current string
+		state   *SignState
+		want    *SignState
+		written bool
+	}{
+		{name: "nothing known"},
+		{name: "fresh home", state: &SignState{Height: 100, Round: 1, Step: 3}, want: &SignState{Height: 100, Round: 1, Step: 3}, written: true},
+		{name: "home behind", current: `{"height":"90","round":0,"step":3}`, state: &SignState{Height: 100}, want: &SignState{Height: 100}, written: true},
+		{name: "home ahead", current: `{"height":"110","round":0,"step":3}`, state: &SignState{Height: 100}, want: &SignState{Height: 110, Step: 3}},
+		{name: "home only", current: `{"height":"110","round":0,"step":3}`, want: &SignState{Height: 110, Step: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			if tt.current != "" {
+				files[statePath] = tt.current
+			}
+			f, cli := newHome(t, files)
+
+			state, err := carry(context.Background(), cli, tt.state)
+			if err != nil {
+				t.Fatalf("carry() error: %v", err)
+			}
+			if (state == nil) != (tt.want == nil) || (state != nil && *state != *tt.want) {
+				t.Fatalf("carry() = %v, want %v", state, tt.want)
+			}
+			data, ok := f.File("validator-2", statePath)
+			if tt.written {
+				var written SignState
+				if err := json.Unmarshal(data, &written); err != nil || written != *tt.state {
+					t.Fatalf("written state = %s, want %s", data, tt.state)
+				}
+			} else if string(data) != tt.current || ok != (tt.current != "") {
+				t.Fatalf("state file = %q, want it untouched", data)
+			}
+		})
+	}
+}
+
+func TestRunsKey(t *testing.T) {
+	secret, key := validatorKey(t)
+	rpc := tmfake.NewServer(tmfake.Node{})
+	down := rpc.URL()
+	rpc.Close()
+
+	tests := []struct {
+		name    string
+		file    string
+		stopped bool
+		runs    bool
+		err     string
+	}{
+		{name: "no key file"},
+		{name: "other key", file: func() string { s, _ := validatorKey(t); return string(s) }()},
+		{name: "running with the key", file: string(secret), runs: true},
+		{name: "stopped with the key", file: string(secret), stopped: true},
+		{name: "damaged key file", file: `{"address":"00"}`, err: "invalid priv_validator_key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			if tt.file != "" {
+				files["/sekai/config/priv_validator_key.json"] = tt.file
+			}
+			f, cli := newHome(t, files)
+			if tt.stopped {
+				f.Exit("validator-2", 0)
+			}
+
+			n := inventory.Node{Name: "validator-2", Container: "validator-2", RPC: down}
+			runs, how, err := runsKey(context.Background(), n, cli.DM, key)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("runsKey() = %t, %v, want error containing %q", runs, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runsKey() error: %v", err)
+			}
+			if runs != tt.runs {
+				t.Fatalf("runsKey() = %t (%s), want %t", runs, how, tt.runs)
+			}
+		})
+	}
+
+	n := inventory.Node{Name: "validator-2", RPC: down}
+	if _, _, err := runsKey(context.Background(), n, nil, key); err == nil || !strings.Contains(err.Error(), "RPC and Docker daemon unreachable") {
+		t.Fatalf("runsKey() without RPC and daemon = %v", err)
+	}
+}
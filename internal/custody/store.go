@@ -0,0 +1,224 @@
+package custody
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// manifestFile holds the records of a key set.
+const manifestFile = "fingerprints.json"
+
+var setNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Store keeps key sets in a directory. Every set is a subdirectory holding one envelope per
+// key and the unencrypted records of the keys.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns `~/.kira2/keys`.
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "kira2-keys"
+	}
+	return filepath.Join(home, ".kira2", "keys")
+}
+
+// NewStore returns a Store in dir, DefaultDir when empty.
+func NewStore(dir string) *Store {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Store{Dir: dir}
+}
+
+func (s *Store) setDir(set string) (string, error) {
+	if !setNameRe.MatchString(set) {
+		return "", fmt.Errorf("invalid key set name %q", set)
+	}
+	return filepath.Join(s.Dir, set), nil
+}
+
+// Sets returns the names of the key sets in the store, sorted.
+func (s *Store) Sets() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store %s: %w", s.Dir, err)
+	}
+
+	var sets []string
+	for _, e := range entries {
+		if e.IsDir() && setNameRe.MatchString(e.Name()) {
+			sets = append(sets, e.Name())
+		}
+	}
+	sort.Strings(sets)
+	return sets, nil
+}
+
+// Records returns the records of the keys in a set, in the order of Kinds.
+func (s *Store) Records(set string) ([]Record, error) {
+	dir, err := s.setDir(set)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records of key set %s: %w", set, err)
+	}
+
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode records of key set %s: %w", set, err)
+	}
+	return records, nil
+}
+
+// Put encrypts secret with passphrase and adds it to a set with its record. A key that is
+// already in the set is never replaced: losing a validator key cannot be undone.
+func (s *Store) Put(set string, secret []byte, rec Record, passphrase string) error {
+	if len(passphrase) < MinPassphrase {
+		return fmt.Errorf("passphrase has to be at least %d characters", MinPassphrase)
+	}
+	dir, err := s.setDir(set)
+	if err != nil {
+		return err
+	}
+	records, err := s.Records(set)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.Kind == rec.Kind {
+			return fmt.Errorf("key set %s already holds a %s (%s)", set, rec.Kind, r.Fingerprint)
+		}
+	}
+
+	sealed, err := seal(rec.Kind, secret, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key set %s: %w", set, err)
+	}
+	if err := writeFile(filepath.Join(dir, string(rec.Kind)+".enc"), sealed); err != nil {
+		return err
+	}
+
+	if rec.Created.IsZero() {
+		rec.Created = time.Now().UTC()
+	}
+	records = append(records, rec)
+	sort.SliceStable(records, func(i, j int) bool { return kindIndex(records[i].Kind) < kindIndex(records[j].Kind) })
+	manifest, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode records of key set %s: %w", set, err)
+	}
+
+	return writeFile(filepath.Join(dir, manifestFile), manifest)
+}
+
+// Bundle is a key set decrypted for a deployment.
+type Bundle struct {
+	Set     string
+	Records []Record
+	secrets map[Kind][]byte
+}
+
+// Record returns the record of a kind of key in the bundle.
+func (b *Bundle) Record(kind Kind) (Record, bool) {
+	for _, r := range b.Records {
+		if r.Kind == kind {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// Open decrypts every key of a set. The validator and node keys are checked against their
+// recorded fingerprints, so a replaced envelope is noticed before it reaches a node.
+func (s *Store) Open(set, passphrase string) (*Bundle, error) {
+	dir, err := s.setDir(set)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.Records(set)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("key set %s holds no keys", set)
+	}
+
+	b := &Bundle{Set: set, Records: records, secrets: map[Kind][]byte{}}
+	for _, rec := range records {
+		sealed, err := os.ReadFile(filepath.Join(dir, string(rec.Kind)+".enc"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s key of set %s: %w", rec.Kind, set, err)
+		}
+		secret, err := open(rec.Kind, sealed, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s key of set %s: %w", rec.Kind, set, err)
+		}
+		if rec.Kind != OperatorKey {
+			got, err := Inspect(rec.Kind, secret)
+			if err != nil {
+				return nil, err
+			}
+			if got.Fingerprint != rec.Fingerprint {
+				return nil, fmt.Errorf("%s key of set %s has fingerprint %s, recorded is %s", rec.Kind, set, got.Fingerprint, rec.Fingerprint)
+			}
+		}
+		b.secrets[rec.Kind] = secret
+	}
+
+	return b, nil
+}
+
+// writeFile replaces path with data through a temporary file, readable by the owner only.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func kindIndex(kind Kind) int {
+	for i, k := range Kinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(Kinds)
+}
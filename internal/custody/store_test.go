@@ -0,0 +1,167 @@
+package custody
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// putKeys stores a new validator and node key in set and returns their secrets.
+func putKeys(t *testing.T, s *Store, set string) map[Kind][]byte {
+	secrets := map[Kind][]byte{}
+	for kind, generate := range map[Kind]func() ([]byte, error){ValidatorKey: GenerateValidatorKey, NodeKey: GenerateNodeKey} {
+		secret, err := generate()
+		if err != nil {
+			t.Fatalf("generate %s error: %v", kind, err)
+		}
+		rec, err := Inspect(kind, secret)
+		if err != nil {
+			t.Fatalf("Inspect(%s) error: %v", kind, err)
+		}
+		rec.Source = SourceGenerated
+		if err := s.Put(set, secret, rec, passphrase); err != nil {
+			t.Fatalf("Put(%s) error: %v", kind, err)
+		}
+		secrets[kind] = secret
+	}
+	return secrets
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := NewStore(t.TempDir())
+	secrets := putKeys(t, s, "validator-1")
+
+	sets, err := s.Sets()
+	if err != nil || len(sets) != 1 || sets[0] != "validator-1" {
+		t.Fatalf("Sets() = %v, %v, want validator-1", sets, err)
+	}
+	records, err := s.Records("validator-1")
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(records) != 2 || records[0].Kind != ValidatorKey || records[1].Kind != NodeKey || records[0].Created.IsZero() {
+		t.Fatalf("Records() = %+v, want the validator key then the node key with a creation time", records)
+	}
+	for _, name := range []string{"priv_validator_key.enc", "node_key.enc", manifestFile} {
+		info, err := os.Stat(filepath.Join(s.Dir, "validator-1", name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("%s has mode %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+
+	b, err := s.Open("validator-1", passphrase)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	for kind, secret := range secrets {
+		if string(b.secrets[kind]) != string(secret) {
+			t.Fatalf("%s = %q, want the stored secret", kind, b.secrets[kind])
+		}
+	}
+	if rec, ok := b.Record(NodeKey); !ok || rec.Fingerprint != records[1].Fingerprint {
+		t.Fatalf("Record(node_key) = %+v, %t", rec, ok)
+	}
+
+	if _, err := s.Open("validator-1", "wrong horse battery"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("Open() with a wrong passphrase = %v", err)
+	}
+}
+
+func TestStorePut(t *testing.T) {
+	s := NewStore(t.TempDir())
+	putKeys(t, s, "validator-1")
+	secret, err := GenerateValidatorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := Inspect(ValidatorKey, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		set        string
+		passphrase string
+		err        string
+	}{
+		{name: "existing kind", set: "validator-1", passphrase: passphrase, err: "key set validator-1 already holds a priv_validator_key"},
+		{name: "short passphrase", set: "validator-2", passphrase: "short", err: "at least 12 characters"},
+		{name: "invalid set name", set: "../validator", passphrase: passphrase, err: `invalid key set name "../validator"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Put(tt.set, secret, rec, tt.passphrase)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Put() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+
+	records, _ := s.Records("validator-1")
+	if records[0].Fingerprint == rec.Fingerprint {
+		t.Fatal("Put() replaced the validator key of validator-1")
+	}
+}
+
+func TestStoreOpenTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		err    string
+	}{
+		{
+			name: "swapped envelopes",
+			tamper: func(t *testing.T, dir string) {
+				node, err := os.ReadFile(filepath.Join(dir, "node_key.enc"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "priv_validator_key.enc"), node, 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "failed to decrypt priv_validator_key key of set validator-1: wrong passphrase or corrupted priv_validator_key",
+		},
+		{
+			name: "tampered fingerprint",
+			tamper: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, manifestFile)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var records []Record
+				if err := json.Unmarshal(data, &records); err != nil {
+					t.Fatal(err)
+				}
+				records[1].Fingerprint = Fingerprint([]byte("another key"))
+				if data, err = json.Marshal(records); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "node_key key of set validator-1 has fingerprint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(t.TempDir())
+			putKeys(t, s, "validator-1")
+			tt.tamper(t, filepath.Join(s.Dir, "validator-1"))
+
+			if _, err := s.Open("validator-1", passphrase); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Open() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
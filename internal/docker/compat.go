@@ -0,0 +1,163 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/go-units"
+)
+
+// MinAPIVersion is the oldest Docker Engine API the launcher supports (Docker 20.10).
+const MinAPIVersion = "1.41"
+
+// CompatibilityReport describes the Docker daemon and whether it can run the launcher's node specs.
+type CompatibilityReport struct {
+	ServerVersion string `json:"server_version"`
+	APIVersion    string `json:"api_version"`
+	MinAPIVersion string `json:"min_api_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	StorageDriver string `json:"storage_driver"`
+	CgroupDriver  string `json:"cgroup_driver"`
+	CgroupVersion string `json:"cgroup_version"`
+	Rootless      bool   `json:"rootless"`
+	DockerRootDir string `json:"docker_root_dir"`
+	// DiskAvailableBytes is the free space of DockerRootDir, or -1 when the daemon is remote.
+	DiskAvailableBytes int64    `json:"disk_available_bytes"`
+	LogDrivers         []string `json:"log_drivers"`
+	MemoryLimit        bool     `json:"memory_limit"`
+	CPUCfsQuota        bool     `json:"cpu_cfs_quota"`
+	CPUShares          bool     `json:"cpu_shares"`
+	PidsLimit          bool     `json:"pids_limit"`
+	Problems           []string `json:"problems"`
+	Compatible         bool     `json:"compatible"`
+}
+
+// CheckCompatibility queries the Docker daemon and checks it against the minimum supported
+// API version and the features the given node specs need.
+// ctx: The context.Context to use for the daemon queries.
+// specs: The NodeSpecs that will run on the daemon. May be empty.
+// Returns the report and an error if the daemon cannot be queried. An incompatible daemon is
+// not an error, check CompatibilityReport.Compatible and CompatibilityReport.Problems instead.
+func (dm *DockerManager) CheckCompatibility(ctx context.Context, specs []NodeSpec) (*CompatibilityReport, error) {
+	version, err := dm.cli.ServerVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get docker server version: %w", err)
+	}
+
+	info, err := dm.cli.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get docker info: %w", err)
+	}
+
+	report := &CompatibilityReport{
+		ServerVersion:      version.Version,
+		APIVersion:         version.APIVersion,
+		MinAPIVersion:      MinAPIVersion,
+		OS:                 version.Os,
+		Arch:               version.Arch,
+		StorageDriver:      info.Driver,
+		CgroupDriver:       info.CgroupDriver,
+		CgroupVersion:      info.CgroupVersion,
+		Rootless:           isRootless(info),
+		DockerRootDir:      info.DockerRootDir,
+		DiskAvailableBytes: -1,
+		LogDrivers:         info.Plugins.Log,
+		MemoryLimit:        info.MemoryLimit,
+		CPUCfsQuota:        info.CPUCfsQuota,
+		CPUShares:          info.CPUShares,
+		PidsLimit:          info.PidsLimit,
+	}
+
+	if strings.HasPrefix(dm.cli.DaemonHost(), "unix://") {
+		if available, err := diskAvailable(info.DockerRootDir); err == nil {
+			report.DiskAvailableBytes = available
+		} else {
+			log.Printf("Failed to check free disk space of %s: %s", info.DockerRootDir, err)
+		}
+	}
+
+	if versions.LessThan(version.APIVersion, MinAPIVersion) {
+		report.Problems = append(report.Problems, fmt.Sprintf("docker API version %s (docker %s) is older than the minimum supported %s", version.APIVersion, version.Version, MinAPIVersion))
+	}
+	for _, spec := range specs {
+		report.Problems = append(report.Problems, report.specProblems(spec)...)
+	}
+	report.Compatible = len(report.Problems) == 0
+
+	return report, nil
+}
+
+// specProblems lists the features spec needs that the daemon lacks.
+func (r *CompatibilityReport) specProblems(spec NodeSpec) []string {
+	var problems []string
+	res := spec.Resources
+
+	if driver := spec.Logging.Driver; driver != "" && !contains(r.LogDrivers, driver) {
+		problems = append(problems, fmt.Sprintf("node %s: log driver %q is not available, daemon has: %s", spec.Name, driver, strings.Join(r.LogDrivers, ", ")))
+	}
+	if (res.Memory != "" || res.MemoryReservation != "") && !r.MemoryLimit {
+		problems = append(problems, fmt.Sprintf("node %s: daemon does not support memory limits", spec.Name))
+	}
+	if (res.CPUQuota != 0 || res.CPUs != 0) && !r.CPUCfsQuota {
+		problems = append(problems, fmt.Sprintf("node %s: daemon does not support CPU quotas", spec.Name))
+	}
+	if res.CPUShares != 0 && !r.CPUShares {
+		problems = append(problems, fmt.Sprintf("node %s: daemon does not support CPU shares", spec.Name))
+	}
+	if res.PidsLimit != 0 && !r.PidsLimit {
+		problems = append(problems, fmt.Sprintf("node %s: daemon does not support pids limits", spec.Name))
+	}
+
+	return problems
+}
+
+// String renders the report as human readable text.
+func (r *CompatibilityReport) String() string {
+	disk := "free space unknown on remote daemon"
+	if r.DiskAvailableBytes >= 0 {
+		disk = units.BytesSize(float64(r.DiskAvailableBytes)) + " available"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Server version:  %s (%s/%s)\n", r.ServerVersion, r.OS, r.Arch)
+	fmt.Fprintf(&b, "API version:     %s (minimum %s)\n", r.APIVersion, r.MinAPIVersion)
+	fmt.Fprintf(&b, "Storage driver:  %s\n", r.StorageDriver)
+	fmt.Fprintf(&b, "Cgroup:          %s (v%s)\n", r.CgroupDriver, r.CgroupVersion)
+	fmt.Fprintf(&b, "Rootless:        %t\n", r.Rootless)
+	fmt.Fprintf(&b, "Docker root:     %s (%s)\n", r.DockerRootDir, disk)
+	fmt.Fprintf(&b, "Log drivers:     %s\n", strings.Join(r.LogDrivers, ", "))
+	fmt.Fprintf(&b, "Resource limits: memory=%t cpu-quota=%t cpu-shares=%t pids=%t\n", r.MemoryLimit, r.CPUCfsQuota, r.CPUShares, r.PidsLimit)
+	if r.Compatible {
+		b.WriteString("Compatible:      yes\n")
+	} else {
+		b.WriteString("Compatible:      no\n")
+		for _, problem := range r.Problems {
+			fmt.Fprintf(&b, "  - %s\n", problem)
+		}
+	}
+
+	return b.String()
+}
+
+func isRootless(info types.Info) bool {
+	for _, opt := range info.SecurityOptions {
+		if strings.Contains(opt, "name=rootless") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package docker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	limited := validSpec()
+	limited.Resources = docker.ResourceLimits{CPUShares: 512, CPUQuota: 50000, Memory: "1g", PidsLimit: 100}
+
+	tests := []struct {
+		name     string
+		modify   func(f *fake.Client)
+		specs    []docker.NodeSpec
+		problems []string
+	}{
+		{name: "current daemon", modify: func(f *fake.Client) {}, specs: []docker.NodeSpec{validSpec(), limited}},
+		{name: "minimum api version", modify: func(f *fake.Client) { f.Version.APIVersion = docker.MinAPIVersion }},
+		{
+			name:     "old api version",
+			modify:   func(f *fake.Client) { f.Version.Version, f.Version.APIVersion = "19.03.15", "1.40" },
+			problems: []string{"docker API version 1.40 (docker 19.03.15) is older than the minimum supported 1.41"},
+		},
+		{
+			name:     "missing log driver",
+			modify:   func(f *fake.Client) { f.DaemonInfo.Plugins.Log = []string{"journald"} },
+			specs:    []docker.NodeSpec{validSpec()},
+			problems: []string{`node sekai: log driver "json-file" is not available, daemon has: journald`},
+		},
+		{
+			name: "no cgroup limits",
+			modify: func(f *fake.Client) {
+				f.DaemonInfo.MemoryLimit, f.DaemonInfo.CPUCfsQuota, f.DaemonInfo.CPUShares, f.DaemonInfo.PidsLimit = false, false, false, false
+			},
+			specs: []docker.NodeSpec{limited, {Name: "interx", Image: image}},
+			problems: []string{
+				"node sekai: daemon does not support memory limits",
+				"node sekai: daemon does not support CPU quotas",
+				"node sekai: daemon does not support CPU shares",
+				"node sekai: daemon does not support pids limits",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fake.New()
+			tt.modify(f)
+			report, err := docker.NewDockerManagerWithClient(f).CheckCompatibility(context.Background(), tt.specs)
+			if err != nil {
+				t.Fatalf("CheckCompatibility() error: %v", err)
+			}
+			if report.Compatible != (len(tt.problems) == 0) {
+				t.Fatalf("Compatible = %t with problems %q", report.Compatible, report.Problems)
+			}
+			if strings.Join(report.Problems, "\n") != strings.Join(tt.problems, "\n") {
+				t.Fatalf("Problems = %q, want %q", report.Problems, tt.problems)
+			}
+			if report.DiskAvailableBytes != -1 {
+				t.Fatalf("DiskAvailableBytes = %d, want -1 for a daemon that is not local", report.DiskAvailableBytes)
+			}
+		})
+	}
+}
+
+func TestCompatibilityReportString(t *testing.T) {
+	f := fake.New()
+	f.Version.APIVersion = "1.40"
+	f.DaemonInfo.SecurityOptions = []string{"name=seccomp,profile=default", "name=rootless"}
+	report, err := docker.NewDockerManagerWithClient(f).CheckCompatibility(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("CheckCompatibility() error: %v", err)
+	}
+	if !report.Rootless {
+		t.Fatal("Rootless = false for a daemon with the rootless security option")
+	}
+
+	text := report.String()
+	for _, want := range []string{
+		"Server version:  24.0.2 (linux/amd64)",
+		"API version:     1.40 (minimum 1.41)",
+		"Docker root:     /var/lib/docker (free space unknown on remote daemon)",
+		"Rootless:        true",
+		"Compatible:      no\n  - docker API version 1.40",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("String() = %q, want it to contain %q", text, want)
+		}
+	}
+}
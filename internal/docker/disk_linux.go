@@ -0,0 +1,13 @@
+package docker
+
+import "syscall"
+
+// diskAvailable returns the bytes available to unprivileged users on the filesystem of path.
+func diskAvailable(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
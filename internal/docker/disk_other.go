@@ -0,0 +1,10 @@
+//go:build !linux
+
+package docker
+
+import "errors"
+
+// diskAvailable is only implemented on linux, where the launcher's nodes run.
+func diskAvailable(path string) (int64, error) {
+	return 0, errors.New("disk space check is not supported on this platform")
+}
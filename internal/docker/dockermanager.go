@@ -30,7 +30,7 @@ func (dc *DockerConfig) SetVersion(version string) {
 }
 
 type DockerManager struct {
-	Cli *client.Client
+	cli Client
 }
 
 // NewDockerManager creates a new DockerManager instance based on the provided configuration.
@@ -48,19 +48,54 @@ func NewDockerManager(r io.Reader) (*DockerManager, error) {
 		return nil, fmt.Errorf("Failed to decode config: %w", err)
 	}
 
-	cli, err := client.NewClientWithOpts(client.WithHost(config.Host), client.WithAPIVersionNegotiation(), client.WithTLSClientConfig(config.CacertPath, config.CertPath, config.KeyPath))
+	return NewDockerManagerFromConfig(config)
+}
 
-	// Add API version to config. For future use in debug log etc.
-	config.SetVersion(cli.ClientVersion())
-	log.Printf("Docker API versio set to: %v\n", config.APIVersion)
+// NewDockerManagerFromConfig creates a new DockerManager instance from an already decoded configuration.
+// TLS is only configured when at least one of the certificate paths is set, so an empty config
+// talks to the local daemon the same way the docker CLI does.
+// config: The DockerConfig describing the daemon to connect to.
+// Returns a new DockerManager instance and an error if there is an issue with creating the Docker client.
+func NewDockerManagerFromConfig(config DockerConfig) (*DockerManager, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	if config.Host != "" {
+		opts = append(opts, client.WithHost(config.Host))
+	} else {
+		opts = append(opts, client.FromEnv)
+	}
+	if config.CacertPath != "" || config.CertPath != "" || config.KeyPath != "" {
+		opts = append(opts, client.WithTLSClientConfig(config.CacertPath, config.CertPath, config.KeyPath))
+	}
 
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		log.Printf("Failed to create Docker client: %s", err)
 		return nil, fmt.Errorf("Failed to create Docker client: %w", err)
 	}
 
+	// Add API version to config. For future use in debug log etc.
+	config.SetVersion(cli.ClientVersion())
+	log.Printf("Docker API versio set to: %v\n", config.APIVersion)
+
 	log.Println("Successfully created DockerManager")
-	return &DockerManager{Cli: cli}, nil
+	return &DockerManager{cli: cli}, nil
+}
+
+// NewDockerManagerFromFile creates a new DockerManager instance from a JSON configuration file.
+// path: Path to the configuration file. When empty, the local daemon from the environment is used.
+// Returns a new DockerManager instance and an error if the file cannot be read or the client cannot be created.
+func NewDockerManagerFromFile(path string) (*DockerManager, error) {
+	if path == "" {
+		return NewDockerManagerFromConfig(DockerConfig{})
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open docker config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return NewDockerManager(f)
 }
 
 // VerifyDockerInstallation verifies if Docker is installed and running by pinging the Docker daemon.
@@ -68,7 +103,7 @@ func NewDockerManager(r io.Reader) (*DockerManager, error) {
 // Returns an error if the Docker daemon is not reachable or if there is an error in the ping operation.
 func (dm *DockerManager) VerifyDockerInstallation(ctx context.Context) error {
 	// Try to ping the Docker daemon to check if it's running
-	_, err := dm.Cli.Ping(ctx)
+	_, err := dm.cli.Ping(ctx)
 	if err != nil {
 		log.Println("Error pinging Docker daemon:", err)
 		return fmt.Errorf("Failed to ping Docker daemon: %w", err)
@@ -86,7 +121,7 @@ func (dm *DockerManager) VerifyDockerInstallation(ctx context.Context) error {
 // Returns an error if the image pull fails or if there is an error in copying the image pull output.
 func (dm *DockerManager) PullImage(ctx context.Context, imageName string) error {
 	options := types.ImagePullOptions{}
-	reader, err := dm.Cli.ImagePull(ctx, imageName, options)
+	reader, err := dm.cli.ImagePull(ctx, imageName, options)
 	if err != nil {
 		return fmt.Errorf("failed to pull image: %w", err)
 	}
@@ -118,18 +153,18 @@ func (dm *DockerManager) RunContainer(ctx context.Context, image string) error {
 		Tty:   false,
 	}
 
-	resp, err := dm.Cli.ContainerCreate(ctx, config, nil, nil, nil, "")
+	resp, err := dm.cli.ContainerCreate(ctx, config, nil, nil, nil, "")
 	if err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
-	if err := dm.Cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := dm.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
 		return fmt.Errorf("failed to start container: %w", err)
 	}
 
 	log.Printf("Container %s started", resp.ID)
 
-	statusCh, errCh := dm.Cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	statusCh, errCh := dm.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		if err != nil {
@@ -140,7 +175,7 @@ func (dm *DockerManager) RunContainer(ctx context.Context, image string) error {
 
 	log.Printf("Container %s finished", resp.ID)
 
-	out, err := dm.Cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
+	out, err := dm.cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
 	if err != nil {
 		return fmt.Errorf("failed to retrieve container logs: %w", err)
 	}
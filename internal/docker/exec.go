@@ -0,0 +1,249 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecResult is the output and exit code of a command executed in a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec runs a command in a running container and waits for it to finish.
+// ctx: The context.Context to use for the exec operations.
+// containerName: The name or ID of the container.
+// cmd: The command and its arguments.
+// Returns the output and exit code of the command. A non-zero exit code is not an error,
+// the error is only set when the command cannot be run at all.
+func (dm *DockerManager) Exec(ctx context.Context, containerName string, cmd []string) (ExecResult, error) {
+	resp, err := dm.cli.ContainerExecCreate(ctx, containerName, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("failed to create exec in container %s: %w", containerName, err)
+	}
+
+	attach, err := dm.cli.ContainerExecAttach(ctx, resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("failed to attach to exec in container %s: %w", containerName, err)
+	}
+	defer attach.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, attach.Reader); err != nil {
+		return ExecResult{}, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	inspect, err := dm.cli.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("failed to inspect exec in container %s: %w", containerName, err)
+	}
+
+	return ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: inspect.ExitCode}, nil
+}
+
+// IsNotFound reports whether err, wrapped or not, is the daemon reporting that a container,
+// a file in it or another object does not exist, e.g. an error of ReadFile for a missing file.
+func IsNotFound(err error) bool {
+	var notFound errdefs.ErrNotFound
+	return errors.As(err, &notFound)
+}
+
+// ReadFile reads a single file from a container. It works on stopped containers too.
+// ctx: The context.Context to use for the copy operation.
+// containerName: The name or ID of the container.
+// filePath: The absolute path of the file in the container.
+// Returns the content of the file and an error if it cannot be copied.
+func (dm *DockerManager) ReadFile(ctx context.Context, containerName, filePath string) ([]byte, error) {
+	file, err := dm.OpenFile(ctx, containerName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from container %s: %w", filePath, containerName, err)
+	}
+	return data, nil
+}
+
+// OpenFile streams a single file from a container without holding it in memory, for files
+// like exported states that can be gigabytes large. It works on stopped containers too.
+// ctx: The context.Context to use for the copy operation.
+// containerName: The name or ID of the container.
+// filePath: The absolute path of the file in the container.
+// Returns the content of the file, close it when done, and an error if it cannot be copied.
+func (dm *DockerManager) OpenFile(ctx context.Context, containerName, filePath string) (io.ReadCloser, error) {
+	reader, _, err := dm.cli.CopyFromContainer(ctx, containerName, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s from container %s: %w", filePath, containerName, err)
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			reader.Close()
+			return nil, fmt.Errorf("file %s not found in archive from container %s", filePath, containerName)
+		}
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("failed to read archive from container %s: %w", containerName, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, reader}, nil
+		}
+	}
+}
+
+// WriteFile writes a single file into a container, replacing an existing one.
+// ctx: The context.Context to use for the copy operation.
+// containerName: The name or ID of the container.
+// filePath: The absolute path of the file in the container. Its directory has to exist.
+// data: The content of the file.
+// mode: The permission bits of the file, e.g. 0600 for keys.
+// Returns an error if the file cannot be copied.
+func (dm *DockerManager) WriteFile(ctx context.Context, containerName, filePath string, data []byte, mode int64) error {
+	return dm.WriteFileFrom(ctx, containerName, filePath, bytes.NewReader(data), int64(len(data)), mode)
+}
+
+// WriteFileFrom streams size bytes of r into a file in a container, replacing an existing one.
+// ctx: The context.Context to use for the copy operation.
+// containerName: The name or ID of the container.
+// filePath: The absolute path of the file in the container. Its directory has to exist.
+// r: The content of the file.
+// size: The length of the content.
+// mode: The permission bits of the file.
+// Returns an error if the file cannot be copied or r is shorter than size.
+func (dm *DockerManager) WriteFileFrom(ctx context.Context, containerName, filePath string, r io.Reader, size, mode int64) error {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Name: path.Base(filePath), Mode: mode, Size: size})
+		if err != nil {
+			err = fmt.Errorf("failed to write archive header: %w", err)
+		} else if _, err = io.CopyN(tw, r, size); err != nil {
+			err = fmt.Errorf("failed to write archive: %w", err)
+		} else if err = tw.Close(); err != nil {
+			err = fmt.Errorf("failed to close archive: %w", err)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := dm.cli.CopyToContainer(ctx, containerName, path.Dir(filePath), pr, types.CopyToContainerOptions{})
+	// Unblock the writer if the copy ended before reading the whole archive.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to container %s: %w", filePath, containerName, err)
+	}
+
+	return nil
+}
+
+// StartToolbox starts an idle container from image that commands can be executed in with Exec.
+// The container mounts the given volumes and is labelled like a node so it shows up in listings.
+// ctx: The context.Context to use for the container operations.
+// name: The name of the toolbox container.
+// image: The image to run, usually the sekai image.
+// volumes: The volumes to mount.
+// Returns an error if the container cannot be created or started. Remove it with RemoveContainer.
+func (dm *DockerManager) StartToolbox(ctx context.Context, name, image string, volumes []VolumeMount) error {
+	spec := NodeSpec{
+		Name:       name,
+		Image:      image,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"trap 'exit 0' TERM INT; while true; do sleep 1; done"},
+		Volumes:    volumes,
+		Labels:     map[string]string{ToolboxLabel: "true"},
+	}
+	if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+		return err
+	}
+
+	return dm.StartContainer(ctx, name)
+}
+
+// DiskSpace is the capacity of the filesystem a path lives on.
+type DiskSpace struct {
+	TotalBytes int64
+	FreeBytes  int64
+}
+
+// DiskSpace returns the capacity of the filesystem filePath lives on, as seen from inside a
+// running container. For a path in a volume this is the disk of the Docker host.
+// ctx: The context.Context to use for the exec operation.
+// containerName: The name or ID of the container.
+// filePath: The absolute path in the container.
+// Returns an error if df fails or its output cannot be parsed.
+func (dm *DockerManager) DiskSpace(ctx context.Context, containerName, filePath string) (DiskSpace, error) {
+	res, err := dm.Exec(ctx, containerName, []string{"df", "-Pk", filePath})
+	if err != nil {
+		return DiskSpace{}, err
+	}
+	if res.ExitCode != 0 {
+		return DiskSpace{}, fmt.Errorf("df %s exited with code %d: %s", filePath, res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	// Filesystem 1024-blocks Used Available Capacity Mounted on
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 4 {
+		return DiskSpace{}, fmt.Errorf("unexpected output of df %s: %s", filePath, res.Stdout)
+	}
+	total, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return DiskSpace{}, fmt.Errorf("unexpected output of df %s: %w", filePath, err)
+	}
+	free, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return DiskSpace{}, fmt.Errorf("unexpected output of df %s: %w", filePath, err)
+	}
+
+	return DiskSpace{TotalBytes: total * 1024, FreeBytes: free * 1024}, nil
+}
+
+// DirSize returns the disk usage of a directory in a running container.
+// ctx: The context.Context to use for the exec operation.
+// containerName: The name or ID of the container.
+// dirPath: The absolute path of the directory.
+// Returns an error if du fails.
+func (dm *DockerManager) DirSize(ctx context.Context, containerName, dirPath string) (int64, error) {
+	res, err := dm.Exec(ctx, containerName, []string{"du", "-sk", dirPath})
+	if err != nil {
+		return 0, err
+	}
+	if res.ExitCode != 0 {
+		return 0, fmt.Errorf("du %s exited with code %d: %s", dirPath, res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	fields := strings.Fields(res.Stdout)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected output of du %s: %s", dirPath, res.Stdout)
+	}
+	kb, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of du %s: %w", dirPath, err)
+	}
+
+	return kb * 1024, nil
+}
@@ -0,0 +1,242 @@
+package fake
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/errdefs"
+	"github.com/mrlutik/kira2.0/internal/docker"
+)
+
+// ContainerExecCreate implements docker.Client. The container must be running.
+func (c *Client) ContainerExecCreate(ctx context.Context, name string, config types.ExecConfig) (types.IDResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return types.IDResponse{}, err
+	}
+	if !ctr.json.State.Running || ctr.json.State.Paused {
+		return types.IDResponse{}, conflict("Container %s is not running", ctr.json.ID)
+	}
+
+	id := c.newID()
+	c.execs[id] = &fakeExec{id: id, container: strings.TrimPrefix(ctr.json.Name, "/"), cmd: append([]string(nil), config.Cmd...)}
+	attrs := c.containerAttrs(ctr)
+	attrs["execID"] = id
+	c.emit(events.ContainerEventType, "exec_create: "+strings.Join(config.Cmd, " "), ctr.json.ID, attrs)
+	return types.IDResponse{ID: id}, nil
+}
+
+// ContainerExecAttach implements docker.Client. The command runs through ExecHandler
+// and its output is returned as a multiplexed stream.
+func (c *Client) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	c.mu.Lock()
+	exec, ok := c.execs[execID]
+	handler := c.ExecHandler
+	c.mu.Unlock()
+	if !ok {
+		return types.HijackedResponse{}, notFound("No such exec instance: %s", execID)
+	}
+
+	result := docker.ExecResult{}
+	if handler != nil {
+		result = handler(exec.container, exec.cmd)
+	}
+
+	c.mu.Lock()
+	exec.result = &result
+	c.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	if result.Stdout != "" {
+		writeFrame(buf, false, []byte(result.Stdout))
+	}
+	if result.Stderr != "" {
+		writeFrame(buf, true, []byte(result.Stderr))
+	}
+	return types.HijackedResponse{Conn: nopConn{}, Reader: bufio.NewReader(buf)}, nil
+}
+
+// ContainerExecInspect implements docker.Client.
+func (c *Client) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exec, ok := c.execs[execID]
+	if !ok {
+		return types.ContainerExecInspect{}, notFound("No such exec instance: %s", execID)
+	}
+	inspect := types.ContainerExecInspect{ExecID: exec.id, ContainerID: exec.container, Running: exec.result == nil}
+	if exec.result != nil {
+		inspect.ExitCode = exec.result.ExitCode
+	}
+	return inspect, nil
+}
+
+// CopyToContainer implements docker.Client. content is a tar archive extracted into dstPath.
+func (c *Client) CopyToContainer(ctx context.Context, name, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	files := map[string][]byte{}
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		files[path.Join(dstPath, hdr.Name)] = data
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	for p, data := range files {
+		c.putFile(ctr, p, data)
+	}
+	return nil
+}
+
+// CopyFromContainer implements docker.Client. srcPath may be a file or a directory;
+// archive entries are named relative to the parent of srcPath like the real daemon does.
+func (c *Client) CopyFromContainer(ctx context.Context, name, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+
+	srcPath = path.Clean(srcPath)
+	base := path.Dir(srcPath)
+	all := c.files(ctr)
+	var paths []string
+	for p := range all {
+		if p == srcPath || strings.HasPrefix(p, srcPath+"/") {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, types.ContainerPathStat{}, notFound("Could not find the file %s in container %s", srcPath, name)
+	}
+	sort.Strings(paths)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	stat := types.ContainerPathStat{Name: path.Base(srcPath), Mode: os.ModeDir | 0755, Mtime: c.epoch}
+	var size int64
+	for _, p := range paths {
+		data := all[p]
+		size += int64(len(data))
+		rel := strings.TrimPrefix(p, base+"/")
+		if err := tw.WriteHeader(&tar.Header{Name: rel, Mode: 0644, Size: int64(len(data)), ModTime: c.epoch}); err != nil {
+			return nil, types.ContainerPathStat{}, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, types.ContainerPathStat{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	if len(paths) == 1 && paths[0] == srcPath {
+		stat.Mode = 0644
+	}
+	stat.Size = size
+
+	return io.NopCloser(buf), stat, nil
+}
+
+// volumeFor returns the volume mounted at the longest prefix of p and the path inside it.
+// Callers must hold mu.
+func (c *Client) volumeFor(ctr *fakeContainer, p string) (string, string) {
+	var name, rel string
+	best := -1
+	for _, m := range ctr.json.Mounts {
+		if m.Type != "volume" || len(m.Destination) <= best {
+			continue
+		}
+		if p == m.Destination || strings.HasPrefix(p, m.Destination+"/") {
+			name, rel, best = m.Name, strings.TrimPrefix(p, m.Destination), len(m.Destination)
+		}
+	}
+	return name, rel
+}
+
+// putFile stores a file in the mounted volume that covers p, or in the container itself.
+// Callers must hold mu.
+func (c *Client) putFile(ctr *fakeContainer, p string, data []byte) {
+	if name, rel := c.volumeFor(ctr, p); name != "" {
+		if c.volumeFiles[name] == nil {
+			c.volumeFiles[name] = map[string][]byte{}
+		}
+		c.volumeFiles[name][rel] = data
+		return
+	}
+	ctr.files[p] = data
+}
+
+// files returns all files visible in a container by absolute path, volume content included.
+// Callers must hold mu.
+func (c *Client) files(ctr *fakeContainer) map[string][]byte {
+	all := map[string][]byte{}
+	for p, data := range ctr.files {
+		if name, _ := c.volumeFor(ctr, p); name == "" {
+			all[p] = data
+		}
+	}
+	for _, m := range ctr.json.Mounts {
+		if m.Type != "volume" {
+			continue
+		}
+		for rel, data := range c.volumeFiles[m.Name] {
+			p := m.Destination + rel
+			if name, _ := c.volumeFor(ctr, p); name == m.Name {
+				all[p] = data
+			}
+		}
+	}
+	return all
+}
+
+// nopConn is the connection behind a fake hijacked exec response.
+type nopConn struct{}
+
+func (nopConn) Read(b []byte) (int, error)         { return 0, io.EOF }
+func (nopConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (nopConn) Close() error                       { return nil }
+func (nopConn) LocalAddr() net.Addr                { return fakeAddr{} }
+func (nopConn) RemoteAddr() net.Addr               { return fakeAddr{} }
+func (nopConn) SetDeadline(t time.Time) error      { return nil }
+func (nopConn) SetReadDeadline(t time.Time) error  { return nil }
+func (nopConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type fakeAddr struct{}
+
+func (fakeAddr) Network() string { return "fake" }
+func (fakeAddr) String() string  { return "fake" }
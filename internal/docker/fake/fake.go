@@ -0,0 +1,966 @@
+// Package fake provides an in-memory implementation of docker.Client.
+//
+// The fake keeps images, containers, networks and volumes in maps and moves
+// containers through the same states a real daemon does (created, running,
+// paused, exited, removed), emitting the matching events on the way. Time is
+// a counter, so every run produces the same IDs, timestamps and events.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ExecHandler answers a command executed in a container.
+type ExecHandler func(containerName string, cmd []string) docker.ExecResult
+
+// Client is an in-memory docker.Client.
+type Client struct {
+	mu sync.Mutex
+
+	// Version and DaemonInfo are returned by ServerVersion and Info.
+	Version    types.Version
+	DaemonInfo types.Info
+	// PullErrors makes ImagePull fail for the given references.
+	PullErrors map[string]error
+	// ExecHandler answers exec commands. Without one every command succeeds with no output.
+	ExecHandler ExecHandler
+	// RunHandler decides what the main process of a starting container does. When it returns a
+	// result the container writes the output to its log and exits with the exit code right away,
+	// like a one-off job. Without a handler, or when it returns nil, the container keeps running.
+	RunHandler func(containerName string, cmd []string) *docker.ExecResult
+	// StartHealth is the health status a container with a healthcheck gets when it starts.
+	// Defaults to healthy.
+	StartHealth string
+
+	images     map[string]types.ImageSummary
+	containers map[string]*fakeContainer
+	networks   map[string]*types.NetworkResource
+	volumes    map[string]*volume.Volume
+	// volumeFiles holds the content of volumes by volume name and path inside the volume.
+	volumeFiles map[string]map[string][]byte
+	execs       map[string]*fakeExec
+	history     []events.Message
+	listeners   []*listener
+	seq         int64
+	epoch       time.Time
+}
+
+// listener is an Events subscriber. Events queue up in pending, so a slow reader never loses
+// one, and wake tells its goroutine there is something to deliver.
+type listener struct {
+	pending []events.Message
+	wake    chan struct{}
+}
+
+// push queues msg for the listener. Callers must hold mu.
+func (l *listener) push(msg events.Message) {
+	l.pending = append(l.pending, msg)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+type fakeContainer struct {
+	json    types.ContainerJSON
+	files   map[string][]byte
+	logs    []logLine
+	waiters []waiter
+}
+
+type logLine struct {
+	stderr bool
+	at     time.Time
+	text   string
+}
+
+type waiter struct {
+	condition container.WaitCondition
+	ch        chan container.WaitResponse
+}
+
+type fakeExec struct {
+	id        string
+	container string
+	cmd       []string
+	result    *docker.ExecResult
+}
+
+var _ docker.Client = (*Client)(nil)
+
+// New returns an empty fake daemon that reports itself as Docker 24.0.2.
+func New() *Client {
+	return &Client{
+		Version: types.Version{Version: "24.0.2", APIVersion: "1.43", MinAPIVersion: "1.12", Os: "linux", Arch: "amd64"},
+		DaemonInfo: types.Info{
+			ID:            "fake",
+			NCPU:          8,
+			MemTotal:      32 << 30,
+			Driver:        "overlay2",
+			CgroupDriver:  "systemd",
+			CgroupVersion: "2",
+			DockerRootDir: "/var/lib/docker",
+			MemoryLimit:   true,
+			CPUCfsQuota:   true,
+			CPUShares:     true,
+			PidsLimit:     true,
+			Plugins:       types.PluginsInfo{Log: []string{"json-file", "local", "journald"}},
+		},
+		PullErrors:  map[string]error{},
+		StartHealth: types.Healthy,
+		images:      map[string]types.ImageSummary{},
+		containers:  map[string]*fakeContainer{},
+		networks:    map[string]*types.NetworkResource{},
+		volumes:     map[string]*volume.Volume{},
+		volumeFiles: map[string]map[string][]byte{},
+		execs:       map[string]*fakeExec{},
+		epoch:       time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// now advances the fake clock by one second and returns it. Callers must hold mu.
+func (c *Client) now() time.Time {
+	c.seq++
+	return c.epoch.Add(time.Duration(c.seq) * time.Second)
+}
+
+// newID returns a deterministic 64 character hex ID. Callers must hold mu.
+func (c *Client) newID() string {
+	c.seq++
+	return fmt.Sprintf("%064x", c.seq)
+}
+
+// emit records an event and sends it to all listeners. Callers must hold mu.
+func (c *Client) emit(typ events.Type, action, id string, attrs map[string]string) {
+	at := c.now()
+	msg := events.Message{
+		Type:     typ,
+		Action:   action,
+		Actor:    events.Actor{ID: id, Attributes: attrs},
+		Scope:    "local",
+		Time:     at.Unix(),
+		TimeNano: at.UnixNano(),
+	}
+	c.history = append(c.history, msg)
+	for _, l := range c.listeners {
+		l.push(msg)
+	}
+}
+
+// EventHistory returns every event emitted so far, in order.
+func (c *Client) EventHistory() []events.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]events.Message(nil), c.history...)
+}
+
+func notFound(format string, args ...interface{}) error {
+	return errdefs.NotFound(fmt.Errorf(format, args...))
+}
+
+func conflict(format string, args ...interface{}) error {
+	return errdefs.Conflict(fmt.Errorf(format, args...))
+}
+
+// ClientVersion implements docker.Client.
+func (c *Client) ClientVersion() string { return c.Version.APIVersion }
+
+// DaemonHost implements docker.Client.
+func (c *Client) DaemonHost() string { return "fake://" }
+
+// Ping implements docker.Client.
+func (c *Client) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{APIVersion: c.Version.APIVersion, OSType: c.Version.Os}, nil
+}
+
+// ServerVersion implements docker.Client.
+func (c *Client) ServerVersion(ctx context.Context) (types.Version, error) {
+	return c.Version, nil
+}
+
+// Info implements docker.Client. Container counters are computed from the fake state.
+func (c *Client) Info(ctx context.Context) (types.Info, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := c.DaemonInfo
+	info.Images = len(c.images)
+	info.Containers = len(c.containers)
+	for _, ctr := range c.containers {
+		switch ctr.json.State.Status {
+		case "running":
+			info.ContainersRunning++
+		case "paused":
+			info.ContainersPaused++
+		default:
+			info.ContainersStopped++
+		}
+	}
+
+	return info, nil
+}
+
+// Events implements docker.Client. Past events are replayed when options.Since is set,
+// new events are delivered until ctx is cancelled. Filters on type, event, container and label are honoured.
+func (c *Client) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	out := make(chan events.Message)
+	errs := make(chan error, 1)
+	l := &listener{wake: make(chan struct{}, 1)}
+
+	c.mu.Lock()
+	if options.Since != "" {
+		for _, msg := range c.history {
+			l.push(msg)
+		}
+	}
+	c.listeners = append(c.listeners, l)
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			for i, other := range c.listeners {
+				if other == l {
+					c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
+					break
+				}
+			}
+			c.mu.Unlock()
+			close(out)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-l.wake:
+			}
+
+			c.mu.Lock()
+			pending := l.pending
+			l.pending = nil
+			c.mu.Unlock()
+
+			for _, msg := range pending {
+				if !matchEvent(options.Filters, msg) {
+					continue
+				}
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+func matchEvent(f filters.Args, msg events.Message) bool {
+	if f.Len() == 0 {
+		return true
+	}
+	if !f.ExactMatch("type", string(msg.Type)) || !f.ExactMatch("event", msg.Action) {
+		return false
+	}
+	if f.Contains("container") && msg.Type == events.ContainerEventType &&
+		!f.ExactMatch("container", msg.Actor.ID) && !f.ExactMatch("container", msg.Actor.Attributes["name"]) {
+		return false
+	}
+	return matchLabels(f, msg.Actor.Attributes)
+}
+
+func matchLabels(f filters.Args, labels map[string]string) bool {
+	for _, want := range f.Get("label") {
+		key, value, hasValue := strings.Cut(want, "=")
+		got, ok := labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddImage makes ref available without pulling it.
+func (c *Client) AddImage(ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addImage(normalizeRef(ref))
+}
+
+func (c *Client) addImage(ref string) {
+	if _, ok := c.images[ref]; ok {
+		return
+	}
+	c.images[ref] = types.ImageSummary{ID: "sha256:" + c.newID(), RepoTags: []string{ref}, Created: c.now().Unix()}
+}
+
+// normalizeRef adds the implicit `latest` tag.
+func normalizeRef(ref string) string {
+	if strings.Contains(ref, "@") {
+		return ref
+	}
+	if i := strings.LastIndex(ref, ":"); i < 0 || strings.Contains(ref[i:], "/") {
+		return ref + ":latest"
+	}
+	return ref
+}
+
+// ImagePull implements docker.Client.
+func (c *Client) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ref = normalizeRef(ref)
+	if err, ok := c.PullErrors[ref]; ok {
+		return nil, err
+	}
+	c.addImage(ref)
+	c.emit(events.ImageEventType, "pull", ref, map[string]string{"name": ref})
+
+	progress := fmt.Sprintf("{\"status\":\"Pulling from %s\"}\n{\"status\":\"Status: Downloaded newer image for %s\"}\n", ref, ref)
+	return io.NopCloser(strings.NewReader(progress)), nil
+}
+
+// ImageInspectWithRaw implements docker.Client.
+func (c *Client) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	img, ok := c.images[normalizeRef(image)]
+	if !ok {
+		return types.ImageInspect{}, nil, notFound("No such image: %s", image)
+	}
+	return types.ImageInspect{ID: img.ID, RepoTags: img.RepoTags}, nil, nil
+}
+
+// ImageList implements docker.Client.
+func (c *Client) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var list []types.ImageSummary
+	for _, img := range c.images {
+		list = append(list, img)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RepoTags[0] < list[j].RepoTags[0] })
+	return list, nil
+}
+
+// lookupContainer finds a container by ID, unique ID prefix or name. Callers must hold mu.
+func (c *Client) lookupContainer(ref string) (*fakeContainer, error) {
+	if ctr, ok := c.containers[ref]; ok {
+		return ctr, nil
+	}
+	name := "/" + strings.TrimPrefix(ref, "/")
+	var found *fakeContainer
+	for id, ctr := range c.containers {
+		if ctr.json.Name == name {
+			return ctr, nil
+		}
+		if len(ref) >= 12 && strings.HasPrefix(id, ref) {
+			found = ctr
+		}
+	}
+	if found == nil {
+		return nil, notFound("No such container: %s", ref)
+	}
+	return found, nil
+}
+
+// WriteLog appends a line to the stdout or stderr log of a container.
+func (c *Client) WriteLog(containerName string, stderr bool, line string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	ctr.logs = append(ctr.logs, logLine{stderr: stderr, at: c.now(), text: strings.TrimSuffix(line, "\n") + "\n"})
+	return nil
+}
+
+// SetHealth changes the health status of a running container.
+func (c *Client) SetHealth(containerName, status string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if ctr.json.State.Health == nil {
+		return fmt.Errorf("container %s has no healthcheck", containerName)
+	}
+	ctr.json.State.Health.Status = status
+	c.emit(events.ContainerEventType, "health_status: "+status, ctr.json.ID, c.containerAttrs(ctr))
+	return nil
+}
+
+// Exit simulates the main process of a running container exiting with code, e.g. after a crash.
+func (c *Client) Exit(containerName string, code int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if !ctr.json.State.Running {
+		return conflict("container %s is not running", containerName)
+	}
+	c.stop(ctr, code)
+	return nil
+}
+
+// File returns the content of a file in a container, including files in mounted volumes.
+func (c *Client) File(containerName, path string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(containerName)
+	if err != nil {
+		return nil, false
+	}
+	data, ok := c.files(ctr)[path]
+	return data, ok
+}
+
+// WriteFile puts a file into a container, creating or replacing it. Paths below a volume
+// mount end up in the volume and are visible to every container that mounts it.
+func (c *Client) WriteFile(containerName, path string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	c.putFile(ctr, path, append([]byte(nil), data...))
+	return nil
+}
+
+func (c *Client) containerAttrs(ctr *fakeContainer) map[string]string {
+	attrs := map[string]string{"name": strings.TrimPrefix(ctr.json.Name, "/"), "image": ctr.json.Config.Image}
+	for k, v := range ctr.json.Config.Labels {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+// ContainerCreate implements docker.Client. The image must be present, named volumes
+// referenced by mounts are created on the fly like the real daemon does.
+func (c *Client) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if config == nil {
+		return container.CreateResponse{}, errdefs.InvalidParameter(fmt.Errorf("config cannot be empty in order to create a container"))
+	}
+	if _, ok := c.images[normalizeRef(config.Image)]; !ok {
+		return container.CreateResponse{}, notFound("No such image: %s", config.Image)
+	}
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+
+	id := c.newID()
+	if containerName == "" {
+		containerName = "fake_" + id[len(id)-8:]
+	}
+	if _, err := c.lookupContainer(containerName); err == nil {
+		return container.CreateResponse{}, conflict("Conflict. The container name \"/%s\" is already in use", containerName)
+	}
+
+	cfg := *config
+	hc := *hostConfig
+	created := c.now()
+	ctr := &fakeContainer{
+		json: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         id,
+				Created:    created.Format(time.RFC3339Nano),
+				Name:       "/" + containerName,
+				Image:      c.images[normalizeRef(config.Image)].ID,
+				State:      &types.ContainerState{Status: "created"},
+				HostConfig: &hc,
+			},
+			Config:          &cfg,
+			NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{}},
+		},
+		files: map[string][]byte{},
+	}
+
+	for _, m := range hc.Mounts {
+		point := types.MountPoint{Type: m.Type, Source: m.Source, Destination: m.Target, RW: !m.ReadOnly}
+		if m.Type == "volume" {
+			name := m.Source
+			if name == "" {
+				name = c.newID()
+				c.ensureVolume(name).Labels[anonymousVolumeLabel] = ""
+			} else {
+				c.ensureVolume(name)
+			}
+			point.Source, point.Name = name, name
+		}
+		ctr.json.Mounts = append(ctr.json.Mounts, point)
+	}
+	for _, bind := range hc.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 {
+			continue
+		}
+		point := types.MountPoint{Type: "bind", Source: parts[0], Destination: parts[1], RW: len(parts) < 3 || !strings.Contains(parts[2], "ro")}
+		if !strings.HasPrefix(parts[0], "/") {
+			c.ensureVolume(parts[0])
+			point.Type, point.Name = "volume", parts[0]
+		}
+		ctr.json.Mounts = append(ctr.json.Mounts, point)
+	}
+
+	c.containers[id] = ctr
+
+	if mode := string(hc.NetworkMode); mode != "" && mode != "default" && mode != "bridge" && mode != "host" && mode != "none" {
+		if err := c.connect(mode, ctr, nil); err != nil {
+			delete(c.containers, id)
+			return container.CreateResponse{}, err
+		}
+	}
+	if networkingConfig != nil {
+		for name, endpoint := range networkingConfig.EndpointsConfig {
+			if _, ok := ctr.json.NetworkSettings.Networks[name]; ok {
+				continue
+			}
+			if err := c.connect(name, ctr, endpoint); err != nil {
+				delete(c.containers, id)
+				return container.CreateResponse{}, err
+			}
+		}
+	}
+
+	c.emit(events.ContainerEventType, "create", id, c.containerAttrs(ctr))
+	return container.CreateResponse{ID: id}, nil
+}
+
+// ContainerStart implements docker.Client.
+func (c *Client) ContainerStart(ctx context.Context, name string, options types.ContainerStartOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	state := ctr.json.State
+	if state.Running {
+		return nil
+	}
+
+	state.Status, state.Running, state.Paused, state.ExitCode = "running", true, false, 0
+	state.Pid = int(c.seq)
+	state.StartedAt = c.now().Format(time.RFC3339Nano)
+	state.FinishedAt = ""
+	if ctr.json.Config.Healthcheck != nil && len(ctr.json.Config.Healthcheck.Test) > 0 && ctr.json.Config.Healthcheck.Test[0] != "NONE" {
+		state.Health = &types.Health{Status: c.StartHealth}
+	}
+	c.emit(events.ContainerEventType, "start", ctr.json.ID, c.containerAttrs(ctr))
+
+	if c.RunHandler != nil {
+		cmd := append(append([]string(nil), ctr.json.Config.Entrypoint...), ctr.json.Config.Cmd...)
+		if result := c.RunHandler(strings.TrimPrefix(ctr.json.Name, "/"), cmd); result != nil {
+			if result.Stdout != "" {
+				ctr.logs = append(ctr.logs, logLine{at: c.now(), text: result.Stdout})
+			}
+			if result.Stderr != "" {
+				ctr.logs = append(ctr.logs, logLine{stderr: true, at: c.now(), text: result.Stderr})
+			}
+			c.stop(ctr, result.ExitCode)
+		}
+	}
+	return nil
+}
+
+// stop moves a running container to exited. Callers must hold mu.
+func (c *Client) stop(ctr *fakeContainer, code int) {
+	state := ctr.json.State
+	state.Status, state.Running, state.Paused, state.ExitCode, state.Pid = "exited", false, false, code, 0
+	state.FinishedAt = c.now().Format(time.RFC3339Nano)
+	if state.Health != nil {
+		state.Health.Status = types.Unhealthy
+	}
+
+	attrs := c.containerAttrs(ctr)
+	attrs["exitCode"] = fmt.Sprint(code)
+	c.emit(events.ContainerEventType, "die", ctr.json.ID, attrs)
+	c.notify(ctr, container.WaitConditionNotRunning, container.WaitConditionNextExit)
+}
+
+// notify releases waiters waiting for one of the conditions. Callers must hold mu.
+func (c *Client) notify(ctr *fakeContainer, conditions ...container.WaitCondition) {
+	var pending []waiter
+	for _, w := range ctr.waiters {
+		released := false
+		for _, cond := range conditions {
+			if w.condition == cond || (w.condition == "" && cond == container.WaitConditionNotRunning) {
+				w.ch <- container.WaitResponse{StatusCode: int64(ctr.json.State.ExitCode)}
+				released = true
+				break
+			}
+		}
+		if !released {
+			pending = append(pending, w)
+		}
+	}
+	ctr.waiters = pending
+}
+
+// ContainerStop implements docker.Client. Stopped containers exit with code 0.
+func (c *Client) ContainerStop(ctx context.Context, name string, options container.StopOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if !ctr.json.State.Running {
+		return nil
+	}
+	c.stop(ctr, 0)
+	c.emit(events.ContainerEventType, "stop", ctr.json.ID, c.containerAttrs(ctr))
+	return nil
+}
+
+// ContainerRestart implements docker.Client.
+func (c *Client) ContainerRestart(ctx context.Context, name string, options container.StopOptions) error {
+	if err := c.ContainerStop(ctx, name, options); err != nil {
+		return err
+	}
+	return c.ContainerStart(ctx, name, types.ContainerStartOptions{})
+}
+
+// ContainerKill implements docker.Client. Killed containers exit with code 137.
+func (c *Client) ContainerKill(ctx context.Context, name, signal string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if !ctr.json.State.Running {
+		return conflict("Container %s is not running", name)
+	}
+	attrs := c.containerAttrs(ctr)
+	attrs["signal"] = signal
+	c.emit(events.ContainerEventType, "kill", ctr.json.ID, attrs)
+	c.stop(ctr, 137)
+	return nil
+}
+
+// ContainerPause implements docker.Client.
+func (c *Client) ContainerPause(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if !ctr.json.State.Running {
+		return conflict("Container %s is not running", name)
+	}
+	if ctr.json.State.Paused {
+		return conflict("Container %s is already paused", name)
+	}
+	ctr.json.State.Status, ctr.json.State.Paused = "paused", true
+	c.emit(events.ContainerEventType, "pause", ctr.json.ID, c.containerAttrs(ctr))
+	return nil
+}
+
+// ContainerUnpause implements docker.Client.
+func (c *Client) ContainerUnpause(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if !ctr.json.State.Paused {
+		return conflict("Container %s is not paused", name)
+	}
+	ctr.json.State.Status, ctr.json.State.Paused = "running", false
+	c.emit(events.ContainerEventType, "unpause", ctr.json.ID, c.containerAttrs(ctr))
+	return nil
+}
+
+// ContainerRemove implements docker.Client. Running containers need options.Force.
+func (c *Client) ContainerRemove(ctx context.Context, name string, options types.ContainerRemoveOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if ctr.json.State.Running {
+		if !options.Force {
+			return conflict("You cannot remove a running container %s. Stop the container before attempting removal or force remove", ctr.json.ID)
+		}
+		c.stop(ctr, 137)
+	}
+
+	for netName := range ctr.json.NetworkSettings.Networks {
+		if n, ok := c.lookupNetwork(netName); ok {
+			delete(n.Containers, ctr.json.ID)
+		}
+	}
+	ctr.json.State.Status = "removing"
+	delete(c.containers, ctr.json.ID)
+	// Like the daemon, only anonymous volumes go with the container, named ones are kept.
+	if options.RemoveVolumes {
+		for _, m := range ctr.json.Mounts {
+			if v, ok := c.volumes[m.Name]; ok && m.Type == "volume" && isAnonymous(v) && !c.volumeInUse(m.Name) {
+				delete(c.volumes, m.Name)
+				delete(c.volumeFiles, m.Name)
+				c.emit(events.VolumeEventType, "destroy", m.Name, map[string]string{"driver": v.Driver})
+			}
+		}
+	}
+	c.emit(events.ContainerEventType, "destroy", ctr.json.ID, c.containerAttrs(ctr))
+	c.notify(ctr, container.WaitConditionNotRunning, container.WaitConditionNextExit, container.WaitConditionRemoved)
+	return nil
+}
+
+// ContainerRename implements docker.Client.
+func (c *Client) ContainerRename(ctx context.Context, name, newName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	if _, err := c.lookupContainer(newName); err == nil {
+		return conflict("Conflict. The container name \"/%s\" is already in use", newName)
+	}
+	attrs := c.containerAttrs(ctr)
+	attrs["oldName"] = ctr.json.Name
+	ctr.json.Name = "/" + strings.TrimPrefix(newName, "/")
+	attrs["name"] = strings.TrimPrefix(newName, "/")
+	c.emit(events.ContainerEventType, "rename", ctr.json.ID, attrs)
+	return nil
+}
+
+// ContainerWait implements docker.Client.
+func (c *Client) ContainerWait(ctx context.Context, name string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	resp := make(chan container.WaitResponse, 1)
+	errs := make(chan error, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		errs <- err
+		return resp, errs
+	}
+	if (condition == "" || condition == container.WaitConditionNotRunning) && !ctr.json.State.Running {
+		resp <- container.WaitResponse{StatusCode: int64(ctr.json.State.ExitCode)}
+		return resp, errs
+	}
+
+	ch := make(chan container.WaitResponse, 1)
+	ctr.waiters = append(ctr.waiters, waiter{condition: condition, ch: ch})
+	go func() {
+		select {
+		case r := <-ch:
+			resp <- r
+		case <-ctx.Done():
+			errs <- ctx.Err()
+		}
+	}()
+	return resp, errs
+}
+
+// ContainerInspect implements docker.Client. The returned value is a copy.
+func (c *Client) ContainerInspect(ctx context.Context, name string) (types.ContainerJSON, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return copyJSON(ctr.json), nil
+}
+
+func copyJSON(in types.ContainerJSON) types.ContainerJSON {
+	base := *in.ContainerJSONBase
+	state := *base.State
+	if state.Health != nil {
+		health := *state.Health
+		state.Health = &health
+	}
+	base.State = &state
+	hc := *base.HostConfig
+	base.HostConfig = &hc
+	cfg := *in.Config
+	settings := types.NetworkSettings{Networks: map[string]*network.EndpointSettings{}}
+	for name, endpoint := range in.NetworkSettings.Networks {
+		e := *endpoint
+		settings.Networks[name] = &e
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &base,
+		Mounts:            append([]types.MountPoint(nil), in.Mounts...),
+		Config:            &cfg,
+		NetworkSettings:   &settings,
+	}
+}
+
+// ContainerList implements docker.Client. Filters on label, name and status are honoured.
+func (c *Client) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var list []types.Container
+	for _, ctr := range c.containers {
+		state := ctr.json.State
+		if !options.All && !state.Running {
+			continue
+		}
+		if !matchLabels(options.Filters, ctr.json.Config.Labels) {
+			continue
+		}
+		name := strings.TrimPrefix(ctr.json.Name, "/")
+		if options.Filters.Contains("name") && !options.Filters.Match("name", name) {
+			continue
+		}
+		if options.Filters.Contains("status") && !options.Filters.ExactMatch("status", state.Status) {
+			continue
+		}
+
+		item := types.Container{
+			ID:      ctr.json.ID,
+			Names:   []string{ctr.json.Name},
+			Image:   ctr.json.Config.Image,
+			ImageID: ctr.json.Image,
+			Command: strings.Join(ctr.json.Config.Cmd, " "),
+			Labels:  ctr.json.Config.Labels,
+			State:   state.Status,
+			Status:  state.Status,
+			Mounts:  append([]types.MountPoint(nil), ctr.json.Mounts...),
+		}
+		if created, err := time.Parse(time.RFC3339Nano, ctr.json.Created); err == nil {
+			item.Created = created.Unix()
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Names[0] < list[j].Names[0] })
+	return list, nil
+}
+
+// ContainerLogs implements docker.Client. The stream is a snapshot of the log written
+// with WriteLog, multiplexed like a non-TTY container. Follow is treated as a snapshot too.
+// Like the daemon, Tail picks the last lines before Since and Until filter them.
+func (c *Client) ContainerLogs(ctx context.Context, name string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []logLine
+	for _, l := range ctr.logs {
+		if (l.stderr && options.ShowStderr) || (!l.stderr && options.ShowStdout) {
+			lines = append(lines, l)
+		}
+	}
+	if options.Tail != "" && options.Tail != "all" {
+		var n int
+		if _, err := fmt.Sscan(options.Tail, &n); err == nil && n < len(lines) {
+			lines = lines[len(lines)-n:]
+		}
+	}
+
+	since, err := c.logTime(options.Since)
+	if err != nil {
+		return nil, err
+	}
+	until, err := c.logTime(options.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	for _, l := range lines {
+		if (!since.IsZero() && l.at.Before(since)) || (!until.IsZero() && l.at.After(until)) {
+			continue
+		}
+		text := l.text
+		if options.Timestamps {
+			text = l.at.Format(time.RFC3339Nano) + " " + text
+		}
+		writeFrame(buf, l.stderr, []byte(text))
+	}
+	return io.NopCloser(buf), nil
+}
+
+// logTime parses the Since or Until of a log request like the docker client does, durations
+// are relative to the fake clock. Returns the zero time for an empty value. Callers must hold mu.
+func (c *Client) logTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	ts, err := timetypes.GetTimestamp(value, c.epoch.Add(time.Duration(c.seq)*time.Second))
+	if err != nil {
+		return time.Time{}, errdefs.InvalidParameter(err)
+	}
+	sec, nsec, err := timetypes.ParseTimestamps(ts, 0)
+	if err != nil {
+		return time.Time{}, errdefs.InvalidParameter(err)
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// writeFrame writes a stdcopy frame: a 8 byte header with the stream type and payload size.
+func writeFrame(w *bytes.Buffer, stderr bool, payload []byte) {
+	header := make([]byte, 8)
+	header[0] = 1
+	if stderr {
+		header[0] = 2
+	}
+	size := len(payload)
+	header[4], header[5], header[6], header[7] = byte(size>>24), byte(size>>16), byte(size>>8), byte(size)
+	w.Write(header)
+	w.Write(payload)
+}
@@ -0,0 +1,106 @@
+package fake_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+)
+
+func TestEventsKeepsUpWithBursts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := fake.New()
+
+	msgs, errs := f.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(filters.Arg("type", "volume"))})
+	// Far more events than any buffer, emitted before anything is read.
+	const count = 500
+	for i := 0; i < count; i++ {
+		if _, err := f.VolumeCreate(ctx, volume.CreateOptions{Name: fmt.Sprintf("vol-%d", i)}); err != nil {
+			t.Fatalf("VolumeCreate() error: %v", err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case msg := <-msgs:
+			if want := fmt.Sprintf("vol-%d", i); msg.Actor.ID != want {
+				t.Fatalf("event %d is of %s, want %s", i, msg.Actor.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("received %d events, want %d", i, count)
+		}
+	}
+
+	// Cancelling with an event nobody reads still ends the stream.
+	if _, err := f.VolumeCreate(ctx, volume.CreateOptions{Name: "unread"}); err != nil {
+		t.Fatalf("VolumeCreate() error: %v", err)
+	}
+	cancel()
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Fatalf("Events() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Events() did not stop after cancel")
+	}
+}
+
+func TestEventsReplaysHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := fake.New()
+	if _, err := f.VolumeCreate(ctx, volume.CreateOptions{Name: "before"}); err != nil {
+		t.Fatalf("VolumeCreate() error: %v", err)
+	}
+
+	msgs, _ := f.Events(ctx, types.EventsOptions{Since: "0"})
+	select {
+	case msg := <-msgs:
+		if msg.Actor.ID != "before" {
+			t.Fatalf("first event is of %s, want the replayed volume before", msg.Actor.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Events() with since replayed nothing")
+	}
+}
+
+func TestContainerRemoveVolumes(t *testing.T) {
+	ctx := context.Background()
+	f := fake.New()
+	f.AddImage("sekai")
+	hc := &container.HostConfig{Mounts: []mount.Mount{
+		{Type: mount.TypeVolume, Source: "kira-sekai", Target: "/sekai"},
+		{Type: mount.TypeVolume, Target: "/tmp"},
+	}}
+	created, err := f.ContainerCreate(ctx, &container.Config{Image: "sekai"}, hc, nil, nil, "sekai")
+	if err != nil {
+		t.Fatalf("ContainerCreate() error: %v", err)
+	}
+	info, err := f.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ContainerInspect() error: %v", err)
+	}
+	anonymous := info.Mounts[1].Name
+	if anonymous == "" {
+		t.Fatal("mount without a source has no volume")
+	}
+
+	if err := f.ContainerRemove(ctx, "sekai", types.ContainerRemoveOptions{RemoveVolumes: true}); err != nil {
+		t.Fatalf("ContainerRemove() error: %v", err)
+	}
+	if _, err := f.VolumeInspect(ctx, "kira-sekai"); err != nil {
+		t.Fatalf("named volume is gone after ContainerRemove() with RemoveVolumes: %v", err)
+	}
+	if _, err := f.VolumeInspect(ctx, anonymous); err == nil {
+		t.Fatal("anonymous volume exists after ContainerRemove() with RemoveVolumes")
+	}
+}
@@ -0,0 +1,253 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// lookupNetwork finds a network by ID or name. Callers must hold mu.
+func (c *Client) lookupNetwork(ref string) (*types.NetworkResource, bool) {
+	if n, ok := c.networks[ref]; ok {
+		return n, true
+	}
+	for _, n := range c.networks {
+		if n.Name == ref {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// connect attaches a container to a network and assigns it an address. Callers must hold mu.
+func (c *Client) connect(ref string, ctr *fakeContainer, endpoint *network.EndpointSettings) error {
+	n, ok := c.lookupNetwork(ref)
+	if !ok {
+		return notFound("network %s not found", ref)
+	}
+	if _, ok := n.Containers[ctr.json.ID]; ok {
+		return conflict("endpoint with name %s already exists in network %s", strings.TrimPrefix(ctr.json.Name, "/"), n.Name)
+	}
+
+	settings := network.EndpointSettings{}
+	if endpoint != nil {
+		settings = *endpoint
+	}
+	settings.NetworkID = n.ID
+	settings.EndpointID = c.newID()
+	settings.IPAddress = fmt.Sprintf("172.30.0.%d", len(n.Containers)+2)
+	ctr.json.NetworkSettings.Networks[n.Name] = &settings
+
+	name := strings.TrimPrefix(ctr.json.Name, "/")
+	n.Containers[ctr.json.ID] = types.EndpointResource{Name: name, EndpointID: settings.EndpointID, IPv4Address: settings.IPAddress + "/24"}
+	c.emit(events.NetworkEventType, "connect", n.ID, map[string]string{"name": n.Name, "container": ctr.json.ID})
+	return nil
+}
+
+// NetworkCreate implements docker.Client. Names must be unique.
+func (c *Client) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lookupNetwork(name); ok {
+		return types.NetworkCreateResponse{}, conflict("network with name %s already exists", name)
+	}
+	driver := options.Driver
+	if driver == "" {
+		driver = "bridge"
+	}
+
+	id := c.newID()
+	c.networks[id] = &types.NetworkResource{
+		Name:       name,
+		ID:         id,
+		Created:    c.now(),
+		Scope:      "local",
+		Driver:     driver,
+		Internal:   options.Internal,
+		Attachable: options.Attachable,
+		Labels:     options.Labels,
+		Containers: map[string]types.EndpointResource{},
+	}
+	c.emit(events.NetworkEventType, "create", id, map[string]string{"name": name, "type": driver})
+	return types.NetworkCreateResponse{ID: id}, nil
+}
+
+// NetworkInspect implements docker.Client.
+func (c *Client) NetworkInspect(ctx context.Context, ref string, options types.NetworkInspectOptions) (types.NetworkResource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, ok := c.lookupNetwork(ref)
+	if !ok {
+		return types.NetworkResource{}, notFound("network %s not found", ref)
+	}
+	out := *n
+	out.Containers = map[string]types.EndpointResource{}
+	for id, e := range n.Containers {
+		out.Containers[id] = e
+	}
+	return out, nil
+}
+
+// NetworkList implements docker.Client. Filters on name and label are honoured.
+func (c *Client) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var list []types.NetworkResource
+	for _, n := range c.networks {
+		if options.Filters.Contains("name") && !options.Filters.Match("name", n.Name) {
+			continue
+		}
+		if !matchLabels(options.Filters, n.Labels) {
+			continue
+		}
+		list = append(list, *n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// NetworkConnect implements docker.Client.
+func (c *Client) NetworkConnect(ctx context.Context, ref, name string, config *network.EndpointSettings) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, err := c.lookupContainer(name)
+	if err != nil {
+		return err
+	}
+	return c.connect(ref, ctr, config)
+}
+
+// NetworkRemove implements docker.Client. Networks with attached containers cannot be removed.
+func (c *Client) NetworkRemove(ctx context.Context, ref string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, ok := c.lookupNetwork(ref)
+	if !ok {
+		return notFound("network %s not found", ref)
+	}
+	if len(n.Containers) > 0 {
+		return conflict("error while removing network: network %s id %s has active endpoints", n.Name, n.ID)
+	}
+	delete(c.networks, n.ID)
+	c.emit(events.NetworkEventType, "destroy", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+	return nil
+}
+
+// ensureVolume creates a local volume if it does not exist. Callers must hold mu.
+func (c *Client) ensureVolume(name string) *volume.Volume {
+	if v, ok := c.volumes[name]; ok {
+		return v
+	}
+	v := &volume.Volume{
+		Name:       name,
+		Driver:     "local",
+		Mountpoint: "/var/lib/docker/volumes/" + name + "/_data",
+		CreatedAt:  c.now().Format("2006-01-02T15:04:05Z07:00"),
+		Scope:      "local",
+		Labels:     map[string]string{},
+	}
+	c.volumes[name] = v
+	c.emit(events.VolumeEventType, "create", name, map[string]string{"driver": "local"})
+	return v
+}
+
+// anonymousVolumeLabel is the label the daemon puts on the volumes it creates for a mount
+// without a source.
+const anonymousVolumeLabel = "com.docker.volume.anonymous"
+
+func isAnonymous(v *volume.Volume) bool {
+	_, ok := v.Labels[anonymousVolumeLabel]
+	return ok
+}
+
+// volumeInUse reports whether a container mounts the volume. Callers must hold mu.
+func (c *Client) volumeInUse(name string) bool {
+	for _, ctr := range c.containers {
+		for _, m := range ctr.json.Mounts {
+			if m.Type == "volume" && m.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VolumeCreate implements docker.Client. Creating an existing volume returns it unchanged.
+func (c *Client) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := options.Name
+	if name == "" {
+		name = c.newID()
+	}
+	_, existed := c.volumes[name]
+	v := c.ensureVolume(name)
+	if !existed && options.Labels != nil {
+		v.Labels = options.Labels
+	}
+	return *v, nil
+}
+
+// VolumeInspect implements docker.Client.
+func (c *Client) VolumeInspect(ctx context.Context, name string) (volume.Volume, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.volumes[name]
+	if !ok {
+		return volume.Volume{}, notFound("get %s: no such volume", name)
+	}
+	return *v, nil
+}
+
+// VolumeList implements docker.Client. Filters on name and label are honoured.
+func (c *Client) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var list []*volume.Volume
+	for _, v := range c.volumes {
+		if options.Filters.Contains("name") && !options.Filters.Match("name", v.Name) {
+			continue
+		}
+		if !matchLabels(options.Filters, v.Labels) {
+			continue
+		}
+		out := *v
+		list = append(list, &out)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return volume.ListResponse{Volumes: list}, nil
+}
+
+// VolumeRemove implements docker.Client. Volumes used by a container cannot be removed.
+func (c *Client) VolumeRemove(ctx context.Context, name string, force bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.volumes[name]; !ok {
+		if force {
+			return nil
+		}
+		return notFound("get %s: no such volume", name)
+	}
+	if c.volumeInUse(name) {
+		return conflict("remove %s: volume is in use", name)
+	}
+	delete(c.volumes, name)
+	delete(c.volumeFiles, name)
+	c.emit(events.VolumeEventType, "destroy", name, map[string]string{"driver": "local"})
+	return nil
+}
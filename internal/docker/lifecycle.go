@@ -0,0 +1,527 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// StackLabel marks the networks, volumes and containers that belong to one launcher stack.
+	StackLabel = "kira.stack"
+	// ToolboxLabel marks idle helper containers that only exist to execute commands in.
+	ToolboxLabel = "kira.toolbox"
+)
+
+// ImageExists checks whether the image is present on the daemon.
+// ctx: The context.Context to use for the inspect operation.
+// image: The image reference.
+// Returns true if the image exists and an error for failures other than a missing image.
+func (dm *DockerManager) ImageExists(ctx context.Context, image string) (bool, error) {
+	_, _, err := dm.cli.ImageInspectWithRaw(ctx, image)
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+
+	return true, nil
+}
+
+// EnsureNetwork creates a bridge network unless a network with that name already exists.
+// ctx: The context.Context to use for the network operations.
+// name: The name of the network.
+// labels: Labels for a newly created network.
+// Returns the ID of the network and an error if it can neither be found nor created.
+func (dm *DockerManager) EnsureNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	existing, err := dm.cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		return existing.ID, nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return "", fmt.Errorf("failed to inspect network %s: %w", name, err)
+	}
+
+	resp, err := dm.cli.NetworkCreate(ctx, name, types.NetworkCreate{Driver: "bridge", CheckDuplicate: true, Labels: labels})
+	if err != nil {
+		return "", fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	log.Printf("Network %s created", name)
+
+	return resp.ID, nil
+}
+
+// RemoveNetwork removes a network. A missing network is not an error.
+// ctx: The context.Context to use for the network operation.
+// name: The name or ID of the network.
+// Returns an error if the network exists but cannot be removed.
+func (dm *DockerManager) RemoveNetwork(ctx context.Context, name string) error {
+	if err := dm.cli.NetworkRemove(ctx, name); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// EnsureVolume creates a local volume unless it already exists.
+// ctx: The context.Context to use for the volume operations.
+// name: The name of the volume.
+// labels: Labels for a newly created volume.
+// Returns an error if the volume can neither be found nor created.
+func (dm *DockerManager) EnsureVolume(ctx context.Context, name string, labels map[string]string) error {
+	_, err := dm.cli.VolumeInspect(ctx, name)
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect volume %s: %w", name, err)
+	}
+
+	if _, err := dm.cli.VolumeCreate(ctx, volume.CreateOptions{Name: name, Driver: "local", Labels: labels}); err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	log.Printf("Volume %s created", name)
+
+	return nil
+}
+
+// RemoveVolume removes a volume. A missing volume is not an error.
+// ctx: The context.Context to use for the volume operation.
+// name: The name of the volume.
+// Returns an error if the volume exists but cannot be removed.
+func (dm *DockerManager) RemoveVolume(ctx context.Context, name string) error {
+	if err := dm.cli.VolumeRemove(ctx, name, false); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ContainerExists checks whether a container with the given name or ID exists.
+// ctx: The context.Context to use for the inspect operation.
+// name: The name or ID of the container.
+// Returns true if the container exists and an error for failures other than a missing container.
+func (dm *DockerManager) ContainerExists(ctx context.Context, name string) (bool, error) {
+	_, err := dm.cli.ContainerInspect(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// StartContainer starts a created or stopped container.
+// ctx: The context.Context to use for the start operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be started.
+func (dm *DockerManager) StartContainer(ctx context.Context, name string) error {
+	if err := dm.cli.ContainerStart(ctx, name, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", name, err)
+	}
+	log.Printf("Container %s started", name)
+
+	return nil
+}
+
+// StopContainer stops a running container, killing it after timeout.
+// A missing container is not an error.
+// ctx: The context.Context to use for the stop operation.
+// name: The name or ID of the container.
+// timeout: How long the container gets to shut down gracefully.
+// Returns an error if the container exists but cannot be stopped.
+func (dm *DockerManager) StopContainer(ctx context.Context, name string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+	if err := dm.cli.ContainerStop(ctx, name, container.StopOptions{Timeout: &seconds}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stop container %s: %w", name, err)
+	}
+	log.Printf("Container %s stopped", name)
+
+	return nil
+}
+
+// RemoveContainer force removes a container. A missing container is not an error.
+// ctx: The context.Context to use for the remove operation.
+// name: The name or ID of the container.
+// Returns an error if the container exists but cannot be removed.
+func (dm *DockerManager) RemoveContainer(ctx context.Context, name string) error {
+	if err := dm.cli.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove container %s: %w", name, err)
+	}
+	log.Printf("Container %s removed", name)
+
+	return nil
+}
+
+// WaitHealthy polls a container until its healthcheck reports healthy. Containers without a
+// healthcheck count as healthy as soon as they are running.
+// ctx: The context.Context to use for the inspect operations.
+// name: The name or ID of the container.
+// timeout: How long to wait before giving up.
+// Returns an error if the container exits, becomes unhealthy or the timeout expires.
+func (dm *DockerManager) WaitHealthy(ctx context.Context, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		info, err := dm.cli.ContainerInspect(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container %s: %w", name, err)
+		}
+
+		state := info.State
+		switch {
+		case state.Status == "exited" || state.Status == "dead":
+			return fmt.Errorf("container %s exited with code %d", name, state.ExitCode)
+		case state.Health == nil && state.Running:
+			return nil
+		case state.Health != nil && state.Health.Status == types.Healthy:
+			log.Printf("Container %s is healthy", name)
+			return nil
+		case state.Health != nil && state.Health.Status == types.Unhealthy:
+			return fmt.Errorf("container %s is unhealthy", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for container %s to become healthy", timeout, name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunToCompletion creates a container from spec, runs it until it exits and removes it again.
+// It is meant for one-off jobs such as initialising a node home in a volume.
+// ctx: The context.Context to use for the container operations.
+// spec: The NodeSpec of the job container.
+// Returns the stdout and stderr of the job and an error if it cannot be run or exits with a non-zero code.
+func (dm *DockerManager) RunToCompletion(ctx context.Context, spec NodeSpec) (string, string, error) {
+	id, err := dm.CreateNodeContainer(ctx, spec)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), id); err != nil {
+			log.Printf("Failed to clean up job container %s: %s", spec.Name, err)
+		}
+	}()
+
+	if err := dm.StartContainer(ctx, id); err != nil {
+		return "", "", err
+	}
+
+	var exitCode int64
+	statusCh, errCh := dm.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return "", "", fmt.Errorf("container wait error: %w", err)
+		}
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	out, err := dm.cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve container logs: %w", err)
+	}
+	defer out.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, out); err != nil {
+		return "", "", fmt.Errorf("failed to copy container logs: %w", err)
+	}
+
+	if exitCode != 0 {
+		return stdout.String(), stderr.String(), fmt.Errorf("job %s exited with code %d: %s", spec.Name, exitCode, stderr.String())
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
+
+// RestartContainer stops and starts a container, killing it after timeout if it does not stop.
+// ctx: The context.Context to use for the restart operation.
+// name: The name or ID of the container.
+// timeout: How long the container gets to shut down gracefully.
+// Returns an error if the container cannot be restarted.
+func (dm *DockerManager) RestartContainer(ctx context.Context, name string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+	if err := dm.cli.ContainerRestart(ctx, name, container.StopOptions{Timeout: &seconds}); err != nil {
+		return fmt.Errorf("failed to restart container %s: %w", name, err)
+	}
+	log.Printf("Container %s restarted", name)
+
+	return nil
+}
+
+// RecreateContainer replaces a container by a new one with the same name, configuration,
+// mounts and networks but a different image. The old container is stopped and kept under a
+// temporary name until the new one is created, so a failed create leaves it in place. The new
+// container is created but not started.
+// ctx: The context.Context to use for the container operations.
+// name: The name of the container.
+// image: The image of the new container.
+// Returns the image the old container ran and an error if the container cannot be replaced.
+func (dm *DockerManager) RecreateContainer(ctx context.Context, name, image string) (string, error) {
+	info, err := dm.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+
+	config := *info.Config
+	oldImage := config.Image
+	config.Image = image
+	endpoints := map[string]*network.EndpointSettings{}
+	for netName, endpoint := range info.NetworkSettings.Networks {
+		endpoints[netName] = &network.EndpointSettings{Aliases: endpoint.Aliases}
+	}
+
+	if err := dm.StopContainer(ctx, name, 30*time.Second); err != nil {
+		return "", err
+	}
+	replaced := name + "-replaced"
+	if err := dm.cli.ContainerRename(ctx, info.ID, replaced); err != nil {
+		return "", fmt.Errorf("failed to rename container %s to %s: %w", name, replaced, err)
+	}
+
+	if _, err := dm.cli.ContainerCreate(ctx, &config, info.HostConfig, &network.NetworkingConfig{EndpointsConfig: endpoints}, nil, name); err != nil {
+		if renameErr := dm.cli.ContainerRename(ctx, info.ID, name); renameErr != nil {
+			return "", fmt.Errorf("failed to recreate container %s with image %s: %w; the old container is left as %s: %s", name, image, err, replaced, renameErr)
+		}
+		return "", fmt.Errorf("failed to recreate container %s with image %s: %w", name, image, err)
+	}
+	if err := dm.cli.ContainerRemove(ctx, info.ID, types.ContainerRemoveOptions{}); err != nil {
+		log.Printf("Failed to remove replaced container %s: %s", replaced, err)
+	}
+	log.Printf("Container %s recreated with image %s (was %s)", name, image, oldImage)
+
+	return oldImage, nil
+}
+
+// VolumeAt returns the name of the volume mounted at target in a container.
+// ctx: The context.Context to use for the inspect operation.
+// name: The name or ID of the container.
+// target: The mount point inside the container, e.g. `/sekai`.
+// Returns an error if the container has no volume mounted there.
+func (dm *DockerManager) VolumeAt(ctx context.Context, name, target string) (string, error) {
+	info, err := dm.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	for _, m := range info.Mounts {
+		if m.Type == "volume" && m.Destination == target {
+			return m.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("container %s has no volume mounted at %s", name, target)
+}
+
+// IsRunning reports whether a container is running.
+// ctx: The context.Context to use for the inspect operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be inspected.
+func (dm *DockerManager) IsRunning(ctx context.Context, name string) (bool, error) {
+	info, err := dm.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+
+	return info.State.Running, nil
+}
+
+// StartedAt returns when the current or, for a stopped container, the last run of a container
+// started, in the RFC 3339 format the daemon reports and log requests accept as since.
+// ctx: The context.Context to use for the inspect operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be inspected.
+func (dm *DockerManager) StartedAt(ctx context.Context, name string) (string, error) {
+	info, err := dm.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	if info.State == nil {
+		return "", fmt.Errorf("container %s has no state", name)
+	}
+
+	return info.State.StartedAt, nil
+}
+
+// ContainerImage returns the image reference a container was created from.
+// ctx: The context.Context to use for the inspect operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be inspected.
+func (dm *DockerManager) ContainerImage(ctx context.Context, name string) (string, error) {
+	info, err := dm.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	if info.Config == nil {
+		return "", fmt.Errorf("container %s has no config", name)
+	}
+
+	return info.Config.Image, nil
+}
+
+// CopyDir replaces the directory to with a copy of the directory from in a job container
+// that mounts the given volumes. The paths are paths inside the job container.
+// ctx: The context.Context to use for the container operations.
+// name: The name of the job container.
+// image: The image to run, it needs /bin/sh and cp.
+// volumes: The volumes holding from and to.
+// Returns an error if the copy fails.
+func (dm *DockerManager) CopyDir(ctx context.Context, name, image string, volumes []VolumeMount, from, to string) error {
+	spec := NodeSpec{
+		Name:       name,
+		Image:      image,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{fmt.Sprintf("rm -rf %[2]s && cp -a %[1]s %[2]s", shellQuote(from), shellQuote(to))},
+		Volumes:    volumes,
+		Labels:     map[string]string{ToolboxLabel: "true"},
+	}
+	if _, _, err := dm.RunToCompletion(ctx, spec); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", from, to, err)
+	}
+	log.Printf("Copied %s to %s", from, to)
+
+	return nil
+}
+
+// shellQuote quotes s as a single word for /bin/sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// KillContainer sends a signal to the main process of a container.
+// ctx: The context.Context to use for the kill operation.
+// name: The name or ID of the container.
+// signal: The signal, e.g. `SIGKILL`. Empty sends SIGKILL.
+// Returns an error if the container cannot be signalled.
+func (dm *DockerManager) KillContainer(ctx context.Context, name, signal string) error {
+	if err := dm.cli.ContainerKill(ctx, name, signal); err != nil {
+		return fmt.Errorf("failed to kill container %s: %w", name, err)
+	}
+	log.Printf("Container %s killed", name)
+
+	return nil
+}
+
+// PauseContainer freezes all processes of a container.
+// ctx: The context.Context to use for the pause operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be paused.
+func (dm *DockerManager) PauseContainer(ctx context.Context, name string) error {
+	if err := dm.cli.ContainerPause(ctx, name); err != nil {
+		return fmt.Errorf("failed to pause container %s: %w", name, err)
+	}
+	log.Printf("Container %s paused", name)
+
+	return nil
+}
+
+// UnpauseContainer resumes a paused container.
+// ctx: The context.Context to use for the unpause operation.
+// name: The name or ID of the container.
+// Returns an error if the container cannot be resumed.
+func (dm *DockerManager) UnpauseContainer(ctx context.Context, name string) error {
+	if err := dm.cli.ContainerUnpause(ctx, name); err != nil {
+		return fmt.Errorf("failed to unpause container %s: %w", name, err)
+	}
+	log.Printf("Container %s unpaused", name)
+
+	return nil
+}
+
+// ListStackContainers returns all containers, running or not, labelled with the StackLabel of stack.
+// ctx: The context.Context to use for the list operation.
+// stack: The name of the stack.
+// Returns the containers and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListStackContainers(ctx context.Context, stack string) ([]types.Container, error) {
+	return dm.ListLabeledContainers(ctx, StackLabel, stack)
+}
+
+// ListStackVolumes returns the names of the volumes labelled with the StackLabel of stack.
+// ctx: The context.Context to use for the list operation.
+// stack: The name of the stack.
+// Returns the volume names and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListStackVolumes(ctx context.Context, stack string) ([]string, error) {
+	return dm.ListLabeledVolumes(ctx, StackLabel, stack)
+}
+
+// ListLabeledContainers returns all containers, running or not, whose label has value.
+// ctx: The context.Context to use for the list operation.
+// label: The label key, e.g. StackLabel.
+// value: The value of the label.
+// Returns the containers and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListLabeledContainers(ctx context.Context, label, value string) ([]types.Container, error) {
+	containers, err := dm.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label+"="+value)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers labelled %s=%s: %w", label, value, err)
+	}
+
+	return containers, nil
+}
+
+// ListLabeledVolumes returns the names of the volumes whose label has value.
+// ctx: The context.Context to use for the list operation.
+// label: The label key, e.g. StackLabel.
+// value: The value of the label.
+// Returns the volume names and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListLabeledVolumes(ctx context.Context, label, value string) ([]string, error) {
+	resp, err := dm.cli.VolumeList(ctx, volume.ListOptions{Filters: filters.NewArgs(filters.Arg("label", label+"="+value))})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes labelled %s=%s: %w", label, value, err)
+	}
+
+	names := make([]string, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		names = append(names, v.Name)
+	}
+
+	return names, nil
+}
+
+// ListLabeledNetworks returns the names of the networks whose label has value.
+// ctx: The context.Context to use for the list operation.
+// label: The label key, e.g. StackLabel.
+// value: The value of the label.
+// Returns the network names and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListLabeledNetworks(ctx context.Context, label, value string) ([]string, error) {
+	networks, err := dm.cli.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("label", label+"="+value))})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks labelled %s=%s: %w", label, value, err)
+	}
+
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+
+	return names, nil
+}
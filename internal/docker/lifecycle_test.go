@@ -0,0 +1,230 @@
+package docker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+)
+
+const image = "ghcr.io/kiracore/sekai:v0.3.46"
+
+func newManager() (*fake.Client, *docker.DockerManager) {
+	f := fake.New()
+	f.AddImage(image)
+	return f, docker.NewDockerManagerWithClient(f)
+}
+
+func TestEnsureNetworkAndVolume(t *testing.T) {
+	ctx := context.Background()
+	f, dm := newManager()
+	labels := map[string]string{docker.StackLabel: "kira"}
+
+	first, err := dm.EnsureNetwork(ctx, "kira-net", labels)
+	if err != nil {
+		t.Fatalf("EnsureNetwork() error: %v", err)
+	}
+	second, err := dm.EnsureNetwork(ctx, "kira-net", nil)
+	if err != nil {
+		t.Fatalf("EnsureNetwork() of an existing network error: %v", err)
+	}
+	if first != second {
+		t.Fatalf("EnsureNetwork() created a second network %s, want %s", second, first)
+	}
+	net, err := f.NetworkInspect(ctx, "kira-net", types.NetworkInspectOptions{})
+	if err != nil {
+		t.Fatalf("NetworkInspect() error: %v", err)
+	}
+	if net.Driver != "bridge" || net.Labels[docker.StackLabel] != "kira" {
+		t.Fatalf("network has driver %q and labels %v, want bridge with the stack label", net.Driver, net.Labels)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := dm.EnsureVolume(ctx, "kira-sekai", labels); err != nil {
+			t.Fatalf("EnsureVolume() #%d error: %v", i, err)
+		}
+	}
+	vol, err := f.VolumeInspect(ctx, "kira-sekai")
+	if err != nil {
+		t.Fatalf("VolumeInspect() error: %v", err)
+	}
+	if vol.Labels[docker.StackLabel] != "kira" {
+		t.Fatalf("volume labels = %v, want the stack label", vol.Labels)
+	}
+
+	if err := dm.RemoveVolume(ctx, "kira-sekai"); err != nil {
+		t.Fatalf("RemoveVolume() error: %v", err)
+	}
+	if err := dm.RemoveNetwork(ctx, "kira-net"); err != nil {
+		t.Fatalf("RemoveNetwork() error: %v", err)
+	}
+	if err := dm.RemoveVolume(ctx, "kira-sekai"); err != nil {
+		t.Fatalf("RemoveVolume() of a missing volume error: %v", err)
+	}
+	if err := dm.RemoveNetwork(ctx, "kira-net"); err != nil {
+		t.Fatalf("RemoveNetwork() of a missing network error: %v", err)
+	}
+}
+
+func TestRunToCompletion(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *docker.ExecResult
+		stdout string
+		err    string
+	}{
+		{
+			name:   "success",
+			result: &docker.ExecResult{Stdout: "initialised\n"},
+			stdout: "initialised\n",
+		},
+		{
+			name:   "non-zero exit",
+			result: &docker.ExecResult{Stdout: "starting\n", Stderr: "no space left\n", ExitCode: 2},
+			stdout: "starting\n",
+			err:    "job init exited with code 2: no space left",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f, dm := newManager()
+			var ran []string
+			f.RunHandler = func(containerName string, cmd []string) *docker.ExecResult {
+				ran = cmd
+				return tt.result
+			}
+
+			stdout, _, err := dm.RunToCompletion(ctx, docker.NodeSpec{Name: "init", Image: image, Cmd: []string{"init", "--home=/sekai"}})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("RunToCompletion() error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("RunToCompletion() = %v, want error containing %q", err, tt.err)
+			}
+			if stdout != tt.stdout {
+				t.Fatalf("stdout = %q, want %q", stdout, tt.stdout)
+			}
+			if strings.Join(ran, " ") != "init --home=/sekai" {
+				t.Fatalf("job ran %q, want the spec command", ran)
+			}
+			if exists, err := dm.ContainerExists(ctx, "init"); err != nil || exists {
+				t.Fatalf("job container exists = %v, %v after the run, want it removed", exists, err)
+			}
+		})
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	healthcheck := &docker.Healthcheck{Test: "true", Interval: time.Second, Timeout: time.Second, Retries: 1}
+	tests := []struct {
+		name        string
+		healthcheck *docker.Healthcheck
+		startHealth string
+		exit        *docker.ExecResult
+		err         string
+	}{
+		{name: "healthy", healthcheck: healthcheck, startHealth: types.Healthy},
+		{name: "running without healthcheck"},
+		{name: "unhealthy", healthcheck: healthcheck, startHealth: types.Unhealthy, err: "is unhealthy"},
+		{name: "starting", healthcheck: healthcheck, startHealth: types.Starting, err: "timed out"},
+		{name: "exited", exit: &docker.ExecResult{ExitCode: 1}, err: "exited with code 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f, dm := newManager()
+			f.StartHealth = tt.startHealth
+			f.RunHandler = func(containerName string, cmd []string) *docker.ExecResult { return tt.exit }
+
+			if _, err := dm.CreateNodeContainer(ctx, docker.NodeSpec{Name: "sekai", Image: image, Healthcheck: tt.healthcheck}); err != nil {
+				t.Fatalf("CreateNodeContainer() error: %v", err)
+			}
+			if err := dm.StartContainer(ctx, "sekai"); err != nil {
+				t.Fatalf("StartContainer() error: %v", err)
+			}
+
+			err := dm.WaitHealthy(ctx, "sekai", 50*time.Millisecond)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("WaitHealthy() error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("WaitHealthy() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRecreateContainer(t *testing.T) {
+	ctx := context.Background()
+	f, dm := newManager()
+	const newImage = "ghcr.io/kiracore/sekai:v0.3.47"
+	f.AddImage(newImage)
+
+	if _, err := dm.EnsureNetwork(ctx, "kira-net", nil); err != nil {
+		t.Fatalf("EnsureNetwork() error: %v", err)
+	}
+	spec := docker.NodeSpec{
+		Name:    "sekai",
+		Image:   image,
+		Cmd:     []string{"start", "--home=/sekai"},
+		Network: "kira-net",
+		Volumes: []docker.VolumeMount{{Name: "kira-sekai", Target: "/sekai"}},
+		Labels:  map[string]string{docker.StackLabel: "kira"},
+	}
+	if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	if err := dm.StartContainer(ctx, "sekai"); err != nil {
+		t.Fatalf("StartContainer() error: %v", err)
+	}
+
+	oldImage, err := dm.RecreateContainer(ctx, "sekai", newImage)
+	if err != nil {
+		t.Fatalf("RecreateContainer() error: %v", err)
+	}
+	if oldImage != image {
+		t.Fatalf("RecreateContainer() = %s, want the old image %s", oldImage, image)
+	}
+
+	info, err := f.ContainerInspect(ctx, "sekai")
+	if err != nil {
+		t.Fatalf("ContainerInspect() error: %v", err)
+	}
+	if info.Config.Image != newImage {
+		t.Fatalf("recreated container runs %s, want %s", info.Config.Image, newImage)
+	}
+	if info.State.Running {
+		t.Fatal("recreated container is running, want it created only")
+	}
+	if strings.Join(info.Config.Cmd, " ") != "start --home=/sekai" || info.Config.Labels[docker.StackLabel] != "kira" {
+		t.Fatalf("recreated container has cmd %v and labels %v, want those of the old one", info.Config.Cmd, info.Config.Labels)
+	}
+	if _, ok := info.NetworkSettings.Networks["kira-net"]; !ok {
+		t.Fatalf("recreated container networks = %v, want kira-net", info.NetworkSettings.Networks)
+	}
+	if volume, err := dm.VolumeAt(ctx, "sekai", "/sekai"); err != nil || volume != "kira-sekai" {
+		t.Fatalf("VolumeAt() = %q, %v, want kira-sekai", volume, err)
+	}
+	if exists, err := dm.ContainerExists(ctx, "sekai-replaced"); err != nil || exists {
+		t.Fatalf("ContainerExists(sekai-replaced) = %t, %v, want the old container removed", exists, err)
+	}
+
+	// An image that is not on the daemon fails the create, the old container stays.
+	if _, err := dm.RecreateContainer(ctx, "sekai", "ghcr.io/kiracore/sekai:v9.9.9"); err == nil {
+		t.Fatal("RecreateContainer() with a missing image succeeded")
+	}
+	if current, err := dm.ContainerImage(ctx, "sekai"); err != nil || current != newImage {
+		t.Fatalf("ContainerImage() after a failed recreate = %q, %v, want the old container with %s", current, err, newImage)
+	}
+
+	if _, err := dm.RecreateContainer(ctx, "missing", newImage); err == nil {
+		t.Fatal("RecreateContainer() of a missing container succeeded")
+	}
+}
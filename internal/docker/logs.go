@@ -0,0 +1,183 @@
+package docker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// NodeLabel is the container label the launcher puts on every node container.
+// Its value is the node name, e.g. `sekai` or `interx`.
+const NodeLabel = "kira.node"
+
+// LogOptions describes which part of a container log should be read.
+type LogOptions struct {
+	// Follow keeps the stream open and prints new lines as they are written.
+	Follow bool
+	// Tail is the number of lines to show from the end of the log, or "all".
+	Tail string
+	// Since and Until accept RFC3339 timestamps, unix timestamps or relative durations like `42m`.
+	Since string
+	Until string
+	// Timestamps prefixes every line with its RFC3339Nano timestamp.
+	Timestamps bool
+	Stdout     bool
+	Stderr     bool
+}
+
+func (o LogOptions) toContainerLogsOptions() types.ContainerLogsOptions {
+	return types.ContainerLogsOptions{
+		ShowStdout: o.Stdout,
+		ShowStderr: o.Stderr,
+		Follow:     o.Follow,
+		Tail:       o.Tail,
+		Since:      o.Since,
+		Until:      o.Until,
+		Timestamps: o.Timestamps,
+	}
+}
+
+// StreamContainerLogs copies the logs of the given container into stdout and stderr.
+// In follow mode the call blocks until ctx is cancelled or the container stops.
+// ctx: The context.Context to use for the log operation.
+// containerName: The name or ID of the container.
+// opts: The LogOptions selecting streams and the time window.
+// Returns an error if the container cannot be inspected or the log stream fails.
+func (dm *DockerManager) StreamContainerLogs(ctx context.Context, containerName string, opts LogOptions, stdout, stderr io.Writer) error {
+	info, err := dm.cli.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+
+	out, err := dm.cli.ContainerLogs(ctx, info.ID, opts.toContainerLogsOptions())
+	if err != nil {
+		return fmt.Errorf("failed to retrieve container logs: %w", err)
+	}
+	defer out.Close()
+
+	// Containers with a TTY have a single raw stream, everything else is multiplexed.
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, out)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, out)
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to copy container logs: %w", err)
+	}
+
+	return nil
+}
+
+// ListNodeContainers returns all containers, running or not, that carry the NodeLabel.
+// Toolbox containers are left out.
+// ctx: The context.Context to use for the list operation.
+// Returns the containers and an error if the daemon cannot be queried.
+func (dm *DockerManager) ListNodeContainers(ctx context.Context) ([]types.Container, error) {
+	containers, err := dm.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", NodeLabel)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list node containers: %w", err)
+	}
+
+	nodes := containers[:0]
+	for _, c := range containers {
+		if _, ok := c.Labels[ToolboxLabel]; !ok {
+			nodes = append(nodes, c)
+		}
+	}
+
+	return nodes, nil
+}
+
+// ExportLogs writes the logs of the given containers into a gzip compressed tar archive.
+// Every container gets a `<name>/stdout.log` and a `<name>/stderr.log` entry.
+// Follow mode is ignored, the archive always contains a finite window. A tar entry needs its
+// size before its content, the logs of each container are spooled to temporary files and
+// copied into the archive from there, so no log is held in memory.
+// ctx: The context.Context to use for the log operations.
+// containerNames: The names or IDs of the containers to export.
+// opts: The LogOptions selecting streams and the time window.
+// w: The destination of the archive.
+// Returns an error if any of the containers cannot be read or the archive cannot be written.
+func (dm *DockerManager) ExportLogs(ctx context.Context, containerNames []string, opts LogOptions, w io.Writer) error {
+	opts.Follow = false
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for _, name := range containerNames {
+		log.Printf("Exporting logs of container %s", name)
+		if err := dm.exportContainerLogs(ctx, tw, name, opts, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	return nil
+}
+
+// exportContainerLogs spools the logs of one container to temporary files and adds them to tw.
+func (dm *DockerManager) exportContainerLogs(ctx context.Context, tw *tar.Writer, name string, opts LogOptions, modTime time.Time) error {
+	stdout, err := os.CreateTemp("", "kira-logs-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary log file: %w", err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	stderr, err := os.CreateTemp("", "kira-logs-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary log file: %w", err)
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+
+	if err := dm.StreamContainerLogs(ctx, name, opts, stdout, stderr); err != nil {
+		return err
+	}
+
+	dir := strings.TrimPrefix(name, "/")
+	files := []struct {
+		name string
+		f    *os.File
+	}{
+		{dir + "/stdout.log", stdout},
+		{dir + "/stderr.log", stderr},
+	}
+	for _, file := range files {
+		size, err := file.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("failed to read spooled %s: %w", file.name, err)
+		}
+		if _, err := file.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read spooled %s: %w", file.name, err)
+		}
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: size, ModTime: modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive header for %s: %w", file.name, err)
+		}
+		if _, err := io.CopyN(tw, file.f, size); err != nil {
+			return fmt.Errorf("failed to write %s to archive: %w", file.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package docker_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+)
+
+func TestStreamContainerLogsWindow(t *testing.T) {
+	ctx := context.Background()
+	f, dm := newManager()
+	if _, err := dm.CreateNodeContainer(ctx, docker.NodeSpec{Name: "sekai", Image: image}); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	for _, line := range []string{"one", "two", "three", "four"} {
+		if err := f.WriteLog("sekai", line == "three", line); err != nil {
+			t.Fatalf("WriteLog() error: %v", err)
+		}
+	}
+
+	// The timestamps of the fake clock, read back to pick the window boundaries.
+	stamped := new(bytes.Buffer)
+	if err := dm.StreamContainerLogs(ctx, "sekai", docker.LogOptions{Stdout: true, Stderr: true, Timestamps: true}, stamped, stamped); err != nil {
+		t.Fatalf("StreamContainerLogs() error: %v", err)
+	}
+	var at []time.Time
+	for _, line := range strings.Split(strings.TrimSpace(stamped.String()), "\n") {
+		ts, err := time.Parse(time.RFC3339Nano, strings.Fields(line)[0])
+		if err != nil {
+			t.Fatalf("line %q has no timestamp: %v", line, err)
+		}
+		at = append(at, ts)
+	}
+	if len(at) != 4 {
+		t.Fatalf("read %d stamped lines, want 4", len(at))
+	}
+
+	tests := []struct {
+		name   string
+		opts   docker.LogOptions
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "everything",
+			opts:   docker.LogOptions{Stdout: true, Stderr: true},
+			stdout: "one\ntwo\nfour\n",
+			stderr: "three\n",
+		},
+		{
+			name:   "since rfc3339",
+			opts:   docker.LogOptions{Stdout: true, Stderr: true, Since: at[1].Format(time.RFC3339)},
+			stdout: "two\nfour\n",
+			stderr: "three\n",
+		},
+		{
+			name:   "until unix timestamp",
+			opts:   docker.LogOptions{Stdout: true, Stderr: true, Until: strconv.FormatInt(at[1].Unix(), 10)},
+			stdout: "one\ntwo\n",
+		},
+		{
+			name:   "window",
+			opts:   docker.LogOptions{Stdout: true, Stderr: true, Since: at[1].Format(time.RFC3339), Until: at[2].Format(time.RFC3339)},
+			stdout: "two\n",
+			stderr: "three\n",
+		},
+		{
+			name:   "tail before since",
+			opts:   docker.LogOptions{Stdout: true, Tail: "1", Since: at[0].Format(time.RFC3339)},
+			stdout: "four\n",
+		},
+		{
+			name:   "stderr only",
+			opts:   docker.LogOptions{Stderr: true, Until: at[3].Format(time.RFC3339)},
+			stderr: "three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			if err := dm.StreamContainerLogs(ctx, "sekai", tt.opts, stdout, stderr); err != nil {
+				t.Fatalf("StreamContainerLogs() error: %v", err)
+			}
+			if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Fatalf("StreamContainerLogs() = %q, %q, want %q, %q", stdout, stderr, tt.stdout, tt.stderr)
+			}
+		})
+	}
+
+	if err := dm.StreamContainerLogs(ctx, "sekai", docker.LogOptions{Stdout: true, Since: "yesterday"}, new(bytes.Buffer), new(bytes.Buffer)); err == nil {
+		t.Fatal("StreamContainerLogs() with an invalid since succeeded")
+	}
+}
+
+func TestExportLogs(t *testing.T) {
+	ctx := context.Background()
+	f, dm := newManager()
+	for _, name := range []string{"sekai", "interx"} {
+		if _, err := dm.CreateNodeContainer(ctx, docker.NodeSpec{Name: name, Image: image}); err != nil {
+			t.Fatalf("CreateNodeContainer(%s) error: %v", name, err)
+		}
+		if err := f.WriteLog(name, false, name+" started"); err != nil {
+			t.Fatalf("WriteLog() error: %v", err)
+		}
+		if err := f.WriteLog(name, true, name+" warning"); err != nil {
+			t.Fatalf("WriteLog() error: %v", err)
+		}
+	}
+
+	archive := new(bytes.Buffer)
+	if err := dm.ExportLogs(ctx, []string{"sekai", "/interx"}, docker.LogOptions{Stdout: true, Stderr: true, Tail: "all"}, archive); err != nil {
+		t.Fatalf("ExportLogs() error: %v", err)
+	}
+
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatalf("archive is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("archive is not tar: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = string(content)
+	}
+	want := map[string]string{
+		"sekai/stdout.log":  "sekai started\n",
+		"sekai/stderr.log":  "sekai warning\n",
+		"interx/stdout.log": "interx started\n",
+		"interx/stderr.log": "interx warning\n",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("archive entries = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Fatalf("archive entry %s = %q, want %q", name, got[name], content)
+		}
+	}
+
+	if err := dm.ExportLogs(ctx, []string{"sekai", "missing"}, docker.LogOptions{Stdout: true}, new(bytes.Buffer)); err == nil {
+		t.Fatal("ExportLogs() of a missing container succeeded")
+	}
+}
@@ -0,0 +1,392 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v3"
+)
+
+// NodeSpec describes a node container the launcher creates.
+type NodeSpec struct {
+	Name       string   `yaml:"name"`
+	Image      string   `yaml:"image"`
+	Entrypoint []string `yaml:"entrypoint,omitempty"`
+	Cmd        []string `yaml:"cmd,omitempty"`
+	Env        []string `yaml:"env,omitempty"`
+	// Network is the docker network the container joins, the name of the container is its alias there.
+	Network string `yaml:"network,omitempty"`
+	// Ports are published in the docker notation, e.g. `26657:26657` or `127.0.0.1:9090:9090/tcp`.
+	Ports   []string      `yaml:"ports,omitempty"`
+	Volumes []VolumeMount `yaml:"volumes,omitempty"`
+	// Labels are added next to the NodeLabel.
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Healthcheck *Healthcheck      `yaml:"healthcheck,omitempty"`
+	// DependsOn names the nodes that have to be healthy before this one starts.
+	DependsOn []string       `yaml:"depends_on,omitempty"`
+	Resources ResourceLimits `yaml:"resources,omitempty"`
+	Logging   LogConfig      `yaml:"logging,omitempty"`
+}
+
+// VolumeMount mounts a named docker volume into a node container.
+type VolumeMount struct {
+	Name   string `yaml:"name"`
+	Target string `yaml:"target"`
+}
+
+// Healthcheck is the docker healthcheck of a node container.
+type Healthcheck struct {
+	// Test is a shell command, it is run with `CMD-SHELL`.
+	Test        string        `yaml:"test"`
+	Interval    time.Duration `yaml:"interval,omitempty"`
+	Timeout     time.Duration `yaml:"timeout,omitempty"`
+	StartPeriod time.Duration `yaml:"start_period,omitempty"`
+	Retries     int           `yaml:"retries,omitempty"`
+}
+
+// ResourceLimits holds the cgroup limits and ulimits applied to a node container.
+// Memory values use the docker notation, e.g. `512m` or `8g`.
+type ResourceLimits struct {
+	// CPUs is the number of CPUs the container may use, e.g. 1.5.
+	CPUs float64 `yaml:"cpus,omitempty"`
+	// CPUShares is the relative CPU weight against other containers (default 1024).
+	CPUShares int64 `yaml:"cpu_shares,omitempty"`
+	// CPUPeriod and CPUQuota limit the CFS scheduler, both in microseconds.
+	CPUPeriod         int64  `yaml:"cpu_period,omitempty"`
+	CPUQuota          int64  `yaml:"cpu_quota,omitempty"`
+	Memory            string `yaml:"memory,omitempty"`
+	MemoryReservation string `yaml:"memory_reservation,omitempty"`
+	PidsLimit         int64  `yaml:"pids_limit,omitempty"`
+	NoFile            Ulimit `yaml:"nofile,omitempty"`
+}
+
+// Ulimit is a soft/hard pair of a single ulimit.
+type Ulimit struct {
+	Soft int64 `yaml:"soft,omitempty"`
+	Hard int64 `yaml:"hard,omitempty"`
+}
+
+// LogConfig configures the log driver of a node container and its rotation.
+type LogConfig struct {
+	Driver  string `yaml:"driver,omitempty"`
+	MaxSize string `yaml:"max_size,omitempty"`
+	MaxFile int    `yaml:"max_file,omitempty"`
+}
+
+// HostInventory is the hardware a Docker daemon reports about its host.
+type HostInventory struct {
+	CPUs        int
+	MemoryBytes int64
+}
+
+// specsFile is the on-disk layout of a node spec file.
+type specsFile struct {
+	Nodes []NodeSpec `yaml:"nodes"`
+}
+
+// LoadNodeSpecs reads node specs from a YAML document with a top level `nodes` list.
+// r: An io.Reader with the YAML document.
+// Returns the parsed specs and an error if the document is invalid.
+func LoadNodeSpecs(r io.Reader) ([]NodeSpec, error) {
+	var file specsFile
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode node specs: %w", err)
+	}
+
+	for _, spec := range file.Nodes {
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return file.Nodes, nil
+}
+
+// Validate checks that the spec can be turned into a container.
+func (s NodeSpec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("node spec has no name")
+	}
+	if s.Image == "" {
+		return fmt.Errorf("node spec %s has no image", s.Name)
+	}
+	if _, _, err := nat.ParsePortSpecs(s.Ports); err != nil {
+		return fmt.Errorf("node spec %s: invalid ports: %w", s.Name, err)
+	}
+	for _, v := range s.Volumes {
+		if v.Name == "" || v.Target == "" {
+			return fmt.Errorf("node spec %s: volumes need a name and a target", s.Name)
+		}
+	}
+	if _, err := s.Resources.memory(); err != nil {
+		return fmt.Errorf("node spec %s: %w", s.Name, err)
+	}
+	if _, err := s.Resources.memoryReservation(); err != nil {
+		return fmt.Errorf("node spec %s: %w", s.Name, err)
+	}
+	if s.Resources.CPUs < 0 {
+		return fmt.Errorf("node spec %s: cpus %g is negative", s.Name, s.Resources.CPUs)
+	}
+	for _, limit := range []struct {
+		field string
+		value int64
+	}{
+		{"cpu_shares", s.Resources.CPUShares},
+		{"cpu_period", s.Resources.CPUPeriod},
+		{"cpu_quota", s.Resources.CPUQuota},
+		{"pids_limit", s.Resources.PidsLimit},
+		{"nofile soft limit", s.Resources.NoFile.Soft},
+		{"nofile hard limit", s.Resources.NoFile.Hard},
+	} {
+		if limit.value < 0 {
+			return fmt.Errorf("node spec %s: %s %d is negative", s.Name, limit.field, limit.value)
+		}
+	}
+	// The daemon maps cpus to NanoCPUs, which it refuses next to a CFS period or quota.
+	if s.Resources.CPUs != 0 && (s.Resources.CPUPeriod != 0 || s.Resources.CPUQuota != 0) {
+		return fmt.Errorf("node spec %s: cpus cannot be combined with cpu_period or cpu_quota", s.Name)
+	}
+	if s.Resources.NoFile.Soft > s.Resources.NoFile.Hard && s.Resources.NoFile.Hard != 0 {
+		return fmt.Errorf("node spec %s: nofile soft limit %d is above hard limit %d", s.Name, s.Resources.NoFile.Soft, s.Resources.NoFile.Hard)
+	}
+	if err := s.Logging.validate(); err != nil {
+		return fmt.Errorf("node spec %s: %w", s.Name, err)
+	}
+
+	return nil
+}
+
+// validate checks the rotation settings the way the json-file and local drivers do.
+func (l LogConfig) validate() error {
+	if l.MaxSize != "" {
+		size, err := units.RAMInBytes(l.MaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid logging max_size %q: %w", l.MaxSize, err)
+		}
+		if size <= 0 {
+			return fmt.Errorf("logging max_size %q is not positive", l.MaxSize)
+		}
+	}
+	if l.MaxFile < 0 {
+		return fmt.Errorf("logging max_file %d is negative", l.MaxFile)
+	}
+	if l.MaxFile > 1 && l.MaxSize == "" {
+		return fmt.Errorf("logging max_file %d needs a max_size to rotate at", l.MaxFile)
+	}
+	return nil
+}
+
+// ContainerConfig builds the container.Config for the spec.
+func (s NodeSpec) ContainerConfig() *container.Config {
+	labels := map[string]string{NodeLabel: s.Name}
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	exposed, _, _ := nat.ParsePortSpecs(s.Ports)
+
+	config := &container.Config{
+		Hostname:     s.Name,
+		Image:        s.Image,
+		Entrypoint:   s.Entrypoint,
+		Cmd:          s.Cmd,
+		Env:          s.Env,
+		ExposedPorts: exposed,
+		Labels:       labels,
+	}
+	if s.Healthcheck != nil {
+		config.Healthcheck = &container.HealthConfig{
+			Test:        []string{"CMD-SHELL", s.Healthcheck.Test},
+			Interval:    s.Healthcheck.Interval,
+			Timeout:     s.Healthcheck.Timeout,
+			StartPeriod: s.Healthcheck.StartPeriod,
+			Retries:     s.Healthcheck.Retries,
+		}
+	}
+
+	return config
+}
+
+// NetworkingConfig attaches the container to the network of the spec with its name as alias.
+func (s NodeSpec) NetworkingConfig() *network.NetworkingConfig {
+	if s.Network == "" {
+		return &network.NetworkingConfig{}
+	}
+
+	return &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+		s.Network: {Aliases: []string{s.Name}},
+	}}
+}
+
+// HostConfig builds the container.HostConfig with the resource limits and log settings of the spec.
+// Returns an error if one of the memory values cannot be parsed.
+func (s NodeSpec) HostConfig() (*container.HostConfig, error) {
+	memory, err := s.Resources.memory()
+	if err != nil {
+		return nil, err
+	}
+	reservation, err := s.Resources.memoryReservation()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := container.Resources{
+		NanoCPUs:          int64(s.Resources.CPUs * 1e9),
+		CPUShares:         s.Resources.CPUShares,
+		CPUPeriod:         s.Resources.CPUPeriod,
+		CPUQuota:          s.Resources.CPUQuota,
+		Memory:            memory,
+		MemoryReservation: reservation,
+	}
+	if s.Resources.PidsLimit != 0 {
+		pids := s.Resources.PidsLimit
+		resources.PidsLimit = &pids
+	}
+	if s.Resources.NoFile.Soft != 0 || s.Resources.NoFile.Hard != 0 {
+		hard := s.Resources.NoFile.Hard
+		if hard == 0 {
+			hard = s.Resources.NoFile.Soft
+		}
+		resources.Ulimits = []*units.Ulimit{{Name: "nofile", Soft: s.Resources.NoFile.Soft, Hard: hard}}
+	}
+
+	logConfig := container.LogConfig{Type: s.Logging.Driver}
+	if s.Logging.MaxSize != "" || s.Logging.MaxFile != 0 {
+		logConfig.Config = map[string]string{}
+		if s.Logging.MaxSize != "" {
+			logConfig.Config["max-size"] = s.Logging.MaxSize
+		}
+		if s.Logging.MaxFile != 0 {
+			logConfig.Config["max-file"] = strconv.Itoa(s.Logging.MaxFile)
+		}
+	}
+
+	_, bindings, err := nat.ParsePortSpecs(s.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ports: %w", err)
+	}
+	var mounts []mount.Mount
+	for _, v := range s.Volumes {
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: v.Name, Target: v.Target})
+	}
+
+	return &container.HostConfig{
+		NetworkMode:  container.NetworkMode(s.Network),
+		Resources:    resources,
+		LogConfig:    logConfig,
+		PortBindings: bindings,
+		Mounts:       mounts,
+	}, nil
+}
+
+// Check compares the limits against the host inventory and returns a warning
+// for every limit the host cannot satisfy.
+func (r ResourceLimits) Check(inv HostInventory) []string {
+	var warnings []string
+
+	if inv.CPUs > 0 {
+		if r.CPUs > float64(inv.CPUs) {
+			warnings = append(warnings, fmt.Sprintf("cpus %.2f exceeds the %d CPUs of the host", r.CPUs, inv.CPUs))
+		}
+		if r.CPUQuota > 0 {
+			period := r.CPUPeriod
+			if period == 0 {
+				period = 100000
+			}
+			if cpus := float64(r.CPUQuota) / float64(period); cpus > float64(inv.CPUs) {
+				warnings = append(warnings, fmt.Sprintf("cpu quota allows %.2f CPUs but the host has %d", cpus, inv.CPUs))
+			}
+		}
+	}
+
+	memory, _ := r.memory()
+	reservation, _ := r.memoryReservation()
+	if inv.MemoryBytes > 0 {
+		if memory > inv.MemoryBytes {
+			warnings = append(warnings, fmt.Sprintf("memory limit %s exceeds the %s of host memory", units.BytesSize(float64(memory)), units.BytesSize(float64(inv.MemoryBytes))))
+		}
+		if reservation > inv.MemoryBytes {
+			warnings = append(warnings, fmt.Sprintf("memory reservation %s exceeds the %s of host memory", units.BytesSize(float64(reservation)), units.BytesSize(float64(inv.MemoryBytes))))
+		}
+	}
+	if memory > 0 && reservation > memory {
+		warnings = append(warnings, fmt.Sprintf("memory reservation %s is above the memory limit %s", units.BytesSize(float64(reservation)), units.BytesSize(float64(memory))))
+	}
+
+	return warnings
+}
+
+func (r ResourceLimits) memory() (int64, error) {
+	return parseBytes("memory", r.Memory)
+}
+
+func (r ResourceLimits) memoryReservation() (int64, error) {
+	return parseBytes("memory_reservation", r.MemoryReservation)
+}
+
+func parseBytes(field, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+
+	return n, nil
+}
+
+// HostInventory returns the CPU and memory the Docker daemon reports for its host.
+// ctx: The context.Context to use for the info operation.
+// Returns the inventory and an error if the daemon cannot be queried.
+func (dm *DockerManager) HostInventory(ctx context.Context) (HostInventory, error) {
+	info, err := dm.cli.Info(ctx)
+	if err != nil {
+		return HostInventory{}, fmt.Errorf("failed to get docker info: %w", err)
+	}
+
+	return HostInventory{CPUs: info.NCPU, MemoryBytes: info.MemTotal}, nil
+}
+
+// CreateNodeContainer creates, but does not start, the container described by spec.
+// Limits that exceed the host inventory are logged as warnings, they do not fail the creation.
+// ctx: The context.Context to use for the container operations.
+// spec: The NodeSpec of the container.
+// Returns the ID of the new container and an error if the spec is invalid or the creation fails.
+func (dm *DockerManager) CreateNodeContainer(ctx context.Context, spec NodeSpec) (string, error) {
+	if err := spec.Validate(); err != nil {
+		return "", err
+	}
+
+	hostConfig, err := spec.HostConfig()
+	if err != nil {
+		return "", err
+	}
+
+	inv, err := dm.HostInventory(ctx)
+	if err != nil {
+		log.Printf("Skipping resource checks for %s: %s", spec.Name, err)
+	} else {
+		for _, warning := range spec.Resources.Check(inv) {
+			log.Printf("WARNING: node %s: %s", spec.Name, warning)
+		}
+	}
+
+	resp, err := dm.cli.ContainerCreate(ctx, spec.ContainerConfig(), hostConfig, spec.NetworkingConfig(), nil, spec.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container %s: %w", spec.Name, err)
+	}
+	for _, warning := range resp.Warnings {
+		log.Printf("WARNING: node %s: %s", spec.Name, warning)
+	}
+
+	return resp.ID, nil
+}
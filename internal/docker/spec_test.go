@@ -0,0 +1,188 @@
+package docker_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/mrlutik/kira2.0/internal/docker"
+)
+
+func validSpec() docker.NodeSpec {
+	return docker.NodeSpec{
+		Name:    "sekai",
+		Image:   image,
+		Network: "kira-net",
+		Ports:   []string{"26657:26657", "127.0.0.1:9090:9090/tcp"},
+		Volumes: []docker.VolumeMount{{Name: "kira-sekai", Target: "/sekai"}},
+		Labels:  map[string]string{"kira.stack": "kira"},
+		Healthcheck: &docker.Healthcheck{
+			Test:     "curl -f http://localhost:26657/status",
+			Interval: 10 * time.Second,
+			Retries:  3,
+		},
+		Resources: docker.ResourceLimits{
+			CPUs:              2,
+			CPUShares:         512,
+			Memory:            "4g",
+			MemoryReservation: "1g",
+			PidsLimit:         4096,
+			NoFile:            docker.Ulimit{Soft: 65535},
+		},
+		Logging: docker.LogConfig{Driver: "json-file", MaxSize: "100m", MaxFile: 3},
+	}
+}
+
+func TestNodeSpecValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *docker.NodeSpec)
+		err    string
+	}{
+		{name: "valid", modify: func(s *docker.NodeSpec) {}},
+		{name: "no name", modify: func(s *docker.NodeSpec) { s.Name = "" }, err: "has no name"},
+		{name: "no image", modify: func(s *docker.NodeSpec) { s.Image = "" }, err: "has no image"},
+		{name: "invalid port", modify: func(s *docker.NodeSpec) { s.Ports = []string{"26657:http"} }, err: "invalid ports"},
+		{name: "volume without target", modify: func(s *docker.NodeSpec) { s.Volumes[0].Target = "" }, err: "need a name and a target"},
+		{name: "invalid memory", modify: func(s *docker.NodeSpec) { s.Resources.Memory = "lots" }, err: "invalid memory"},
+		{name: "negative cpus", modify: func(s *docker.NodeSpec) { s.Resources.CPUs = -1 }, err: "cpus -1 is negative"},
+		{name: "negative cpu shares", modify: func(s *docker.NodeSpec) { s.Resources.CPUShares = -2 }, err: "cpu_shares -2 is negative"},
+		{name: "negative cpu quota", modify: func(s *docker.NodeSpec) { s.Resources.CPUs, s.Resources.CPUQuota = 0, -1 }, err: "cpu_quota -1 is negative"},
+		{name: "negative pids limit", modify: func(s *docker.NodeSpec) { s.Resources.PidsLimit = -1 }, err: "pids_limit -1 is negative"},
+		{name: "cpus with quota", modify: func(s *docker.NodeSpec) { s.Resources.CPUQuota = 50000 }, err: "cannot be combined"},
+		{name: "quota without cpus", modify: func(s *docker.NodeSpec) {
+			s.Resources.CPUs, s.Resources.CPUPeriod, s.Resources.CPUQuota = 0, 100000, 50000
+		}},
+		{name: "nofile soft above hard", modify: func(s *docker.NodeSpec) { s.Resources.NoFile = docker.Ulimit{Soft: 10, Hard: 5} }, err: "above hard limit"},
+		{name: "invalid log max size", modify: func(s *docker.NodeSpec) { s.Logging.MaxSize = "big" }, err: "invalid logging max_size"},
+		{name: "zero log max size", modify: func(s *docker.NodeSpec) { s.Logging.MaxSize = "0" }, err: "is not positive"},
+		{name: "negative log max file", modify: func(s *docker.NodeSpec) { s.Logging.MaxFile = -1 }, err: "max_file -1 is negative"},
+		{name: "log max file without max size", modify: func(s *docker.NodeSpec) { s.Logging.MaxSize = "" }, err: "needs a max_size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := validSpec()
+			tt.modify(&spec)
+			err := spec.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNodeSpecHostConfig(t *testing.T) {
+	spec := validSpec()
+	hc, err := spec.HostConfig()
+	if err != nil {
+		t.Fatalf("HostConfig() error: %v", err)
+	}
+
+	r := hc.Resources
+	if r.NanoCPUs != 2e9 || r.CPUShares != 512 || r.Memory != 4<<30 || r.MemoryReservation != 1<<30 {
+		t.Fatalf("resources = %+v, want 2 CPUs, 512 shares, 4g memory and 1g reservation", r)
+	}
+	if r.PidsLimit == nil || *r.PidsLimit != 4096 {
+		t.Fatalf("pids limit = %v, want 4096", r.PidsLimit)
+	}
+	if len(r.Ulimits) != 1 || r.Ulimits[0].Name != "nofile" || r.Ulimits[0].Soft != 65535 || r.Ulimits[0].Hard != 65535 {
+		t.Fatalf("ulimits = %+v, want nofile 65535 with the hard limit defaulting to the soft one", r.Ulimits)
+	}
+	if hc.LogConfig.Type != "json-file" || hc.LogConfig.Config["max-size"] != "100m" || hc.LogConfig.Config["max-file"] != "3" {
+		t.Fatalf("log config = %+v, want json-file rotating at 100m over 3 files", hc.LogConfig)
+	}
+	if b := hc.PortBindings[nat.Port("9090/tcp")]; len(b) != 1 || b[0].HostIP != "127.0.0.1" || b[0].HostPort != "9090" {
+		t.Fatalf("port bindings of 9090 = %+v, want 127.0.0.1:9090", b)
+	}
+	if len(hc.Mounts) != 1 || hc.Mounts[0].Source != "kira-sekai" || hc.Mounts[0].Target != "/sekai" {
+		t.Fatalf("mounts = %+v, want kira-sekai at /sekai", hc.Mounts)
+	}
+	if hc.NetworkMode != "kira-net" {
+		t.Fatalf("network mode = %s, want kira-net", hc.NetworkMode)
+	}
+
+	cfg := spec.ContainerConfig()
+	if cfg.Labels[docker.NodeLabel] != "sekai" || cfg.Labels["kira.stack"] != "kira" {
+		t.Fatalf("labels = %v, want the node label and the spec labels", cfg.Labels)
+	}
+	if cfg.Healthcheck == nil || cfg.Healthcheck.Test[0] != "CMD-SHELL" || cfg.Healthcheck.Retries != 3 {
+		t.Fatalf("healthcheck = %+v, want a CMD-SHELL test with 3 retries", cfg.Healthcheck)
+	}
+
+	bare, err := docker.NodeSpec{Name: "interx", Image: image}.HostConfig()
+	if err != nil {
+		t.Fatalf("HostConfig() of a bare spec error: %v", err)
+	}
+	if bare.Resources.PidsLimit != nil || bare.Resources.Ulimits != nil || bare.LogConfig.Config != nil {
+		t.Fatalf("bare host config = %+v, want no limits and the default log config", bare)
+	}
+}
+
+func TestResourceLimitsCheck(t *testing.T) {
+	host := docker.HostInventory{CPUs: 4, MemoryBytes: 8 << 30}
+	tests := []struct {
+		name     string
+		limits   docker.ResourceLimits
+		inv      docker.HostInventory
+		warnings []string
+	}{
+		{name: "fits", limits: docker.ResourceLimits{CPUs: 2, Memory: "4g", MemoryReservation: "2g"}, inv: host},
+		{name: "too many cpus", limits: docker.ResourceLimits{CPUs: 8}, inv: host, warnings: []string{"cpus 8.00 exceeds the 4 CPUs"}},
+		{name: "quota over the host", limits: docker.ResourceLimits{CPUQuota: 600000}, inv: host, warnings: []string{"cpu quota allows 6.00 CPUs"}},
+		{name: "quota with a period", limits: docker.ResourceLimits{CPUPeriod: 50000, CPUQuota: 150000}, inv: host},
+		{
+			name:     "memory over the host",
+			limits:   docker.ResourceLimits{Memory: "16g", MemoryReservation: "12g"},
+			inv:      host,
+			warnings: []string{"memory limit 16GiB exceeds", "memory reservation 12GiB exceeds"},
+		},
+		{name: "reservation above limit", limits: docker.ResourceLimits{Memory: "1g", MemoryReservation: "2g"}, inv: host, warnings: []string{"is above the memory limit"}},
+		{name: "unknown host", limits: docker.ResourceLimits{CPUs: 64, Memory: "1t"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := tt.limits.Check(tt.inv)
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("Check() = %q, want %d warnings", warnings, len(tt.warnings))
+			}
+			for i, want := range tt.warnings {
+				if !strings.Contains(warnings[i], want) {
+					t.Fatalf("warning %d = %q, want it to contain %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadNodeSpecs(t *testing.T) {
+	specs, err := docker.LoadNodeSpecs(strings.NewReader(`
+nodes:
+  - name: sekai
+    image: ghcr.io/kiracore/sekai:v0.3.46
+    resources:
+      cpus: 2
+      memory: 4g
+    logging:
+      max_size: 50m
+      max_file: 5
+`))
+	if err != nil {
+		t.Fatalf("LoadNodeSpecs() error: %v", err)
+	}
+	if len(specs) != 1 || specs[0].Resources.Memory != "4g" || specs[0].Logging.MaxFile != 5 {
+		t.Fatalf("LoadNodeSpecs() = %+v", specs)
+	}
+
+	if _, err := docker.LoadNodeSpecs(strings.NewReader("nodes:\n  - name: sekai\n    image: x\n    resources:\n      pids_limit: -1\n")); err == nil {
+		t.Fatal("LoadNodeSpecs() accepted a negative pids_limit")
+	}
+}
@@ -0,0 +1,224 @@
+package genesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a single difference between two genesis files.
+type Change struct {
+	// Path is the JSON path of the value, e.g. `app_state.bank.balances[kira1...].coins[ukex].amount`.
+	// List entries are addressed by their identifying field when they have one, by index otherwise.
+	Path string `json:"path"`
+	// Kind is one of `added`, `removed` or `changed`.
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Path, compact(c.New))
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Path, compact(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, compact(c.Old), compact(c.New))
+	}
+}
+
+// identityFields are the fields that identify an entry of a list in a sekai genesis, in order of preference.
+// Lists whose entries all carry one of them are compared by that field instead of by position, so
+// inserted, removed or reordered accounts and validators do not show up as changes to their neighbours.
+// A field has alternatives where entries of one list are encoded differently: base accounts carry
+// their address at the top level, module and vesting accounts under base_account.
+var identityFields = [][]string{
+	{"address", "base_account.address", "base_vesting_account.base_account.address"},
+	{"val_key"},
+	{"denom"},
+	{"name"},
+	{"id"},
+	{"sid"},
+	{"transaction_type"},
+}
+
+// Diff compares two genesis files semantically: key order, whitespace and the order of
+// identifiable list entries do not matter.
+// Returns the changes sorted by path and an error if either file is not valid JSON.
+func Diff(a, b []byte) ([]Change, error) {
+	left, err := decode(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode first genesis: %w", err)
+	}
+	right, err := decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode second genesis: %w", err)
+	}
+
+	var changes []Change
+	diffValues("", left, right, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes, nil
+}
+
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			diffObjects(path, av, bv, changes)
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			diffLists(path, av, bv, changes)
+			return
+		}
+	default:
+		if compact(a) == compact(b) {
+			return
+		}
+	}
+	*changes = append(*changes, Change{Path: path, Kind: "changed", Old: a, New: b})
+}
+
+func diffObjects(path string, a, b map[string]interface{}, changes *[]Change) {
+	for key, av := range a {
+		bv, ok := b[key]
+		if !ok {
+			*changes = append(*changes, Change{Path: join(path, key), Kind: "removed", Old: av})
+			continue
+		}
+		diffValues(join(path, key), av, bv, changes)
+	}
+	for key, bv := range b {
+		if _, ok := a[key]; !ok {
+			*changes = append(*changes, Change{Path: join(path, key), Kind: "added", New: bv})
+		}
+	}
+}
+
+func diffLists(path string, a, b []interface{}, changes *[]Change) {
+	if field := identityField(a, b); field != nil {
+		left, right := index(a, field), index(b, field)
+		for id, av := range left {
+			bv, ok := right[id]
+			if !ok {
+				*changes = append(*changes, Change{Path: path + "[" + id + "]", Kind: "removed", Old: av})
+				continue
+			}
+			diffValues(path+"["+id+"]", av, bv, changes)
+		}
+		for id, bv := range right {
+			if _, ok := left[id]; !ok {
+				*changes = append(*changes, Change{Path: path + "[" + id + "]", Kind: "added", New: bv})
+			}
+		}
+		return
+	}
+
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(b):
+			*changes = append(*changes, Change{Path: p, Kind: "removed", Old: a[i]})
+		case i >= len(a):
+			*changes = append(*changes, Change{Path: p, Kind: "added", New: b[i]})
+		default:
+			diffValues(p, a[i], b[i], changes)
+		}
+	}
+}
+
+// identityField returns the first identity field that is present and unique in every entry of both lists.
+func identityField(lists ...[]interface{}) []string {
+	for _, field := range identityFields {
+		usable := true
+		for _, list := range lists {
+			ids := map[string]bool{}
+			for _, entry := range list {
+				id, ok := lookup(entry, field)
+				if !ok || ids[id] {
+					usable = false
+					break
+				}
+				ids[id] = true
+			}
+			if !usable {
+				break
+			}
+		}
+		if usable && (len(lists[0]) > 0 || len(lists[1]) > 0) {
+			return field
+		}
+	}
+	return nil
+}
+
+func index(list []interface{}, field []string) map[string]interface{} {
+	m := make(map[string]interface{}, len(list))
+	for _, entry := range list {
+		id, _ := lookup(entry, field)
+		m[id] = entry
+	}
+	return m
+}
+
+// lookup resolves the first of the alternative fields present in an object and returns it as a string.
+func lookup(v interface{}, field []string) (string, bool) {
+	for _, alt := range field {
+		if id, ok := lookupPath(v, alt); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// lookupPath resolves a dotted field in an object and returns it as a string.
+func lookupPath(v interface{}, field string) (string, bool) {
+	for _, part := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[part]; !ok {
+			return "", false
+		}
+	}
+	switch id := v.(type) {
+	case string:
+		return id, id != ""
+	case json.Number:
+		return id.String(), true
+	}
+	return "", false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func compact(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
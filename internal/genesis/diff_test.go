@@ -0,0 +1,86 @@
+package genesis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	base := `{
+  "chain_id": "localnet-1",
+  "app_state": {
+    "auth": {"accounts": [
+      {"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1a", "sequence": "0"},
+      {"@type": "/cosmos.auth.v1beta1.ModuleAccount", "base_account": {"address": "kira1module"}, "name": "gov"},
+      {"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1c", "sequence": "0"}
+    ]},
+    "customstaking": {"validators": [{"val_key": "kiravaloper1a", "status": "ACTIVE"}]}
+  }
+}`
+	tests := []struct {
+		name    string
+		other   string
+		changes []string
+	}{
+		{
+			name: "formatting and key order",
+			other: `{"app_state": {"customstaking": {"validators": [{"status": "ACTIVE", "val_key": "kiravaloper1a"}]}, "auth": {"accounts": [
+			  {"address": "kira1a", "sequence": "0", "@type": "/cosmos.auth.v1beta1.BaseAccount"},
+			  {"@type": "/cosmos.auth.v1beta1.ModuleAccount", "base_account": {"address": "kira1module"}, "name": "gov"},
+			  {"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1c", "sequence": "0"}
+			]}}, "chain_id": "localnet-1"}`,
+		},
+		{
+			name: "inserted account",
+			other: strings.Replace(base, `{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1a", "sequence": "0"},`,
+				`{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1a", "sequence": "0"},
+      {"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "kira1b", "sequence": "0"},`, 1),
+			changes: []string{`+ app_state.auth.accounts[kira1b]: {"@type":"/cosmos.auth.v1beta1.BaseAccount","address":"kira1b","sequence":"0"}`},
+		},
+		{
+			name:    "changed account",
+			other:   strings.Replace(base, `"address": "kira1c", "sequence": "0"`, `"address": "kira1c", "sequence": "4"`, 1),
+			changes: []string{`~ app_state.auth.accounts[kira1c].sequence: "0" -> "4"`},
+		},
+		{
+			name:    "removed validator",
+			other:   strings.Replace(base, `{"val_key": "kiravaloper1a", "status": "ACTIVE"}`, ``, 1),
+			changes: []string{`- app_state.customstaking.validators[kiravaloper1a]: {"status":"ACTIVE","val_key":"kiravaloper1a"}`},
+		},
+		{
+			name:    "chain id",
+			other:   strings.Replace(base, `"localnet-1"`, `"localnet-2"`, 1),
+			changes: []string{`~ chain_id: "localnet-1" -> "localnet-2"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff([]byte(base), []byte(tt.other))
+			if err != nil {
+				t.Fatalf("Diff() error: %v", err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.changes, "\n") {
+				t.Fatalf("Diff() = %q, want %q", got, tt.changes)
+			}
+		})
+	}
+
+	if _, err := Diff([]byte(base), []byte("{")); err == nil {
+		t.Fatal("Diff() accepted invalid JSON")
+	}
+}
+
+func TestDiffListsWithoutIdentity(t *testing.T) {
+	changes, err := Diff([]byte(`{"peers": ["a", "b"]}`), []byte(`{"peers": ["a", "c", "d"]}`))
+	if err != nil {
+		t.Fatalf("Diff() error: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Path != "peers[1]" || changes[0].Kind != "changed" || changes[1].Path != "peers[2]" || changes[1].Kind != "added" {
+		t.Fatalf("Diff() = %+v, want peers[1] changed and peers[2] added", changes)
+	}
+}
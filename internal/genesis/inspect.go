@@ -0,0 +1,292 @@
+package genesis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Document is the part of a sekai genesis file the launcher validates.
+type Document struct {
+	ChainID       string          `json:"chain_id"`
+	GenesisTime   string          `json:"genesis_time"`
+	InitialHeight json.Number     `json:"initial_height"`
+	Validators    []ConsensusKey  `json:"validators"`
+	AppState      json.RawMessage `json:"app_state"`
+}
+
+// ConsensusKey is an entry of the Tendermint validator set at the top level of the genesis.
+type ConsensusKey struct {
+	Address string `json:"address"`
+	PubKey  PubKey `json:"pub_key"`
+	Power   string `json:"power"`
+	Name    string `json:"name"`
+}
+
+// PubKey is a public key in either the amino (`type`/`value`) or the proto (`@type`/`key`) encoding.
+type PubKey struct {
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+	Proto string `json:"@type,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
+func (k PubKey) base64() string {
+	if k.Key != "" {
+		return k.Key
+	}
+	return k.Value
+}
+
+// Coin is a single denomination amount as it appears in the bank module.
+type Coin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+type appState struct {
+	Auth struct {
+		Accounts []struct {
+			Address     string `json:"address"`
+			BaseAccount *struct {
+				Address string `json:"address"`
+			} `json:"base_account"`
+		} `json:"accounts"`
+	} `json:"auth"`
+	Bank struct {
+		Balances []struct {
+			Address string `json:"address"`
+			Coins   []Coin `json:"coins"`
+		} `json:"balances"`
+		Supply []Coin `json:"supply"`
+	} `json:"bank"`
+	Customstaking *struct {
+		Validators []struct {
+			ValKey string `json:"val_key"`
+			PubKey PubKey `json:"pub_key"`
+			Status string `json:"status"`
+		} `json:"validators"`
+	} `json:"customstaking"`
+}
+
+// Report is the result of inspecting a genesis file.
+type Report struct {
+	ChainID     string `json:"chain_id"`
+	SHA256      string `json:"sha256"`
+	GenesisTime string `json:"genesis_time"`
+	Accounts    int    `json:"accounts"`
+	Validators  int    `json:"validators"`
+	// Balances is the sum of all account balances by denom.
+	Balances map[string]string `json:"balances"`
+	// Supply is the total supply recorded in the bank module. Empty for fresh genesis files,
+	// sekaid computes it from the balances then.
+	Supply   map[string]string `json:"supply"`
+	Warnings []string          `json:"warnings"`
+	Problems []string          `json:"problems"`
+	Valid    bool              `json:"valid"`
+}
+
+// Inspect parses a sekai genesis file and checks the chain-id format, the account and
+// balance lists, the total supply and the validator set.
+// Returns an error only if data is not a genesis file at all. Semantic problems are
+// collected in Report.Problems.
+func Inspect(data []byte) (*Report, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis: %w", err)
+	}
+	state := &appState{}
+	if len(doc.AppState) == 0 || string(doc.AppState) == "null" {
+		return nil, fmt.Errorf("genesis has no app_state")
+	}
+	if err := json.Unmarshal(doc.AppState, state); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis app_state: %w", err)
+	}
+
+	report := &Report{
+		ChainID:     doc.ChainID,
+		SHA256:      Hash(data),
+		GenesisTime: doc.GenesisTime,
+		Accounts:    len(state.Auth.Accounts),
+		Balances:    map[string]string{},
+		Supply:      map[string]string{},
+	}
+	problem := func(format string, args ...interface{}) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+	warning := func(format string, args ...interface{}) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if !chainIDPattern.MatchString(doc.ChainID) {
+		problem("invalid chain_id %q", doc.ChainID)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, doc.GenesisTime); err != nil {
+		problem("invalid genesis_time %q", doc.GenesisTime)
+	}
+
+	accounts := map[string]bool{}
+	for i, acc := range state.Auth.Accounts {
+		addr := acc.Address
+		if acc.BaseAccount != nil {
+			addr = acc.BaseAccount.Address
+		}
+		if addr == "" {
+			problem("auth account %d has no address", i)
+			continue
+		}
+		if accounts[addr] {
+			problem("auth account %s is listed twice", addr)
+		}
+		accounts[addr] = true
+	}
+
+	balances := map[string]*big.Int{}
+	seen := map[string]bool{}
+	for _, bal := range state.Bank.Balances {
+		if seen[bal.Address] {
+			problem("balance of %s is listed twice", bal.Address)
+		}
+		seen[bal.Address] = true
+		if !accounts[bal.Address] {
+			warning("balance of %s has no auth account", bal.Address)
+		}
+		for _, coin := range bal.Coins {
+			amount, ok := parseAmount(coin.Amount)
+			if !ok {
+				problem("balance of %s has invalid amount %q of %s", bal.Address, coin.Amount, coin.Denom)
+				continue
+			}
+			if balances[coin.Denom] == nil {
+				balances[coin.Denom] = new(big.Int)
+			}
+			balances[coin.Denom].Add(balances[coin.Denom], amount)
+		}
+	}
+	for denom, sum := range balances {
+		report.Balances[denom] = sum.String()
+	}
+
+	for _, coin := range state.Bank.Supply {
+		amount, ok := parseAmount(coin.Amount)
+		if !ok {
+			problem("supply has invalid amount %q of %s", coin.Amount, coin.Denom)
+			continue
+		}
+		report.Supply[coin.Denom] = amount.String()
+	}
+	if len(state.Bank.Supply) > 0 {
+		for _, denom := range unionKeys(report.Balances, report.Supply) {
+			if report.Balances[denom] != report.Supply[denom] {
+				problem("supply of %s is %s but balances add up to %s", denom, orZero(report.Supply[denom]), orZero(report.Balances[denom]))
+			}
+		}
+	}
+
+	report.checkValidators(doc, state)
+	report.Valid = len(report.Problems) == 0
+
+	return report, nil
+}
+
+// checkValidators verifies that the customstaking validator set is non-empty, has no duplicate
+// operator or consensus keys and matches the Tendermint validator set when the genesis has one.
+func (r *Report) checkValidators(doc *Document, state *appState) {
+	consensus := map[string]string{}
+	if state.Customstaking != nil {
+		r.Validators = len(state.Customstaking.Validators)
+		operators := map[string]bool{}
+		for _, val := range state.Customstaking.Validators {
+			if operators[val.ValKey] {
+				r.Problems = append(r.Problems, fmt.Sprintf("validator %s is listed twice", val.ValKey))
+			}
+			operators[val.ValKey] = true
+
+			key := val.PubKey.base64()
+			if key == "" {
+				r.Problems = append(r.Problems, fmt.Sprintf("validator %s has no consensus key", val.ValKey))
+				continue
+			}
+			if other, ok := consensus[key]; ok {
+				r.Problems = append(r.Problems, fmt.Sprintf("validators %s and %s share the consensus key %s", other, val.ValKey, key))
+			}
+			consensus[key] = val.ValKey
+		}
+	}
+	if r.Validators == 0 {
+		r.Problems = append(r.Problems, "genesis has no validators, the chain cannot produce blocks")
+	}
+
+	// Fresh sekai genesis files leave the Tendermint set empty, exported ones fill it in.
+	for _, val := range doc.Validators {
+		if _, ok := consensus[val.PubKey.base64()]; !ok {
+			r.Problems = append(r.Problems, fmt.Sprintf("consensus validator %s (%s) is not a customstaking validator", val.Name, val.Address))
+		}
+	}
+	if len(doc.Validators) > 0 && len(doc.Validators) != len(consensus) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d consensus validators but %d customstaking validators", len(doc.Validators), len(consensus)))
+	}
+}
+
+// String renders the report as human readable text.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chain ID:     %s\n", r.ChainID)
+	fmt.Fprintf(&b, "SHA-256:      %s\n", r.SHA256)
+	fmt.Fprintf(&b, "Genesis time: %s\n", r.GenesisTime)
+	fmt.Fprintf(&b, "Accounts:     %d\n", r.Accounts)
+	fmt.Fprintf(&b, "Validators:   %d\n", r.Validators)
+	b.WriteString("Balances:\n")
+	for _, denom := range unionKeys(r.Balances, r.Supply) {
+		supply := "not recorded"
+		if s, ok := r.Supply[denom]; ok {
+			supply = s
+		}
+		fmt.Fprintf(&b, "  %-12s %s (supply %s)\n", denom, orZero(r.Balances[denom]), supply)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", warning)
+	}
+	if r.Valid {
+		b.WriteString("Valid:        yes\n")
+	} else {
+		b.WriteString("Valid:        no\n")
+		for _, problem := range r.Problems {
+			fmt.Fprintf(&b, "  - %s\n", problem)
+		}
+	}
+
+	return b.String()
+}
+
+func parseAmount(s string) (*big.Int, bool) {
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, false
+	}
+	return amount, true
+}
+
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package genesis
+
+import (
+	"strings"
+	"testing"
+)
+
+const inspectGenesis = `{
+  "chain_id": "localnet-1",
+  "genesis_time": "2023-06-01T00:00:00Z",
+  "validators": [],
+  "app_state": {
+    "auth": {"accounts": [{"address": "kira1a"}, {"base_account": {"address": "kira1b"}}]},
+    "bank": {
+      "balances": [
+        {"address": "kira1a", "coins": [{"denom": "ukex", "amount": "300"}]},
+        {"address": "kira1b", "coins": [{"denom": "ukex", "amount": "200"}, {"denom": "test", "amount": "5"}]}
+      ],
+      "supply": []
+    },
+    "customstaking": {"validators": [{"val_key": "kiravaloper1a", "pub_key": {"@type": "/cosmos.crypto.ed25519.PubKey", "key": "cons-a"}}]}
+  }
+}`
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		replace  []string
+		problems []string
+		warnings []string
+	}{
+		{name: "valid"},
+		{name: "invalid chain id", replace: []string{`"localnet-1"`, `"Local Net"`}, problems: []string{`invalid chain_id "Local Net"`}},
+		{name: "invalid genesis time", replace: []string{`2023-06-01T00:00:00Z`, `yesterday`}, problems: []string{`invalid genesis_time "yesterday"`}},
+		{name: "duplicate account", replace: []string{`{"base_account": {"address": "kira1b"}}`, `{"address": "kira1a"}`}, problems: []string{"auth account kira1a is listed twice"}, warnings: []string{"balance of kira1b has no auth account"}},
+		{name: "invalid amount", replace: []string{`"amount": "300"`, `"amount": "-3"`}, problems: []string{`balance of kira1a has invalid amount "-3" of ukex`}},
+		{
+			name:     "supply mismatch",
+			replace:  []string{`"supply": []`, `"supply": [{"denom": "ukex", "amount": "400"}, {"denom": "test", "amount": "5"}]`},
+			problems: []string{"supply of ukex is 400 but balances add up to 500"},
+		},
+		{name: "no validators", replace: []string{`{"val_key": "kiravaloper1a", "pub_key": {"@type": "/cosmos.crypto.ed25519.PubKey", "key": "cons-a"}}`, ``}, problems: []string{"genesis has no validators"}},
+		{
+			name:     "consensus validator outside customstaking",
+			replace:  []string{`"validators": [],`, `"validators": [{"address": "ABC", "name": "other", "pub_key": {"type": "tendermint/PubKeyEd25519", "value": "cons-b"}}],`},
+			problems: []string{"consensus validator other (ABC) is not a customstaking validator"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := inspectGenesis
+			if tt.replace != nil {
+				data = strings.Replace(data, tt.replace[0], tt.replace[1], 1)
+			}
+			report, err := Inspect([]byte(data))
+			if err != nil {
+				t.Fatalf("Inspect() error: %v", err)
+			}
+			if report.Valid != (len(tt.problems) == 0) || len(report.Problems) != len(tt.problems) {
+				t.Fatalf("Inspect() problems = %q, want %q", report.Problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(report.Problems[i], want) {
+					t.Fatalf("problem %d = %q, want it to contain %q", i, report.Problems[i], want)
+				}
+			}
+			if len(report.Warnings) != len(tt.warnings) {
+				t.Fatalf("Inspect() warnings = %q, want %q", report.Warnings, tt.warnings)
+			}
+			for i, want := range tt.warnings {
+				if !strings.Contains(report.Warnings[i], want) {
+					t.Fatalf("warning %d = %q, want it to contain %q", i, report.Warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectSummary(t *testing.T) {
+	report, err := Inspect([]byte(inspectGenesis))
+	if err != nil {
+		t.Fatalf("Inspect() error: %v", err)
+	}
+	if report.Accounts != 2 || report.Validators != 1 || report.Balances["ukex"] != "500" || report.Balances["test"] != "5" {
+		t.Fatalf("Inspect() = %+v, want 2 accounts, 1 validator and 500ukex, 5test", report)
+	}
+	if report.SHA256 != Hash([]byte(inspectGenesis)) {
+		t.Fatalf("SHA256 = %s, want the hash of the file", report.SHA256)
+	}
+	if !strings.Contains(report.String(), "ukex         500 (supply not recorded)") {
+		t.Fatalf("String() = %q", report.String())
+	}
+
+	for _, data := range []string{`[]`, `{"chain_id": "x"}`} {
+		if _, err := Inspect([]byte(data)); err == nil {
+			t.Fatalf("Inspect(%s) accepted a file that is not a genesis", data)
+		}
+	}
+}
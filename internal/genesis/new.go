@@ -0,0 +1,176 @@
+package genesis
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Result is a genesis file produced by New.
+type Result struct {
+	ChainID string
+	Genesis []byte
+	// SHA256 is the hex encoded hash of Genesis, as expected by `sekaid start --genesis_hash`.
+	SHA256 string
+	// Keys are the keys New added to the keyring, with their mnemonics. Keys the keyring
+	// already held are left out.
+	Keys []sekai.Key
+}
+
+// New builds a genesis from spec by running sekaid init, keys add, add-genesis-account and
+// gentx-claim in the sekaid home of cli, then reads back the resulting genesis.json.
+// An existing genesis in the home is overwritten.
+func New(ctx context.Context, cli *sekai.CLI, spec *Spec) (*Result, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Initialising %s with chain-id %s...", cli.Home, spec.ChainID)
+	if _, err := cli.Run(ctx, "init", spec.moniker(), "--chain-id="+spec.ChainID, "--overwrite"); err != nil {
+		return nil, err
+	}
+
+	var keys []sekai.Key
+	for _, acc := range spec.Accounts {
+		target := acc.Address
+		if acc.Name != "" {
+			target = acc.Name
+			key, err := ensureKey(ctx, cli, acc.Name)
+			if err != nil {
+				return nil, err
+			}
+			if key != nil {
+				keys = append(keys, *key)
+			}
+		}
+
+		log.Infof("Adding genesis account %s with %s...", target, acc.Coins)
+		if _, err := cli.Run(ctx, "add-genesis-account", target, acc.Coins, "--keyring-backend="+sekai.KeyringBackend); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, val := range spec.Validators {
+		args := []string{"gentx-claim", val.Key, "--keyring-backend=" + sekai.KeyringBackend, "--moniker=" + val.Moniker}
+		if val.PubKey != "" {
+			args = append(args, "--pubkey="+val.PubKey)
+		}
+
+		log.Infof("Claiming genesis validator %s (%s)...", val.Moniker, val.Key)
+		if _, err := cli.Run(ctx, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := cli.DM.ReadFile(ctx, cli.Container, cli.GenesisPath())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ChainID: spec.ChainID, Genesis: data, SHA256: Hash(data), Keys: keys}
+	log.Infof("Genesis of %s created, sha256 %s", spec.ChainID, result.SHA256)
+
+	return result, nil
+}
+
+// ensureKey adds a key to the test keyring unless it already exists. Returns the new key, nil
+// for an existing one.
+func ensureKey(ctx context.Context, cli *sekai.CLI, name string) (*sekai.Key, error) {
+	if _, err := cli.Run(ctx, "keys", "show", name, "--keyring-backend="+sekai.KeyringBackend); err == nil {
+		return nil, nil
+	}
+
+	log.Infof("Creating key %s...", name)
+	return cli.AddKey(ctx, name)
+}
+
+// Hash returns the hex encoded SHA-256 of a genesis file.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Canonical returns a genesis as compact JSON with the keys of every object sorted. Documents
+// that only differ in formatting, like the file a network was started with and the document its
+// RPC serves, have the same canonical form and so the same canonical hash.
+func Canonical(data []byte) ([]byte, error) {
+	doc, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode genesis: %w", err)
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode genesis: %w", err)
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// Equal reports whether two genesis documents have the same canonical form.
+func Equal(a, b []byte) (bool, error) {
+	left, err := Canonical(a)
+	if err != nil {
+		return false, err
+	}
+	right, err := Canonical(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(left, right), nil
+}
+
+// WriteMnemonics saves the mnemonic of every new key to `<dir>/<name>.mnemonic`, readable by
+// the owner only, in the format `custody import --operator-mnemonic` reads. Existing files are
+// not overwritten. Returns the paths written.
+func (r *Result) WriteMnemonics(dir string) ([]string, error) {
+	if len(r.Keys) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create mnemonic directory %s: %w", dir, err)
+	}
+	var paths []string
+	for _, key := range r.Keys {
+		path := filepath.Join(dir, key.Name+".mnemonic")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return paths, fmt.Errorf("failed to write mnemonic of %s: %w", key.Name, err)
+		}
+		_, err = f.WriteString(key.Mnemonic + "\n")
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, fmt.Errorf("failed to write mnemonic of %s: %w", key.Name, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Write saves the genesis to path and records its hash in `<path>.sha256`
+// in the format `sha256sum --check` understands.
+func (r *Result) Write(path string) error {
+	if err := os.WriteFile(path, r.Genesis, 0644); err != nil {
+		return fmt.Errorf("failed to write genesis to %s: %w", path, err)
+	}
+
+	record := fmt.Sprintf("%s  %s\n", r.SHA256, filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(record), 0644); err != nil {
+		return fmt.Errorf("failed to write genesis hash to %s.sha256: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package genesis
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "sorts keys and drops whitespace",
+			in:   "{\n  \"chain_id\": \"localnet-1\",\n  \"app_state\": {\"b\": 1, \"a\": [2, 1]}\n}\n",
+			want: `{"app_state":{"a":[2,1],"b":1},"chain_id":"localnet-1"}`,
+		},
+		{
+			name: "keeps numbers as written",
+			in:   `{"big": 123456789012345678901234567890, "float": 1.50}`,
+			want: `{"big":123456789012345678901234567890,"float":1.50}`,
+		},
+		{
+			name: "does not escape html",
+			in:   `{"memo": "<a&b>"}`,
+			want: `{"memo":"<a&b>"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonical([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Canonical() error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Canonical() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	file := []byte("{\n  \"genesis_time\": \"2023-01-01T00:00:00Z\",\n  \"chain_id\": \"localnet-1\"\n}\n")
+	served := []byte(`{"chain_id":"localnet-1","genesis_time":"2023-01-01T00:00:00Z"}`)
+	other := []byte(`{"chain_id":"localnet-2","genesis_time":"2023-01-01T00:00:00Z"}`)
+
+	if same, err := Equal(file, served); err != nil || !same {
+		t.Fatalf("Equal(file, served) = %v, %v, want true", same, err)
+	}
+	if same, err := Equal(file, other); err != nil || same {
+		t.Fatalf("Equal(file, other) = %v, %v, want false", same, err)
+	}
+	if _, err := Equal(file, []byte("{")); err == nil {
+		t.Fatal("Equal() of invalid JSON succeeded")
+	}
+}
+
+func TestNewReturnsCreatedKeys(t *testing.T) {
+	ctx := context.Background()
+	const image = "ghcr.io/kiracore/sekai:v0.3.46"
+	f := fake.New()
+	f.AddImage(image)
+	var ran []string
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		ran = append(ran, strings.Join(cmd[1:3], " "))
+		switch {
+		case cmd[1] == "init":
+			f.WriteFile(containerName, sekai.DefaultHome+"/config/genesis.json", []byte(`{"chain_id":"localnet-1"}`))
+		case cmd[1] == "keys" && cmd[2] == "show" && cmd[3] != "faucet":
+			return docker.ExecResult{Stderr: "key not found", ExitCode: 1}
+		case cmd[1] == "keys" && cmd[2] == "add":
+			return docker.ExecResult{Stderr: `{"name":"` + cmd[3] + `","address":"kira1` + cmd[3] + `","mnemonic":"mnemonic of ` + cmd[3] + `"}` + "\n"}
+		}
+		return docker.ExecResult{}
+	}
+	dm := docker.NewDockerManagerWithClient(f)
+	if err := dm.StartToolbox(ctx, "genesis", image, nil); err != nil {
+		t.Fatalf("StartToolbox() error: %v", err)
+	}
+
+	spec := &Spec{
+		ChainID: "localnet-1",
+		Accounts: []Account{
+			{Name: "validator", Coins: "100ukex"},
+			{Name: "faucet", Coins: "100ukex"},
+			{Address: "kira1external", Coins: "100ukex"},
+		},
+		Validators: []Validator{{Key: "validator", Moniker: "validator"}},
+	}
+	result, err := New(ctx, sekai.NewCLI(dm, "genesis", ""), spec)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if len(result.Keys) != 1 || result.Keys[0].Name != "validator" || result.Keys[0].Mnemonic != "mnemonic of validator" {
+		t.Fatalf("Keys = %+v, want only the new validator key with its mnemonic", result.Keys)
+	}
+	if result.SHA256 != Hash([]byte(`{"chain_id":"localnet-1"}`)) {
+		t.Fatalf("SHA256 = %s, want the hash of the genesis read back", result.SHA256)
+	}
+
+	dir := filepath.Join(t.TempDir(), "mnemonics")
+	paths, err := result.WriteMnemonics(dir)
+	if err != nil {
+		t.Fatalf("WriteMnemonics() error: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("WriteMnemonics() wrote %v, want one file", paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", paths[0], err)
+	}
+	if string(data) != "mnemonic of validator\n" {
+		t.Fatalf("mnemonic file = %q", data)
+	}
+	if info, err := os.Stat(paths[0]); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("mnemonic file mode = %v, %v, want 0600", info.Mode(), err)
+	}
+	if _, err := result.WriteMnemonics(dir); err == nil {
+		t.Fatal("WriteMnemonics() overwrote an existing mnemonic")
+	}
+}
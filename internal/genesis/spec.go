@@ -0,0 +1,133 @@
+// Package genesis creates, inspects and compares sekai genesis files.
+package genesis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the declarative description of a new network's genesis.
+//
+//	chain_id: localnet-1
+//	moniker: GENESIS VALIDATOR
+//	accounts:
+//	  - name: validator
+//	    coins: 300000000000000ukex,1000000000test
+//	  - address: kira1wh5zkqgg87tes5r6ycp5r56qgyvzglhply5yu4
+//	    coins: 1000000ukex
+//	validators:
+//	  - key: validator
+//	    moniker: GENESIS VALIDATOR
+type Spec struct {
+	ChainID string `yaml:"chain_id"`
+	// Moniker is used for `sekaid init`. Defaults to the moniker of the first validator.
+	Moniker    string      `yaml:"moniker,omitempty"`
+	Accounts   []Account   `yaml:"accounts"`
+	Validators []Validator `yaml:"validators"`
+}
+
+// Account is an initial account of the genesis. Accounts with a Name get a key in the
+// test keyring of the node, accounts with an Address are added as they are.
+type Account struct {
+	Name    string `yaml:"name,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	// Coins is a comma separated list of coins, e.g. `300000000000000ukex,1000test`.
+	Coins string `yaml:"coins"`
+}
+
+// Validator is a genesis validator claimed with `sekaid gentx-claim`.
+type Validator struct {
+	// Key is the keyring name of the validator operator, it must be one of the named accounts.
+	Key     string `yaml:"key"`
+	Moniker string `yaml:"moniker"`
+	// PubKey is the consensus public key in the `sekaid tendermint show-validator` format.
+	// When empty the consensus key of the node the genesis is built on is used, which only the
+	// first validator may do.
+	PubKey string `yaml:"pubkey,omitempty"`
+}
+
+var (
+	// chainIDPattern is the cosmos chain-id format, e.g. `localnet-1` or `kira-mainnet-1`.
+	chainIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,48}$`)
+	coinsPattern   = regexp.MustCompile(`^[0-9]+[a-zA-Z][a-zA-Z0-9/:._-]{1,127}(,[0-9]+[a-zA-Z][a-zA-Z0-9/:._-]{1,127})*$`)
+)
+
+// LoadSpec decodes and validates a YAML genesis spec.
+func LoadSpec(r io.Reader) (*Spec, error) {
+	spec := &Spec{}
+	if err := yaml.NewDecoder(r).Decode(spec); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis spec: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// Validate checks the spec for problems that would make one of the sekaid steps fail.
+func (s *Spec) Validate() error {
+	if !chainIDPattern.MatchString(s.ChainID) {
+		return fmt.Errorf("invalid chain_id %q", s.ChainID)
+	}
+	if len(s.Validators) == 0 {
+		return fmt.Errorf("genesis spec needs at least one validator")
+	}
+
+	named := map[string]bool{}
+	seen := map[string]bool{}
+	for i, acc := range s.Accounts {
+		if (acc.Name == "") == (acc.Address == "") {
+			return fmt.Errorf("account %d needs either a name or an address", i)
+		}
+		id := acc.Name + acc.Address
+		if seen[id] {
+			return fmt.Errorf("account %s is listed twice", id)
+		}
+		seen[id] = true
+		if !coinsPattern.MatchString(acc.Coins) {
+			return fmt.Errorf("account %s has invalid coins %q", id, acc.Coins)
+		}
+		if acc.Name != "" {
+			named[acc.Name] = true
+		}
+	}
+
+	monikers := map[string]bool{}
+	pubKeys := map[string]bool{}
+	for i, val := range s.Validators {
+		if !named[val.Key] {
+			return fmt.Errorf("validator key %q is not a named account", val.Key)
+		}
+		if val.Moniker == "" {
+			return fmt.Errorf("validator %s has no moniker", val.Key)
+		}
+		if monikers[val.Moniker] {
+			return fmt.Errorf("validator moniker %q is used twice", val.Moniker)
+		}
+		monikers[val.Moniker] = true
+		// Only one validator can use the consensus key of the node the genesis is built on.
+		if val.PubKey == "" {
+			if i > 0 {
+				return fmt.Errorf("validator %s needs a pubkey, only the first validator may use the key of the node", val.Key)
+			}
+			continue
+		}
+		if pubKeys[val.PubKey] {
+			return fmt.Errorf("validator %s uses pubkey %s of another validator", val.Key, val.PubKey)
+		}
+		pubKeys[val.PubKey] = true
+	}
+
+	return nil
+}
+
+func (s *Spec) moniker() string {
+	if s.Moniker != "" {
+		return s.Moniker
+	}
+	return s.Validators[0].Moniker
+}
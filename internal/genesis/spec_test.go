@@ -0,0 +1,69 @@
+package genesis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpecValidateValidators(t *testing.T) {
+	accounts := []Account{
+		{Name: "a", Coins: "100ukex"},
+		{Name: "b", Coins: "100ukex"},
+		{Name: "c", Coins: "100ukex"},
+	}
+	tests := []struct {
+		name       string
+		validators []Validator
+		err        string
+	}{
+		{
+			name:       "single validator on the node key",
+			validators: []Validator{{Key: "a", Moniker: "A"}},
+		},
+		{
+			name: "first validator on the node key",
+			validators: []Validator{
+				{Key: "a", Moniker: "A"},
+				{Key: "b", Moniker: "B", PubKey: "pub-b"},
+				{Key: "c", Moniker: "C", PubKey: "pub-c"},
+			},
+		},
+		{
+			name: "every validator with a pubkey",
+			validators: []Validator{
+				{Key: "a", Moniker: "A", PubKey: "pub-a"},
+				{Key: "b", Moniker: "B", PubKey: "pub-b"},
+			},
+		},
+		{
+			name: "second validator without pubkey",
+			validators: []Validator{
+				{Key: "a", Moniker: "A", PubKey: "pub-a"},
+				{Key: "b", Moniker: "B"},
+			},
+			err: "validator b needs a pubkey",
+		},
+		{
+			name: "duplicate pubkey",
+			validators: []Validator{
+				{Key: "a", Moniker: "A"},
+				{Key: "b", Moniker: "B", PubKey: "pub"},
+				{Key: "c", Moniker: "C", PubKey: "pub"},
+			},
+			err: "validator c uses pubkey pub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &Spec{ChainID: "localnet-1", Accounts: accounts, Validators: tt.validators}
+			err := spec.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("Validate() = %v, want no error", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
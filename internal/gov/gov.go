@@ -0,0 +1,90 @@
+package gov
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// Execution fee types of the governance transactions.
+const (
+	submitFeeType = "submit-proposal"
+	voteFeeType   = "vote-proposal"
+)
+
+// Submitted is a proposal committed to the chain.
+type Submitted struct {
+	Title      string `json:"title"`
+	TxHash     string `json:"txhash"`
+	ProposalID uint64 `json:"proposal_id"`
+	Height     int64  `json:"height"`
+	Fees       string `json:"fees"`
+	GasUsed    int64  `json:"gas_used"`
+}
+
+// Submit broadcasts a proposal and returns the ID the chain assigned to it.
+func Submit(ctx context.Context, cli *sekai.CLI, p Proposal, opts sekai.TxOptions) (*Submitted, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.FeeType == "" {
+		opts.FeeType = submitFeeType
+	}
+
+	log.Infof("Submitting %s proposal %q...", p.Type, p.Title)
+	res, err := cli.Tx(ctx, opts, p.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit proposal %q: %w", p.Title, err)
+	}
+	id, err := strconv.ParseUint(res.Event("submit_proposal", "proposal_id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s of proposal %q emitted no proposal ID", res.TxHash, p.Title)
+	}
+
+	return &Submitted{Title: p.Title, TxHash: res.TxHash, ProposalID: id, Height: res.Height, Fees: res.Fees, GasUsed: res.GasUsed}, nil
+}
+
+// Option is a vote on a proposal, as sekaid takes it.
+type Option int
+
+// Options of a vote.
+const (
+	OptionYes        Option = 1
+	OptionAbstain    Option = 2
+	OptionNo         Option = 3
+	OptionNoWithVeto Option = 4
+)
+
+var optionNames = map[string]Option{
+	"yes":          OptionYes,
+	"abstain":      OptionAbstain,
+	"no":           OptionNo,
+	"veto":         OptionNoWithVeto,
+	"no_with_veto": OptionNoWithVeto,
+}
+
+// ParseOption parses yes, abstain, no or veto.
+func ParseOption(s string) (Option, error) {
+	o, ok := optionNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown vote option %q, expected yes, abstain, no or veto", s)
+	}
+	return o, nil
+}
+
+// Vote broadcasts a vote on proposal id and returns its transaction.
+func Vote(ctx context.Context, cli *sekai.CLI, id uint64, option Option, opts sekai.TxOptions) (*sekai.TxResult, error) {
+	if opts.FeeType == "" {
+		opts.FeeType = voteFeeType
+	}
+
+	log.Infof("Voting %d on proposal %d...", option, id)
+	res, err := cli.Tx(ctx, opts, "customgov", "proposal", "vote", strconv.FormatUint(id, 10), strconv.Itoa(int(option)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to vote on proposal %d: %w", id, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,203 @@
+// Package gov submits and follows customgov proposals through sekaid.
+package gov
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Type is a kind of proposal and how sekaid takes it.
+type Type struct {
+	// Command is the path of the subcommand below `sekaid tx`.
+	Command []string `json:"command"`
+	// Args are the parameters passed as positional arguments, in order. All are required.
+	Args []string `json:"args"`
+	// Flags are the required parameters passed as flags of the same name.
+	Flags []string `json:"flags"`
+	// Optional are the optional parameters passed as flags of the same name.
+	Optional []string `json:"optional"`
+}
+
+// Types are the proposals that can be built from YAML, by the name used in `type`.
+var Types = map[string]Type{
+	"set-network-property":   {Command: customgov("set-network-property"), Args: []string{"property", "value"}},
+	"set-poor-network-msgs":  {Command: customgov("set-poor-network-msgs"), Args: []string{"messages"}},
+	"set-proposal-durations": {Command: customgov("set-proposal-durations-proposal"), Args: []string{"proposal_types", "durations"}},
+	"upsert-data-registry":   {Command: customgov("upsert-data-registry"), Args: []string{"key", "hash", "reference", "encoding", "size"}},
+	"jail-councilor":         {Command: customgov("proposal-jail-councilor"), Args: []string{"councilors"}},
+	"reset-councilor-rank":   {Command: customgov("proposal-reset-whole-councilor-rank")},
+
+	"assign-role":                   {Command: customgov("account", "assign-role"), Args: []string{"role"}, Flags: []string{"addr"}},
+	"unassign-role":                 {Command: customgov("account", "unassign-role"), Args: []string{"role"}, Flags: []string{"addr"}},
+	"whitelist-permission":          {Command: customgov("account", "whitelist-permission"), Args: []string{"permission"}, Flags: []string{"addr"}},
+	"blacklist-permission":          {Command: customgov("account", "blacklist-permission"), Args: []string{"permission"}, Flags: []string{"addr"}},
+	"remove-whitelisted-permission": {Command: customgov("account", "remove-whitelisted-permission"), Args: []string{"permission"}, Flags: []string{"addr"}},
+	"remove-blacklisted-permission": {Command: customgov("account", "remove-blacklisted-permission"), Args: []string{"permission"}, Flags: []string{"addr"}},
+
+	"create-role":                        {Command: customgov("role", "create"), Args: []string{"role", "role_description"}, Optional: []string{"whitelist", "blacklist"}},
+	"remove-role":                        {Command: customgov("role", "remove"), Args: []string{"role"}},
+	"role-whitelist-permission":          {Command: customgov("role", "whitelist-permission"), Args: []string{"role", "permission"}},
+	"role-blacklist-permission":          {Command: customgov("role", "blacklist-permission"), Args: []string{"role", "permission"}},
+	"role-remove-whitelisted-permission": {Command: customgov("role", "remove-whitelisted-permission"), Args: []string{"role", "permission"}},
+	"role-remove-blacklisted-permission": {Command: customgov("role", "remove-blacklisted-permission"), Args: []string{"role", "permission"}},
+
+	"upsert-token-alias": {
+		Command:  []string{"tokens", "proposal-upsert-alias"},
+		Flags:    []string{"symbol", "name", "decimals", "denoms"},
+		Optional: []string{"icon", "invalidated"},
+	},
+	"upsert-token-rate": {
+		Command:  []string{"tokens", "proposal-upsert-rate"},
+		Flags:    []string{"denom", "rate"},
+		Optional: []string{"fee_payments", "stake_cap", "stake_min", "stake_token", "invalidated"},
+	},
+	"update-tokens-blackwhite": {
+		Command:  []string{"tokens", "proposal-update-tokens-blackwhite"},
+		Flags:    []string{"tokens"},
+		Optional: []string{"is_blacklist", "is_add"},
+	},
+}
+
+// customgov returns the path of a `sekaid tx customgov proposal` subcommand.
+func customgov(path ...string) []string {
+	return append([]string{"customgov", "proposal"}, path...)
+}
+
+// TypeNames returns the names of the Types, sorted.
+func TypeNames() []string {
+	names := make([]string, 0, len(Types))
+	for name := range Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Proposals is a YAML file of proposals.
+//
+//	proposals:
+//	  - type: set-network-property
+//	    title: Raise the minimum fee
+//	    description: Spam protection
+//	    property: MIN_TX_FEE
+//	    value: 200
+//	  - type: assign-role
+//	    title: Make kira1... a validator
+//	    role: validator
+//	    addr: kira1...
+//
+// Lists are passed to sekaid comma separated.
+type Proposals struct {
+	Proposals []Proposal `yaml:"proposals"`
+}
+
+// Proposal is one proposal of a Proposals file. The parameters of its type are set next to
+// the common fields.
+type Proposal struct {
+	Type        string                 `yaml:"type"`
+	Title       string                 `yaml:"title"`
+	Description string                 `yaml:"description"`
+	Params      map[string]interface{} `yaml:",inline"`
+}
+
+// LoadProposals decodes and validates a Proposals file.
+func LoadProposals(r io.Reader) ([]Proposal, error) {
+	var doc Proposals
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode proposals: %w", err)
+	}
+	if len(doc.Proposals) == 0 {
+		return nil, fmt.Errorf("no proposals found")
+	}
+	for i, p := range doc.Proposals {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("proposal %d: %w", i+1, err)
+		}
+	}
+
+	return doc.Proposals, nil
+}
+
+// LoadProposalsFile reads a Proposals file from path.
+func LoadProposalsFile(path string) ([]Proposal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open proposals %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return LoadProposals(f)
+}
+
+// Validate checks that the type is known, the title is set and the parameters match the type.
+func (p Proposal) Validate() error {
+	t, ok := Types[p.Type]
+	if !ok {
+		return fmt.Errorf("unknown proposal type %q, expected one of %s", p.Type, strings.Join(TypeNames(), ", "))
+	}
+	if p.Title == "" {
+		return fmt.Errorf("%s proposal has no title", p.Type)
+	}
+
+	known := map[string]bool{}
+	for _, group := range [][]string{t.Args, t.Flags, t.Optional} {
+		for _, name := range group {
+			known[name] = true
+		}
+	}
+	for name := range p.Params {
+		if !known[name] {
+			return fmt.Errorf("%s proposal has unknown parameter %q", p.Type, name)
+		}
+	}
+	for _, group := range [][]string{t.Args, t.Flags} {
+		for _, name := range group {
+			if p.param(name) == "" {
+				return fmt.Errorf("%s proposal needs parameter %q", p.Type, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// param returns a parameter as sekaid takes it.
+func (p Proposal) param(name string) string {
+	switch v := p.Params[name].(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Args returns the arguments of `sekaid tx` submitting the proposal.
+func (p Proposal) Args() []string {
+	t := Types[p.Type]
+	args := append([]string{}, t.Command...)
+	for _, name := range t.Args {
+		args = append(args, p.param(name))
+	}
+	for _, name := range append(append([]string{}, t.Flags...), t.Optional...) {
+		if v := p.param(name); v != "" {
+			args = append(args, "--"+name+"="+v)
+		}
+	}
+
+	return append(args, "--title="+p.Title, "--description="+p.Description)
+}
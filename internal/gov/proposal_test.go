@@ -0,0 +1,125 @@
+package gov_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/gov"
+)
+
+func TestProposalValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		proposal gov.Proposal
+		err      string
+	}{
+		{
+			name:     "network property",
+			proposal: gov.Proposal{Type: "set-network-property", Title: "Raise fee", Params: map[string]interface{}{"property": "MIN_TX_FEE", "value": 200}},
+		},
+		{
+			name:     "optional parameter left out",
+			proposal: gov.Proposal{Type: "upsert-token-rate", Title: "Rate", Params: map[string]interface{}{"denom": "ukex", "rate": "1.0"}},
+		},
+		{name: "no parameters", proposal: gov.Proposal{Type: "reset-councilor-rank", Title: "Reset"}},
+		{name: "unknown type", proposal: gov.Proposal{Type: "set-everything", Title: "All"}, err: `unknown proposal type "set-everything", expected one of assign-role,`},
+		{name: "no title", proposal: gov.Proposal{Type: "reset-councilor-rank"}, err: "reset-councilor-rank proposal has no title"},
+		{
+			name:     "unknown parameter",
+			proposal: gov.Proposal{Type: "assign-role", Title: "Role", Params: map[string]interface{}{"role": "validator", "addr": "kira1a", "address": "kira1a"}},
+			err:      `assign-role proposal has unknown parameter "address"`,
+		},
+		{
+			name:     "missing argument",
+			proposal: gov.Proposal{Type: "set-network-property", Title: "Fee", Params: map[string]interface{}{"property": "MIN_TX_FEE"}},
+			err:      `set-network-property proposal needs parameter "value"`,
+		},
+		{
+			name:     "missing flag",
+			proposal: gov.Proposal{Type: "assign-role", Title: "Role", Params: map[string]interface{}{"role": "validator"}},
+			err:      `assign-role proposal needs parameter "addr"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.proposal.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProposalArgs(t *testing.T) {
+	proposals, err := gov.LoadProposals(strings.NewReader(`
+proposals:
+  - type: set-network-property
+    title: Raise the minimum fee
+    description: Spam protection
+    property: MIN_TX_FEE
+    value: 200
+  - type: assign-role
+    title: Make kira1a a validator
+    role: validator
+    addr: kira1a
+  - type: create-role
+    title: Auditors
+    role: auditor
+    role_description: Read only
+    whitelist: [1, 2]
+  - type: upsert-token-rate
+    title: KEX rate
+    denom: ukex
+    rate: "1.0"
+    invalidated: false
+`))
+	if err != nil {
+		t.Fatalf("LoadProposals() error: %v", err)
+	}
+
+	want := []string{
+		"customgov proposal set-network-property MIN_TX_FEE 200 --title=Raise the minimum fee --description=Spam protection",
+		"customgov proposal account assign-role validator --addr=kira1a --title=Make kira1a a validator --description=",
+		"customgov proposal role create auditor Read only --whitelist=1,2 --title=Auditors --description=",
+		"tokens proposal-upsert-rate --denom=ukex --rate=1.0 --invalidated=false --title=KEX rate --description=",
+	}
+	if len(proposals) != len(want) {
+		t.Fatalf("LoadProposals() = %d proposals, want %d", len(proposals), len(want))
+	}
+	for i, p := range proposals {
+		if got := strings.Join(p.Args(), " "); got != want[i] {
+			t.Fatalf("Args() of %s = %q, want %q", p.Type, got, want[i])
+		}
+	}
+	// Every argument is one element, whatever spaces it holds.
+	if args := proposals[2].Args(); args[5] != "Read only" {
+		t.Fatalf("Args() = %q, want the role description as one argument", args)
+	}
+}
+
+func TestLoadProposals(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{name: "empty", yaml: "proposals: []\n", err: "no proposals found"},
+		{name: "invalid yaml", yaml: "proposals: {\n", err: "failed to decode proposals"},
+		{name: "invalid proposal", yaml: "proposals:\n  - type: remove-role\n    title: Drop\n", err: `proposal 1: remove-role proposal needs parameter "role"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := gov.LoadProposals(strings.NewReader(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("LoadProposals() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
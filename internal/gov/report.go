@@ -0,0 +1,470 @@
+package gov
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// Report is the state of the customgov module at one height, normalized so two reports of the
+// same state are equal: lists are sorted and numbers are kept as strings.
+type Report struct {
+	ChainID           string            `json:"chain_id"`
+	Height            int64             `json:"height"`
+	Generated         time.Time         `json:"generated"`
+	NetworkProperties map[string]string `json:"network_properties"`
+	Roles             []Role            `json:"roles"`
+	Members           []Member          `json:"members"`
+	Councilors        []Councilor       `json:"councilors"`
+	Permissions       []Permission      `json:"permissions"`
+	ExecutionFees     []ExecutionFee    `json:"execution_fees"`
+}
+
+// Role is a role with its permissions and the addresses it is assigned to.
+type Role struct {
+	ID          uint64   `json:"id"`
+	SID         string   `json:"sid"`
+	Description string   `json:"description"`
+	Whitelist   []int    `json:"whitelist"`
+	Blacklist   []int    `json:"blacklist"`
+	Addresses   []string `json:"addresses"`
+}
+
+// Member is a governance member that is not a councilor, with the roles and permissions
+// assigned to its address.
+type Member struct {
+	Address   string   `json:"address"`
+	Status    string   `json:"status"`
+	Roles     []string `json:"roles"`
+	Whitelist []int    `json:"whitelist"`
+	Blacklist []int    `json:"blacklist"`
+}
+
+// Councilor is a member of the council, with the permissions assigned to its address.
+type Councilor struct {
+	Address   string `json:"address"`
+	Status    string `json:"status"`
+	Rank      string `json:"rank"`
+	Whitelist []int  `json:"whitelist"`
+	Blacklist []int  `json:"blacklist"`
+}
+
+// Permission is a permission with the addresses it is whitelisted and blacklisted for.
+type Permission struct {
+	ID          int      `json:"id"`
+	Whitelisted []string `json:"whitelisted"`
+	Blacklisted []string `json:"blacklisted"`
+}
+
+// ExecutionFee is the fee of a transaction type.
+type ExecutionFee struct {
+	TransactionType string `json:"transaction_type"`
+	ExecutionFee    string `json:"execution_fee"`
+	FailureFee      string `json:"failure_fee"`
+	Timeout         string `json:"timeout"`
+}
+
+// scalar decodes a JSON string, number or bool as a string.
+type scalar string
+
+func (s *scalar) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = scalar(str)
+		return nil
+	}
+	*s = scalar(strings.TrimSpace(string(data)))
+	return nil
+}
+
+type permissionsResponse struct {
+	Whitelist []int `json:"whitelist"`
+	Blacklist []int `json:"blacklist"`
+}
+
+type addressesResponse struct {
+	Addresses []string `json:"addresses"`
+}
+
+// Collect queries the customgov module of the node at its latest height. All queries run at
+// that height so the report is consistent even while blocks are committed.
+func Collect(ctx context.Context, cli *sekai.CLI) (*Report, error) {
+	chainID, err := cli.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	height, err := cli.LatestHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	at := "--height=" + strconv.FormatInt(height, 10)
+	query := func(v interface{}, args ...string) error {
+		args = append(append([]string{"query", "customgov"}, args...), at)
+		if err := cli.RunJSON(ctx, v, args...); err != nil {
+			return fmt.Errorf("failed to query %s: %w", args[2], err)
+		}
+		return nil
+	}
+
+	log.Infof("Collecting customgov state of %s at height %d...", chainID, height)
+	r := &Report{ChainID: chainID, Height: height, Generated: time.Now().UTC().Truncate(time.Second), NetworkProperties: map[string]string{}}
+
+	var props struct {
+		Properties map[string]scalar `json:"properties"`
+	}
+	if err := query(&props, "network-properties"); err != nil {
+		return nil, err
+	}
+	for name, value := range props.Properties {
+		r.NetworkProperties[name] = string(value)
+	}
+
+	var roles struct {
+		Roles []struct {
+			ID          uint64              `json:"id"`
+			SID         string              `json:"sid"`
+			Description string              `json:"description"`
+			Permissions permissionsResponse `json:"permissions"`
+		} `json:"roles"`
+	}
+	if err := query(&roles, "all-roles"); err != nil {
+		return nil, err
+	}
+	permissions := map[int]bool{}
+	for _, role := range roles.Roles {
+		var addrs addressesResponse
+		if err := query(&addrs, "whitelisted-role-addresses", strconv.FormatUint(role.ID, 10)); err != nil {
+			return nil, err
+		}
+		r.Roles = append(r.Roles, Role{
+			ID:          role.ID,
+			SID:         role.SID,
+			Description: role.Description,
+			Whitelist:   sortedInts(role.Permissions.Whitelist),
+			Blacklist:   sortedInts(role.Permissions.Blacklist),
+			Addresses:   sortedStrings(addrs.Addresses),
+		})
+		addPermissions(permissions, role.Permissions)
+	}
+
+	var members struct {
+		NonCouncilors []struct {
+			Address     string              `json:"address"`
+			Status      string              `json:"status"`
+			Roles       []string            `json:"roles"`
+			Permissions permissionsResponse `json:"permissions"`
+		} `json:"non_councilors"`
+	}
+	if err := query(&members, "non-councilors"); err != nil {
+		return nil, err
+	}
+	for _, m := range members.NonCouncilors {
+		r.Members = append(r.Members, Member{
+			Address:   m.Address,
+			Status:    m.Status,
+			Roles:     sortedStrings(m.Roles),
+			Whitelist: sortedInts(m.Permissions.Whitelist),
+			Blacklist: sortedInts(m.Permissions.Blacklist),
+		})
+		addPermissions(permissions, m.Permissions)
+	}
+
+	var councilors struct {
+		Councilors []struct {
+			Address string `json:"address"`
+			Status  scalar `json:"status"`
+			Rank    scalar `json:"rank"`
+		} `json:"councilors"`
+	}
+	if err := query(&councilors, "councilors"); err != nil {
+		return nil, err
+	}
+	for _, c := range councilors.Councilors {
+		// Councilors are not listed with the non-councilors, their permissions are queried by address.
+		var perms permissionsResponse
+		if err := query(&perms, "permissions", c.Address); err != nil {
+			return nil, err
+		}
+		r.Councilors = append(r.Councilors, Councilor{
+			Address:   c.Address,
+			Status:    string(c.Status),
+			Rank:      string(c.Rank),
+			Whitelist: sortedInts(perms.Whitelist),
+			Blacklist: sortedInts(perms.Blacklist),
+		})
+		addPermissions(permissions, perms)
+	}
+
+	for _, id := range sortedIDs(permissions) {
+		var white, black addressesResponse
+		if err := query(&white, "whitelisted-permission-addresses", strconv.Itoa(id)); err != nil {
+			return nil, err
+		}
+		if err := query(&black, "blacklisted-permission-addresses", strconv.Itoa(id)); err != nil {
+			return nil, err
+		}
+		r.Permissions = append(r.Permissions, Permission{ID: id, Whitelisted: sortedStrings(white.Addresses), Blacklisted: sortedStrings(black.Addresses)})
+	}
+
+	var fees struct {
+		Fees []struct {
+			TransactionType string `json:"transaction_type"`
+			ExecutionFee    scalar `json:"execution_fee"`
+			FailureFee      scalar `json:"failure_fee"`
+			Timeout         scalar `json:"timeout"`
+		} `json:"fees"`
+	}
+	if err := query(&fees, "all-execution-fees"); err != nil {
+		return nil, err
+	}
+	for _, f := range fees.Fees {
+		r.ExecutionFees = append(r.ExecutionFees, ExecutionFee{
+			TransactionType: f.TransactionType,
+			ExecutionFee:    string(f.ExecutionFee),
+			FailureFee:      string(f.FailureFee),
+			Timeout:         string(f.Timeout),
+		})
+	}
+
+	r.normalize()
+	return r, nil
+}
+
+// LoadReport reads a report saved as JSON, e.g. a baseline.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode report %s: %w", path, err)
+	}
+	r.normalize()
+	return &r, nil
+}
+
+// normalize sorts the entries of every section and the lists within the entries, so a
+// baseline edited by hand compares equal to a collected report of the same state.
+func (r *Report) normalize() {
+	for i := range r.Roles {
+		sort.Ints(r.Roles[i].Whitelist)
+		sort.Ints(r.Roles[i].Blacklist)
+		sort.Strings(r.Roles[i].Addresses)
+	}
+	for i := range r.Members {
+		sort.Strings(r.Members[i].Roles)
+		sort.Ints(r.Members[i].Whitelist)
+		sort.Ints(r.Members[i].Blacklist)
+	}
+	for i := range r.Councilors {
+		sort.Ints(r.Councilors[i].Whitelist)
+		sort.Ints(r.Councilors[i].Blacklist)
+	}
+	for i := range r.Permissions {
+		sort.Strings(r.Permissions[i].Whitelisted)
+		sort.Strings(r.Permissions[i].Blacklisted)
+	}
+	sort.Slice(r.Roles, func(i, j int) bool { return r.Roles[i].ID < r.Roles[j].ID })
+	sort.Slice(r.Members, func(i, j int) bool { return r.Members[i].Address < r.Members[j].Address })
+	sort.Slice(r.Councilors, func(i, j int) bool { return r.Councilors[i].Address < r.Councilors[j].Address })
+	sort.Slice(r.Permissions, func(i, j int) bool { return r.Permissions[i].ID < r.Permissions[j].ID })
+	sort.Slice(r.ExecutionFees, func(i, j int) bool {
+		return r.ExecutionFees[i].TransactionType < r.ExecutionFees[j].TransactionType
+	})
+}
+
+// JSON returns the report as indented JSON.
+func (r *Report) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Markdown returns the report as a Markdown document. Changes against a baseline are listed
+// first when there are any.
+func (r *Report) Markdown(changes []Change) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Governance report of %s\n\n", r.ChainID)
+	fmt.Fprintf(&b, "Height %d, generated %s.\n\n", r.Height, r.Generated.Format(time.RFC3339))
+
+	if changes != nil {
+		b.WriteString("## Drift from baseline\n\n")
+		if len(changes) == 0 {
+			b.WriteString("No changes.\n\n")
+		} else {
+			b.WriteString("| Key | Baseline | Current |\n| --- | --- | --- |\n")
+			for _, c := range changes {
+				fmt.Fprintf(&b, "| `%s` | %s | %s |\n", c.Key, cell(c.Before), cell(c.After))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("## Network properties\n\n| Property | Value |\n| --- | --- |\n")
+	names := make([]string, 0, len(r.NetworkProperties))
+	for name := range r.NetworkProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "| %s | %s |\n", name, cell(r.NetworkProperties[name]))
+	}
+
+	b.WriteString("\n## Roles\n\n| ID | Role | Description | Whitelist | Blacklist | Addresses |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, role := range r.Roles {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n", role.ID, role.SID, cell(role.Description),
+			cell(joinInts(role.Whitelist)), cell(joinInts(role.Blacklist)), cell(strings.Join(role.Addresses, " ")))
+	}
+
+	b.WriteString("\n## Members\n\n| Address | Status | Roles | Whitelist | Blacklist |\n| --- | --- | --- | --- | --- |\n")
+	for _, m := range r.Members {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", m.Address, m.Status, cell(strings.Join(m.Roles, ",")),
+			cell(joinInts(m.Whitelist)), cell(joinInts(m.Blacklist)))
+	}
+
+	b.WriteString("\n## Councilors\n\n| Address | Status | Rank | Whitelist | Blacklist |\n| --- | --- | --- | --- | --- |\n")
+	for _, c := range r.Councilors {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", c.Address, c.Status, c.Rank, cell(joinInts(c.Whitelist)), cell(joinInts(c.Blacklist)))
+	}
+
+	b.WriteString("\n## Permissions\n\n| Permission | Whitelisted | Blacklisted |\n| --- | --- | --- |\n")
+	for _, p := range r.Permissions {
+		fmt.Fprintf(&b, "| %d | %s | %s |\n", p.ID, cell(strings.Join(p.Whitelisted, " ")), cell(strings.Join(p.Blacklisted, " ")))
+	}
+
+	b.WriteString("\n## Execution fees\n\n| Transaction | Execution fee | Failure fee | Timeout |\n| --- | --- | --- | --- |\n")
+	for _, f := range r.ExecutionFees {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", f.TransactionType, f.ExecutionFee, f.FailureFee, f.Timeout)
+	}
+
+	return b.String()
+}
+
+// Change is a value that differs between a baseline and a report. Before or After is empty
+// when the key was added or removed.
+type Change struct {
+	Key    string `json:"key"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Diff returns the values that changed from baseline to r, sorted by key.
+func Diff(baseline, r *Report) []Change {
+	before, after := baseline.flatten(), r.flatten()
+	changes := []Change{}
+	for key, value := range after {
+		if before[key] != value {
+			changes = append(changes, Change{Key: key, Before: before[key], After: value})
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, Change{Key: key, Before: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// flatten returns the governance state of the report as `section/entry/field` keys.
+// Chain-id, height and generation time are not part of the state.
+func (r *Report) flatten() map[string]string {
+	m := map[string]string{}
+	for name, value := range r.NetworkProperties {
+		m["network_properties/"+name] = value
+	}
+	for _, role := range r.Roles {
+		prefix := "roles/" + role.SID + "/"
+		m[prefix+"id"] = strconv.FormatUint(role.ID, 10)
+		m[prefix+"description"] = role.Description
+		m[prefix+"whitelist"] = joinInts(role.Whitelist)
+		m[prefix+"blacklist"] = joinInts(role.Blacklist)
+		m[prefix+"addresses"] = strings.Join(role.Addresses, ",")
+	}
+	for _, mem := range r.Members {
+		prefix := "members/" + mem.Address + "/"
+		m[prefix+"status"] = mem.Status
+		m[prefix+"roles"] = strings.Join(mem.Roles, ",")
+		m[prefix+"whitelist"] = joinInts(mem.Whitelist)
+		m[prefix+"blacklist"] = joinInts(mem.Blacklist)
+	}
+	for _, c := range r.Councilors {
+		prefix := "councilors/" + c.Address + "/"
+		m[prefix+"status"] = c.Status
+		m[prefix+"rank"] = c.Rank
+		m[prefix+"whitelist"] = joinInts(c.Whitelist)
+		m[prefix+"blacklist"] = joinInts(c.Blacklist)
+	}
+	for _, p := range r.Permissions {
+		prefix := "permissions/" + strconv.Itoa(p.ID) + "/"
+		m[prefix+"whitelisted"] = strings.Join(p.Whitelisted, ",")
+		m[prefix+"blacklisted"] = strings.Join(p.Blacklisted, ",")
+	}
+	for _, f := range r.ExecutionFees {
+		prefix := "execution_fees/" + f.TransactionType + "/"
+		m[prefix+"execution_fee"] = f.ExecutionFee
+		m[prefix+"failure_fee"] = f.FailureFee
+		m[prefix+"timeout"] = f.Timeout
+	}
+
+	// An empty list and a missing entry are the same state.
+	for key, value := range m {
+		if value == "" {
+			delete(m, key)
+		}
+	}
+	return m
+}
+
+func addPermissions(set map[int]bool, p permissionsResponse) {
+	for _, id := range append(append([]int{}, p.Whitelist...), p.Blacklist...) {
+		set[id] = true
+	}
+}
+
+func sortedIDs(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for id := range set {
+		out = append(out, id)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func sortedInts(in []int) []int {
+	out := append([]int{}, in...)
+	sort.Ints(out)
+	return out
+}
+
+func sortedStrings(in []string) []string {
+	out := append([]string{}, in...)
+	sort.Strings(out)
+	return out
+}
+
+func joinInts(in []int) string {
+	parts := make([]string, len(in))
+	for i, v := range in {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// cell escapes a value for a Markdown table cell.
+func cell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
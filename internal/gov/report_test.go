@@ -0,0 +1,263 @@
+package gov
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// customgovState answers the customgov queries of Collect by their name and argument.
+var customgovState = map[string]string{
+	"network-properties": `{"properties":{"min_tx_fee":"100","enable_foreign_fee_payments":true,"vote_quorum":33}}`,
+	"all-roles": `{"roles":[
+		{"id":2,"sid":"validator","description":"Validator","permissions":{"whitelist":[18,2]}},
+		{"id":1,"sid":"sudo","description":"Sudo","permissions":{"whitelist":[1],"blacklist":[]}}]}`,
+	"whitelisted-role-addresses 1": `{"addresses":["kira1councilor"]}`,
+	"whitelisted-role-addresses 2": `{"addresses":["kira1validator","kira1member"]}`,
+	"non-councilors":               `{"non_councilors":[{"address":"kira1member","status":"ACTIVE","roles":["2"],"permissions":{"whitelist":[3],"blacklist":[4]}}]}`,
+	"councilors":                   `{"councilors":[{"address":"kira1councilor","status":"active","rank":"5"}]}`,
+	"permissions kira1councilor":   `{"whitelist":[30,20],"blacklist":[40]}`,
+	"all-execution-fees":           `{"fees":[{"transaction_type":"submit-proposal","execution_fee":"10","failure_fee":1,"timeout":"10"}]}`,
+}
+
+// newNode returns a sekaid CLI in a container answering the customgov queries from state.
+// queries collects the queries it ran.
+func newNode(t *testing.T, state map[string]string, queries *[]string) *sekai.CLI {
+	f := fake.New()
+	f.AddImage("sekai")
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		if cmd[1] == "status" {
+			return docker.ExecResult{Stdout: `{"SyncInfo":{"latest_block_height":"120"}}`}
+		}
+		var args []string
+		for _, arg := range cmd[3:] {
+			if !strings.HasPrefix(arg, "--") {
+				args = append(args, arg)
+			} else if strings.HasPrefix(arg, "--height=") && arg != "--height=120" {
+				return docker.ExecResult{Stderr: "query at " + arg, ExitCode: 1}
+			}
+		}
+		query := strings.Join(args, " ")
+		*queries = append(*queries, query)
+		if out, ok := state[query]; ok {
+			return docker.ExecResult{Stdout: out}
+		}
+		if strings.HasSuffix(args[0], "-permission-addresses") {
+			return docker.ExecResult{Stdout: `{"addresses":["kira1` + args[1] + `"]}`}
+		}
+		return docker.ExecResult{Stderr: "unknown query " + query, ExitCode: 1}
+	}
+	dm := docker.NewDockerManagerWithClient(f)
+	if err := dm.StartToolbox(context.Background(), "sekai", "sekai", nil); err != nil {
+		t.Fatalf("StartToolbox() error: %v", err)
+	}
+	f.WriteFile("sekai", sekai.DefaultHome+"/config/genesis.json", []byte(`{"chain_id":"localnet-1"}`))
+	return sekai.NewCLI(dm, "sekai", sekai.DefaultHome)
+}
+
+func TestCollect(t *testing.T) {
+	var queries []string
+	r, err := Collect(context.Background(), newNode(t, customgovState, &queries))
+	if err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+
+	if r.ChainID != "localnet-1" || r.Height != 120 {
+		t.Fatalf("report of %s at %d, want localnet-1 at 120", r.ChainID, r.Height)
+	}
+	if want := map[string]string{"min_tx_fee": "100", "enable_foreign_fee_payments": "true", "vote_quorum": "33"}; !reflect.DeepEqual(r.NetworkProperties, want) {
+		t.Fatalf("NetworkProperties = %v, want %v", r.NetworkProperties, want)
+	}
+	if len(r.Roles) != 2 || r.Roles[0].SID != "sudo" || !reflect.DeepEqual(r.Roles[1].Whitelist, []int{2, 18}) ||
+		!reflect.DeepEqual(r.Roles[1].Addresses, []string{"kira1member", "kira1validator"}) {
+		t.Fatalf("Roles = %+v, want sudo then validator with sorted permissions and addresses", r.Roles)
+	}
+	want := Councilor{Address: "kira1councilor", Status: "active", Rank: "5", Whitelist: []int{20, 30}, Blacklist: []int{40}}
+	if len(r.Councilors) != 1 || !reflect.DeepEqual(r.Councilors[0], want) {
+		t.Fatalf("Councilors = %+v, want %+v", r.Councilors, want)
+	}
+	var ids []int
+	for _, p := range r.Permissions {
+		ids = append(ids, p.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 18, 20, 30, 40}) {
+		t.Fatalf("permissions = %v, want those of the roles, the members and the councilor", ids)
+	}
+	if p := r.Permissions[5]; p.ID != 20 || !reflect.DeepEqual(p.Whitelisted, []string{"kira120"}) {
+		t.Fatalf("permission 20 = %+v", p)
+	}
+	if f := r.ExecutionFees; len(f) != 1 || f[0].FailureFee != "1" {
+		t.Fatalf("ExecutionFees = %+v, want the numeric failure fee as a string", f)
+	}
+	if !strings.Contains(strings.Join(queries, "\n"), "permissions kira1councilor") {
+		t.Fatalf("queries = %q, want the permissions of the councilor", queries)
+	}
+}
+
+func TestCollectFails(t *testing.T) {
+	state := map[string]string{}
+	for query, out := range customgovState {
+		if query != "permissions kira1councilor" {
+			state[query] = out
+		}
+	}
+	var queries []string
+	if _, err := Collect(context.Background(), newNode(t, state, &queries)); err == nil || !strings.Contains(err.Error(), "failed to query permissions") {
+		t.Fatalf("Collect() = %v, want the failed councilor query", err)
+	}
+}
+
+func testReport() *Report {
+	return &Report{
+		ChainID:           "localnet-1",
+		Height:            120,
+		NetworkProperties: map[string]string{"min_tx_fee": "100", "vote_quorum": "33"},
+		Roles:             []Role{{ID: 1, SID: "sudo", Whitelist: []int{1}, Addresses: []string{"kira1a"}}},
+		Members:           []Member{{Address: "kira1b", Status: "ACTIVE", Roles: []string{"2"}}},
+		Councilors:        []Councilor{{Address: "kira1a", Status: "active", Rank: "1", Whitelist: []int{20}}},
+		Permissions:       []Permission{{ID: 1, Whitelisted: []string{"kira1a"}}},
+		ExecutionFees:     []ExecutionFee{{TransactionType: "vote", ExecutionFee: "10", FailureFee: "1", Timeout: "10"}},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *Report)
+		changes []Change
+	}{
+		{name: "same state", modify: func(r *Report) { r.Height, r.ChainID = 500, "localnet-2" }, changes: []Change{}},
+		{
+			name:    "changed property",
+			modify:  func(r *Report) { r.NetworkProperties["min_tx_fee"] = "200" },
+			changes: []Change{{Key: "network_properties/min_tx_fee", Before: "100", After: "200"}},
+		},
+		{
+			name:    "removed property",
+			modify:  func(r *Report) { delete(r.NetworkProperties, "vote_quorum") },
+			changes: []Change{{Key: "network_properties/vote_quorum", Before: "33"}},
+		},
+		{
+			name:   "new member",
+			modify: func(r *Report) { r.Members = append(r.Members, Member{Address: "kira1c", Status: "ACTIVE"}) },
+			changes: []Change{
+				{Key: "members/kira1c/status", After: "ACTIVE"},
+			},
+		},
+		{
+			name:    "councilor permission",
+			modify:  func(r *Report) { r.Councilors[0].Whitelist = []int{20, 21} },
+			changes: []Change{{Key: "councilors/kira1a/whitelist", Before: "20", After: "20,21"}},
+		},
+		{
+			name:    "empty list and missing entry",
+			modify:  func(r *Report) { r.Permissions = append(r.Permissions, Permission{ID: 9, Whitelisted: []string{}}) },
+			changes: []Change{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReport()
+			tt.modify(r)
+			if changes := Diff(testReport(), r); !reflect.DeepEqual(changes, tt.changes) {
+				t.Fatalf("Diff() = %+v, want %+v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	want := map[string]string{
+		"network_properties/min_tx_fee":     "100",
+		"network_properties/vote_quorum":    "33",
+		"roles/sudo/id":                     "1",
+		"roles/sudo/whitelist":              "1",
+		"roles/sudo/addresses":              "kira1a",
+		"members/kira1b/status":             "ACTIVE",
+		"members/kira1b/roles":              "2",
+		"councilors/kira1a/status":          "active",
+		"councilors/kira1a/rank":            "1",
+		"councilors/kira1a/whitelist":       "20",
+		"permissions/1/whitelisted":         "kira1a",
+		"execution_fees/vote/execution_fee": "10",
+		"execution_fees/vote/failure_fee":   "1",
+		"execution_fees/vote/timeout":       "10",
+	}
+	if got := testReport().flatten(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("flatten() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadReportNormalizes(t *testing.T) {
+	// A baseline edited by hand, with its entries and lists in any order.
+	baseline := `{
+  "network_properties": {"min_tx_fee": "100"},
+  "roles": [
+    {"id": 2, "sid": "validator", "whitelist": [18, 2], "addresses": ["kira1z", "kira1a"]},
+    {"id": 1, "sid": "sudo", "whitelist": [1]}
+  ],
+  "members": [{"address": "kira1m", "roles": ["2", "1"], "blacklist": [5, 4]}],
+  "councilors": [{"address": "kira1z", "rank": "2"}, {"address": "kira1a", "rank": "1", "whitelist": [30, 20]}],
+  "permissions": [{"id": 18, "whitelisted": ["kira1z", "kira1a"]}, {"id": 2}],
+  "execution_fees": [{"transaction_type": "vote"}, {"transaction_type": "claim"}]
+}`
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, []byte(baseline), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadReport(path)
+	if err != nil {
+		t.Fatalf("LoadReport() error: %v", err)
+	}
+
+	data, err := json.Marshal(struct {
+		Roles       []Role         `json:"roles"`
+		Members     []Member       `json:"members"`
+		Councilors  []Councilor    `json:"councilors"`
+		Permissions []Permission   `json:"permissions"`
+		Fees        []ExecutionFee `json:"fees"`
+	}{r.Roles, r.Members, r.Councilors, r.Permissions, r.ExecutionFees})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"roles":[{"id":1,"sid":"sudo"`,
+		`"whitelist":[2,18],"blacklist":null,"addresses":["kira1a","kira1z"]`,
+		`"roles":["1","2"],"whitelist":null,"blacklist":[4,5]`,
+		`"councilors":[{"address":"kira1a","status":"","rank":"1","whitelist":[20,30]`,
+		`"permissions":[{"id":2,"whitelisted":null,"blacklisted":null},{"id":18,"whitelisted":["kira1a","kira1z"]`,
+		`"fees":[{"transaction_type":"claim"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("normalized report = %s, want it to contain %s", data, want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	r := testReport()
+	r.Roles[0].Description = "Root | admin"
+	md := r.Markdown([]Change{{Key: "network_properties/min_tx_fee", Before: "100", After: "200"}})
+	for _, want := range []string{
+		"# Governance report of localnet-1",
+		"| `network_properties/min_tx_fee` | 100 | 200 |",
+		"| 1 | sudo | Root \\| admin | 1 | - | kira1a |",
+		"| kira1a | active | 1 | 20 | - |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("Markdown() = %s, want it to contain %q", md, want)
+		}
+	}
+	if md := r.Markdown([]Change{}); !strings.Contains(md, "No changes.") {
+		t.Fatalf("Markdown() without changes = %s", md)
+	}
+}
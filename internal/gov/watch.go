@@ -0,0 +1,141 @@
+package gov
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// Results of a proposal that is still open.
+const (
+	ResultPending   = "VOTE_PENDING"
+	ResultEnactment = "VOTE_RESULT_ENACTMENT"
+)
+
+// Status is the state of a proposal and the votes cast on it.
+type Status struct {
+	ProposalID      uint64         `json:"proposal_id"`
+	Title           string         `json:"title"`
+	Result          string         `json:"result"`
+	ExecResult      string         `json:"exec_result,omitempty"`
+	VotingEnd       time.Time      `json:"voting_end_time"`
+	EnactmentEnd    time.Time      `json:"enactment_end_time"`
+	Votes           map[string]int `json:"votes"`
+	Voters          int            `json:"voters"`
+	MinVotingEnd    int64          `json:"min_voting_end_block_height"`
+	MinEnactmentEnd int64          `json:"min_enactment_end_block_height"`
+}
+
+// Done reports whether the proposal reached its final outcome.
+func (s *Status) Done() bool {
+	return s.Result != "" && s.Result != ResultPending && s.Result != ResultEnactment
+}
+
+// Passed reports whether the proposal passed.
+func (s *Status) Passed() bool {
+	return s.Result == "VOTE_RESULT_PASSED"
+}
+
+// Tally returns the votes as `yes=2 no=1`, sorted by option.
+func (s *Status) Tally() string {
+	if len(s.Votes) == 0 {
+		return "no votes"
+	}
+	options := make([]string, 0, len(s.Votes))
+	for option := range s.Votes {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+
+	parts := make([]string, len(options))
+	for i, option := range options {
+		parts[i] = option + "=" + strconv.Itoa(s.Votes[option])
+	}
+	return strings.Join(parts, " ")
+}
+
+// proposalResponse is the output of `sekaid query customgov proposal`.
+type proposalResponse struct {
+	ProposalID                 uint64    `json:"proposal_id,string"`
+	Title                      string    `json:"title"`
+	VotingEndTime              time.Time `json:"voting_end_time"`
+	EnactmentEndTime           time.Time `json:"enactment_end_time"`
+	MinVotingEndBlockHeight    int64     `json:"min_voting_end_block_height,string"`
+	MinEnactmentEndBlockHeight int64     `json:"min_enactment_end_block_height,string"`
+	Result                     string    `json:"result"`
+	ExecResult                 string    `json:"exec_result"`
+}
+
+// votesResponse is the output of `sekaid query customgov votes`.
+type votesResponse struct {
+	Votes []struct {
+		Voter  string `json:"voter"`
+		Option string `json:"option"`
+	} `json:"votes"`
+}
+
+// Query returns the status of proposal id.
+func Query(ctx context.Context, cli *sekai.CLI, id uint64) (*Status, error) {
+	ref := strconv.FormatUint(id, 10)
+
+	var p proposalResponse
+	if err := cli.RunJSON(ctx, &p, "query", "customgov", "proposal", ref); err != nil {
+		return nil, fmt.Errorf("failed to query proposal %d: %w", id, err)
+	}
+	var v votesResponse
+	if err := cli.RunJSON(ctx, &v, "query", "customgov", "votes", ref); err != nil {
+		return nil, fmt.Errorf("failed to query votes of proposal %d: %w", id, err)
+	}
+
+	s := &Status{
+		ProposalID:      id,
+		Title:           p.Title,
+		Result:          p.Result,
+		ExecResult:      p.ExecResult,
+		VotingEnd:       p.VotingEndTime,
+		EnactmentEnd:    p.EnactmentEndTime,
+		Votes:           map[string]int{},
+		Voters:          len(v.Votes),
+		MinVotingEnd:    p.MinVotingEndBlockHeight,
+		MinEnactmentEnd: p.MinEnactmentEndBlockHeight,
+	}
+	for _, vote := range v.Votes {
+		option := strings.ToLower(strings.TrimPrefix(vote.Option, "VOTE_OPTION_"))
+		s.Votes[option]++
+	}
+
+	return s, nil
+}
+
+// Watch polls proposal id every interval until it reaches its final outcome, calling
+// onChange whenever its result or votes changed.
+func Watch(ctx context.Context, cli *sekai.CLI, id uint64, interval time.Duration, onChange func(*Status)) (*Status, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		s, err := Query(ctx, cli, id)
+		if err != nil {
+			return nil, err
+		}
+		if key := s.Result + " " + s.Tally(); key != last {
+			last = key
+			onChange(s)
+		}
+		if s.Done() {
+			return s, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return s, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
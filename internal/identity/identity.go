@@ -0,0 +1,376 @@
+// Package identity keeps the customgov identity records of an address, such as the moniker and
+// website of a validator, in sync with a local YAML file and tracks their verification.
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"gopkg.in/yaml.v3"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+var keyRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// File is the YAML file of the identity records an address should have.
+//
+//	address: kira1...
+//	records:
+//	  moniker: validator-1
+//	  website: https://example.com
+//	  contact: ops@example.com
+//	verify:
+//	  - verifier: kira1...
+//	    keys: [moniker, website]
+//	    tip: 200ukex
+//
+// Address is optional, the address of the signing key is used when empty.
+type File struct {
+	Address string            `yaml:"address,omitempty"`
+	Records map[string]string `yaml:"records"`
+	Verify  []Verification    `yaml:"verify,omitempty"`
+}
+
+// Verification asks a verifier to verify records of the File.
+type Verification struct {
+	Verifier string   `yaml:"verifier"`
+	Keys     []string `yaml:"keys"`
+	Tip      string   `yaml:"tip"`
+}
+
+// Load decodes and validates a File.
+func Load(r io.Reader) (*File, error) {
+	var f File
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode identity file: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// LoadFile reads a File from path.
+func LoadFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Save writes the File to path.
+func (f *File) Save(path string) error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode identity file: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write identity file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the record keys and that verifications only name records of the file.
+func (f *File) Validate() error {
+	for key, value := range f.Records {
+		if !keyRe.MatchString(key) {
+			return fmt.Errorf("invalid identity record key %q, expected lowercase letters, digits and underscores", key)
+		}
+		if value == "" {
+			return fmt.Errorf("identity record %s has no value", key)
+		}
+	}
+	for _, v := range f.Verify {
+		if v.Verifier == "" {
+			return fmt.Errorf("verification without verifier")
+		}
+		if len(v.Keys) == 0 {
+			return fmt.Errorf("verification by %s names no keys", v.Verifier)
+		}
+		for _, key := range v.Keys {
+			if _, ok := f.Records[key]; !ok {
+				return fmt.Errorf("verification by %s names %s, which is not a record of the file", v.Verifier, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Record is an identity record on chain.
+type Record struct {
+	ID        uint64    `json:"id,string"`
+	Address   string    `json:"address"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Date      time.Time `json:"date"`
+	Verifiers []string  `json:"verifiers"`
+}
+
+// VerifiedBy reports whether verifier verified the record.
+func (r Record) VerifiedBy(verifier string) bool {
+	for _, v := range r.Verifiers {
+		if v == verifier {
+			return true
+		}
+	}
+	return false
+}
+
+// Request is a pending request to verify identity records.
+type Request struct {
+	ID        uint64   `json:"id,string"`
+	Address   string   `json:"address"`
+	Verifier  string   `json:"verifier"`
+	RecordIDs []string `json:"recordIds"`
+	Tip       struct {
+		Denom  string `json:"denom"`
+		Amount string `json:"amount"`
+	} `json:"tip"`
+	LastRecordEditDate time.Time `json:"lastRecordEditDate"`
+}
+
+// Records returns the identity records of address, by key.
+func Records(ctx context.Context, cli *sekai.CLI, address string) (map[string]Record, error) {
+	var resp struct {
+		Records []Record `json:"records"`
+	}
+	if err := cli.RunJSON(ctx, &resp, "query", "customgov", "identity-records-by-addr", address); err != nil {
+		return nil, fmt.Errorf("failed to query identity records of %s: %w", address, err)
+	}
+	records := map[string]Record{}
+	for _, r := range resp.Records {
+		records[r.Key] = r
+	}
+	return records, nil
+}
+
+// Requests returns the pending verify requests of address, sorted by ID.
+func Requests(ctx context.Context, cli *sekai.CLI, address string) ([]Request, error) {
+	var resp struct {
+		VerifyRecords []Request `json:"verify_records"`
+	}
+	if err := cli.RunJSON(ctx, &resp, "query", "customgov", "identity-record-verify-requests-by-requester", address, "--limit=1000"); err != nil {
+		return nil, fmt.Errorf("failed to query verify requests of %s: %w", address, err)
+	}
+	sort.Slice(resp.VerifyRecords, func(i, j int) bool { return resp.VerifyRecords[i].ID < resp.VerifyRecords[j].ID })
+	return resp.VerifyRecords, nil
+}
+
+// FromChain returns a File holding the records of address on chain.
+func FromChain(address string, records map[string]Record) *File {
+	f := &File{Address: address, Records: map[string]string{}}
+	for key, r := range records {
+		f.Records[key] = r.Value
+	}
+	return f
+}
+
+// Change is a record that differs between the file and the chain. Old is empty for a new
+// record, New for a record that is only on chain.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// Diff returns the records of f that are new or changed and the keys only on chain, sorted by key.
+func Diff(f *File, records map[string]Record) (set []Change, onlyOnChain []Change) {
+	for key, value := range f.Records {
+		r, ok := records[key]
+		if !ok || r.Value != value {
+			set = append(set, Change{Key: key, Old: r.Value, New: value})
+		}
+	}
+	for key, r := range records {
+		if _, ok := f.Records[key]; !ok {
+			onlyOnChain = append(onlyOnChain, Change{Key: key, Old: r.Value})
+		}
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Key < set[j].Key })
+	sort.Slice(onlyOnChain, func(i, j int) bool { return onlyOnChain[i].Key < onlyOnChain[j].Key })
+	return set, onlyOnChain
+}
+
+// FormatDiff returns the changes as `+ key: value`, `~ key: old -> new` and `- key: old` lines.
+func FormatDiff(set, onlyOnChain []Change) string {
+	var b strings.Builder
+	for _, c := range set {
+		if c.Old == "" {
+			fmt.Fprintf(&b, "+ %s: %s\n", c.Key, c.New)
+		} else {
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", c.Key, c.Old, c.New)
+		}
+	}
+	for _, c := range onlyOnChain {
+		fmt.Fprintf(&b, "- %s: %s\n", c.Key, c.Old)
+	}
+	return b.String()
+}
+
+// Register sets the changed records in one transaction. Editing a record drops its verifications.
+func Register(ctx context.Context, cli *sekai.CLI, set []Change, opts sekai.TxOptions) (*sekai.TxResult, error) {
+	infos := map[string]string{}
+	for _, c := range set {
+		infos[c.Key] = c.New
+	}
+	data, err := json.Marshal(infos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode identity records: %w", err)
+	}
+	if opts.FeeType == "" {
+		opts.FeeType = "register-identity-records"
+	}
+
+	log.Infof("Registering %d identity records...", len(set))
+	res, err := cli.Tx(ctx, opts, "customgov", "register-identity-records", "--infos-json="+string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to register identity records: %w", err)
+	}
+	return res, nil
+}
+
+// Delete removes records by key in one transaction.
+func Delete(ctx context.Context, cli *sekai.CLI, keys []string, opts sekai.TxOptions) (*sekai.TxResult, error) {
+	if opts.FeeType == "" {
+		opts.FeeType = "delete-identity-records"
+	}
+
+	log.Infof("Deleting identity records %s...", strings.Join(keys, ", "))
+	res, err := cli.Tx(ctx, opts, "customgov", "delete-identity-records", "--keys="+strings.Join(keys, ","))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete identity records: %w", err)
+	}
+	return res, nil
+}
+
+// Pending is a verification of the file that still has to be requested.
+type Pending struct {
+	Verifier  string   `json:"verifier"`
+	Tip       string   `json:"tip"`
+	Keys      []string `json:"keys"`
+	RecordIDs []string `json:"record_ids"`
+}
+
+// Unrequested returns the verifications of f whose records are neither verified by their
+// verifier nor part of a pending request to it. Records have to be on chain with the value
+// of the file, a record that is about to change would lose its verification.
+func Unrequested(f *File, records map[string]Record, requests []Request) ([]Pending, error) {
+	requested := map[string]bool{}
+	for _, req := range requests {
+		for _, id := range req.RecordIDs {
+			requested[req.Verifier+"/"+id] = true
+		}
+	}
+
+	var pending []Pending
+	for _, v := range f.Verify {
+		p := Pending{Verifier: v.Verifier, Tip: v.Tip}
+		for _, key := range v.Keys {
+			r, ok := records[key]
+			if !ok || r.Value != f.Records[key] {
+				return nil, fmt.Errorf("record %s is not on chain with the value of the file, apply the file first", key)
+			}
+			id := strconv.FormatUint(r.ID, 10)
+			if r.VerifiedBy(v.Verifier) || requested[v.Verifier+"/"+id] {
+				continue
+			}
+			p.Keys = append(p.Keys, key)
+			p.RecordIDs = append(p.RecordIDs, id)
+		}
+		if len(p.RecordIDs) > 0 {
+			pending = append(pending, p)
+		}
+	}
+	return pending, nil
+}
+
+// RequestVerify asks the verifier of p to verify its records.
+func RequestVerify(ctx context.Context, cli *sekai.CLI, p Pending, opts sekai.TxOptions) (*sekai.TxResult, error) {
+	if opts.FeeType == "" {
+		opts.FeeType = "request-identity-records-verify"
+	}
+	args := []string{"customgov", "request-identity-record-verify", "--verifier=" + p.Verifier, "--record-ids=" + strings.Join(p.RecordIDs, ",")}
+	if p.Tip != "" {
+		args = append(args, "--tip="+p.Tip)
+	}
+
+	log.Infof("Requesting verification of %s by %s...", strings.Join(p.Keys, ", "), p.Verifier)
+	res, err := cli.Tx(ctx, opts, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request verification by %s: %w", p.Verifier, err)
+	}
+	return res, nil
+}
+
+// Cancel cancels the pending verify request id.
+func Cancel(ctx context.Context, cli *sekai.CLI, id uint64, opts sekai.TxOptions) (*sekai.TxResult, error) {
+	if opts.FeeType == "" {
+		opts.FeeType = "cancel-identity-records-verify-request"
+	}
+	res, err := cli.Tx(ctx, opts, "customgov", "cancel-identity-records-verify-request", strconv.FormatUint(id, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel verify request %d: %w", id, err)
+	}
+	return res, nil
+}
+
+// FormatRequests returns the pending requests as a table, naming records by key.
+func FormatRequests(requests []Request, records map[string]Record) string {
+	keys := map[string]string{}
+	for key, r := range records {
+		keys[strconv.FormatUint(r.ID, 10)] = key
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-45s %-12s %-24s %s\n", "ID", "VERIFIER", "TIP", "RECORDS EDITED", "RECORDS")
+	for _, req := range requests {
+		names := make([]string, len(req.RecordIDs))
+		for i, id := range req.RecordIDs {
+			names[i] = id
+			if key, ok := keys[id]; ok {
+				names[i] = key + " (" + id + ")"
+			}
+		}
+		fmt.Fprintf(&b, "%-6d %-45s %-12s %-24s %s\n", req.ID, req.Verifier, req.Tip.Amount+req.Tip.Denom,
+			req.LastRecordEditDate.Format(time.RFC3339), strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// FormatRecords returns the records as a table with their verifiers, sorted by key.
+func FormatRecords(records map[string]Record) string {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-16s %-40s %s\n", "ID", "KEY", "VALUE", "VERIFIERS")
+	for _, key := range keys {
+		r := records[key]
+		verifiers := "-"
+		if len(r.Verifiers) > 0 {
+			verifiers = strings.Join(r.Verifiers, ",")
+		}
+		fmt.Fprintf(&b, "%-6d %-16s %-40s %s\n", r.ID, r.Key, r.Value, verifiers)
+	}
+	return b.String()
+}
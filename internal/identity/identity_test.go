@@ -0,0 +1,193 @@
+package identity_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/identity"
+)
+
+const verifier = "kira1verifier"
+
+func testFile() *identity.File {
+	return &identity.File{
+		Records: map[string]string{"moniker": "validator-1", "website": "https://example.com", "contact": "ops@example.com"},
+		Verify:  []identity.Verification{{Verifier: verifier, Keys: []string{"moniker", "website"}, Tip: "200ukex"}},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		err  string
+	}{
+		{name: "valid", file: "records:\n  moniker: validator-1\nverify:\n  - verifier: kira1v\n    keys: [moniker]\n    tip: 200ukex\n"},
+		{name: "invalid key", file: "records:\n  Moniker: validator-1\n", err: `invalid identity record key "Moniker"`},
+		{name: "empty value", file: "records:\n  moniker: \"\"\n", err: "identity record moniker has no value"},
+		{name: "verifier missing", file: "records:\n  moniker: v\nverify:\n  - keys: [moniker]\n", err: "verification without verifier"},
+		{name: "no keys", file: "records:\n  moniker: v\nverify:\n  - verifier: kira1v\n", err: "verification by kira1v names no keys"},
+		{name: "key not in records", file: "records:\n  moniker: v\nverify:\n  - verifier: kira1v\n    keys: [website]\n", err: "names website, which is not a record of the file"},
+		{name: "unknown field", file: "records:\n  moniker: v\nverifiers: []\n", err: "field verifiers not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := identity.Load(strings.NewReader(tt.file))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Load() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Load() = %+v, %v, want error containing %q", f, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     map[string]identity.Record
+		set         []identity.Change
+		onlyOnChain []identity.Change
+	}{
+		{
+			name: "nothing on chain",
+			set: []identity.Change{
+				{Key: "contact", New: "ops@example.com"},
+				{Key: "moniker", New: "validator-1"},
+				{Key: "website", New: "https://example.com"},
+			},
+		},
+		{
+			name: "in sync",
+			records: map[string]identity.Record{
+				"moniker": {Key: "moniker", Value: "validator-1"},
+				"website": {Key: "website", Value: "https://example.com"},
+				"contact": {Key: "contact", Value: "ops@example.com"},
+			},
+		},
+		{
+			name: "changed and only on chain",
+			records: map[string]identity.Record{
+				"moniker": {Key: "moniker", Value: "validator-0"},
+				"website": {Key: "website", Value: "https://example.com"},
+				"contact": {Key: "contact", Value: "ops@example.com"},
+				"social":  {Key: "social", Value: "@validator"},
+				"avatar":  {Key: "avatar", Value: "https://example.com/a.png"},
+			},
+			set: []identity.Change{{Key: "moniker", Old: "validator-0", New: "validator-1"}},
+			onlyOnChain: []identity.Change{
+				{Key: "avatar", Old: "https://example.com/a.png"},
+				{Key: "social", Old: "@validator"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, onlyOnChain := identity.Diff(testFile(), tt.records)
+			if !reflect.DeepEqual(set, tt.set) {
+				t.Fatalf("Diff() set = %+v, want %+v", set, tt.set)
+			}
+			if !reflect.DeepEqual(onlyOnChain, tt.onlyOnChain) {
+				t.Fatalf("Diff() only on chain = %+v, want %+v", onlyOnChain, tt.onlyOnChain)
+			}
+		})
+	}
+
+	set, onlyOnChain := identity.Diff(testFile(), map[string]identity.Record{
+		"moniker": {Value: "validator-0"},
+		"social":  {Value: "@validator"},
+	})
+	want := "+ contact: ops@example.com\n~ moniker: validator-0 -> validator-1\n+ website: https://example.com\n- social: @validator\n"
+	if got := identity.FormatDiff(set, onlyOnChain); got != want {
+		t.Fatalf("FormatDiff() = %q, want %q", got, want)
+	}
+}
+
+func TestUnrequested(t *testing.T) {
+	records := func() map[string]identity.Record {
+		return map[string]identity.Record{
+			"moniker": {ID: 1, Key: "moniker", Value: "validator-1"},
+			"website": {ID: 2, Key: "website", Value: "https://example.com"},
+			"contact": {ID: 3, Key: "contact", Value: "ops@example.com"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		records  func() map[string]identity.Record
+		requests []identity.Request
+		pending  []identity.Pending
+		err      string
+	}{
+		{
+			name:    "nothing requested",
+			records: records,
+			pending: []identity.Pending{{Verifier: verifier, Tip: "200ukex", Keys: []string{"moniker", "website"}, RecordIDs: []string{"1", "2"}}},
+		},
+		{
+			name: "verified",
+			records: func() map[string]identity.Record {
+				r := records()
+				moniker := r["moniker"]
+				moniker.Verifiers = []string{verifier}
+				r["moniker"] = moniker
+				return r
+			},
+			pending: []identity.Pending{{Verifier: verifier, Tip: "200ukex", Keys: []string{"website"}, RecordIDs: []string{"2"}}},
+		},
+		{
+			name:     "requested from the verifier",
+			records:  records,
+			requests: []identity.Request{{ID: 7, Verifier: verifier, RecordIDs: []string{"1", "2"}}},
+		},
+		{
+			name:     "requested from another verifier",
+			records:  records,
+			requests: []identity.Request{{ID: 7, Verifier: "kira1other", RecordIDs: []string{"1", "2"}}},
+			pending:  []identity.Pending{{Verifier: verifier, Tip: "200ukex", Keys: []string{"moniker", "website"}, RecordIDs: []string{"1", "2"}}},
+		},
+		{
+			name: "record not on chain",
+			records: func() map[string]identity.Record {
+				r := records()
+				delete(r, "website")
+				return r
+			},
+			err: "record website is not on chain with the value of the file",
+		},
+		{
+			name: "record about to change",
+			records: func() map[string]identity.Record {
+				r := records()
+				r["moniker"] = identity.Record{ID: 1, Key: "moniker", Value: "validator-0"}
+				return r
+			},
+			err: "record moniker is not on chain with the value of the file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := identity.Unrequested(testFile(), tt.records(), tt.requests)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Unrequested() = %+v, %v, want error containing %q", pending, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unrequested() error: %v", err)
+			}
+			if !reflect.DeepEqual(pending, tt.pending) {
+				t.Fatalf("Unrequested() = %+v, want %+v", pending, tt.pending)
+			}
+		})
+	}
+}
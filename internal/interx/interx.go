@@ -0,0 +1,79 @@
+// Package interx configures the interx gateway of a sekai node and checks its health.
+package interx
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+const (
+	// DefaultPort is the port interx serves its API on.
+	DefaultPort = "11000"
+	// DefaultHome is the interx home inside the interx container.
+	DefaultHome = "/interx"
+	// sekaiGRPCPort is the port sekaid serves gRPC on.
+	sekaiGRPCPort = "9090"
+)
+
+// Config is the configuration interx is initialised with.
+type Config struct {
+	Home string
+	// GRPC is the gRPC endpoint of the sekai node, e.g. `dns:///sekai:9090`.
+	GRPC string
+	// RPC is the Tendermint RPC of the sekai node, e.g. `http://sekai:26657`.
+	RPC  string
+	Port string
+}
+
+// NewConfig returns the configuration of an interx in front of the sekai node reachable as
+// sekaiHost, usually the name of the sekai container on the docker network.
+func NewConfig(sekaiHost string) Config {
+	return Config{
+		Home: DefaultHome,
+		GRPC: "dns:///" + net.JoinHostPort(sekaiHost, sekaiGRPCPort),
+		RPC:  "http://" + net.JoinHostPort(sekaiHost, tendermint.DefaultRPCPort),
+		Port: DefaultPort,
+	}
+}
+
+// ConfigPath returns the path of the config.json `interx init` generates.
+func (c Config) ConfigPath() string {
+	return c.Home + "/config.json"
+}
+
+// InitArgs returns the arguments of `interx init` generating the configuration.
+func (c Config) InitArgs() []string {
+	return []string{"init", "--home=" + c.Home, "--grpc=" + c.GRPC, "--rpc=" + c.RPC, "--port=" + c.Port}
+}
+
+// Spec returns the container of an interx node named name. The configuration is generated on
+// the first start and kept in the home afterwards, so the keys interx generates survive restarts.
+// The caller sets the network, volumes, labels and dependencies.
+func (c Config) Spec(name, image string) docker.NodeSpec {
+	script := `[ -f ` + c.ConfigPath() + ` ] || interx ` + strings.Join(c.InitArgs(), " ") + `
+exec interx start --home=` + c.Home
+
+	return docker.NodeSpec{
+		Name:       name,
+		Image:      image,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{script},
+		Ports:      []string{c.Port + ":" + c.Port},
+		Healthcheck: &docker.Healthcheck{
+			Test:        "curl -sf http://localhost:" + c.Port + StatusPath + " > /dev/null",
+			Interval:    5 * time.Second,
+			Timeout:     5 * time.Second,
+			StartPeriod: 10 * time.Second,
+			Retries:     10,
+		},
+		Logging: docker.LogConfig{Driver: "json-file", MaxSize: "100m", MaxFile: 5},
+	}
+}
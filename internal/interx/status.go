@@ -0,0 +1,107 @@
+package interx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// StatusPath is the status endpoint of the interx API.
+const StatusPath = "/api/status"
+
+// Client queries the API of one interx over HTTP.
+type Client struct {
+	// URL is the base address of the API, e.g. `http://10.0.0.1:11000`.
+	URL  string
+	HTTP *http.Client
+}
+
+// NewClient returns a Client for the API at addr. addr may omit the scheme.
+func NewClient(addr string) *Client {
+	addr = strings.TrimSuffix(addr, "/")
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{URL: addr, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Info is what interx reports about itself.
+type Info struct {
+	ChainID           string `json:"chain_id"`
+	Moniker           string `json:"moniker"`
+	Version           string `json:"version"`
+	GenesisChecksum   string `json:"genesis_checksum"`
+	LatestBlockHeight int64  `json:"latest_block_height,string"`
+	CatchingUp        bool   `json:"catching_up"`
+}
+
+// Status is the result of /api/status. NodeInfo and SyncInfo are those of the sekai node
+// interx is connected to.
+type Status struct {
+	ID         string              `json:"id"`
+	InterxInfo Info                `json:"interx_info"`
+	NodeInfo   tendermint.NodeInfo `json:"node_info"`
+	SyncInfo   tendermint.SyncInfo `json:"sync_info"`
+}
+
+// Status queries /api/status.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	target := c.URL + StatusPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", target, err)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", target, resp.StatusCode)
+	}
+	status := &Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("failed to decode response of %s: %w", target, err)
+	}
+	return status, nil
+}
+
+// WaitHealthy blocks until the interx at c answers on its status endpoint for chainID and is no
+// longer catching up. Errors while it starts count as not healthy yet. An empty chainID matches
+// any chain.
+func WaitHealthy(ctx context.Context, c *Client, chainID string, timeout, interval time.Duration) (*Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		status, err := c.Status(ctx)
+		switch {
+		case err != nil:
+			last = "api not available: " + err.Error()
+		case chainID != "" && status.InterxInfo.ChainID != chainID:
+			return nil, fmt.Errorf("interx at %s serves chain %s, expected %s", c.URL, status.InterxInfo.ChainID, chainID)
+		case status.InterxInfo.CatchingUp:
+			last = fmt.Sprintf("height %d, catching up", status.InterxInfo.LatestBlockHeight)
+		default:
+			log.Infof("Interx at %s is healthy at height %d", c.URL, status.InterxInfo.LatestBlockHeight)
+			return status, nil
+		}
+		log.Infof("Waiting for interx at %s: %s", c.URL, last)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interx at %s did not become healthy within %s: %s", c.URL, timeout, last)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package inventory describes the sekai nodes of a network the launcher manages.
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is the list of nodes of a network.
+//
+//	nodes:
+//	  - name: validator-1
+//	    role: validator
+//	    rpc: http://10.0.0.1:26657
+//	    docker_config: hosts/validator-1.json
+//	  - name: sentry-1
+//	    role: sentry
+//	    rpc: http://10.0.0.2:26657
+type Inventory struct {
+	Nodes []Node `yaml:"nodes"`
+}
+
+// Node is a sekai node and the Docker daemon it runs on.
+type Node struct {
+	Name string `yaml:"name"`
+	// Role is the node role, e.g. `validator`, `sentry` or `seed`.
+	Role string `yaml:"role,omitempty"`
+	// RPC is the Tendermint RPC address of the node.
+	RPC string `yaml:"rpc"`
+	// DockerConfig is the path to the JSON docker config of the node's host. The local daemon
+	// is used when empty.
+	DockerConfig string `yaml:"docker_config,omitempty"`
+	// Container is the name of the sekai container, types.DefaultSekaiContainer when empty.
+	Container string `yaml:"container,omitempty"`
+}
+
+// ContainerName returns the name of the node's sekai container.
+func (n Node) ContainerName() string {
+	if n.Container == "" {
+		return types.DefaultSekaiContainer
+	}
+	return n.Container
+}
+
+// Load decodes and validates a YAML inventory.
+func Load(r io.Reader) (*Inventory, error) {
+	inv := &Inventory{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(inv); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory: %w", err)
+	}
+	if err := inv.Validate(); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// LoadFile reads an inventory from path.
+func LoadFile(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inventory %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Validate checks that every node has a unique name and an RPC address.
+func (inv *Inventory) Validate() error {
+	if len(inv.Nodes) == 0 {
+		return fmt.Errorf("inventory has no nodes")
+	}
+	seen := map[string]bool{}
+	for i, node := range inv.Nodes {
+		if node.Name == "" {
+			return fmt.Errorf("node %d has no name", i)
+		}
+		if seen[node.Name] {
+			return fmt.Errorf("node %s is listed twice", node.Name)
+		}
+		seen[node.Name] = true
+		if node.RPC == "" {
+			return fmt.Errorf("node %s has no rpc address", node.Name)
+		}
+	}
+
+	return nil
+}
+
+// Select returns the nodes with the given names in inventory order, or all nodes when names is empty.
+func (inv *Inventory) Select(names ...string) ([]Node, error) {
+	if len(names) == 0 {
+		return inv.Nodes, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var nodes []Node
+	for _, node := range inv.Nodes {
+		if wanted[node.Name] {
+			nodes = append(nodes, node)
+			delete(wanted, node.Name)
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("node %s is not in the inventory", name)
+	}
+
+	return nodes, nil
+}
+
+// DockerManager connects to the Docker daemon of the node's host.
+func (n Node) DockerManager() (*docker.DockerManager, error) {
+	dm, err := docker.NewDockerManagerFromFile(n.DockerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker manager for node %s: %w", n.Name, err)
+	}
+	return dm, nil
+}
+
+// WriteFile saves the inventory as YAML to path.
+func (inv *Inventory) WriteFile(path string) error {
+	data, err := yaml.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write inventory %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,437 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// ExportOptions describes a state export of a node.
+type ExportOptions struct {
+	// Container is the sekai container of the node.
+	Container string
+	// Home is the sekaid home inside the container.
+	Home string
+	// Height is the height to export, 0 exports the latest committed height.
+	Height int64
+	// ForZeroHeight prepares the state to start a new chain at height zero.
+	ForZeroHeight bool
+	// NewGenesis also runs `sekaid new-genesis-from-exported` on the exported state.
+	NewGenesis bool
+	// KeepStopped leaves the node stopped after the export instead of starting it again.
+	KeepStopped bool
+	// Dir is the directory the export is saved to, see Export.
+	Dir string
+}
+
+// ExportMetadata describes an exported state. It is saved next to the export.
+type ExportMetadata struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	ChainID   string `json:"chain_id"`
+	// Height is the exported height, 0 for a state prepared with ForZeroHeight.
+	Height   int64     `json:"height"`
+	AppHash  string    `json:"app_hash,omitempty"`
+	Exported time.Time `json:"exported"`
+	// SHA256 is the hash of the exported state.
+	SHA256 string `json:"sha256"`
+	// NewGenesisChainID and NewGenesisSHA256 are set when a new genesis was produced from the export.
+	NewGenesisChainID string `json:"new_genesis_chain_id,omitempty"`
+	NewGenesisSHA256  string `json:"new_genesis_sha256,omitempty"`
+}
+
+// Export is a state exported by ExportState into a directory: the state as `exported.json`
+// with `exported.json.sha256`, `metadata.json`, and the new genesis as `new-genesis.json` with
+// its hash when requested.
+type Export struct {
+	Metadata ExportMetadata
+	// StatePath is the path of the exported state.
+	StatePath string
+	// NewGenesis is the output of `sekaid new-genesis-from-exported`, nil unless requested.
+	NewGenesis *genesis.Result
+	// NewGenesisPath is the path of the new genesis, empty unless requested.
+	NewGenesisPath string
+}
+
+// exportOutput is where the toolbox keeps the output of `sekaid export`.
+const (
+	exportStdout = "/tmp/export.stdout"
+	exportStderr = "/tmp/export.stderr"
+)
+
+// ExportState stops the node, runs `sekaid export` on its data directory in a toolbox container
+// that mounts the node home, and starts the node again unless opts.KeepStopped is set.
+// sekaid cannot export while the node holds the database, hence the stop.
+// The state is streamed into opts.Dir and saved before the new genesis is created, so a failed
+// conversion returns the saved export along with the error.
+func ExportState(ctx context.Context, dm *docker.DockerManager, opts ExportOptions) (*Export, error) {
+	if opts.Home == "" {
+		opts.Home = sekai.DefaultHome
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory %s: %w", opts.Dir, err)
+	}
+
+	image, err := dm.ContainerImage(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+	wasRunning, err := dm.IsRunning(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+	volume, err := dm.VolumeAt(ctx, opts.Container, opts.Home)
+	if err != nil {
+		return nil, err
+	}
+
+	if wasRunning {
+		log.Infof("Stopping node %s for the export...", opts.Container)
+		if err := dm.StopContainer(ctx, opts.Container, 30*time.Second); err != nil {
+			return nil, err
+		}
+	}
+	if wasRunning && !opts.KeepStopped {
+		defer func() {
+			if err := dm.StartContainer(context.Background(), opts.Container); err != nil {
+				log.Errorf("Failed to start node %s after the export: %s", opts.Container, err)
+			}
+		}()
+	}
+
+	toolbox := opts.Container + "-export"
+	if err := dm.StartToolbox(ctx, toolbox, image, []docker.VolumeMount{{Name: volume, Target: opts.Home}}); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	cli := sekai.NewCLI(dm, toolbox, opts.Home)
+	export, err := exportState(ctx, cli, opts)
+	if err != nil {
+		return nil, err
+	}
+	export.Metadata.Container = opts.Container
+	export.Metadata.Image = image
+	if err := export.writeMetadata(opts.Dir); err != nil {
+		return nil, err
+	}
+
+	if opts.NewGenesis {
+		result, err := newGenesisFromExported(ctx, cli, export.StatePath)
+		if err != nil {
+			return export, fmt.Errorf("state exported to %s, but creating the new genesis failed: %w", export.StatePath, err)
+		}
+		path := filepath.Join(opts.Dir, "new-genesis.json")
+		if err := result.Write(path); err != nil {
+			return export, err
+		}
+		export.NewGenesis, export.NewGenesisPath = result, path
+		export.Metadata.NewGenesisChainID = result.ChainID
+		export.Metadata.NewGenesisSHA256 = result.SHA256
+		if err := export.writeMetadata(opts.Dir); err != nil {
+			return export, err
+		}
+	}
+
+	return export, nil
+}
+
+// exportState runs `sekaid export` with its output redirected to files in the toolbox and
+// streams the state from there into opts.Dir.
+func exportState(ctx context.Context, cli *sekai.CLI, opts ExportOptions) (*Export, error) {
+	cmd := []string{"sekaid", "export", "--home=" + cli.Home}
+	if opts.Height > 0 {
+		cmd = append(cmd, "--height="+strconv.FormatInt(opts.Height, 10))
+	}
+	if opts.ForZeroHeight {
+		cmd = append(cmd, "--for-zero-height")
+	}
+
+	log.Infof("Exporting state of %s at height %s...", opts.Container, heightName(opts.Height))
+	script := fmt.Sprintf("%s >%s 2>%s || { code=$?; tail -c 4096 %[3]s >&2; exit $code; }", strings.Join(cmd, " "), exportStdout, exportStderr)
+	if _, err := cli.Shell(ctx, script); err != nil {
+		return nil, fmt.Errorf("`sekaid export` failed: %w", err)
+	}
+
+	statePath := filepath.Join(opts.Dir, "exported.json")
+	hash, err := saveState(ctx, cli, statePath)
+	if err != nil {
+		return nil, err
+	}
+	// A state that is not what was asked for is not kept.
+	discard := func() {
+		os.Remove(statePath)
+		os.Remove(statePath + ".sha256")
+	}
+	header, err := readStateHeader(statePath)
+	if err != nil {
+		discard()
+		return nil, err
+	}
+	// The exported state starts the chain at the block after the exported height.
+	initialHeight, _ := strconv.ParseInt(header.InitialHeight, 10, 64)
+
+	export := &Export{
+		StatePath: statePath,
+		Metadata: ExportMetadata{
+			ChainID:  header.ChainID,
+			Height:   initialHeight - 1,
+			AppHash:  header.AppHash,
+			Exported: time.Now().UTC(),
+			SHA256:   hash,
+		},
+	}
+	if opts.Height > 0 && export.Metadata.Height != opts.Height && !opts.ForZeroHeight {
+		discard()
+		return nil, fmt.Errorf("exported state is at height %d, not at the requested height %d", export.Metadata.Height, opts.Height)
+	}
+	log.Infof("Exported state of %s at height %d, sha256 %s", header.ChainID, export.Metadata.Height, export.Metadata.SHA256)
+
+	return export, nil
+}
+
+// saveState streams the exported state from the toolbox into path with its `.sha256` record.
+// Returns the hash of the state.
+func saveState(ctx context.Context, cli *sekai.CLI, path string) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			os.Remove(path)
+		}
+	}()
+	defer f.Close()
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	found := false
+	for _, output := range []string{exportStdout, exportStderr} {
+		r, err := cli.DM.OpenFile(ctx, cli.Container, output)
+		if err != nil {
+			return "", err
+		}
+		found, err = exportedJSON(w, r)
+		r.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to save exported state: %w", err)
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("`sekaid export` printed no state")
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	record := fmt.Sprintf("%s  %s\n", hash, filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(record), 0644); err != nil {
+		return "", fmt.Errorf("failed to write state hash to %s.sha256: %w", path, err)
+	}
+	saved = true
+	return hash, nil
+}
+
+// exportedJSON copies the state printed by `sekaid export` from one of its outputs to w.
+// Depending on the SDK version the state is printed to stdout, or as a single line after the
+// log lines to stderr. Only the first bytes of a line are held in memory to recognise it.
+// Returns false when r holds no state.
+func exportedJSON(w io.Writer, r io.Reader) (bool, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		trimmed := bytes.TrimSpace(line)
+		switch {
+		case string(trimmed) == "{" && !isPrefix:
+			// An indented state: the rest of the output belongs to it.
+			if _, err := w.Write([]byte("{\n")); err != nil {
+				return false, err
+			}
+			_, err := io.Copy(w, br)
+			return true, err
+		case bytes.HasPrefix(trimmed, []byte("{")) && isState(trimmed):
+			if _, err := w.Write(line); err != nil {
+				return false, err
+			}
+			for isPrefix {
+				if line, isPrefix, err = br.ReadLine(); err != nil && err != io.EOF {
+					return false, err
+				}
+				if _, err := w.Write(line); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+		// Skip the rest of a long line that is not the state.
+		for isPrefix {
+			if _, isPrefix, err = br.ReadLine(); err != nil {
+				return false, nil
+			}
+		}
+	}
+}
+
+// isState reports whether the start of a JSON line is an exported state rather than a JSON log
+// line. sekaid sorts the keys of the state, so app_hash and app_state come first.
+func isState(start []byte) bool {
+	return bytes.HasPrefix(start, []byte(`{"app_hash"`)) || bytes.HasPrefix(start, []byte(`{"app_state"`))
+}
+
+// stateHeader is the part of an exported state the export metadata records.
+type stateHeader struct {
+	ChainID       string `json:"chain_id"`
+	AppHash       string `json:"app_hash"`
+	InitialHeight string `json:"initial_height"`
+}
+
+// readStateHeader decodes the header fields of the exported state at path. The other values,
+// app_state above all, are skipped token by token instead of being decoded, which also
+// validates the whole file.
+func readStateHeader(path string) (*stateHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exported state: %w", err)
+	}
+	defer f.Close()
+
+	header := &stateHeader{}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("failed to decode exported state: not a JSON object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode exported state: %w", err)
+		}
+		switch tok {
+		case "chain_id":
+			err = dec.Decode(&header.ChainID)
+		case "app_hash":
+			err = dec.Decode(&header.AppHash)
+		case "initial_height":
+			err = dec.Decode(&header.InitialHeight)
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode exported state: %w", err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to decode exported state: %w", err)
+	}
+	return header, nil
+}
+
+// skipValue reads the next value of dec without keeping it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// newGenesisFromExported copies the exported state into the toolbox and converts it with
+// `sekaid new-genesis-from-exported`. The result is inspected, problems fail the conversion.
+func newGenesisFromExported(ctx context.Context, cli *sekai.CLI, statePath string) (*genesis.Result, error) {
+	const exported, converted = "/tmp/exported.json", "/tmp/new-genesis.json"
+	state, err := os.Open(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exported state: %w", err)
+	}
+	defer state.Close()
+	info, err := state.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exported state: %w", err)
+	}
+	if err := cli.DM.WriteFileFrom(ctx, cli.Container, exported, state, info.Size(), 0644); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Creating a new genesis from the exported state...")
+	if _, err := cli.Run(ctx, "new-genesis-from-exported", exported, converted); err != nil {
+		return nil, err
+	}
+	data, err := cli.DM.ReadFile(ctx, cli.Container, converted)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := genesis.Inspect(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range report.Warnings {
+		log.Warnf("New genesis: %s", warning)
+	}
+	if !report.Valid {
+		return nil, fmt.Errorf("new genesis is invalid: %s", strings.Join(report.Problems, "; "))
+	}
+	log.Infof("New genesis of %s created, sha256 %s", report.ChainID, report.SHA256)
+
+	return &genesis.Result{ChainID: report.ChainID, Genesis: data, SHA256: report.SHA256}, nil
+}
+
+// writeMetadata saves the metadata of the export as `metadata.json` in dir.
+func (e *Export) writeMetadata(dir string) error {
+	metadata, err := json.MarshalIndent(e.Metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode export metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), append(metadata, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write export metadata: %w", err)
+	}
+
+	return nil
+}
+
+func heightName(height int64) string {
+	if height <= 0 {
+		return "latest"
+	}
+	return strconv.FormatInt(height, 10)
+}
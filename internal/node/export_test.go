@@ -0,0 +1,148 @@
+package node_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/node"
+)
+
+const (
+	sekaiImage    = "ghcr.io/kiracore/sekai:v0.3.46"
+	exportedState = `{"app_hash":"A1B2","app_state":{"bank":{"balances":[{"address":"kira1a","coins":[]}]}},"chain_id":"localnet-1","initial_height":"121","validators":[]}`
+	newGenesis    = `{"chain_id":"localnet-2","genesis_time":"2023-06-01T00:00:00Z","app_state":{"customstaking":{"validators":[{"val_key":"kiravaloper1a","pub_key":{"key":"cons-a"}}]}}}`
+)
+
+// newSekaiNode runs a sekai container whose toolboxes answer `sekaid export` with stdout and
+// stderr and `sekaid new-genesis-from-exported` with converted.
+func newSekaiNode(t *testing.T, stdout, stderr, converted string) (*fake.Client, *docker.DockerManager) {
+	f := fake.New()
+	f.AddImage(sekaiImage)
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		script := strings.Join(cmd, " ")
+		switch {
+		case strings.Contains(script, "sekaid export"):
+			if stdout == "" && stderr == "" {
+				return docker.ExecResult{Stderr: "panic: database locked", ExitCode: 1}
+			}
+			f.WriteFile(containerName, "/tmp/export.stdout", []byte(stdout))
+			f.WriteFile(containerName, "/tmp/export.stderr", []byte(stderr))
+		case strings.Contains(script, "new-genesis-from-exported"):
+			if state, _ := f.File(containerName, "/tmp/exported.json"); string(state) != exportedState {
+				return docker.ExecResult{Stderr: "no exported state", ExitCode: 1}
+			}
+			if converted == "" {
+				return docker.ExecResult{Stderr: "conversion failed", ExitCode: 1}
+			}
+			f.WriteFile(containerName, "/tmp/new-genesis.json", []byte(converted))
+		}
+		return docker.ExecResult{}
+	}
+	dm := docker.NewDockerManagerWithClient(f)
+	spec := docker.NodeSpec{Name: "kira-sekai", Image: sekaiImage, Volumes: []docker.VolumeMount{{Name: "kira-sekai", Target: "/sekai"}}}
+	if _, err := dm.CreateNodeContainer(context.Background(), spec); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	if err := dm.StartContainer(context.Background(), "kira-sekai"); err != nil {
+		t.Fatalf("StartContainer() error: %v", err)
+	}
+	return f, dm
+}
+
+func TestExportState(t *testing.T) {
+	indented := strings.Replace(exportedState, `{"app_hash"`, "{\n  \"app_hash\"", 1)
+	tests := []struct {
+		name       string
+		stdout     string
+		stderr     string
+		height     int64
+		newGenesis bool
+		converted  string
+		state      string
+		err        string
+		saved      bool
+	}{
+		{name: "state on stdout", stdout: exportedState + "\n", state: exportedState},
+		{name: "indented state on stdout", stdout: indented, state: indented},
+		{
+			name:   "state on stderr after log lines",
+			stderr: "3:04PM INF loading state\n{\"level\":\"info\",\"msg\":\"json log line\"}\n" + exportedState + "\n",
+			state:  exportedState,
+		},
+		{name: "requested height", stdout: exportedState, height: 120, state: exportedState},
+		{name: "other height", stdout: exportedState, height: 100, err: "not at the requested height 100"},
+		{name: "no state", stderr: "3:04PM INF nothing to export\n", err: "printed no state"},
+		{name: "invalid state", stdout: `{"app_hash":"A1B2","app_state":{`, err: "failed to decode exported state"},
+		{name: "export fails", err: "database locked"},
+		{name: "new genesis", stdout: exportedState, newGenesis: true, converted: newGenesis, state: exportedState},
+		{name: "new genesis fails", stdout: exportedState, newGenesis: true, state: exportedState, err: "creating the new genesis failed", saved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dm := newSekaiNode(t, tt.stdout, tt.stderr, tt.converted)
+			dir := filepath.Join(t.TempDir(), "export")
+			opts := node.ExportOptions{Container: "kira-sekai", Height: tt.height, NewGenesis: tt.newGenesis, Dir: dir}
+			export, err := node.ExportState(context.Background(), dm, opts)
+
+			if running, _ := dm.IsRunning(context.Background(), "kira-sekai"); !running {
+				t.Fatal("node is not running after the export")
+			}
+			if exists, _ := dm.ContainerExists(context.Background(), "kira-sekai-export"); exists {
+				t.Fatal("export toolbox is left behind")
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ExportState() = %v, want error containing %q", err, tt.err)
+				}
+				if (export != nil) != tt.saved {
+					t.Fatalf("ExportState() returned export %v, want it %t", export, tt.saved)
+				}
+				if _, statErr := os.Stat(filepath.Join(dir, "exported.json")); (statErr == nil) != tt.saved {
+					t.Fatalf("exported.json exists = %t, want %t", statErr == nil, tt.saved)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportState() error: %v", err)
+			}
+
+			state, err := os.ReadFile(export.StatePath)
+			if err != nil {
+				t.Fatalf("failed to read exported state: %v", err)
+			}
+			if string(state) != tt.state {
+				t.Fatalf("exported state = %q, want %q", state, tt.state)
+			}
+			m := export.Metadata
+			if m.ChainID != "localnet-1" || m.Height != 120 || m.AppHash != "A1B2" || m.Image != sekaiImage || m.SHA256 != genesis.Hash(state) {
+				t.Fatalf("metadata = %+v", m)
+			}
+			record, _ := os.ReadFile(export.StatePath + ".sha256")
+			if string(record) != m.SHA256+"  exported.json\n" {
+				t.Fatalf("exported.json.sha256 = %q", record)
+			}
+			var saved node.ExportMetadata
+			data, _ := os.ReadFile(filepath.Join(dir, "metadata.json"))
+			if err := json.Unmarshal(data, &saved); err != nil || saved.SHA256 != m.SHA256 || saved.NewGenesisSHA256 != m.NewGenesisSHA256 {
+				t.Fatalf("metadata.json = %s, %v, want the metadata of the export", data, err)
+			}
+
+			if tt.newGenesis {
+				if export.NewGenesis == nil || export.NewGenesis.ChainID != "localnet-2" || m.NewGenesisSHA256 != genesis.Hash([]byte(newGenesis)) {
+					t.Fatalf("new genesis = %+v with metadata %+v", export.NewGenesis, m)
+				}
+				if data, err := os.ReadFile(export.NewGenesisPath); err != nil || string(data) != newGenesis {
+					t.Fatalf("new-genesis.json = %q, %v", data, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Readiness configures the gates a node has to pass before an operation on it counts as done.
+type Readiness struct {
+	// SyncTimeout is how long the node gets to stop catching up.
+	SyncTimeout time.Duration
+	// AdvanceTimeout is how long the node gets to commit MinBlocks new blocks.
+	AdvanceTimeout time.Duration
+	MinBlocks      int64
+	// PeersTimeout is how long the node gets to connect to MinPeers peers.
+	PeersTimeout time.Duration
+	MinPeers     int
+	// Interval is the time between two polls of the RPC.
+	Interval time.Duration
+}
+
+// DefaultReadiness returns the gates used by deploy, restart and upgrade.
+func DefaultReadiness() Readiness {
+	return Readiness{
+		SyncTimeout:    24 * time.Hour,
+		AdvanceTimeout: 2 * time.Minute,
+		MinBlocks:      2,
+		PeersTimeout:   5 * time.Minute,
+		MinPeers:       1,
+		Interval:       5 * time.Second,
+	}
+}
+
+// Event reports the progress of a node through its readiness gates.
+type Event struct {
+	Node   string
+	Gate   string
+	Passed bool
+	// Detail describes the last observation, e.g. `height 1200, catching up`.
+	Detail string
+	Time   time.Time
+}
+
+// EventFunc receives readiness events.
+type EventFunc func(Event)
+
+// LogEvents is an EventFunc that logs every event.
+func LogEvents(e Event) {
+	if e.Passed {
+		log.Infof("Node %s passed gate %s: %s", e.Node, e.Gate, e.Detail)
+		return
+	}
+	log.Infof("Node %s waiting for gate %s: %s", e.Node, e.Gate, e.Detail)
+}
+
+// gate is a single readiness condition. check returns whether it holds and what was observed.
+type gate struct {
+	name    string
+	timeout time.Duration
+	check   func(ctx context.Context, client *tendermint.Client) (bool, string, error)
+}
+
+func (r Readiness) gates() []gate {
+	var startHeight int64
+	return []gate{
+		{
+			name:    "synced",
+			timeout: r.SyncTimeout,
+			check: func(ctx context.Context, client *tendermint.Client) (bool, string, error) {
+				st, err := client.Status(ctx)
+				if err != nil {
+					return false, "", err
+				}
+				if st.SyncInfo.CatchingUp {
+					return false, fmt.Sprintf("height %d, catching up", st.SyncInfo.LatestBlockHeight), nil
+				}
+				return true, fmt.Sprintf("height %d", st.SyncInfo.LatestBlockHeight), nil
+			},
+		},
+		{
+			name:    "advancing",
+			timeout: r.AdvanceTimeout,
+			check: func(ctx context.Context, client *tendermint.Client) (bool, string, error) {
+				st, err := client.Status(ctx)
+				if err != nil {
+					return false, "", err
+				}
+				height := st.SyncInfo.LatestBlockHeight
+				if startHeight == 0 {
+					startHeight = height
+				}
+				if height-startHeight >= r.MinBlocks {
+					return true, fmt.Sprintf("height %d -> %d", startHeight, height), nil
+				}
+				return false, fmt.Sprintf("height %d, %d of %d new blocks", height, height-startHeight, r.MinBlocks), nil
+			},
+		},
+		{
+			name:    "peers",
+			timeout: r.PeersTimeout,
+			check: func(ctx context.Context, client *tendermint.Client) (bool, string, error) {
+				info, err := client.NetInfo(ctx)
+				if err != nil {
+					return false, "", err
+				}
+				detail := fmt.Sprintf("%d of %d peers", len(info.Peers), r.MinPeers)
+				return len(info.Peers) >= r.MinPeers, detail, nil
+			},
+		},
+	}
+}
+
+// WaitReady blocks until the node behind rpc passes every readiness gate in turn: it is no
+// longer catching up, its height is advancing and it has enough peers. RPC errors while a gate
+// is pending count as not ready yet, so WaitReady can be called right after a container start.
+// Returns an error naming the gate that timed out.
+func WaitReady(ctx context.Context, name, rpc string, r Readiness, events EventFunc) error {
+	if events == nil {
+		events = LogEvents
+	}
+	client := tendermint.NewClient(rpc)
+
+	for _, g := range r.gates() {
+		if err := waitGate(ctx, name, client, g, r.Interval, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func waitGate(ctx context.Context, name string, client *tendermint.Client, g gate, interval time.Duration, events EventFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		passed, detail, err := g.check(ctx, client)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("node %s did not pass gate %s within %s: %s", name, g.name, g.timeout, last)
+		}
+		if err != nil {
+			detail = "rpc not available: " + err.Error()
+		}
+		events(Event{Node: name, Gate: g.name, Passed: passed, Detail: detail, Time: time.Now()})
+		if passed {
+			return nil
+		}
+		last = detail
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("node %s did not pass gate %s within %s: %s", name, g.name, g.timeout, last)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package node_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	"github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+func TestWaitReady(t *testing.T) {
+	tests := []struct {
+		name string
+		// catchingUp is the number of polls the node is catching up for.
+		catchingUp int
+		// produces makes the node commit a block on every poll of the advancing gate.
+		produces bool
+		// peersAfter is the number of polls of the peers gate before a peer connects, -1 for never.
+		peersAfter int
+		passed     []string
+		err        string
+	}{
+		{
+			name:       "ready",
+			produces:   true,
+			peersAfter: 0,
+			passed:     []string{"synced", "advancing", "peers"},
+		},
+		{
+			name:       "catches up, then produces and finds peers",
+			catchingUp: 3,
+			produces:   true,
+			peersAfter: 2,
+			passed:     []string{"synced", "advancing", "peers"},
+		},
+		{
+			name:       "stays catching up",
+			catchingUp: 1000,
+			produces:   true,
+			err:        "did not pass gate synced",
+		},
+		{
+			name:       "halted",
+			peersAfter: 0,
+			passed:     []string{"synced"},
+			err:        "did not pass gate advancing",
+		},
+		{
+			name:       "no peers",
+			produces:   true,
+			peersAfter: -1,
+			passed:     []string{"synced", "advancing"},
+			err:        "did not pass gate peers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNode(100, 0)
+			n.Peers = nil
+			n.Status.SyncInfo.CatchingUp = tt.catchingUp > 0
+			srv := fake.NewServer(n)
+			defer srv.Close()
+
+			polls := map[string]int{}
+			var passed []string
+			events := func(e node.Event) {
+				if e.Node != "validator-1" {
+					t.Errorf("event of node %s, want validator-1", e.Node)
+				}
+				if e.Passed {
+					passed = append(passed, e.Gate)
+					return
+				}
+				polls[e.Gate]++
+				switch e.Gate {
+				case "synced":
+					if polls[e.Gate] >= tt.catchingUp {
+						srv.Update(func(n *fake.Node) { n.Status.SyncInfo.CatchingUp = false })
+					}
+				case "advancing":
+					if tt.produces {
+						srv.Advance(1)
+					}
+				case "peers":
+					if tt.peersAfter >= 0 && polls[e.Gate] > tt.peersAfter {
+						srv.Update(func(n *fake.Node) { n.Peers = []tendermint.Peer{{RemoteIP: "10.0.0.2"}} })
+					}
+				}
+			}
+
+			r := node.Readiness{
+				SyncTimeout:    200 * time.Millisecond,
+				AdvanceTimeout: 200 * time.Millisecond,
+				MinBlocks:      2,
+				PeersTimeout:   200 * time.Millisecond,
+				MinPeers:       1,
+				Interval:       5 * time.Millisecond,
+			}
+			err := node.WaitReady(context.Background(), "validator-1", srv.URL(), r, events)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("WaitReady() error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("WaitReady() = %v, want error containing %q", err, tt.err)
+			}
+			if strings.Join(passed, ",") != strings.Join(tt.passed, ",") {
+				t.Fatalf("passed gates %v, want %v", passed, tt.passed)
+			}
+		})
+	}
+}
+
+func TestWaitReadyRPCDown(t *testing.T) {
+	srv := fake.NewServer(newNode(100, 0))
+	srv.Close()
+
+	r := node.DefaultReadiness()
+	r.SyncTimeout, r.Interval = 50*time.Millisecond, 5*time.Millisecond
+	var details []string
+	err := node.WaitReady(context.Background(), "validator-1", srv.URL(), r, func(e node.Event) { details = append(details, e.Detail) })
+	if err == nil || !strings.Contains(err.Error(), "did not pass gate synced") {
+		t.Fatalf("WaitReady() = %v, want the synced gate to time out", err)
+	}
+	if len(details) == 0 || !strings.HasPrefix(details[0], "rpc not available") {
+		t.Fatalf("events = %v, want the rpc errors reported", details)
+	}
+}
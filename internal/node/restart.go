@@ -0,0 +1,37 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/inventory"
+)
+
+// stopTimeout is how long a node gets to shut down before it is killed.
+const stopTimeout = 30 * time.Second
+
+// Restart restarts the sekai container of n and blocks until the node passes the readiness gates.
+func Restart(ctx context.Context, n inventory.Node, r Readiness, events EventFunc) error {
+	dm, err := n.DockerManager()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Restarting node %s...", n.Name)
+	if err := dm.RestartContainer(ctx, n.ContainerName(), stopTimeout); err != nil {
+		return err
+	}
+
+	return WaitReady(ctx, n.Name, n.RPC, r, events)
+}
+
+// RestartAll restarts the nodes one after another. The next node is only touched once the
+// previous one is ready again, so a network never loses more than one node at a time.
+func RestartAll(ctx context.Context, nodes []inventory.Node, r Readiness, events EventFunc) error {
+	for _, n := range nodes {
+		if err := Restart(ctx, n, r, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// BackupLabel marks the volumes holding a data directory backup. Its value is the container name.
+const BackupLabel = "kira.backup"
+
+// appHashMismatch is the error Tendermint logs when the state of a node disagrees with the chain.
+const appHashMismatch = "wrong Block.Header.AppHash"
+
+var rolledBackRe = regexp.MustCompile(`Rolled back state to height (\d+) and hash ([0-9A-Fa-f]+)`)
+
+// RollbackOptions describes a rollback of a node.
+type RollbackOptions struct {
+	// Container is the sekai container of the node.
+	Container string
+	// Home is the sekaid home inside the container.
+	Home string
+	// RPC is the Tendermint RPC address of the node.
+	RPC string
+	// HaltCheck is how long the height of a running node is watched to confirm it is halted.
+	HaltCheck time.Duration
+	// VerifyTimeout is how long the restarted node gets to re-execute the rolled back block.
+	VerifyTimeout time.Duration
+	// DryRun stops after the diagnosis.
+	DryRun bool
+}
+
+// Diagnosis is what Diagnose found out about a node.
+type Diagnosis struct {
+	Running bool `json:"running"`
+	// Height is the height reported by the RPC, 0 for a stopped node.
+	Height int64 `json:"height"`
+	// Halted is set when the node is stopped or its height did not move during the halt check.
+	Halted bool `json:"halted"`
+	// Mismatch is the log line reporting the app hash mismatch, empty when none was logged.
+	Mismatch string `json:"mismatch"`
+}
+
+// RollbackResult describes a completed rollback.
+type RollbackResult struct {
+	Diagnosis Diagnosis `json:"diagnosis"`
+	// Backup is the volume holding a copy of the data directory from before the rollback.
+	Backup string `json:"backup,omitempty"`
+	// Height and AppHash are the state sekaid rolled back to.
+	Height  int64  `json:"height,omitempty"`
+	AppHash string `json:"app_hash,omitempty"`
+	// Reexecuted is the height the node reached after the restart, at least Height+2.
+	Reexecuted int64 `json:"reexecuted,omitempty"`
+}
+
+// Diagnose checks whether a node is halted and logged an app hash mismatch in its current
+// or, when stopped, its last run. A running node is only halted when its RPC reports the
+// same height before and after the halt check.
+func Diagnose(ctx context.Context, dm *docker.DockerManager, opts RollbackOptions) (*Diagnosis, error) {
+	running, err := dm.IsRunning(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+	d := &Diagnosis{Running: running, Halted: !running}
+
+	if running {
+		client := tendermint.NewClient(opts.RPC)
+		before, err := client.Status(ctx)
+		if err != nil {
+			// A node replaying blocks at startup does not answer either, so this proves nothing.
+			return nil, fmt.Errorf("node %s is running but its height cannot be checked: %w", opts.Container, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(opts.HaltCheck):
+		}
+		after, err := client.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query node %s: %w", opts.Container, err)
+		}
+		d.Height = after.SyncInfo.LatestBlockHeight
+		d.Halted = after.SyncInfo.LatestBlockHeight == before.SyncInfo.LatestBlockHeight
+	}
+
+	started, err := dm.StartedAt(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+	d.Mismatch, err = findMismatch(ctx, dm, opts.Container, started)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// findMismatch returns the last log line of the container since the given time reporting an
+// app hash mismatch.
+func findMismatch(ctx context.Context, dm *docker.DockerManager, container, since string) (string, error) {
+	var logs bytes.Buffer
+	opts := docker.LogOptions{Tail: "2000", Since: since, Stdout: true, Stderr: true}
+	if err := dm.StreamContainerLogs(ctx, container, opts, &logs, &logs); err != nil {
+		return "", err
+	}
+
+	var found string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, appHashMismatch) {
+			found = strings.TrimSpace(line)
+		}
+	}
+	return found, nil
+}
+
+// Rollback runs `sekaid rollback` on a node that halted with an app hash mismatch. It refuses
+// to touch a node that is producing blocks or did not log a mismatch. The data directory is
+// copied into a backup volume first, then the node is rolled back by one height, started
+// again and watched until it re-executed the block after the rolled back height.
+// Every step is recorded in trail.
+func Rollback(ctx context.Context, dm *docker.DockerManager, opts RollbackOptions, trail *audit.Trail) (*RollbackResult, error) {
+	if opts.Home == "" {
+		opts.Home = sekai.DefaultHome
+	}
+	rec := trail.Operation("node rollback", opts.Container)
+
+	d, err := Diagnose(ctx, dm, opts)
+	if err != nil {
+		rec.Record("diagnose", "", err)
+		return nil, err
+	}
+	result := &RollbackResult{Diagnosis: *d}
+	detail := fmt.Sprintf("running=%t halted=%t height=%d mismatch=%q", d.Running, d.Halted, d.Height, d.Mismatch)
+	if !d.Halted {
+		err = fmt.Errorf("node %s is still producing blocks (height %d), refusing to roll back", opts.Container, d.Height)
+	} else if d.Mismatch == "" {
+		err = fmt.Errorf("node %s is halted but logged no app hash mismatch, refusing to roll back", opts.Container)
+	}
+	if recErr := rec.Record("diagnose", detail, err); recErr != nil {
+		return nil, recErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Node %s is halted with an app hash mismatch: %s", opts.Container, d.Mismatch)
+	if opts.DryRun {
+		return result, nil
+	}
+
+	image, err := dm.ContainerImage(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+	volume, err := dm.VolumeAt(ctx, opts.Container, opts.Home)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Running {
+		err := dm.StopContainer(ctx, opts.Container, 30*time.Second)
+		if recErr := rec.Record("stop", "", err); recErr != nil {
+			return nil, recErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Backup = fmt.Sprintf("%s-rollback-%d", volume, time.Now().Unix())
+	err = backup(ctx, dm, opts, image, volume, result.Backup)
+	if recErr := rec.Record("backup", "volume "+result.Backup, err); recErr != nil {
+		return nil, recErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Height, result.AppHash, err = rollbackState(ctx, dm, opts, image, volume)
+	if recErr := rec.Record("rollback", fmt.Sprintf("height %d, app hash %s", result.Height, result.AppHash), err); recErr != nil {
+		return nil, recErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w; the data directory is backed up in volume %s", err, result.Backup)
+	}
+
+	err = dm.StartContainer(ctx, opts.Container)
+	if recErr := rec.Record("start", "", err); recErr != nil {
+		return nil, recErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	started, err := dm.StartedAt(ctx, opts.Container)
+	if err != nil {
+		return nil, err
+	}
+
+	// The block store keeps block n = Height+1 after the rollback, so the node reports it before
+	// re-executing it. Block n+1 carries the app hash of n, committing it proves n was re-executed.
+	result.Reexecuted, err = verifyReexecution(ctx, dm, opts, result.Height+2, started)
+	if recErr := rec.Record("verify", fmt.Sprintf("block %d, reached height %d", result.Height+1, result.Reexecuted), err); recErr != nil {
+		return nil, recErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w; the data directory from before the rollback is backed up in volume %s", err, result.Backup)
+	}
+	log.Infof("Node %s re-executed block %d, now at height %d", opts.Container, result.Height+1, result.Reexecuted)
+
+	return result, nil
+}
+
+// backup copies the data directory of the node into a new volume.
+func backup(ctx context.Context, dm *docker.DockerManager, opts RollbackOptions, image, volume, name string) error {
+	if err := dm.EnsureVolume(ctx, name, map[string]string{BackupLabel: opts.Container}); err != nil {
+		return err
+	}
+
+	log.Infof("Backing up data of %s into volume %s...", opts.Container, name)
+	volumes := []docker.VolumeMount{{Name: volume, Target: opts.Home}, {Name: name, Target: "/backup"}}
+	return dm.CopyDir(ctx, opts.Container+"-backup-job", image, volumes, path.Join(opts.Home, "data"), "/backup/data")
+}
+
+// rollbackState runs `sekaid rollback` in a toolbox container that mounts the node home and
+// returns the height and app hash it rolled back to.
+func rollbackState(ctx context.Context, dm *docker.DockerManager, opts RollbackOptions, image, volume string) (int64, string, error) {
+	toolbox := opts.Container + "-rollback"
+	if err := dm.StartToolbox(ctx, toolbox, image, []docker.VolumeMount{{Name: volume, Target: opts.Home}}); err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	log.Infof("Rolling back state of %s...", opts.Container)
+	res, err := dm.Exec(ctx, toolbox, []string{"sekaid", "rollback", "--home=" + opts.Home})
+	if err != nil {
+		return 0, "", err
+	}
+	if res.ExitCode != 0 {
+		return 0, "", fmt.Errorf("`sekaid rollback` exited with code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	match := rolledBackRe.FindStringSubmatch(res.Stdout + res.Stderr)
+	if match == nil {
+		return 0, "", fmt.Errorf("unexpected output of `sekaid rollback`: %s", strings.TrimSpace(res.Stdout+res.Stderr))
+	}
+	height, _ := strconv.ParseInt(match[1], 10, 64)
+
+	return height, match[2], nil
+}
+
+// verifyReexecution waits until the node reports height. It fails as soon as the node
+// logs another app hash mismatch since started, the start time of its current run.
+func verifyReexecution(ctx context.Context, dm *docker.DockerManager, opts RollbackOptions, height int64, started string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.VerifyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	client := tendermint.NewClient(opts.RPC)
+	var latest int64
+	for {
+		if status, err := client.Status(ctx); err == nil {
+			latest = status.SyncInfo.LatestBlockHeight
+			if latest >= height {
+				return latest, nil
+			}
+		}
+		mismatch, err := findMismatch(ctx, dm, opts.Container, started)
+		if err == nil && mismatch != "" {
+			return latest, fmt.Errorf("node %s hit the app hash mismatch again: %s", opts.Container, mismatch)
+		}
+
+		select {
+		case <-ctx.Done():
+			return latest, fmt.Errorf("node %s did not commit block %d within %s, last seen at height %d", opts.Container, height, opts.VerifyTimeout, latest)
+		case <-ticker.C:
+		}
+	}
+}
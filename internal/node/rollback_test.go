@@ -0,0 +1,258 @@
+package node_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+const mismatchLine = `ERR CONSENSUS FAILURE!!! err="wrong Block.Header.AppHash. Expected 5F2A, got 9C1B" height=120`
+
+// newHaltedNode runs a sekai container and an RPC at height. When halted is set the node logs
+// an app hash mismatch and exits.
+func newHaltedNode(t *testing.T, height int64, halted bool) (*fake.Client, *docker.DockerManager, *tmfake.Server) {
+	f := fake.New()
+	f.AddImage(sekaiImage)
+	dm := docker.NewDockerManagerWithClient(f)
+	ctx := context.Background()
+	spec := docker.NodeSpec{Name: "kira-sekai", Image: sekaiImage, Volumes: []docker.VolumeMount{{Name: "kira-sekai", Target: "/sekai"}}}
+	if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	if err := dm.StartContainer(ctx, "kira-sekai"); err != nil {
+		t.Fatalf("StartContainer() error: %v", err)
+	}
+	if halted {
+		f.WriteLog("kira-sekai", true, mismatchLine)
+		f.Exit("kira-sekai", 1)
+	}
+
+	rpc := tmfake.NewServer(tmfake.Node{Status: tendermint.Status{SyncInfo: tendermint.SyncInfo{LatestBlockHeight: height}}})
+	t.Cleanup(rpc.Close)
+	return f, dm, rpc
+}
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name     string
+		halted   bool
+		setup    func(t *testing.T, f *fake.Client, dm *docker.DockerManager, rpc *tmfake.Server)
+		want     node.Diagnosis
+		err      string
+		rpcDown  bool
+		mismatch bool
+	}{
+		{name: "stopped after a mismatch", halted: true, want: node.Diagnosis{Halted: true}, mismatch: true},
+		{
+			name:   "mismatch of an earlier run",
+			halted: true,
+			setup: func(t *testing.T, f *fake.Client, dm *docker.DockerManager, rpc *tmfake.Server) {
+				if err := dm.StartContainer(context.Background(), "kira-sekai"); err != nil {
+					t.Fatalf("StartContainer() error: %v", err)
+				}
+				f.WriteLog("kira-sekai", false, "INF replaying blocks height=100")
+				f.Exit("kira-sekai", 1)
+			},
+			want: node.Diagnosis{Halted: true},
+		},
+		{name: "running at a static height", want: node.Diagnosis{Running: true, Height: 120, Halted: true}},
+		{
+			name: "running and producing blocks",
+			setup: func(t *testing.T, f *fake.Client, dm *docker.DockerManager, rpc *tmfake.Server) {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					rpc.Advance(1)
+				}()
+			},
+			want: node.Diagnosis{Running: true, Height: 121},
+		},
+		{
+			name: "running with an old mismatch while replaying",
+			setup: func(t *testing.T, f *fake.Client, dm *docker.DockerManager, rpc *tmfake.Server) {
+				f.WriteLog("kira-sekai", true, mismatchLine)
+				f.Exit("kira-sekai", 1)
+				if err := dm.StartContainer(context.Background(), "kira-sekai"); err != nil {
+					t.Fatalf("StartContainer() error: %v", err)
+				}
+			},
+			rpcDown: true,
+			err:     "node kira-sekai is running but its height cannot be checked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, dm, rpc := newHaltedNode(t, 120, tt.halted)
+			if tt.setup != nil {
+				tt.setup(t, f, dm, rpc)
+			}
+			opts := node.RollbackOptions{Container: "kira-sekai", RPC: rpc.URL(), HaltCheck: 100 * time.Millisecond}
+			if tt.rpcDown {
+				rpc.Close()
+			}
+
+			d, err := node.Diagnose(context.Background(), dm, opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Diagnose() = %+v, %v, want error containing %q", d, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Diagnose() error: %v", err)
+			}
+			if tt.mismatch != (d.Mismatch == mismatchLine) {
+				t.Fatalf("Mismatch = %q, want it set: %t", d.Mismatch, tt.mismatch)
+			}
+			d.Mismatch = ""
+			if *d != tt.want {
+				t.Fatalf("Diagnose() = %+v, want %+v", *d, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		halted  bool
+		dryRun  bool
+		height  int64
+		again   bool
+		err     string
+		actions []string
+	}{
+		{
+			name:    "rolled back and re-executed",
+			halted:  true,
+			height:  121,
+			actions: []string{"diagnose", "backup", "rollback", "start", "verify"},
+		},
+		{name: "dry run", halted: true, dryRun: true, height: 120, actions: []string{"diagnose"}},
+		{
+			name:    "producing blocks",
+			height:  120,
+			err:     "node kira-sekai is still producing blocks",
+			actions: []string{"diagnose"},
+		},
+		{
+			name:    "mismatch again",
+			halted:  true,
+			height:  120,
+			again:   true,
+			err:     "node kira-sekai hit the app hash mismatch again",
+			actions: []string{"diagnose", "backup", "rollback", "start", "verify"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, dm, rpc := newHaltedNode(t, tt.height, tt.halted)
+			if !tt.halted {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					rpc.Advance(1)
+				}()
+			}
+			var copies []string
+			f.RunHandler = func(containerName string, cmd []string) *docker.ExecResult {
+				switch {
+				case strings.HasSuffix(containerName, "-backup-job"):
+					copies = append(copies, cmd[len(cmd)-1])
+					return &docker.ExecResult{}
+				case containerName == "kira-sekai" && tt.again:
+					return &docker.ExecResult{Stderr: mismatchLine, ExitCode: 1}
+				}
+				return nil
+			}
+			f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+				if containerName == "kira-sekai-rollback" && strings.Join(cmd, " ") == "sekaid rollback --home=/sekai" {
+					return docker.ExecResult{Stdout: "Rolled back state to height 119 and hash ABCD\n"}
+				}
+				return docker.ExecResult{ExitCode: 1}
+			}
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			trail, err := audit.Open(path)
+			if err != nil {
+				t.Fatalf("audit.Open() error: %v", err)
+			}
+
+			opts := node.RollbackOptions{
+				Container:     "kira-sekai",
+				RPC:           rpc.URL(),
+				HaltCheck:     100 * time.Millisecond,
+				VerifyTimeout: time.Second,
+				DryRun:        tt.dryRun,
+			}
+			result, err := node.Rollback(context.Background(), dm, opts, trail)
+			if got := auditActions(t, path); strings.Join(got, " ") != strings.Join(tt.actions, " ") {
+				t.Fatalf("audit actions = %q, want %q", got, tt.actions)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Rollback() = %+v, %v, want error containing %q", result, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rollback() error: %v", err)
+			}
+			if tt.dryRun {
+				if result.Backup != "" || len(copies) != 0 {
+					t.Fatalf("dry run backed up into %q with copies %q", result.Backup, copies)
+				}
+				return
+			}
+
+			if result.Height != 119 || result.AppHash != "ABCD" || result.Reexecuted != 121 {
+				t.Fatalf("Rollback() = %+v, want height 119, app hash ABCD and re-executed at 121", result)
+			}
+			if len(copies) != 1 || copies[0] != "rm -rf '/backup/data' && cp -a '/sekai/data' '/backup/data'" {
+				t.Fatalf("copies = %q, want the data directory copied to the backup", copies)
+			}
+			vol, err := f.VolumeInspect(context.Background(), result.Backup)
+			if err != nil {
+				t.Fatalf("backup volume %s: %v", result.Backup, err)
+			}
+			if vol.Labels[node.BackupLabel] != "kira-sekai" {
+				t.Fatalf("backup volume labels = %v, want %s=kira-sekai", vol.Labels, node.BackupLabel)
+			}
+			if running, _ := dm.IsRunning(context.Background(), "kira-sekai"); !running {
+				t.Fatal("node is not running after the rollback")
+			}
+		})
+	}
+}
+
+// auditActions returns the actions recorded in the audit file at path.
+func auditActions(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit trail: %v", err)
+	}
+	defer file.Close()
+
+	var actions []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("audit entry %q: %v", scanner.Text(), err)
+		}
+		actions = append(actions, e.Action)
+	}
+	return actions
+}
@@ -0,0 +1,128 @@
+// Package node inspects and operates the sekai nodes of a network through their RPC.
+package node
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// blockTimeWindow is the number of blocks the average block time is measured over.
+const blockTimeWindow = 10
+
+// Status is the health summary of one node.
+type Status struct {
+	Name       string `json:"name"`
+	RPC        string `json:"rpc"`
+	ChainID    string `json:"chain_id,omitempty"`
+	NodeID     string `json:"node_id,omitempty"`
+	Moniker    string `json:"moniker,omitempty"`
+	Height     int64  `json:"height"`
+	CatchingUp bool   `json:"catching_up"`
+	Peers      int    `json:"peers"`
+	// VotingPower is the power of the node's consensus key, 0 for non-validators.
+	VotingPower int64 `json:"voting_power"`
+	// TotalPower is the power of the whole validator set.
+	TotalPower      int64     `json:"total_power"`
+	LatestBlockTime time.Time `json:"latest_block_time"`
+	// BlockTime is the average interval of the last blocks.
+	BlockTime time.Duration `json:"block_time"`
+	// Drift is how far the latest block lags behind the local clock.
+	Drift time.Duration `json:"drift"`
+	// Error is set when the node could not be queried. The other fields are then partial.
+	Error string `json:"error,omitempty"`
+}
+
+// Probe queries the RPC of a node. Failures are recorded in Status.Error, so a down node
+// still produces a row.
+func Probe(ctx context.Context, name, rpc string) *Status {
+	client := tendermint.NewClient(rpc)
+	status := &Status{Name: name, RPC: client.URL}
+	if err := status.probe(ctx, client); err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func (s *Status) probe(ctx context.Context, client *tendermint.Client) error {
+	st, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	s.ChainID = st.NodeInfo.Network
+	s.NodeID = st.NodeInfo.ID
+	s.Moniker = st.NodeInfo.Moniker
+	s.Height = st.SyncInfo.LatestBlockHeight
+	s.CatchingUp = st.SyncInfo.CatchingUp
+	s.VotingPower = st.ValidatorInfo.VotingPower
+	s.LatestBlockTime = st.SyncInfo.LatestBlockTime
+	s.Drift = time.Since(st.SyncInfo.LatestBlockTime).Round(time.Millisecond)
+
+	netInfo, err := client.NetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	s.Peers = len(netInfo.Peers)
+
+	validators, err := client.Validators(ctx, 0)
+	if err != nil {
+		return err
+	}
+	for _, val := range validators {
+		s.TotalPower += val.VotingPower
+	}
+
+	if from := s.Height - blockTimeWindow; from >= 1 && from >= st.SyncInfo.EarliestHeight {
+		block, err := client.Block(ctx, from)
+		if err != nil {
+			return err
+		}
+		s.BlockTime = (st.SyncInfo.LatestBlockTime.Sub(block.Time) / blockTimeWindow).Round(time.Millisecond)
+	}
+
+	return nil
+}
+
+// ProbeAll queries the nodes concurrently and returns their status in inventory order.
+func ProbeAll(ctx context.Context, nodes []inventory.Node) []*Status {
+	statuses := make([]*Status, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, n inventory.Node) {
+			defer wg.Done()
+			statuses[i] = Probe(ctx, n.Name, n.RPC)
+		}(i, n)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// FormatStatuses renders statuses as a text table.
+func FormatStatuses(statuses []*Status) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %-12s %10s %-8s %5s %-16s %-10s %s\n", "NODE", "CHAIN", "HEIGHT", "SYNCING", "PEERS", "POWER", "BLOCK TIME", "DRIFT")
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Fprintf(&b, "%-16s error: %s\n", s.Name, s.Error)
+			continue
+		}
+		power := "-"
+		if s.VotingPower > 0 && s.TotalPower > 0 {
+			power = fmt.Sprintf("%d (%.1f%%)", s.VotingPower, 100*float64(s.VotingPower)/float64(s.TotalPower))
+		}
+		blockTime := "-"
+		if s.BlockTime > 0 {
+			blockTime = s.BlockTime.String()
+		}
+		fmt.Fprintf(&b, "%-16s %-12s %10d %-8t %5d %-16s %-10s %s\n", s.Name, s.ChainID, s.Height, s.CatchingUp, s.Peers, power, blockTime, s.Drift)
+	}
+
+	return b.String()
+}
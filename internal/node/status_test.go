@@ -0,0 +1,117 @@
+package node_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	"github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+// newNode returns a synced validator at height that produced its last block lag ago.
+func newNode(height int64, lag time.Duration) fake.Node {
+	var n fake.Node
+	n.Status.NodeInfo = tendermint.NodeInfo{ID: "a1b2", Network: "localnet-1", Moniker: "validator"}
+	n.Status.SyncInfo = tendermint.SyncInfo{LatestBlockHeight: height, LatestBlockTime: time.Now().Add(-lag), EarliestHeight: 1}
+	n.Status.ValidatorInfo = tendermint.ValidatorInfo{VotingPower: 25}
+	n.Peers = []tendermint.Peer{{RemoteIP: "10.0.0.2"}, {RemoteIP: "10.0.0.3"}}
+	n.Validators = []tendermint.Validator{{Address: "A", VotingPower: 25}, {Address: "B", VotingPower: 75}}
+	n.BlockInterval = 5 * time.Second
+	return n
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      fake.Node
+		height    int64
+		blockTime time.Duration
+		drift     time.Duration
+	}{
+		{name: "block time over the window", node: newNode(100, 30*time.Second), height: 100, blockTime: 5 * time.Second, drift: 30 * time.Second},
+		{name: "too few blocks for a block time", node: newNode(5, time.Second), height: 5, drift: time.Second},
+		{
+			name: "window pruned",
+			node: func() fake.Node {
+				n := newNode(100, 0)
+				n.Status.SyncInfo.EarliestHeight = 95
+				return n
+			}(),
+			height: 100,
+		},
+		{
+			name: "slow blocks",
+			node: func() fake.Node {
+				n := newNode(200, 2*time.Minute)
+				n.BlockInterval = 12 * time.Second
+				return n
+			}(),
+			height:    200,
+			blockTime: 12 * time.Second,
+			drift:     2 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fake.NewServer(tt.node)
+			defer srv.Close()
+
+			status := node.Probe(context.Background(), "validator-1", srv.URL())
+			if status.Error != "" {
+				t.Fatalf("Probe() error: %s", status.Error)
+			}
+			if status.Name != "validator-1" || status.ChainID != "localnet-1" || status.Height != tt.height {
+				t.Fatalf("Probe() = %+v, want validator-1 on localnet-1 at height %d", status, tt.height)
+			}
+			if status.Peers != 2 || status.VotingPower != 25 || status.TotalPower != 100 {
+				t.Fatalf("Probe() has %d peers and power %d of %d, want 2 peers and 25 of 100", status.Peers, status.VotingPower, status.TotalPower)
+			}
+			if status.BlockTime != tt.blockTime {
+				t.Fatalf("Probe() block time = %s, want %s", status.BlockTime, tt.blockTime)
+			}
+			if d := status.Drift - tt.drift; d < 0 || d > time.Second {
+				t.Fatalf("Probe() drift = %s, want about %s", status.Drift, tt.drift)
+			}
+		})
+	}
+}
+
+func TestProbeAll(t *testing.T) {
+	first := fake.NewServer(newNode(100, 0))
+	defer first.Close()
+	second := fake.NewServer(newNode(90, time.Minute))
+	defer second.Close()
+	down := fake.NewServer(newNode(1, 0))
+	down.Close()
+
+	nodes := []inventory.Node{
+		{Name: "validator-1", RPC: first.URL()},
+		{Name: "sentry-1", RPC: down.URL()},
+		{Name: "sentry-2", RPC: second.URL()},
+	}
+	statuses := node.ProbeAll(context.Background(), nodes)
+	if len(statuses) != len(nodes) {
+		t.Fatalf("ProbeAll() returned %d statuses, want %d", len(statuses), len(nodes))
+	}
+	for i, n := range nodes {
+		if statuses[i].Name != n.Name {
+			t.Fatalf("status %d is of %s, want %s", i, statuses[i].Name, n.Name)
+		}
+	}
+	if statuses[0].Height != 100 || statuses[2].Height != 90 {
+		t.Fatalf("ProbeAll() heights = %d, %d, want 100, 90", statuses[0].Height, statuses[2].Height)
+	}
+	if statuses[1].Error == "" {
+		t.Fatal("ProbeAll() of a down node has no error")
+	}
+
+	table := node.FormatStatuses(statuses)
+	if !strings.Contains(table, "sentry-1         error:") || !strings.Contains(table, "25 (25.0%)") {
+		t.Fatalf("FormatStatuses() = %q, want the error row and the power share", table)
+	}
+}
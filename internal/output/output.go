@@ -0,0 +1,129 @@
+// Package output renders command results as text for people or as JSON or YAML for automation.
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format selected with --output.
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// Formats are the values --output accepts.
+var Formats = []string{string(Text), string(JSON), string(YAML)}
+
+// flag is the name of the persistent flag on the root command.
+const flag = "output"
+
+// AddFlag adds the --output flag to the root command, it is inherited by every subcommand.
+func AddFlag(root *cobra.Command) {
+	root.PersistentFlags().String(flag, string(Text), fmt.Sprintf("Output format of command results, one of: %s", strings.Join(Formats, ", ")))
+}
+
+// ParseFormat returns the Format named s.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(s, f) {
+			return Format(f), nil
+		}
+	}
+	return "", fmt.Errorf("invalid output format %q, expected one of: %s", s, strings.Join(Formats, ", "))
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx selecting format for the commands run with it.
+func NewContext(ctx context.Context, format Format) context.Context {
+	return context.WithValue(ctx, contextKey{}, format)
+}
+
+// FormatOf returns the format selected for cmd: the one of its context, else its --output flag.
+func FormatOf(cmd *cobra.Command) Format {
+	if ctx := cmd.Context(); ctx != nil {
+		if format, ok := ctx.Value(contextKey{}).(Format); ok {
+			return format
+		}
+	}
+	value, _ := cmd.Flags().GetString(flag)
+	format, err := ParseFormat(value)
+	if err != nil {
+		return Text
+	}
+	return format
+}
+
+// Print renders the result v of cmd on its output in the selected format. text is printed
+// as is in the text format.
+func Print(cmd *cobra.Command, v interface{}, text string) error {
+	return Write(cmd.OutOrStdout(), FormatOf(cmd), v, text)
+}
+
+// Write renders v, or text in the text format, to w.
+func Write(w io.Writer, format Format, v interface{}, text string) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return nil
+	case YAML:
+		doc, err := toYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(doc)
+		return err
+	default:
+		_, err := io.WriteString(w, text)
+		return err
+	}
+}
+
+// toYAML encodes v as YAML with the field names and order of its JSON encoding, so both
+// formats describe a result the same way and types only need JSON tags.
+func toYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	// JSON is YAML in flow style, decoding it into a node keeps the key order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to convert output to YAML: %w", err)
+	}
+	blockStyle(&node)
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return []byte(b.String()), nil
+}
+
+// blockStyle drops the flow style and the quotes JSON put on the nodes. The encoder quotes
+// the strings that would read as another type again.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,179 @@
+// Package sekai runs sekaid commands inside a node container.
+package sekai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/logging"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+const (
+	// DefaultHome is the sekaid home inside the containers the launcher creates.
+	DefaultHome = "/sekai"
+	// KeyringBackend is the keyring the launcher uses inside containers.
+	KeyringBackend = "test"
+)
+
+// CLI executes sekaid in a running container through DockerManager exec.
+type CLI struct {
+	DM        *docker.DockerManager
+	Container string
+	Home      string
+}
+
+// NewCLI returns a CLI for the sekaid home at home in container.
+func NewCLI(dm *docker.DockerManager, container, home string) *CLI {
+	if home == "" {
+		home = DefaultHome
+	}
+	return &CLI{DM: dm, Container: container, Home: home}
+}
+
+// Run executes `sekaid <args> --home=<home>` and returns its stdout.
+// A non-zero exit code is returned as an error carrying stderr.
+func (c *CLI) Run(ctx context.Context, args ...string) (string, error) {
+	cmd := append([]string{"sekaid"}, args...)
+	cmd = append(cmd, "--home="+c.Home)
+	log.Debugf("Running in %s: %s", c.Container, strings.Join(cmd, " "))
+
+	res, err := c.DM.Exec(ctx, c.Container, cmd)
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return res.Stdout, fmt.Errorf("`sekaid %s` exited with code %d: %s", args[0], res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	if res.Stderr != "" {
+		log.Debugf("sekaid %s stderr: %s", args[0], res.Stderr)
+	}
+
+	return res.Stdout, nil
+}
+
+// RunJSON executes sekaid with `--output=json` and decodes stdout into v.
+func (c *CLI) RunJSON(ctx context.Context, v interface{}, args ...string) error {
+	out, err := c.Run(ctx, append(args, "--output=json")...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(out), v); err != nil {
+		return fmt.Errorf("failed to decode output of `sekaid %s`: %w", args[0], err)
+	}
+
+	return nil
+}
+
+// Shell executes a shell command in the container and returns its stdout.
+func (c *CLI) Shell(ctx context.Context, script string) (string, error) {
+	res, err := c.DM.Exec(ctx, c.Container, []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return res.Stdout, fmt.Errorf("`%s` exited with code %d: %s", script, res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	return res.Stdout, nil
+}
+
+// FileExists reports whether path exists in the container.
+func (c *CLI) FileExists(ctx context.Context, path string) (bool, error) {
+	res, err := c.DM.Exec(ctx, c.Container, []string{"test", "-e", path})
+	if err != nil {
+		return false, err
+	}
+
+	return res.ExitCode == 0, nil
+}
+
+// GenesisPath is the path of genesis.json in the sekaid home.
+func (c *CLI) GenesisPath() string {
+	return c.Home + "/config/genesis.json"
+}
+
+// ConfigPath is the path of a file in the config directory of the sekaid home, e.g. config.toml.
+func (c *CLI) ConfigPath(name string) string {
+	return c.Home + "/config/" + name
+}
+
+// LatestHeight returns the latest block height the node committed, from `sekaid status`.
+func (c *CLI) LatestHeight(ctx context.Context) (int64, error) {
+	res, err := c.DM.Exec(ctx, c.Container, []string{"sekaid", "status", "--home=" + c.Home})
+	if err != nil {
+		return 0, err
+	}
+	if res.ExitCode != 0 {
+		return 0, fmt.Errorf("`sekaid status` exited with code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	// Depending on the version, sekaid prints the status to stdout or stderr.
+	out := res.Stdout
+	if strings.TrimSpace(out) == "" {
+		out = res.Stderr
+	}
+	var status struct {
+		SyncInfo struct {
+			LatestBlockHeight int64 `json:"latest_block_height,string"`
+		} `json:"SyncInfo"`
+	}
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return 0, fmt.Errorf("failed to decode output of `sekaid status`: %w", err)
+	}
+	if status.SyncInfo.LatestBlockHeight == 0 {
+		return 0, fmt.Errorf("node has not committed a block yet")
+	}
+
+	return status.SyncInfo.LatestBlockHeight, nil
+}
+
+// KeyAddress returns the address of a key in the keyring.
+func (c *CLI) KeyAddress(ctx context.Context, name string) (string, error) {
+	out, err := c.Run(ctx, "keys", "show", name, "--address", "--keyring-backend="+KeyringBackend)
+	if err != nil {
+		return "", fmt.Errorf("failed to show key %s: %w", name, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Key is a key added to the keyring with `sekaid keys add`.
+type Key struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	// Mnemonic is the only way to recover the key once the keyring is gone.
+	Mnemonic string `json:"mnemonic"`
+}
+
+// AddKey adds a new key to the keyring and returns it with its mnemonic.
+func (c *CLI) AddKey(ctx context.Context, name string) (*Key, error) {
+	cmd := []string{"sekaid", "keys", "add", name, "--keyring-backend=" + KeyringBackend, "--output=json", "--home=" + c.Home}
+	res, err := c.DM.Exec(ctx, c.Container, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("`sekaid keys add` exited with code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	// Depending on the version sekaid prints the key to stdout or stderr.
+	for _, out := range []string{res.Stdout, res.Stderr} {
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+			var key Key
+			if err := json.Unmarshal([]byte(line), &key); err == nil && key.Address != "" && key.Mnemonic != "" {
+				return &key, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("`sekaid keys add %s` printed no key with a mnemonic", name)
+}
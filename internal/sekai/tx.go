@@ -0,0 +1,234 @@
+package sekai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeeDenom is the denom fees are paid in.
+const FeeDenom = "ukex"
+
+// DefaultGasAdjustment is multiplied with the simulated gas of a transaction.
+const DefaultGasAdjustment = 1.3
+
+var gasEstimateRe = regexp.MustCompile(`gas estimate: (\d+)`)
+
+// TxOptions are the signing, fee and gas settings of a transaction.
+type TxOptions struct {
+	ChainID string
+	// From is the key in the keyring signing the transaction.
+	From string
+	// Fees are paid with the transaction, e.g. `100ukex`. Estimated with EstimateFee when empty.
+	Fees string
+	// FeeType is the execution fee transaction type, e.g. `submit-proposal`, used to estimate Fees.
+	FeeType string
+	// Gas is the gas limit. Estimated by simulating the transaction when 0.
+	Gas uint64
+	// GasAdjustment is multiplied with the simulated gas, DefaultGasAdjustment when 0.
+	GasAdjustment float64
+	// Timeout is how long to wait for the transaction to be committed.
+	Timeout time.Duration
+}
+
+// TxEvent is an event emitted by a transaction.
+type TxEvent struct {
+	Type       string `json:"type"`
+	Attributes []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"attributes"`
+}
+
+// txResponse is the output of `sekaid tx` and `sekaid query tx`.
+type txResponse struct {
+	Height    int64  `json:"height,string"`
+	TxHash    string `json:"txhash"`
+	Codespace string `json:"codespace"`
+	Code      uint32 `json:"code"`
+	RawLog    string `json:"raw_log"`
+	Logs      []struct {
+		Events []TxEvent `json:"events"`
+	} `json:"logs"`
+	GasWanted int64 `json:"gas_wanted,string"`
+	GasUsed   int64 `json:"gas_used,string"`
+}
+
+// TxResult is a committed transaction.
+type TxResult struct {
+	TxHash    string    `json:"txhash"`
+	Height    int64     `json:"height"`
+	GasWanted int64     `json:"gas_wanted"`
+	GasUsed   int64     `json:"gas_used"`
+	Fees      string    `json:"fees"`
+	Events    []TxEvent `json:"events"`
+}
+
+// Event returns the value of the first attribute key of an event of type typ, empty when
+// the transaction emitted none.
+func (r *TxResult) Event(typ, key string) string {
+	for _, e := range r.Events {
+		if e.Type != typ {
+			continue
+		}
+		for _, a := range e.Attributes {
+			if a.Key == key {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// ChainID reads the chain-id from the genesis of the home.
+func (c *CLI) ChainID(ctx context.Context) (string, error) {
+	data, err := c.DM.ReadFile(ctx, c.Container, c.GenesisPath())
+	if err != nil {
+		return "", err
+	}
+	var doc struct {
+		ChainID string `json:"chain_id"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.ChainID == "" {
+		return "", fmt.Errorf("no chain_id in %s", c.GenesisPath())
+	}
+	return doc.ChainID, nil
+}
+
+// EstimateFee returns the fee of a transaction of the given execution fee type: the execution
+// fee of the type when the network sets one, at least the minimum and at most the maximum
+// transaction fee of the network properties.
+func (c *CLI) EstimateFee(ctx context.Context, feeType string) (string, error) {
+	var props struct {
+		Properties struct {
+			MinTxFee uint64 `json:"min_tx_fee,string"`
+			MaxTxFee uint64 `json:"max_tx_fee,string"`
+		} `json:"properties"`
+	}
+	if err := c.RunJSON(ctx, &props, "query", "customgov", "network-properties"); err != nil {
+		return "", err
+	}
+	fee := props.Properties.MinTxFee
+
+	if feeType != "" {
+		var fees struct {
+			Fees []struct {
+				TransactionType string `json:"transaction_type"`
+				ExecutionFee    uint64 `json:"execution_fee,string"`
+			} `json:"fees"`
+		}
+		if err := c.RunJSON(ctx, &fees, "query", "customgov", "all-execution-fees"); err != nil {
+			return "", err
+		}
+		for _, f := range fees.Fees {
+			if f.TransactionType == feeType && f.ExecutionFee > fee {
+				fee = f.ExecutionFee
+			}
+		}
+	}
+	if props.Properties.MaxTxFee > 0 && fee > props.Properties.MaxTxFee {
+		fee = props.Properties.MaxTxFee
+	}
+
+	return strconv.FormatUint(fee, 10) + FeeDenom, nil
+}
+
+// Tx signs and broadcasts `sekaid tx <args>` with the key opts.From and waits until it is
+// committed. Fees and gas are estimated unless set in opts. A transaction rejected by the
+// mempool or failing in its block is returned as an error.
+func (c *CLI) Tx(ctx context.Context, opts TxOptions, args ...string) (*TxResult, error) {
+	if opts.GasAdjustment == 0 {
+		opts.GasAdjustment = DefaultGasAdjustment
+	}
+	if opts.ChainID == "" {
+		chainID, err := c.ChainID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts.ChainID = chainID
+	}
+	if opts.Fees == "" {
+		fees, err := c.EstimateFee(ctx, opts.FeeType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate fees: %w", err)
+		}
+		opts.Fees = fees
+	}
+
+	cmd := append([]string{"tx"}, args...)
+	cmd = append(cmd, "--from="+opts.From, "--chain-id="+opts.ChainID, "--keyring-backend="+KeyringBackend, "--fees="+opts.Fees)
+	if opts.Gas == 0 {
+		gas, err := c.simulate(ctx, cmd, opts.GasAdjustment)
+		if err != nil {
+			return nil, err
+		}
+		opts.Gas = gas
+	}
+	cmd = append(cmd, "--gas="+strconv.FormatUint(opts.Gas, 10), "--broadcast-mode=sync", "--yes")
+
+	log.Infof("Broadcasting `sekaid tx %s` with %s fees and %d gas...", args[0], opts.Fees, opts.Gas)
+	var resp txResponse
+	if err := c.RunJSON(ctx, &resp, cmd...); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("transaction rejected with code %d (%s): %s", resp.Code, resp.Codespace, resp.RawLog)
+	}
+
+	return c.waitTx(ctx, resp.TxHash, opts)
+}
+
+// simulate runs cmd with `--dry-run` and returns the adjusted gas it needs.
+func (c *CLI) simulate(ctx context.Context, cmd []string, adjustment float64) (uint64, error) {
+	full := append([]string{"sekaid"}, cmd...)
+	full = append(full, "--gas=auto", "--gas-adjustment="+strconv.FormatFloat(adjustment, 'f', -1, 64), "--dry-run", "--home="+c.Home)
+	res, err := c.DM.Exec(ctx, c.Container, full)
+	if err != nil {
+		return 0, err
+	}
+	if res.ExitCode != 0 {
+		return 0, fmt.Errorf("failed to simulate transaction: %s", strings.TrimSpace(res.Stderr))
+	}
+	match := gasEstimateRe.FindStringSubmatch(res.Stdout + res.Stderr)
+	if match == nil {
+		return 0, fmt.Errorf("simulation printed no gas estimate: %s", strings.TrimSpace(res.Stdout+res.Stderr))
+	}
+
+	return strconv.ParseUint(match[1], 10, 64)
+}
+
+// waitTx polls for a transaction until it is committed or opts.Timeout passed.
+func (c *CLI) waitTx(ctx context.Context, hash string, opts TxOptions) (*TxResult, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		var resp txResponse
+		if err := c.RunJSON(ctx, &resp, "query", "tx", hash); err == nil && resp.Height > 0 {
+			if resp.Code != 0 {
+				return nil, fmt.Errorf("transaction %s failed at height %d with code %d (%s): %s", hash, resp.Height, resp.Code, resp.Codespace, resp.RawLog)
+			}
+			result := &TxResult{TxHash: hash, Height: resp.Height, GasWanted: resp.GasWanted, GasUsed: resp.GasUsed, Fees: opts.Fees}
+			for _, l := range resp.Logs {
+				result.Events = append(result.Events, l.Events...)
+			}
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("transaction %s was not committed within %s", hash, timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sekaiconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 2
+
+// Diff renders the line changes between two versions of a file in unified diff format.
+// Returns an empty string when both versions are equal.
+func Diff(name string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	before, after := strings.Split(string(a), "\n"), strings.Split(string(b), "\n")
+	ops := lineOps(before, after)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	for start := 0; start < len(ops); {
+		// Find the next change and the hunk of changes close enough to share context.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops) && i <= last+2*diffContext; i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			}
+		}
+
+		from, to := first-diffContext, last+diffContext+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(ops) {
+			to = len(ops)
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", ops[from].oldLine+1, oldCount, ops[from].newLine+1, newCount)
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = to
+	}
+
+	return out.String()
+}
+
+type lineOp struct {
+	kind    byte // ' ', '-' or '+'
+	text    string
+	oldLine int
+	newLine int
+}
+
+// lineOps computes a shortest edit script between two line lists with a longest common subsequence.
+func lineOps(a, b []string) []lineOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []lineOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, lineOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, lineOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, lineOp{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	return ops
+}
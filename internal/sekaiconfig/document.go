@@ -0,0 +1,244 @@
+// Package sekaiconfig edits the config.toml and app.toml files of a sekaid home.
+//
+// Files are edited line by line: only the lines of the changed keys are rewritten, so
+// comments, ordering and blank lines of the files sekaid generates stay as they are. Values
+// are scanned as TOML, so multi-line arrays and strings are edited as a whole.
+package sekaiconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Document is a TOML file held as lines.
+type Document struct {
+	lines []string
+}
+
+// Parse splits a TOML file into a Document.
+func Parse(data []byte) *Document {
+	return &Document{lines: strings.Split(string(data), "\n")}
+}
+
+// Bytes returns the content of the document.
+func (d *Document) Bytes() []byte {
+	return []byte(strings.Join(d.lines, "\n"))
+}
+
+// Get returns the raw TOML value of key in section, e.g. `"tcp://0.0.0.0:26656"` including quotes.
+// Trailing comments are not part of the value, values that span lines keep their line breaks.
+// The empty section is the part before the first table header.
+func (d *Document) Get(section, key string) (string, bool) {
+	for _, e := range d.entries() {
+		if e.section == section && e.key == key {
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of key in section and keeps every other line as it is, as well as the
+// trailing comment of the key. A value that spans lines, like a multi-line array, is replaced as a whole.
+// A key that does not exist yet is appended to the end of its section.
+// Returns an error if the section does not exist or the value has an unsupported type.
+func (d *Document) Set(section, key string, value interface{}) error {
+	formatted, err := formatValue(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	found := section == ""
+	end := 0 // index after the last line of the section
+	for _, e := range d.entries() {
+		if e.section != section {
+			continue
+		}
+		found = true
+		if e.key == key {
+			line := e.prefix + formatted + e.comment
+			d.lines = append(d.lines[:e.first], append([]string{line}, d.lines[e.last+1:]...)...)
+			return nil
+		}
+		end = e.last + 1
+	}
+	if !found {
+		return fmt.Errorf("section [%s] not found", section)
+	}
+
+	d.lines = append(d.lines[:end], append([]string{key + " = " + formatted}, d.lines[end:]...)...)
+	return nil
+}
+
+// entry is a table header or a key of the document. Headers have an empty key.
+type entry struct {
+	section string
+	key     string
+	// first and last are the lines the entry spans.
+	first, last int
+	// prefix is the text of the first line before the value: indentation, key and `=`.
+	prefix string
+	// value is the raw value without comments.
+	value string
+	// comment is the trailing comment of the last line with the blanks before it.
+	comment string
+}
+
+// entries scans the document for table headers and keys. Values are scanned as TOML: strings,
+// including multi-line ones, and arrays or inline tables that span lines belong to their key,
+// so their content is never mistaken for a header or a key.
+func (d *Document) entries() []entry {
+	var entries []entry
+	section := ""
+	for i := 0; i < len(d.lines); i++ {
+		trimmed := strings.TrimSpace(d.lines[i])
+		if name, ok := tableHeader(trimmed); ok {
+			section = name
+			entries = append(entries, entry{section: section, first: i, last: i})
+			continue
+		}
+		key, col, ok := keyValue(d.lines[i])
+		if !ok {
+			continue
+		}
+		e := entry{section: section, key: key, first: i, prefix: d.lines[i][:col]}
+		var parts []string
+		e.last, parts, e.comment = scanValue(d.lines, i, col)
+		e.value = strings.TrimSpace(strings.Join(parts, "\n"))
+		entries = append(entries, e)
+		i = e.last
+	}
+	return entries
+}
+
+// scanValue reads the value that starts at column col of line first, tracking strings and
+// brackets until the value ends. Returns the last line of the value, the value text of each
+// line without comments, and the trailing comment of the last line.
+func scanValue(lines []string, first, col int) (int, []string, string) {
+	var parts []string
+	depth := 0
+	quote := "" // the delimiter of the string the scan is in
+	for i := first; i < len(lines); i++ {
+		line := lines[i]
+		start, end := 0, len(line)
+		if i == first {
+			start = col
+		}
+	scan:
+		for p := start; p < len(line); p++ {
+			if quote != "" {
+				switch {
+				case line[p] == '\\' && quote[0] == '"':
+					p++
+				case strings.HasPrefix(line[p:], quote):
+					p += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+			switch c := line[p]; {
+			case strings.HasPrefix(line[p:], `"""`), strings.HasPrefix(line[p:], "'''"):
+				quote = line[p : p+3]
+				p += 2
+			case c == '"' || c == '\'':
+				quote = string(c)
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			case c == '#':
+				end = p
+				break scan
+			}
+		}
+		parts = append(parts, line[start:end])
+		if len(quote) == 1 {
+			// Basic and literal strings end with their line.
+			quote = ""
+		}
+		if depth <= 0 && quote == "" {
+			comment := line[end:]
+			if comment != "" {
+				comment = line[len(strings.TrimRight(line[:end], " \t")):]
+			}
+			return i, parts, comment
+		}
+	}
+	// An unterminated value runs to the end of the document.
+	return len(lines) - 1, parts, ""
+}
+
+// tableHeader returns the name of a `[table]` header line. Lines of `[[array]]` tables are
+// headers too, their keys are not part of the table before them.
+func tableHeader(line string) (string, bool) {
+	if !strings.HasPrefix(line, "[") {
+		return "", false
+	}
+	if strings.HasPrefix(line, "[[") {
+		end := strings.Index(line, "]]")
+		if end < 0 {
+			return "", false
+		}
+		return line[:end+2], true
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(line[1:end]), true
+}
+
+// keyValue parses the key of a `key = value` line. Returns the key without quotes and the
+// column the value starts at.
+func keyValue(line string) (string, int, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", 0, false
+	}
+	offset := strings.Index(line, trimmed)
+	i := 0
+	if trimmed[0] == '"' || trimmed[0] == '\'' {
+		// A quoted key may contain `=`.
+		closing := strings.IndexByte(trimmed[1:], trimmed[0])
+		if closing < 0 {
+			return "", 0, false
+		}
+		i = closing + 2
+	}
+	eq := strings.Index(trimmed[i:], "=")
+	if eq < 0 || i+eq == 0 {
+		return "", 0, false
+	}
+	eq += i
+	key := strings.Trim(strings.TrimSpace(trimmed[:eq]), `"'`)
+	col := offset + eq + 1
+	for col < len(line) && (line[col] == ' ' || line[col] == '\t') {
+		col++
+	}
+	return key, col, true
+}
+
+// formatValue renders a Go value as a TOML value.
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported type %T", value)
+}
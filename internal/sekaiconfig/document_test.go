@@ -0,0 +1,180 @@
+package sekaiconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+)
+
+func readTestdata(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDocumentGet(t *testing.T) {
+	tests := []struct {
+		file    string
+		section string
+		key     string
+		value   string
+		missing bool
+	}{
+		{file: "app.toml", key: "pruning", value: `"default"`},
+		{file: "app.toml", key: "index-events", value: `[]`},
+		{file: "app.toml", section: "telemetry", key: "enabled", value: `false`},
+		{file: "app.toml", section: "telemetry", key: "global-labels", value: "[\n  [\"chain_id\", \"localnet-1\"],\n  [\"role\", \"validator\"], \n]"},
+		{file: "app.toml", section: "api", key: "enable", value: `false`},
+		{file: "app.toml", section: "grpc", key: "enable", value: `true`},
+		{file: "app.toml", section: "state-sync", key: "snapshot-keep-recent", value: `2`},
+		{file: "app.toml", section: "api", key: "enabled", missing: true},
+		{file: "app.toml", section: `"chain_id", "localnet-1"`, key: "enabled", missing: true},
+		{file: "config.toml", key: "moniker", value: `"KIRA VALIDATOR NODE"`},
+		{file: "config.toml", section: "rpc", key: "laddr", value: `"tcp://127.0.0.1:26657"`},
+		{file: "config.toml", section: "p2p", key: "laddr", value: `"tcp://0.0.0.0:26656"`},
+		{file: "config.toml", section: "rpc", key: "cors_allowed_methods", value: `["HEAD", "GET", "POST", ]`},
+		{file: "config.toml", section: "consensus", key: "timeout_commit", value: `"5s"`},
+		{file: "config.toml", key: "laddr", missing: true},
+	}
+
+	docs := map[string]*sekaiconfig.Document{}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.section+"/"+tt.key, func(t *testing.T) {
+			doc, ok := docs[tt.file]
+			if !ok {
+				doc = sekaiconfig.Parse([]byte(readTestdata(t, tt.file)))
+				docs[tt.file] = doc
+			}
+			value, ok := doc.Get(tt.section, tt.key)
+			if ok == tt.missing {
+				t.Fatalf("Get() found = %t, want %t", ok, !tt.missing)
+			}
+			if value != tt.value {
+				t.Fatalf("Get() = %q, want %q", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		section string
+		key     string
+		value   interface{}
+		// old is replaced with new in the file to get the expected result.
+		old, new string
+		err      string
+	}{
+		{
+			name: "top level string", file: "app.toml", key: "pruning", value: "nothing",
+			old: `pruning = "default"`, new: `pruning = "nothing"`,
+		},
+		{
+			name: "key after a multi-line array", file: "app.toml", section: "api", key: "enable", value: true,
+			old: "[api]\n\n# Enable defines if the API server should be enabled.\nenable = false",
+			new: "[api]\n\n# Enable defines if the API server should be enabled.\nenable = true",
+		},
+		{
+			name: "key before a multi-line array", file: "app.toml", section: "telemetry", key: "enabled", value: true,
+			old: "enabled = false", new: "enabled = true",
+		},
+		{
+			name: "multi-line array", file: "app.toml", section: "telemetry", key: "global-labels", value: []string{"chain_id"},
+			old: "global-labels = [\n  [\"chain_id\", \"localnet-1\"],\n  [\"role\", \"validator\"], # labels are [name, value]\n]",
+			new: `global-labels = ["chain_id"]`,
+		},
+		{
+			name: "new key in a section ending with a multi-line array", file: "app.toml", section: "telemetry", key: "metrics-sink", value: "mem",
+			old: "  [\"role\", \"validator\"], # labels are [name, value]\n]\n",
+			new: "  [\"role\", \"validator\"], # labels are [name, value]\n]\nmetrics-sink = \"mem\"\n",
+		},
+		{
+			name: "trailing comment", file: "config.toml", section: "consensus", key: "timeout_commit", value: "10s",
+			old: `timeout_commit = "5s" # sekai default`, new: `timeout_commit = "10s" # sekai default`,
+		},
+		{
+			name: "same key in another section", file: "config.toml", section: "p2p", key: "laddr", value: "tcp://0.0.0.0:36656",
+			old: `laddr = "tcp://0.0.0.0:26656"`, new: `laddr = "tcp://0.0.0.0:36656"`,
+		},
+		{
+			name: "new key", file: "config.toml", section: "rpc", key: "unsafe", value: false,
+			old: "max_open_connections = 900\n", new: "max_open_connections = 900\nunsafe = false\n",
+		},
+		{
+			name: "new top level key", file: "config.toml", key: "filter_peers", value: false,
+			old: "log_level = \"info\"\n", new: "log_level = \"info\"\nfilter_peers = false\n",
+		},
+		{name: "missing section", file: "config.toml", section: "mempool", key: "size", value: 5000, err: "section [mempool] not found"},
+		{name: "unsupported value", file: "config.toml", key: "moniker", value: struct{}{}, err: "unsupported type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := readTestdata(t, tt.file)
+			doc := sekaiconfig.Parse([]byte(data))
+			err := doc.Set(tt.section, tt.key, tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Set() = %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set() error: %v", err)
+			}
+			if !strings.Contains(data, tt.old) {
+				t.Fatalf("testdata %s does not contain %q", tt.file, tt.old)
+			}
+			want := strings.Replace(data, tt.old, tt.new, 1)
+			if got := string(doc.Bytes()); got != want {
+				t.Fatalf("Set() result differs:\n%s", sekaiconfig.Diff(tt.file, []byte(want), []byte(got)))
+			}
+		})
+	}
+}
+
+func TestDocumentStrings(t *testing.T) {
+	doc := sekaiconfig.Parse([]byte(`description = """
+[not-a-table]
+enabled = "not a key"
+"""
+path = 'C:\data # not a comment' # a comment
+"quoted = key" = 1
+
+[not-a-table]
+enabled = false
+`))
+	if v, ok := doc.Get("", "path"); !ok || v != `'C:\data # not a comment'` {
+		t.Fatalf("Get(path) = %q, %t", v, ok)
+	}
+	if v, ok := doc.Get("", "quoted = key"); !ok || v != "1" {
+		t.Fatalf("Get(quoted = key) = %q, %t", v, ok)
+	}
+	if err := doc.Set("", "enabled", true); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if err := doc.Set("", "path", "/data"); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	want := `description = """
+[not-a-table]
+enabled = "not a key"
+"""
+path = "/data" # a comment
+"quoted = key" = 1
+enabled = true
+
+[not-a-table]
+enabled = false
+`
+	if got := string(doc.Bytes()); got != want {
+		t.Fatalf("Set() result differs:\n%s", sekaiconfig.Diff("doc.toml", []byte(want), []byte(got)))
+	}
+}
@@ -0,0 +1,48 @@
+package sekaiconfig
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// Edit is a pending change of one config file.
+type Edit struct {
+	File File
+	Old  []byte
+	New  []byte
+}
+
+// Changed reports whether the edit changes the file.
+func (e *Edit) Changed() bool {
+	return string(e.Old) != string(e.New)
+}
+
+// Diff renders the change in unified diff format.
+func (e *Edit) Diff() string {
+	return Diff(e.File.String(), e.Old, e.New)
+}
+
+// Write stores the new content. Unchanged files are not written.
+func (e *Edit) Write(ctx context.Context) error {
+	if !e.Changed() {
+		return nil
+	}
+	return e.File.Write(ctx, e.New)
+}
+
+// Prepare reads f and applies the patches that target the file with the same base name,
+// config.toml or app.toml. Nothing is written until Edit.Write is called.
+func Prepare(ctx context.Context, f File, patches []Patch) (*Edit, error) {
+	data, err := f.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := Apply(data, path.Base(f.String()), patches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch %s: %w", f, err)
+	}
+
+	return &Edit{File: f, Old: data, New: updated}, nil
+}
@@ -0,0 +1,61 @@
+package sekaiconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+)
+
+// File is a config file the editor reads and writes, on this machine or in a node container.
+type File interface {
+	Read(ctx context.Context) ([]byte, error)
+	Write(ctx context.Context, data []byte) error
+	// String names the file in diffs and log messages.
+	String() string
+}
+
+// LocalFile is a file on this machine.
+type LocalFile struct {
+	Path string
+}
+
+func (f LocalFile) Read(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Path, err)
+	}
+	return data, nil
+}
+
+func (f LocalFile) Write(ctx context.Context, data []byte) error {
+	if err := os.WriteFile(f.Path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+func (f LocalFile) String() string {
+	return f.Path
+}
+
+// ContainerFile is a file in a container on a local or remote Docker daemon.
+// It also works on stopped containers, so a node can be reconfigured before it is started again.
+type ContainerFile struct {
+	DM        *docker.DockerManager
+	Container string
+	Path      string
+}
+
+func (f ContainerFile) Read(ctx context.Context) ([]byte, error) {
+	return f.DM.ReadFile(ctx, f.Container, f.Path)
+}
+
+func (f ContainerFile) Write(ctx context.Context, data []byte) error {
+	return f.DM.WriteFile(ctx, f.Container, f.Path, data, 0644)
+}
+
+func (f ContainerFile) String() string {
+	return f.Container + ":" + f.Path
+}
@@ -0,0 +1,187 @@
+package sekaiconfig
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFile is the Tendermint configuration in the sekaid config directory.
+	ConfigFile = "config.toml"
+	// AppFile is the application configuration in the sekaid config directory.
+	AppFile = "app.toml"
+)
+
+// Patch is a single value to set in a TOML file.
+type Patch struct {
+	File    string
+	Section string
+	Key     string
+	Value   interface{}
+}
+
+func (p Patch) String() string {
+	key := p.Key
+	if p.Section != "" {
+		key = p.Section + "." + p.Key
+	}
+	return fmt.Sprintf("%s %s = %v", p.File, key, p.Value)
+}
+
+// Overlay is the set of config.toml and app.toml values of one node role.
+// Only the fields that are set are written, everything else keeps the value sekaid generated.
+// PruningProfile names one of the PruningProfiles, pruning values in App override it.
+//
+//	sentry:
+//	  pruning_profile: everything
+//	  config:
+//	    p2p:
+//	      pex: true
+//	      addr_book_strict: false
+//	  app:
+//	    api:
+//	      enable: false
+//	seed:
+//	  pruning_profile: archive
+type Overlay struct {
+	PruningProfile string      `yaml:"pruning_profile"`
+	Config         ConfigPatch `yaml:"config"`
+	App            AppPatch    `yaml:"app"`
+}
+
+// ConfigPatch holds the config.toml values the launcher manages.
+// The toml tag of a struct field is the table it maps to.
+type ConfigPatch struct {
+	Moniker   *string   `yaml:"moniker" toml:"moniker"`
+	RPC       RPC       `yaml:"rpc" toml:"rpc"`
+	P2P       P2P       `yaml:"p2p" toml:"p2p"`
+	Consensus Consensus `yaml:"consensus" toml:"consensus"`
+}
+
+// RPC is the [rpc] table of config.toml.
+type RPC struct {
+	Laddr              *string  `yaml:"laddr" toml:"laddr"`
+	CorsAllowedOrigins []string `yaml:"cors_allowed_origins" toml:"cors_allowed_origins"`
+}
+
+// P2P is the [p2p] table of config.toml.
+type P2P struct {
+	Laddr                *string `yaml:"laddr" toml:"laddr"`
+	ExternalAddress      *string `yaml:"external_address" toml:"external_address"`
+	Seeds                *string `yaml:"seeds" toml:"seeds"`
+	PersistentPeers      *string `yaml:"persistent_peers" toml:"persistent_peers"`
+	UnconditionalPeerIDs *string `yaml:"unconditional_peer_ids" toml:"unconditional_peer_ids"`
+	PrivatePeerIDs       *string `yaml:"private_peer_ids" toml:"private_peer_ids"`
+	Pex                  *bool   `yaml:"pex" toml:"pex"`
+	SeedMode             *bool   `yaml:"seed_mode" toml:"seed_mode"`
+	AddrBookStrict       *bool   `yaml:"addr_book_strict" toml:"addr_book_strict"`
+	MaxNumInboundPeers   *int64  `yaml:"max_num_inbound_peers" toml:"max_num_inbound_peers"`
+	MaxNumOutboundPeers  *int64  `yaml:"max_num_outbound_peers" toml:"max_num_outbound_peers"`
+}
+
+// Consensus is the [consensus] table of config.toml. Timeouts are durations like `5s`.
+type Consensus struct {
+	TimeoutPropose    *string `yaml:"timeout_propose" toml:"timeout_propose"`
+	TimeoutPrevote    *string `yaml:"timeout_prevote" toml:"timeout_prevote"`
+	TimeoutPrecommit  *string `yaml:"timeout_precommit" toml:"timeout_precommit"`
+	TimeoutCommit     *string `yaml:"timeout_commit" toml:"timeout_commit"`
+	CreateEmptyBlocks *bool   `yaml:"create_empty_blocks" toml:"create_empty_blocks"`
+}
+
+// AppPatch holds the app.toml values the launcher manages.
+type AppPatch struct {
+	MinimumGasPrices  *string  `yaml:"minimum-gas-prices" toml:"minimum-gas-prices"`
+	Pruning           *string  `yaml:"pruning" toml:"pruning"`
+	PruningKeepRecent *string  `yaml:"pruning-keep-recent" toml:"pruning-keep-recent"`
+	PruningKeepEvery  *string  `yaml:"pruning-keep-every" toml:"pruning-keep-every"`
+	PruningInterval   *string  `yaml:"pruning-interval" toml:"pruning-interval"`
+	HaltHeight        *int64   `yaml:"halt-height" toml:"halt-height"`
+	HaltTime          *int64   `yaml:"halt-time" toml:"halt-time"`
+	API               Endpoint `yaml:"api" toml:"api"`
+	GRPC              Endpoint `yaml:"grpc" toml:"grpc"`
+}
+
+// Endpoint is the [api] or [grpc] table of app.toml.
+type Endpoint struct {
+	Enable  *bool   `yaml:"enable" toml:"enable"`
+	Address *string `yaml:"address" toml:"address"`
+}
+
+// Patches returns the values set in the overlay, config.toml first.
+func (o Overlay) Patches() []Patch {
+	var patches []Patch
+	collect(ConfigFile, "", reflect.ValueOf(o.Config), &patches)
+	if profile, ok := PruningProfiles[o.PruningProfile]; ok {
+		patches = append(patches, profile.Patches()...)
+	}
+	collect(AppFile, "", reflect.ValueOf(o.App), &patches)
+	return patches
+}
+
+// collect walks a patch struct and appends a Patch for every field that is set.
+// Nested structs are TOML tables named by their toml tag.
+func collect(file, section string, v reflect.Value, patches *[]Patch) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		key := field.Tag.Get("toml")
+		switch value.Kind() {
+		case reflect.Struct:
+			collect(file, key, value, patches)
+		case reflect.Ptr:
+			if !value.IsNil() {
+				*patches = append(*patches, Patch{File: file, Section: section, Key: key, Value: value.Elem().Interface()})
+			}
+		case reflect.Slice:
+			if !value.IsNil() {
+				*patches = append(*patches, Patch{File: file, Section: section, Key: key, Value: value.Interface()})
+			}
+		}
+	}
+}
+
+// LoadOverlays decodes a YAML file mapping node roles to their Overlay.
+func LoadOverlays(r io.Reader) (map[string]Overlay, error) {
+	overlays := map[string]Overlay{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&overlays); err != nil {
+		return nil, fmt.Errorf("failed to decode config overlays: %w", err)
+	}
+	for role, overlay := range overlays {
+		if _, ok := PruningProfiles[overlay.PruningProfile]; overlay.PruningProfile != "" && !ok {
+			return nil, fmt.Errorf("role %s has unknown pruning profile %s, available profiles: %v", role, overlay.PruningProfile, PruningProfileNames())
+		}
+	}
+
+	return overlays, nil
+}
+
+// Roles returns the role names of the overlays, sorted.
+func Roles(overlays map[string]Overlay) []string {
+	roles := make([]string, 0, len(overlays))
+	for role := range overlays {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Apply sets the patches of file on data.
+func Apply(data []byte, file string, patches []Patch) ([]byte, error) {
+	doc := Parse(data)
+	for _, p := range patches {
+		if p.File != file {
+			continue
+		}
+		if err := doc.Set(p.Section, p.Key, p.Value); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", strings.TrimPrefix(p.Section+"."+p.Key, "."), err)
+		}
+	}
+	return doc.Bytes(), nil
+}
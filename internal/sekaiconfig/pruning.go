@@ -0,0 +1,185 @@
+package sekaiconfig
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/mrlutik/kira2.0/internal/docker"
+)
+
+// Pruning strategies understood by `sekaid start --pruning`.
+const (
+	PruningDefault    = "default"
+	PruningNothing    = "nothing"
+	PruningEverything = "everything"
+	PruningCustom     = "custom"
+)
+
+// minFreeDisk is the share of the disk that has to stay free after a pruning change.
+const minFreeDisk = 0.1
+
+// Pruning is the pruning configuration of app.toml.
+type Pruning struct {
+	Strategy   string
+	KeepRecent uint64
+	KeepEvery  uint64
+	Interval   uint64
+}
+
+// PruningProfiles are the profiles a role can name with `pruning_profile`. archive keeps every
+// height, the others match the sekaid strategies of the same name.
+var PruningProfiles = map[string]Pruning{
+	"archive":         {Strategy: PruningNothing, KeepEvery: 1},
+	PruningNothing:    {Strategy: PruningNothing, KeepEvery: 1},
+	PruningDefault:    {Strategy: PruningDefault, KeepRecent: 362880, Interval: 10},
+	PruningEverything: {Strategy: PruningEverything, KeepRecent: 2, Interval: 10},
+}
+
+// PruningProfileNames returns the names of the PruningProfiles, sorted.
+func PruningProfileNames() []string {
+	names := make([]string, 0, len(PruningProfiles))
+	for name := range PruningProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate applies the rules sekaid checks at start, so a bad value fails before the node restarts.
+func (p Pruning) Validate() error {
+	switch p.Strategy {
+	case PruningDefault, PruningNothing, PruningEverything:
+		return nil
+	case PruningCustom:
+		if p.KeepEvery == 0 && p.Interval == 0 {
+			return fmt.Errorf("custom pruning that deletes heights needs a pruning-interval above 0")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown pruning strategy %q", p.Strategy)
+	}
+}
+
+// RetainsAll reports whether no height is ever pruned.
+func (p Pruning) RetainsAll() bool {
+	return p.Strategy == PruningNothing || (p.Strategy == PruningCustom && p.KeepEvery == 1)
+}
+
+func (p Pruning) String() string {
+	if p.Strategy != PruningCustom {
+		return p.Strategy
+	}
+	return fmt.Sprintf("custom (keep-recent %d, keep-every %d, interval %d)", p.KeepRecent, p.KeepEvery, p.Interval)
+}
+
+// Patches returns the app.toml values of p. sekaid ignores the keep and interval values of the
+// named strategies, they are written anyway so app.toml shows what the strategy does.
+func (p Pruning) Patches() []Patch {
+	return []Patch{
+		{File: AppFile, Key: "pruning", Value: p.Strategy},
+		{File: AppFile, Key: "pruning-keep-recent", Value: strconv.FormatUint(p.KeepRecent, 10)},
+		{File: AppFile, Key: "pruning-keep-every", Value: strconv.FormatUint(p.KeepEvery, 10)},
+		{File: AppFile, Key: "pruning-interval", Value: strconv.FormatUint(p.Interval, 10)},
+	}
+}
+
+// ReadPruning returns the pruning configuration of an app.toml. Missing values are zero, the
+// numbers may be written as strings, like sekaid does, or as integers.
+func ReadPruning(app []byte) (Pruning, error) {
+	doc := Parse(app)
+	var p Pruning
+	if v, ok := doc.Get("", "pruning"); ok {
+		p.Strategy = unquote(v)
+	}
+	for key, dst := range map[string]*uint64{
+		"pruning-keep-recent": &p.KeepRecent,
+		"pruning-keep-every":  &p.KeepEvery,
+		"pruning-interval":    &p.Interval,
+	} {
+		v, ok := doc.Get("", key)
+		if !ok || unquote(v) == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(unquote(v), 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s %s: %w", key, v, err)
+		}
+		*dst = n
+	}
+
+	return p, nil
+}
+
+// unquote returns the content of a TOML string value: escapes of basic strings are resolved,
+// literal strings are taken as they are. Bare values are returned unchanged.
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 {
+		return v
+	}
+	switch {
+	case v[0] == '\'' && v[len(v)-1] == '\'':
+		return v[1 : len(v)-1]
+	case v[0] == '"' && v[len(v)-1] == '"':
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// retention is the number of recent heights a configuration keeps, 0 for all of them.
+func (p Pruning) retention() uint64 {
+	switch {
+	case p.RetainsAll():
+		return 0
+	case p.Strategy == PruningDefault:
+		return PruningProfiles[PruningDefault].KeepRecent
+	case p.Strategy == PruningEverything:
+		return PruningProfiles[PruningEverything].KeepRecent
+	default:
+		return p.KeepRecent
+	}
+}
+
+// ResyncWarnings explains what changing the pruning from one configuration to another does to
+// the existing data.
+// Pruning only applies to heights committed after the change: history that is gone stays gone,
+// and history kept so far is not pruned retroactively.
+func ResyncWarnings(from, to Pruning) []string {
+	before, after := from.retention(), to.retention()
+	if from.Strategy == "" || before == after {
+		return nil
+	}
+
+	if after == 0 || (before != 0 && after > before) {
+		return []string{fmt.Sprintf("pruning changes from %s to %s: heights pruned so far cannot be restored, resync the node to serve the full history", from, to)}
+	}
+	return []string{fmt.Sprintf("pruning changes from %s to %s: heights kept so far are not pruned retroactively, resync the node to reclaim the disk space", from, to)}
+}
+
+// CheckDisk validates a pruning configuration against the disk the node data lives on.
+// dataBytes is the current size of the data directory. An archive node needs room to grow
+// its history, a pruned node keeps roughly a constant size. Problems mean the configuration
+// does not fit, warnings mean it fits for now.
+func CheckDisk(p Pruning, disk docker.DiskSpace, dataBytes int64) (problems, warnings []string) {
+	if disk.TotalBytes == 0 {
+		return nil, []string{"disk capacity unknown, pruning not checked against it"}
+	}
+
+	free := float64(disk.FreeBytes) / float64(disk.TotalBytes)
+	if free < minFreeDisk {
+		problems = append(problems, fmt.Sprintf("only %s of %s disk free (%.0f%%), at least %.0f%% is needed",
+			units.BytesSize(float64(disk.FreeBytes)), units.BytesSize(float64(disk.TotalBytes)), 100*free, 100*minFreeDisk))
+	}
+	if p.RetainsAll() && disk.FreeBytes < dataBytes {
+		warnings = append(warnings, fmt.Sprintf("%s keeps every height but only %s is free for %s of data: the disk fills up before the chain is twice its current age",
+			p, units.BytesSize(float64(disk.FreeBytes)), units.BytesSize(float64(dataBytes))))
+	}
+
+	return problems, warnings
+}
@@ -0,0 +1,184 @@
+package sekaiconfig_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+)
+
+func TestReadPruning(t *testing.T) {
+	tests := []struct {
+		name string
+		app  string
+		want sekaiconfig.Pruning
+		err  string
+	}{
+		{name: "generated app.toml", app: readTestdata(t, "app.toml"), want: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningDefault}},
+		{
+			name: "trailing comments",
+			app:  "pruning = \"custom\" # tuned for sentries\npruning-keep-recent = \"100\" # about ten minutes\npruning-keep-every = \"0\"\npruning-interval = \"10\"\n",
+			want: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepRecent: 100, Interval: 10},
+		},
+		{
+			name: "literal strings and integers",
+			app:  "pruning = 'custom'\npruning-keep-recent = 100\npruning-interval = 10 # blocks\n",
+			want: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepRecent: 100, Interval: 10},
+		},
+		{name: "missing", app: "[api]\nenable = true\n"},
+		{name: "invalid number", app: "pruning = \"custom\"\npruning-interval = \"ten\"\n", err: "invalid pruning-interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := sekaiconfig.ReadPruning([]byte(tt.app))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ReadPruning() = %+v, %v, want error containing %q", p, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadPruning() error: %v", err)
+			}
+			if p != tt.want {
+				t.Fatalf("ReadPruning() = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruningProfiles(t *testing.T) {
+	if names := strings.Join(sekaiconfig.PruningProfileNames(), " "); names != "archive default everything nothing" {
+		t.Fatalf("PruningProfileNames() = %s", names)
+	}
+	for name, profile := range sekaiconfig.PruningProfiles {
+		if err := profile.Validate(); err != nil {
+			t.Fatalf("profile %s is invalid: %v", name, err)
+		}
+	}
+
+	overlays, err := sekaiconfig.LoadOverlays(strings.NewReader(`
+seed:
+  pruning_profile: archive
+sentry:
+  pruning_profile: everything
+  app:
+    pruning-keep-recent: "100"
+`))
+	if err != nil {
+		t.Fatalf("LoadOverlays() error: %v", err)
+	}
+	for role, want := range map[string]sekaiconfig.Pruning{
+		"seed":   {Strategy: sekaiconfig.PruningNothing, KeepEvery: 1},
+		"sentry": {Strategy: sekaiconfig.PruningEverything, KeepRecent: 100, Interval: 10},
+	} {
+		app, err := sekaiconfig.Apply([]byte(readTestdata(t, "app.toml")), sekaiconfig.AppFile, overlays[role].Patches())
+		if err != nil {
+			t.Fatalf("Apply() of %s error: %v", role, err)
+		}
+		if got, _ := sekaiconfig.ReadPruning(app); got != want {
+			t.Fatalf("pruning of %s = %+v, want %+v", role, got, want)
+		}
+	}
+
+	if _, err := sekaiconfig.LoadOverlays(strings.NewReader("seed:\n  pruning_profile: forever\n")); err == nil || !strings.Contains(err.Error(), "unknown pruning profile forever") {
+		t.Fatalf("LoadOverlays() with an unknown profile = %v", err)
+	}
+}
+
+func TestPruningValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pruning sekaiconfig.Pruning
+		err     string
+	}{
+		{name: "custom keeping every height", pruning: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepEvery: 1}},
+		{name: "custom with interval", pruning: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepRecent: 100, Interval: 10}},
+		{name: "custom without interval", pruning: sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepRecent: 100}, err: "needs a pruning-interval"},
+		{name: "unknown", pruning: sekaiconfig.Pruning{Strategy: "sometimes"}, err: `unknown pruning strategy "sometimes"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pruning.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResyncWarnings(t *testing.T) {
+	archive := sekaiconfig.PruningProfiles["archive"]
+	everything := sekaiconfig.PruningProfiles[sekaiconfig.PruningEverything]
+	def := sekaiconfig.PruningProfiles[sekaiconfig.PruningDefault]
+	custom := sekaiconfig.Pruning{Strategy: sekaiconfig.PruningCustom, KeepRecent: 362880, Interval: 100}
+
+	tests := []struct {
+		name     string
+		from, to sekaiconfig.Pruning
+		warning  string
+	}{
+		{name: "unset before", to: archive},
+		{name: "same retention", from: def, to: custom},
+		{name: "pruned to archive", from: everything, to: archive, warning: "heights pruned so far cannot be restored"},
+		{name: "keeping more", from: everything, to: def, warning: "heights pruned so far cannot be restored"},
+		{name: "archive to pruned", from: archive, to: everything, warning: "not pruned retroactively"},
+		{name: "keeping less", from: def, to: everything, warning: "not pruned retroactively"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := sekaiconfig.ResyncWarnings(tt.from, tt.to)
+			if tt.warning == "" {
+				if len(warnings) != 0 {
+					t.Fatalf("ResyncWarnings() = %q, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.warning) {
+				t.Fatalf("ResyncWarnings() = %q, want one containing %q", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestCheckDisk(t *testing.T) {
+	archive := sekaiconfig.PruningProfiles["archive"]
+	everything := sekaiconfig.PruningProfiles[sekaiconfig.PruningEverything]
+
+	tests := []struct {
+		name      string
+		pruning   sekaiconfig.Pruning
+		disk      docker.DiskSpace
+		dataBytes int64
+		problem   string
+		warning   string
+	}{
+		{name: "archive with room", pruning: archive, disk: docker.DiskSpace{TotalBytes: 1000, FreeBytes: 600}, dataBytes: 300},
+		{name: "archive outgrowing the disk", pruning: archive, disk: docker.DiskSpace{TotalBytes: 1000, FreeBytes: 200}, dataBytes: 700, warning: "keeps every height"},
+		{name: "pruned on a small disk", pruning: everything, disk: docker.DiskSpace{TotalBytes: 1000, FreeBytes: 200}, dataBytes: 700},
+		{name: "full disk", pruning: everything, disk: docker.DiskSpace{TotalBytes: 1000, FreeBytes: 50}, dataBytes: 900, problem: "at least 10% is needed"},
+		{name: "unknown capacity", pruning: archive, warning: "disk capacity unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, warnings := sekaiconfig.CheckDisk(tt.pruning, tt.disk, tt.dataBytes)
+			if (tt.problem == "") != (len(problems) == 0) || (len(problems) > 0 && !strings.Contains(problems[0], tt.problem)) {
+				t.Fatalf("problems = %q, want %q", problems, tt.problem)
+			}
+			if (tt.warning == "") != (len(warnings) == 0) || (len(warnings) > 0 && !strings.Contains(warnings[0], tt.warning)) {
+				t.Fatalf("warnings = %q, want %q", warnings, tt.warning)
+			}
+		})
+	}
+}
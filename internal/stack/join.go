@@ -0,0 +1,250 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/audit"
+	"github.com/mrlutik/kira2.0/internal/custody"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// JoinConfig describes how a node joins an existing network.
+type JoinConfig struct {
+	// Target is the RPC address (`http://10.0.0.1:26657`) or a seed (`<node-id>@10.0.0.1:26656`)
+	// of a node of the network. For seeds the RPC is expected on the default port of the same host.
+	Target string
+	// GenesisSHA256 is the expected hash of Genesis, as networks publish it.
+	GenesisSHA256 string
+	// Genesis is the genesis file of the network, required. The genesis served by Target is
+	// re-serialised by the RPC and cannot be checked against a published hash, so the file is
+	// verified against GenesisSHA256, compared with the served genesis and written to the node as is.
+	Genesis []byte
+	// MaxPeers limits how many peers of Target become persistent peers.
+	MaxPeers int
+	// Readiness are the gates the node has to pass before Join returns.
+	Readiness node.Readiness
+	// Keys are pushed into the node home before the node starts. The node keeps the keys
+	// `sekaid init` generated when nil.
+	Keys *custody.Bundle
+	// Signing guards the validator key of Keys, its Store is required with Keys. The target
+	// is set by Join.
+	Signing custody.Signing
+	// Trail records the pushed keys, required with Keys.
+	Trail *audit.Trail
+}
+
+// joinPlan is what Join learned about the network before touching the node.
+type joinPlan struct {
+	chainID         string
+	genesis         []byte
+	seeds           []string
+	persistentPeers []string
+}
+
+// Join starts the sekai node of the stack as a full node of an existing network.
+// It fetches the genesis and the peer list from the network's RPC, verifies the genesis hash,
+// initialises the node home with them and blocks until the node passes the readiness gates.
+// When cfg has an InterxImage, interx is started against the synced node afterwards.
+// Like Up, it refuses node containers of another image.
+func Join(ctx context.Context, dm *docker.DockerManager, cfg Config, join JoinConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if join.GenesisSHA256 == "" || join.Genesis == nil {
+		return fmt.Errorf("the genesis file of the network and its expected hash are required to join it")
+	}
+	if join.Keys != nil && (join.Trail == nil || join.Signing.Store == nil) {
+		return fmt.Errorf("an audit trail and the key store are required to push keys")
+	}
+
+	plan, err := discover(ctx, join)
+	if err != nil {
+		return err
+	}
+	cfg.ChainID = plan.chainID
+
+	specs, err := orderByDependencies(cfg.Specs())
+	if err != nil {
+		return err
+	}
+	if err := checkImages(ctx, dm, specs); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		log.Infof("Pulling image %s...", spec.Image)
+		if err := dm.PullImage(ctx, spec.Image); err != nil {
+			return err
+		}
+	}
+	if _, err := dm.EnsureNetwork(ctx, cfg.network(), cfg.labels()); err != nil {
+		return err
+	}
+	volumes := []string{cfg.sekaiVolume()}
+	if cfg.InterxImage != "" {
+		volumes = append(volumes, cfg.interxVolume())
+	}
+	for _, volume := range volumes {
+		if err := dm.EnsureVolume(ctx, volume, cfg.labels()); err != nil {
+			return err
+		}
+	}
+
+	if err := initJoin(ctx, dm, cfg, join, plan); err != nil {
+		return fmt.Errorf("failed to initialise node: %w", err)
+	}
+
+	for _, spec := range specs {
+		if err := startNode(ctx, dm, spec, cfg.HealthTimeout); err != nil {
+			return err
+		}
+		if err := waitNode(ctx, dm, cfg, spec, join.Readiness); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discover queries the RPC of the join target for the chain-id, genesis and peers.
+func discover(ctx context.Context, join JoinConfig) (*joinPlan, error) {
+	plan := &joinPlan{}
+	rpcAddr := join.Target
+	if id, hostPort, ok := strings.Cut(join.Target, "@"); ok {
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed %s: %w", join.Target, err)
+		}
+		plan.seeds = append(plan.seeds, id+"@"+hostPort)
+		rpcAddr = net.JoinHostPort(host, tendermint.DefaultRPCPort)
+	}
+	rpc := tendermint.NewClient(rpcAddr)
+
+	log.Infof("Querying %s...", rpc.URL)
+	status, err := rpc.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan.chainID = status.NodeInfo.Network
+
+	served, err := rpc.Genesis(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := genesis.Hash(join.Genesis)
+	if !strings.EqualFold(hash, join.GenesisSHA256) {
+		return nil, fmt.Errorf("genesis file has sha256 %s, expected %s", hash, join.GenesisSHA256)
+	}
+	same, err := genesis.Equal(join.Genesis, served)
+	if err != nil {
+		return nil, err
+	}
+	if !same {
+		return nil, fmt.Errorf("genesis file is not the genesis served by %s", rpc.URL)
+	}
+	plan.genesis = join.Genesis
+	report, err := genesis.Inspect(plan.genesis)
+	if err != nil {
+		return nil, err
+	}
+	if !report.Valid {
+		return nil, fmt.Errorf("genesis of %s is not valid: %s", plan.chainID, strings.Join(report.Problems, "; "))
+	}
+	if report.ChainID != plan.chainID {
+		return nil, fmt.Errorf("genesis is for chain %s but the node is on %s", report.ChainID, plan.chainID)
+	}
+	log.Infof("Genesis of %s verified, sha256 %s", plan.chainID, hash)
+
+	netInfo, err := rpc.NetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	self := status.NodeInfo.ID + "@" + net.JoinHostPort(rpc.Host(), status.NodeInfo.P2PPort())
+	plan.persistentPeers = append(plan.persistentPeers, self)
+	for _, peer := range netInfo.Peers {
+		if join.MaxPeers > 0 && len(plan.persistentPeers) >= join.MaxPeers {
+			break
+		}
+		if peer.NodeInfo.Network != plan.chainID {
+			continue
+		}
+		plan.persistentPeers = append(plan.persistentPeers, peer.Address())
+	}
+	log.Infof("Found %d peers of %s", len(plan.persistentPeers), plan.chainID)
+
+	return plan, nil
+}
+
+// initJoin creates the sekai home in the sekai volume with the network's genesis and peers,
+// and pushes the keys of join. A volume that already holds the same genesis only gets its
+// peers updated, keys in it are only accepted when they are the pushed ones.
+func initJoin(ctx context.Context, dm *docker.DockerManager, cfg Config, join JoinConfig, plan *joinPlan) error {
+	toolbox := cfg.Name + "-sekai-init"
+	volumes := []docker.VolumeMount{{Name: cfg.sekaiVolume(), Target: sekaiHome}}
+	if err := dm.StartToolbox(ctx, toolbox, cfg.SekaiImage, volumes); err != nil {
+		return err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	cli := sekai.NewCLI(dm, toolbox, sekaiHome)
+	exists, err := cli.FileExists(ctx, cli.GenesisPath())
+	if err != nil {
+		return err
+	}
+	if exists {
+		existing, err := dm.ReadFile(ctx, toolbox, cli.GenesisPath())
+		if err != nil {
+			return err
+		}
+		same, err := genesis.Equal(existing, plan.genesis)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("volume %s already holds a different genesis, remove it with `down --wipe` first", cfg.sekaiVolume())
+		}
+		log.Infof("Node is already initialised for %s in volume %s", plan.chainID, cfg.sekaiVolume())
+	} else {
+		if _, err := cli.Run(ctx, "init", cfg.Moniker, "--chain-id="+plan.chainID, "--overwrite"); err != nil {
+			return err
+		}
+		if err := dm.WriteFile(ctx, toolbox, cli.GenesisPath(), plan.genesis, 0644); err != nil {
+			return err
+		}
+	}
+
+	if join.Keys != nil {
+		container := cfg.SekaiContainer()
+		signing := join.Signing
+		signing.Target = custody.Holder{Container: container, Daemon: dm.DaemonHostname()}
+		if err := signing.Deploy(ctx, cli, join.Keys, !exists, join.Trail.Operation("deploy join", container)); err != nil {
+			return err
+		}
+	}
+
+	path := cli.ConfigPath(sekaiconfig.ConfigFile)
+	data, err := dm.ReadFile(ctx, toolbox, path)
+	if err != nil {
+		return err
+	}
+	doc := sekaiconfig.Parse(data)
+	if err := doc.Set("p2p", "persistent_peers", strings.Join(plan.persistentPeers, ",")); err != nil {
+		return err
+	}
+	if err := doc.Set("p2p", "seeds", strings.Join(plan.seeds, ",")); err != nil {
+		return err
+	}
+
+	return dm.WriteFile(ctx, toolbox, path, doc.Bytes(), 0644)
+}
@@ -0,0 +1,83 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+const joinGenesis = `{
+  "chain_id": "testnet-1",
+  "genesis_time": "2023-06-01T00:00:00Z",
+  "app_state": {
+    "auth": {"accounts": []},
+    "bank": {"balances": []},
+    "customstaking": {"validators": [{"val_key": "kiravaloper1a", "pub_key": {"key": "cons-a"}}]}
+  }
+}
+`
+
+func TestDiscover(t *testing.T) {
+	status := tendermint.Status{NodeInfo: tendermint.NodeInfo{ID: "self", Network: "testnet-1", ListenAddr: "tcp://0.0.0.0:26656"}}
+	peers := []tendermint.Peer{
+		{NodeInfo: tendermint.NodeInfo{ID: "peer", Network: "testnet-1"}, RemoteIP: "10.0.0.2"},
+		{NodeInfo: tendermint.NodeInfo{ID: "stranger", Network: "othernet-1"}, RemoteIP: "10.0.0.3"},
+	}
+	// The RPC serves the genesis re-serialised, so its bytes differ from the published file.
+	served, err := genesis.Canonical([]byte(joinGenesis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpc := tmfake.NewServer(tmfake.Node{Status: status, Peers: peers, Genesis: json.RawMessage(served)})
+	defer rpc.Close()
+
+	tests := []struct {
+		name    string
+		genesis string
+		hash    string
+		err     string
+	}{
+		{name: "published file", genesis: joinGenesis, hash: genesis.Hash([]byte(joinGenesis))},
+		{name: "hash in upper case", genesis: joinGenesis, hash: strings.ToUpper(genesis.Hash([]byte(joinGenesis)))},
+		{name: "hash of the served genesis", genesis: joinGenesis, hash: genesis.Hash(served), err: "genesis file has sha256"},
+		{
+			name:    "file of another network",
+			genesis: strings.Replace(joinGenesis, "testnet-1", "othernet-1", 1),
+			hash:    genesis.Hash([]byte(strings.Replace(joinGenesis, "testnet-1", "othernet-1", 1))),
+			err:     "is not the genesis served by",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := discover(context.Background(), JoinConfig{Target: rpc.URL(), Genesis: []byte(tt.genesis), GenesisSHA256: tt.hash})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("discover() = %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discover() error: %v", err)
+			}
+			if string(plan.genesis) != tt.genesis {
+				t.Fatal("discover() did not keep the genesis file as is")
+			}
+			if plan.chainID != "testnet-1" || len(plan.persistentPeers) != 2 || plan.persistentPeers[1] != "peer@10.0.0.2:26656" {
+				t.Fatalf("discover() = %+v, want testnet-1 with the target and its peer on the same network", plan)
+			}
+		})
+	}
+}
+
+func TestJoinRequiresGenesis(t *testing.T) {
+	err := Join(context.Background(), nil, DefaultConfig(), JoinConfig{Target: "http://127.0.0.1:1", GenesisSHA256: "abc"})
+	if err == nil || !strings.Contains(err.Error(), "genesis file of the network") {
+		t.Fatalf("Join() without a genesis file = %v", err)
+	}
+}
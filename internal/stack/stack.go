@@ -0,0 +1,411 @@
+// Package stack runs a complete local KIRA network, a sekai validator and interx,
+// on a single Docker daemon.
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/interx"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	"github.com/mrlutik/kira2.0/internal/types"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+const (
+	sekaiNode  = "sekai"
+	sekaiHome  = sekai.DefaultHome
+	interxNode = "interx"
+	// sekaiGRPCPort is the port sekaid serves gRPC on inside its container.
+	sekaiGRPCPort = 9090
+	// stopTimeout is how long a node gets to shut down before it is killed.
+	stopTimeout = 30 * time.Second
+)
+
+// Config describes a local stack.
+type Config struct {
+	// Name prefixes the containers, network and volumes of the stack and is the value of
+	// docker.StackLabel.
+	Name    string
+	ChainID string
+	Moniker string
+	// SekaiImage is the sekai image. InterxImage is the interx image, no interx is run when empty.
+	SekaiImage  string
+	InterxImage string
+	// P2PPort, RPCPort, GRPCPort and InterxPort are the host ports the nodes publish, they have
+	// to differ between stacks on the same daemon.
+	P2PPort       int
+	RPCPort       int
+	GRPCPort      int
+	InterxPort    int
+	HealthTimeout time.Duration
+	// Readiness are the gates the sekai node has to pass before its dependents are started.
+	Readiness node.Readiness
+}
+
+// DefaultConfig returns the configuration `kira2_launcher up` uses without flags.
+func DefaultConfig() Config {
+	return Config{
+		Name:          types.DefaultStackName,
+		ChainID:       "localnet-1",
+		Moniker:       "LOCAL VALIDATOR",
+		SekaiImage:    types.SekaiImage + ":" + types.DefaultSekaiVersion,
+		InterxImage:   types.InterxImage + ":" + types.DefaultInterxVersion,
+		P2PPort:       26656,
+		RPCPort:       26657,
+		GRPCPort:      sekaiGRPCPort,
+		InterxPort:    11000,
+		HealthTimeout: 5 * time.Minute,
+		Readiness:     localReadiness(),
+	}
+}
+
+// localReadiness are the gates of a single validator network, which has no peers.
+func localReadiness() node.Readiness {
+	r := node.DefaultReadiness()
+	r.MinPeers = 0
+	return r
+}
+
+// Validate checks the name and the host ports of the stack.
+func (c Config) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("stack has no name")
+	}
+	type hostPort struct {
+		name string
+		port int
+	}
+	published := []hostPort{{"p2p", c.P2PPort}, {"rpc", c.RPCPort}, {"grpc", c.GRPCPort}}
+	if c.InterxImage != "" {
+		published = append(published, hostPort{"interx", c.InterxPort})
+	}
+	ports := map[int]string{}
+	for _, p := range published {
+		if p.port < 1 || p.port > 65535 {
+			return fmt.Errorf("%s port %d is outside 1-65535", p.name, p.port)
+		}
+		if other, ok := ports[p.port]; ok {
+			return fmt.Errorf("%s and %s port are both %d", other, p.name, p.port)
+		}
+		ports[p.port] = p.name
+	}
+	return nil
+}
+
+// SekaiContainer returns the name of the sekai container of the stack.
+func (c Config) SekaiContainer() string {
+	return c.Name + "-" + sekaiNode
+}
+
+// InterxContainer returns the name of the interx container of the stack.
+func (c Config) InterxContainer() string {
+	return c.Name + "-" + interxNode
+}
+
+func (c Config) labels() map[string]string {
+	return map[string]string{docker.StackLabel: c.Name}
+}
+
+func (c Config) network() string {
+	return c.Name
+}
+
+// volumes returns the named volumes of the stack.
+func (c Config) volumes() []string {
+	return []string{c.sekaiVolume(), c.interxVolume()}
+}
+
+func (c Config) sekaiVolume() string {
+	return c.Name + "-sekai"
+}
+
+func (c Config) interxVolume() string {
+	return c.Name + "-interx"
+}
+
+// genesisSpec is the single validator genesis of the stack.
+func (c Config) genesisSpec() *genesis.Spec {
+	return &genesis.Spec{
+		ChainID:    c.ChainID,
+		Accounts:   []genesis.Account{{Name: "validator", Coins: "300000000000000ukex"}},
+		Validators: []genesis.Validator{{Key: "validator", Moniker: c.Moniker}},
+	}
+}
+
+// interxConfig points interx at the gRPC and RPC of the sekai container on the stack network.
+func (c Config) interxConfig() interx.Config {
+	return interx.NewConfig(c.SekaiContainer())
+}
+
+// Specs returns the long running node containers of the stack. Interx is left out when
+// InterxImage is empty.
+func (c Config) Specs() []docker.NodeSpec {
+	sekai := docker.NodeSpec{
+		Name:       c.SekaiContainer(),
+		Image:      c.SekaiImage,
+		Entrypoint: []string{"sekaid"},
+		Cmd:        []string{"start", "--home=" + sekaiHome, "--rpc.laddr=tcp://0.0.0.0:26657"},
+		Network:    c.network(),
+		Ports: []string{
+			fmt.Sprintf("%d:26656", c.P2PPort),
+			fmt.Sprintf("%d:%s", c.RPCPort, tendermint.DefaultRPCPort),
+			fmt.Sprintf("%d:%d", c.GRPCPort, sekaiGRPCPort),
+		},
+		Volumes: []docker.VolumeMount{{Name: c.sekaiVolume(), Target: sekaiHome}},
+		Labels:  c.labels(),
+		Healthcheck: &docker.Healthcheck{
+			Test:        "sekaid status --node=tcp://localhost:26657 > /dev/null",
+			Interval:    5 * time.Second,
+			Timeout:     5 * time.Second,
+			StartPeriod: 10 * time.Second,
+			Retries:     10,
+		},
+		Logging: docker.LogConfig{Driver: "json-file", MaxSize: "100m", MaxFile: 5},
+	}
+
+	if c.InterxImage == "" {
+		return []docker.NodeSpec{sekai}
+	}
+
+	ix := c.interxConfig()
+	gateway := ix.Spec(c.InterxContainer(), c.InterxImage)
+	gateway.Ports = []string{fmt.Sprintf("%d:%s", c.InterxPort, ix.Port)}
+	gateway.Network = c.network()
+	gateway.Volumes = []docker.VolumeMount{{Name: c.interxVolume(), Target: ix.Home}}
+	gateway.Labels = c.labels()
+	gateway.DependsOn = []string{sekai.Name}
+
+	return []docker.NodeSpec{sekai, gateway}
+}
+
+// Up pulls the images, creates the network and volumes, initialises the chain and starts
+// the nodes in dependency order, waiting for each one to become healthy before its dependents.
+// Running nodes are left untouched, so Up can be run again to repair a partially started stack.
+// A node container of another image is refused, changing the version of a stack is an upgrade.
+func Up(ctx context.Context, dm *docker.DockerManager, cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	specs, err := orderByDependencies(cfg.Specs())
+	if err != nil {
+		return err
+	}
+	if err := checkImages(ctx, dm, specs); err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		log.Infof("Pulling image %s...", spec.Image)
+		if err := dm.PullImage(ctx, spec.Image); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dm.EnsureNetwork(ctx, cfg.network(), cfg.labels()); err != nil {
+		return err
+	}
+	for _, volume := range cfg.volumes() {
+		if err := dm.EnsureVolume(ctx, volume, cfg.labels()); err != nil {
+			return err
+		}
+	}
+
+	if err := initChain(ctx, dm, cfg); err != nil {
+		return fmt.Errorf("failed to initialise chain: %w", err)
+	}
+
+	for _, spec := range specs {
+		if err := startNode(ctx, dm, spec, cfg.HealthTimeout); err != nil {
+			return err
+		}
+		if err := waitNode(ctx, dm, cfg, spec, cfg.Readiness); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Stack %s is up", cfg.Name)
+	return nil
+}
+
+// initChain creates the sekai home and genesis in the sekai volume unless it already has one.
+func initChain(ctx context.Context, dm *docker.DockerManager, cfg Config) error {
+	toolbox := cfg.Name + "-sekai-init"
+	volumes := []docker.VolumeMount{{Name: cfg.sekaiVolume(), Target: sekaiHome}}
+	if err := dm.StartToolbox(ctx, toolbox, cfg.SekaiImage, volumes); err != nil {
+		return err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	cli := sekai.NewCLI(dm, toolbox, sekaiHome)
+	exists, err := cli.FileExists(ctx, cli.GenesisPath())
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Infof("Chain is already initialised in volume %s", cfg.sekaiVolume())
+		return nil
+	}
+
+	_, err = genesis.New(ctx, cli, cfg.genesisSpec())
+	return err
+}
+
+// sekaiRPC is the RPC address of the sekai node as published on the Docker host.
+func sekaiRPC(dm *docker.DockerManager, cfg Config) string {
+	return "http://" + net.JoinHostPort(dm.DaemonHostname(), strconv.Itoa(cfg.RPCPort))
+}
+
+// interxAPI is the API address of interx as published on the Docker host.
+func interxAPI(dm *docker.DockerManager, cfg Config) string {
+	return "http://" + net.JoinHostPort(dm.DaemonHostname(), strconv.Itoa(cfg.InterxPort))
+}
+
+// waitNode blocks until a started node can serve its dependents: sekai has to pass the
+// readiness gates, so interx only starts against a synced node, and interx has to answer on
+// its status endpoint for the chain of the stack.
+func waitNode(ctx context.Context, dm *docker.DockerManager, cfg Config, spec docker.NodeSpec, readiness node.Readiness) error {
+	switch spec.Name {
+	case cfg.SekaiContainer():
+		return node.WaitReady(ctx, spec.Name, sekaiRPC(dm, cfg), readiness, nil)
+	case cfg.InterxContainer():
+		_, err := interx.WaitHealthy(ctx, interx.NewClient(interxAPI(dm, cfg)), cfg.ChainID, cfg.HealthTimeout, readiness.Interval)
+		return err
+	}
+	return nil
+}
+
+// checkImages fails when the container of a spec exists with another image than the spec.
+func checkImages(ctx context.Context, dm *docker.DockerManager, specs []docker.NodeSpec) error {
+	for _, spec := range specs {
+		exists, err := dm.ContainerExists(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		image, err := dm.ContainerImage(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if image != spec.Image {
+			return fmt.Errorf("container %s runs %s, not %s: run down first, or upgrade to change the version of a running chain", spec.Name, image, spec.Image)
+		}
+	}
+	return nil
+}
+
+func startNode(ctx context.Context, dm *docker.DockerManager, spec docker.NodeSpec, timeout time.Duration) error {
+	exists, err := dm.ContainerExists(ctx, spec.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		log.Infof("Creating node %s...", spec.Name)
+		if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Starting node %s...", spec.Name)
+	if err := dm.StartContainer(ctx, spec.Name); err != nil {
+		return err
+	}
+
+	return dm.WaitHealthy(ctx, spec.Name, timeout)
+}
+
+// Down stops and removes the node containers in reverse dependency order.
+// With wipe the volumes and the network are removed as well, which deletes all chain state.
+func Down(ctx context.Context, dm *docker.DockerManager, cfg Config, wipe bool) error {
+	specs, err := orderByDependencies(cfg.Specs())
+	if err != nil {
+		return err
+	}
+
+	for i := len(specs) - 1; i >= 0; i-- {
+		log.Infof("Stopping node %s...", specs[i].Name)
+		if err := dm.StopContainer(ctx, specs[i].Name, stopTimeout); err != nil {
+			return err
+		}
+		if err := dm.RemoveContainer(ctx, specs[i].Name); err != nil {
+			return err
+		}
+	}
+
+	if !wipe {
+		log.Infof("Stack %s is down, state is kept in volumes %v", cfg.Name, cfg.volumes())
+		return nil
+	}
+
+	for _, volume := range cfg.volumes() {
+		log.Infof("Removing volume %s...", volume)
+		if err := dm.RemoveVolume(ctx, volume); err != nil {
+			return err
+		}
+	}
+	if err := dm.RemoveNetwork(ctx, cfg.network()); err != nil {
+		return err
+	}
+
+	log.Infof("Stack %s is down and wiped", cfg.Name)
+	return nil
+}
+
+// orderByDependencies sorts specs so every node comes after the nodes it depends on.
+func orderByDependencies(specs []docker.NodeSpec) ([]docker.NodeSpec, error) {
+	byName := map[string]docker.NodeSpec{}
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+
+	var (
+		ordered []docker.NodeSpec
+		state   = map[string]int{} // 1: visiting, 2: done
+		visit   func(name string) error
+	)
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle at node %s", name)
+		case 2:
+			return nil
+		}
+		spec, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown node %s in depends_on", name)
+		}
+		state[name] = 1
+		for _, dep := range spec.DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, spec)
+		return nil
+	}
+
+	for _, spec := range specs {
+		if err := visit(spec.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
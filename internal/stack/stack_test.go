@@ -0,0 +1,252 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/interx"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+// newDaemon returns a fake daemon whose toolbox containers answer the sekaid commands of
+// initChain. inits counts the `sekaid init` runs.
+func newDaemon(inits *int) *fake.Client {
+	f := fake.New()
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		switch {
+		case cmd[0] == "test":
+			if _, ok := f.File(containerName, cmd[len(cmd)-1]); !ok {
+				return docker.ExecResult{ExitCode: 1}
+			}
+		case len(cmd) > 1 && cmd[1] == "init":
+			*inits++
+			f.WriteFile(containerName, sekaiHome+"/config/genesis.json", []byte(`{"chain_id":"localnet-1"}`))
+		case len(cmd) > 2 && cmd[1] == "keys" && cmd[2] == "show":
+			return docker.ExecResult{Stderr: "key not found", ExitCode: 1}
+		case len(cmd) > 3 && cmd[1] == "keys" && cmd[2] == "add":
+			return docker.ExecResult{Stderr: `{"name":"` + cmd[3] + `","address":"kira1validator","mnemonic":"word word word"}` + "\n"}
+		}
+		return docker.ExecResult{}
+	}
+	return f
+}
+
+func port(t *testing.T, rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("invalid url %s: %v", rawURL, err)
+	}
+	p, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("url %s has no port: %v", rawURL, err)
+	}
+	return p
+}
+
+// testConfig returns a stack whose published RPC and interx API are the fake servers.
+func testConfig(t *testing.T, name string, withInterx bool) Config {
+	rpc := tmfake.NewServer(tmfake.Node{})
+	t.Cleanup(rpc.Close)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(interx.Status{InterxInfo: interx.Info{ChainID: "localnet-1", LatestBlockHeight: 5}})
+	}))
+	t.Cleanup(api.Close)
+
+	cfg := DefaultConfig()
+	cfg.Name = name
+	cfg.RPCPort = port(t, rpc.URL())
+	cfg.InterxPort = port(t, api.URL)
+	if !withInterx {
+		cfg.InterxImage = ""
+	}
+	cfg.HealthTimeout = time.Second
+	cfg.Readiness.SyncTimeout = time.Second
+	cfg.Readiness.AdvanceTimeout = time.Second
+	cfg.Readiness.PeersTimeout = time.Second
+	cfg.Readiness.MinBlocks = 0
+	cfg.Readiness.Interval = 10 * time.Millisecond
+	return cfg
+}
+
+func running(t *testing.T, dm *docker.DockerManager, name string) bool {
+	exists, err := dm.ContainerExists(context.Background(), name)
+	if err != nil {
+		t.Fatalf("ContainerExists(%s) error: %v", name, err)
+	}
+	if !exists {
+		return false
+	}
+	up, err := dm.IsRunning(context.Background(), name)
+	if err != nil {
+		t.Fatalf("IsRunning(%s) error: %v", name, err)
+	}
+	return up
+}
+
+func TestUpDown(t *testing.T) {
+	tests := []struct {
+		name       string
+		stack      string
+		withInterx bool
+		pullError  bool
+		running    []string
+		absent     []string
+	}{
+		{
+			name:       "sekai and interx",
+			stack:      "kira",
+			withInterx: true,
+			running:    []string{"kira-sekai", "kira-interx"},
+			absent:     []string{"kira-sekai-init"},
+		},
+		{
+			name:    "sekai only",
+			stack:   "kira",
+			running: []string{"kira-sekai"},
+			absent:  []string{"kira-interx", "kira-sekai-init"},
+		},
+		{
+			name:       "named stack",
+			stack:      "alt",
+			withInterx: true,
+			running:    []string{"alt-sekai", "alt-interx"},
+			absent:     []string{"kira-sekai", "kira-interx"},
+		},
+		{
+			name:       "pull failure",
+			stack:      "kira",
+			withInterx: true,
+			pullError:  true,
+			absent:     []string{"kira-sekai", "kira-interx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var inits int
+			f := newDaemon(&inits)
+			dm := docker.NewDockerManagerWithClient(f)
+			cfg := testConfig(t, tt.stack, tt.withInterx)
+			if tt.pullError {
+				f.PullErrors[cfg.SekaiImage] = errors.New("manifest unknown")
+			}
+
+			err := Up(ctx, dm, cfg)
+			if tt.pullError {
+				if err == nil {
+					t.Fatal("Up() succeeded with a failing pull")
+				}
+			} else if err != nil {
+				t.Fatalf("Up() error: %v", err)
+			}
+			for _, name := range tt.running {
+				if !running(t, dm, name) {
+					t.Fatalf("container %s is not running after Up()", name)
+				}
+			}
+			for _, name := range tt.absent {
+				if exists, _ := dm.ContainerExists(ctx, name); exists {
+					t.Fatalf("container %s exists after Up()", name)
+				}
+			}
+			if tt.pullError {
+				return
+			}
+
+			// A second Up repairs the stack and keeps the chain of the volume.
+			if err := f.Exit(cfg.SekaiContainer(), 1); err != nil {
+				t.Fatalf("Exit() error: %v", err)
+			}
+			if err := Up(ctx, dm, cfg); err != nil {
+				t.Fatalf("second Up() error: %v", err)
+			}
+			if !running(t, dm, cfg.SekaiContainer()) {
+				t.Fatalf("container %s is not running after the second Up()", cfg.SekaiContainer())
+			}
+			if inits != 1 {
+				t.Fatalf("sekaid init ran %d times, want once", inits)
+			}
+
+			if err := Down(ctx, dm, cfg, false); err != nil {
+				t.Fatalf("Down() error: %v", err)
+			}
+			for _, name := range tt.running {
+				if exists, _ := dm.ContainerExists(ctx, name); exists {
+					t.Fatalf("container %s exists after Down()", name)
+				}
+			}
+			if _, err := f.VolumeInspect(ctx, cfg.sekaiVolume()); err != nil {
+				t.Fatalf("volume %s is gone after Down() without wipe: %v", cfg.sekaiVolume(), err)
+			}
+
+			if err := Down(ctx, dm, cfg, true); err != nil {
+				t.Fatalf("Down() with wipe error: %v", err)
+			}
+			for _, volume := range cfg.volumes() {
+				if _, err := f.VolumeInspect(ctx, volume); err == nil {
+					t.Fatalf("volume %s exists after Down() with wipe", volume)
+				}
+			}
+			if _, err := f.NetworkInspect(ctx, cfg.network(), types.NetworkInspectOptions{}); err == nil {
+				t.Fatalf("network %s exists after Down() with wipe", cfg.network())
+			}
+		})
+	}
+}
+
+func TestUpRefusesAnotherImage(t *testing.T) {
+	ctx := context.Background()
+	var inits int
+	f := newDaemon(&inits)
+	dm := docker.NewDockerManagerWithClient(f)
+	cfg := testConfig(t, "kira", true)
+	if err := Up(ctx, dm, cfg); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+
+	newer := cfg
+	newer.SekaiImage = "ghcr.io/kiracore/sekai:v9.9.9"
+	err := Up(ctx, dm, newer)
+	if err == nil || !strings.Contains(err.Error(), "runs "+cfg.SekaiImage+", not "+newer.SekaiImage) {
+		t.Fatalf("Up() with another sekai image = %v, want it refused", err)
+	}
+	if !running(t, dm, cfg.SekaiContainer()) {
+		t.Fatalf("container %s is not running after the refused Up()", cfg.SekaiContainer())
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		valid  bool
+	}{
+		{name: "defaults", modify: func(c *Config) {}, valid: true},
+		{name: "no name", modify: func(c *Config) { c.Name = "" }},
+		{name: "port out of range", modify: func(c *Config) { c.RPCPort = 70000 }},
+		{name: "shared port", modify: func(c *Config) { c.GRPCPort = c.RPCPort }},
+		{name: "interx port unused without interx", modify: func(c *Config) { c.InterxImage, c.InterxPort = "", c.RPCPort }, valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			if err := cfg.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
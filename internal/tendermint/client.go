@@ -0,0 +1,265 @@
+// Package tendermint is a small client for the Tendermint RPC endpoints of sekai nodes.
+package tendermint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRPCPort is the port sekaid serves the Tendermint RPC on.
+const DefaultRPCPort = "26657"
+
+// Client queries the Tendermint RPC of one node over HTTP.
+type Client struct {
+	// URL is the base address of the RPC, e.g. `http://10.0.0.1:26657`.
+	URL  string
+	HTTP *http.Client
+}
+
+// NewClient returns a Client for the RPC at addr. addr may omit the scheme
+// (`10.0.0.1:26657`) and use the `tcp://` scheme of sekaid's --node flag.
+func NewClient(addr string) *Client {
+	addr = strings.TrimSuffix(addr, "/")
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		addr = "http://" + strings.TrimPrefix(addr, "tcp://")
+	case !strings.Contains(addr, "://"):
+		addr = "http://" + addr
+	}
+
+	return &Client{URL: addr, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Host returns the host name of the RPC address without the port.
+func (c *Client) Host() string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// rpcResponse is the JSON-RPC envelope of every Tendermint RPC response.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+// call performs a GET request on an RPC endpoint and decodes its result into v.
+func (c *Client) call(ctx context.Context, endpoint string, params url.Values, v interface{}) error {
+	target := c.URL + "/" + endpoint
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", target, err)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode response of %s (HTTP %d): %w", target, resp.StatusCode, err)
+	}
+	if envelope.Error != nil {
+		return fmt.Errorf("%s returned error %d: %s %s", target, envelope.Error.Code, envelope.Error.Message, envelope.Error.Data)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", target, resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, v); err != nil {
+		return fmt.Errorf("failed to decode result of %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// NodeInfo identifies a node in the p2p network.
+type NodeInfo struct {
+	ID         string `json:"id"`
+	ListenAddr string `json:"listen_addr"`
+	// Network is the chain-id.
+	Network string `json:"network"`
+	Version string `json:"version"`
+	Moniker string `json:"moniker"`
+	Other   struct {
+		TxIndex    string `json:"tx_index"`
+		RPCAddress string `json:"rpc_address"`
+	} `json:"other"`
+}
+
+// P2PPort returns the port of ListenAddr, `26656` when it cannot be parsed.
+func (n NodeInfo) P2PPort() string {
+	addr := n.ListenAddr
+	if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+	if _, port, err := net.SplitHostPort(addr); err == nil && port != "" {
+		return port
+	}
+	return "26656"
+}
+
+// SyncInfo is the block sync state of a node.
+type SyncInfo struct {
+	LatestBlockHash   string    `json:"latest_block_hash"`
+	LatestAppHash     string    `json:"latest_app_hash"`
+	LatestBlockHeight int64     `json:"latest_block_height,string"`
+	LatestBlockTime   time.Time `json:"latest_block_time"`
+	EarliestHeight    int64     `json:"earliest_block_height,string"`
+	CatchingUp        bool      `json:"catching_up"`
+}
+
+// ValidatorInfo is the consensus key and voting power of a node.
+type ValidatorInfo struct {
+	Address     string `json:"address"`
+	PubKey      PubKey `json:"pub_key"`
+	VotingPower int64  `json:"voting_power,string"`
+}
+
+// PubKey is an amino encoded public key.
+type PubKey struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Status is the result of /status.
+type Status struct {
+	NodeInfo      NodeInfo      `json:"node_info"`
+	SyncInfo      SyncInfo      `json:"sync_info"`
+	ValidatorInfo ValidatorInfo `json:"validator_info"`
+}
+
+// Status queries /status.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	if err := c.call(ctx, "status", nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Peer is a connected peer in /net_info.
+type Peer struct {
+	NodeInfo   NodeInfo `json:"node_info"`
+	IsOutbound bool     `json:"is_outbound"`
+	RemoteIP   string   `json:"remote_ip"`
+}
+
+// Address returns the peer in the `<id>@<ip>:<port>` format of persistent_peers and seeds.
+func (p Peer) Address() string {
+	return p.NodeInfo.ID + "@" + net.JoinHostPort(p.RemoteIP, p.NodeInfo.P2PPort())
+}
+
+// NetInfo is the result of /net_info.
+type NetInfo struct {
+	Listening bool   `json:"listening"`
+	NPeers    int    `json:"n_peers,string"`
+	Peers     []Peer `json:"peers"`
+}
+
+// NetInfo queries /net_info.
+func (c *Client) NetInfo(ctx context.Context) (*NetInfo, error) {
+	info := &NetInfo{}
+	if err := c.call(ctx, "net_info", nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Genesis queries /genesis and returns the genesis document as served by the node.
+// The document is re-encoded by the node, so its hash is the hash of the returned bytes
+// and not necessarily the hash of the file the network was started with.
+func (c *Client) Genesis(ctx context.Context) (json.RawMessage, error) {
+	var result struct {
+		Genesis json.RawMessage `json:"genesis"`
+	}
+	if err := c.call(ctx, "genesis", nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Genesis) == 0 {
+		return nil, fmt.Errorf("%s/genesis returned no genesis", c.URL)
+	}
+	return result.Genesis, nil
+}
+
+// Validator is an entry of the validator set in /validators.
+type Validator struct {
+	Address          string `json:"address"`
+	PubKey           PubKey `json:"pub_key"`
+	VotingPower      int64  `json:"voting_power,string"`
+	ProposerPriority int64  `json:"proposer_priority,string"`
+}
+
+// validatorsPerPage is the largest page size the RPC accepts.
+const validatorsPerPage = 100
+
+// Validators queries /validators at height, 0 meaning the latest block, and follows
+// the pagination until the whole set has been read.
+func (c *Client) Validators(ctx context.Context, height int64) ([]Validator, error) {
+	var validators []Validator
+	for page := 1; ; page++ {
+		params := url.Values{"page": {strconv.Itoa(page)}, "per_page": {strconv.Itoa(validatorsPerPage)}}
+		if height > 0 {
+			params.Set("height", strconv.FormatInt(height, 10))
+		}
+
+		var result struct {
+			Validators []Validator `json:"validators"`
+			Total      int         `json:"total,string"`
+		}
+		if err := c.call(ctx, "validators", params, &result); err != nil {
+			return nil, err
+		}
+		validators = append(validators, result.Validators...)
+		if len(result.Validators) == 0 || len(validators) >= result.Total {
+			return validators, nil
+		}
+	}
+}
+
+// BlockHeader is the header of a block in /block.
+type BlockHeader struct {
+	ChainID         string    `json:"chain_id"`
+	Height          int64     `json:"height,string"`
+	Time            time.Time `json:"time"`
+	AppHash         string    `json:"app_hash"`
+	ProposerAddress string    `json:"proposer_address"`
+}
+
+// Block queries /block at height, 0 meaning the latest block, and returns its header.
+func (c *Client) Block(ctx context.Context, height int64) (*BlockHeader, error) {
+	var params url.Values
+	if height > 0 {
+		params = url.Values{"height": {strconv.FormatInt(height, 10)}}
+	}
+
+	var result struct {
+		Block struct {
+			Header BlockHeader `json:"header"`
+		} `json:"block"`
+	}
+	if err := c.call(ctx, "block", params, &result); err != nil {
+		return nil, err
+	}
+	return &result.Block.Header, nil
+}
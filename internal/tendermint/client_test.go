@@ -0,0 +1,171 @@
+package tendermint_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	"github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+var latest = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newNode() fake.Node {
+	var n fake.Node
+	n.Status.NodeInfo = tendermint.NodeInfo{ID: "a1b2", ListenAddr: "tcp://0.0.0.0:36656", Network: "localnet-1", Moniker: "validator"}
+	n.Status.SyncInfo = tendermint.SyncInfo{LatestBlockHeight: 120, LatestBlockTime: latest, EarliestHeight: 1}
+	n.Status.ValidatorInfo = tendermint.ValidatorInfo{Address: "ABCD", VotingPower: 10}
+	n.Peers = []tendermint.Peer{{NodeInfo: tendermint.NodeInfo{ID: "c3d4", ListenAddr: "tcp://0.0.0.0:26656", Network: "localnet-1"}, RemoteIP: "10.0.0.2"}}
+	n.Genesis = json.RawMessage(`{"chain_id":"localnet-1"}`)
+	return n
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		addr string
+		url  string
+		host string
+	}{
+		{addr: "10.0.0.1:26657", url: "http://10.0.0.1:26657", host: "10.0.0.1"},
+		{addr: "tcp://10.0.0.1:26657", url: "http://10.0.0.1:26657", host: "10.0.0.1"},
+		{addr: "https://rpc.example.com/", url: "https://rpc.example.com", host: "rpc.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			c := tendermint.NewClient(tt.addr)
+			if c.URL != tt.url || c.Host() != tt.host {
+				t.Fatalf("NewClient(%q) = %s with host %s, want %s with host %s", tt.addr, c.URL, c.Host(), tt.url, tt.host)
+			}
+		})
+	}
+}
+
+func TestStatusAndNetInfo(t *testing.T) {
+	srv := fake.NewServer(newNode())
+	defer srv.Close()
+	c := tendermint.NewClient(srv.URL())
+	ctx := context.Background()
+
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if status.NodeInfo.Network != "localnet-1" || status.SyncInfo.LatestBlockHeight != 120 || !status.SyncInfo.LatestBlockTime.Equal(latest) {
+		t.Fatalf("Status() = %+v, want localnet-1 at height 120", status)
+	}
+	if status.ValidatorInfo.VotingPower != 10 || status.NodeInfo.P2PPort() != "36656" {
+		t.Fatalf("Status() has power %d and p2p port %s, want 10 and 36656", status.ValidatorInfo.VotingPower, status.NodeInfo.P2PPort())
+	}
+
+	info, err := c.NetInfo(ctx)
+	if err != nil {
+		t.Fatalf("NetInfo() error: %v", err)
+	}
+	if info.NPeers != 1 || len(info.Peers) != 1 || info.Peers[0].Address() != "c3d4@10.0.0.2:26656" {
+		t.Fatalf("NetInfo() = %+v, want the peer c3d4@10.0.0.2:26656", info)
+	}
+
+	genesis, err := c.Genesis(ctx)
+	if err != nil {
+		t.Fatalf("Genesis() error: %v", err)
+	}
+	if string(genesis) != `{"chain_id":"localnet-1"}` {
+		t.Fatalf("Genesis() = %s", genesis)
+	}
+
+	srv.Close()
+	if _, err := c.Status(ctx); err == nil {
+		t.Fatal("Status() of a closed server succeeded")
+	}
+}
+
+func TestValidators(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "empty set", count: 0},
+		{name: "single page", count: 3},
+		{name: "full page", count: 100},
+		{name: "several pages", count: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newNode()
+			for i := 0; i < tt.count; i++ {
+				node.Validators = append(node.Validators, tendermint.Validator{Address: fmt.Sprintf("VAL%03d", i), VotingPower: int64(i + 1)})
+			}
+			srv := fake.NewServer(node)
+			defer srv.Close()
+
+			validators, err := tendermint.NewClient(srv.URL()).Validators(context.Background(), 0)
+			if err != nil {
+				t.Fatalf("Validators() error: %v", err)
+			}
+			if len(validators) != tt.count {
+				t.Fatalf("Validators() returned %d validators, want %d", len(validators), tt.count)
+			}
+			for i, val := range validators {
+				if val.Address != fmt.Sprintf("VAL%03d", i) || val.VotingPower != int64(i+1) {
+					t.Fatalf("validator %d = %+v, want VAL%03d with power %d", i, val, i, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestBlock(t *testing.T) {
+	node := newNode()
+	node.BlockInterval = 6 * time.Second
+	node.Blocks = map[int64]tendermint.BlockHeader{
+		100: {ChainID: "localnet-1", Height: 100, Time: latest.Add(-time.Minute), AppHash: "APP100"},
+	}
+	srv := fake.NewServer(node)
+	defer srv.Close()
+	c := tendermint.NewClient(srv.URL())
+
+	tests := []struct {
+		name   string
+		height int64
+		want   tendermint.BlockHeader
+		err    string
+	}{
+		{name: "latest", height: 0, want: tendermint.BlockHeader{ChainID: "localnet-1", Height: 120, Time: latest}},
+		{name: "derived from the interval", height: 110, want: tendermint.BlockHeader{ChainID: "localnet-1", Height: 110, Time: latest.Add(-time.Minute)}},
+		{name: "stored header", height: 100, want: node.Blocks[100]},
+		{name: "future height", height: 121, err: "must be less than or equal to the current blockchain height"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := c.Block(context.Background(), tt.height)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Block(%d) = %v, want error containing %q", tt.height, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Block(%d) error: %v", tt.height, err)
+			}
+			if header.ChainID != tt.want.ChainID || header.Height != tt.want.Height || !header.Time.Equal(tt.want.Time) || header.AppHash != tt.want.AppHash {
+				t.Fatalf("Block(%d) = %+v, want %+v", tt.height, header, tt.want)
+			}
+		})
+	}
+
+	srv.Advance(5)
+	header, err := c.Block(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Block() after Advance() error: %v", err)
+	}
+	if header.Height != 125 || !header.Time.Equal(latest.Add(30*time.Second)) {
+		t.Fatalf("Block() after Advance(5) = %+v, want height 125 at %s", header, latest.Add(30*time.Second))
+	}
+}
@@ -0,0 +1,151 @@
+// Package fake provides a local HTTP stand-in for the Tendermint RPC of a sekai node.
+//
+// The server answers /status, /net_info, /genesis, /validators and /block from the
+// fields of a Node, which can be changed while the server runs to simulate a chain
+// that produces blocks, loses peers or halts.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// Node is the state the fake RPC serves.
+type Node struct {
+	Status     tendermint.Status
+	Peers      []tendermint.Peer
+	Genesis    json.RawMessage
+	Validators []tendermint.Validator
+	// Blocks holds the block headers by height. Missing heights are answered with the
+	// latest block time minus BlockInterval for every block in between.
+	Blocks        map[int64]tendermint.BlockHeader
+	BlockInterval time.Duration
+}
+
+// Server is a running fake RPC.
+type Server struct {
+	mu   sync.Mutex
+	node Node
+	srv  *httptest.Server
+}
+
+// NewServer starts a fake RPC serving node. Close it when done.
+func NewServer(node Node) *Server {
+	if node.Blocks == nil {
+		node.Blocks = map[int64]tendermint.BlockHeader{}
+	}
+	if node.BlockInterval == 0 {
+		node.BlockInterval = 5 * time.Second
+	}
+
+	s := &Server{node: node}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handle(func(n *Node, r *http.Request) (interface{}, error) {
+		return n.Status, nil
+	}))
+	mux.HandleFunc("/net_info", s.handle(func(n *Node, r *http.Request) (interface{}, error) {
+		return map[string]interface{}{"listening": true, "n_peers": strconv.Itoa(len(n.Peers)), "peers": n.Peers}, nil
+	}))
+	mux.HandleFunc("/genesis", s.handle(func(n *Node, r *http.Request) (interface{}, error) {
+		return map[string]json.RawMessage{"genesis": n.Genesis}, nil
+	}))
+	mux.HandleFunc("/validators", s.handle(validators))
+	mux.HandleFunc("/block", s.handle(block))
+	s.srv = httptest.NewServer(mux)
+
+	return s
+}
+
+// URL is the base address of the fake RPC.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Update changes the served state under the server lock.
+func (s *Server) Update(fn func(n *Node)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.node)
+}
+
+// Advance produces n blocks: the latest height grows by n and the block time by n*BlockInterval.
+func (s *Server) Advance(n int64) {
+	s.Update(func(node *Node) {
+		node.Status.SyncInfo.LatestBlockHeight += n
+		node.Status.SyncInfo.LatestBlockTime = node.Status.SyncInfo.LatestBlockTime.Add(time.Duration(n) * node.BlockInterval)
+	})
+}
+
+func (s *Server) handle(fn func(n *Node, r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		result, err := fn(&s.node, r)
+		s.mu.Unlock()
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": -1}
+		if err != nil {
+			resp["error"] = map[string]interface{}{"code": -32603, "message": "Internal error", "data": err.Error()}
+		} else {
+			resp["result"] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func validators(n *Node, r *http.Request) (interface{}, error) {
+	page, perPage := intParam(r, "page", 1), intParam(r, "per_page", 30)
+	from := (page - 1) * perPage
+	if from > len(n.Validators) {
+		from = len(n.Validators)
+	}
+	to := from + perPage
+	if to > len(n.Validators) {
+		to = len(n.Validators)
+	}
+
+	return map[string]interface{}{
+		"block_height": strconv.FormatInt(n.Status.SyncInfo.LatestBlockHeight, 10),
+		"validators":   n.Validators[from:to],
+		"count":        strconv.Itoa(to - from),
+		"total":        strconv.Itoa(len(n.Validators)),
+	}, nil
+}
+
+func block(n *Node, r *http.Request) (interface{}, error) {
+	latest := n.Status.SyncInfo.LatestBlockHeight
+	height := int64(intParam(r, "height", int(latest)))
+	if height > latest || height < 1 {
+		return nil, fmt.Errorf("height %d must be less than or equal to the current blockchain height %d", height, latest)
+	}
+
+	header, ok := n.Blocks[height]
+	if !ok {
+		header = tendermint.BlockHeader{
+			ChainID: n.Status.NodeInfo.Network,
+			Height:  height,
+			Time:    n.Status.SyncInfo.LatestBlockTime.Add(-time.Duration(latest-height) * n.BlockInterval),
+		}
+	}
+
+	return map[string]interface{}{"block": map[string]interface{}{"header": header}}, nil
+}
+
+func intParam(r *http.Request, name string, def int) int {
+	if v, err := strconv.Atoi(r.URL.Query().Get(name)); err == nil {
+		return v
+	}
+	return def
+}
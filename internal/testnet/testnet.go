@@ -0,0 +1,440 @@
+// Package testnet runs a network of several sekai validators and sentries on a single Docker
+// daemon, for QA and chaos testing.
+//
+// Every node gets its own volume and container on a dedicated network. Validators share one
+// genesis with all of them claimed as genesis validators. With sentries, validators only peer
+// with the sentries, like a production sentry topology, otherwise they peer with each other.
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/genesis"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+	"github.com/mrlutik/kira2.0/internal/types"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+const (
+	// TestnetLabel marks the networks, volumes and containers of a testnet. Its value is the
+	// testnet name. Testnets do not carry docker.StackLabel, so stack commands never touch them.
+	TestnetLabel = "kira.testnet"
+	// RoleLabel holds the role of a testnet node container, `validator` or `sentry`.
+	RoleLabel = "kira.testnet.role"
+
+	RoleValidator = "validator"
+	RoleSentry    = "sentry"
+
+	sekaiHome = sekai.DefaultHome
+	// toolboxRoot is where the toolbox mounts the volumes of all nodes.
+	toolboxRoot = "/testnet"
+	// portStride is the distance between the host ports of two nodes.
+	portStride = 10
+	// stopTimeout is how long a node gets to shut down before it is killed.
+	stopTimeout = 30 * time.Second
+)
+
+// Config describes a testnet.
+type Config struct {
+	// Name prefixes the containers and volumes, names the network and is the value of TestnetLabel.
+	Name       string
+	ChainID    string
+	Validators int
+	Sentries   int
+	SekaiImage string
+	// BasePort is the host P2P port of the first node. Node i publishes P2P on BasePort+10*i,
+	// RPC on the port above and gRPC on the one above that.
+	BasePort      int
+	HealthTimeout time.Duration
+	Readiness     node.Readiness
+}
+
+// DefaultConfig returns the configuration `kira2_launcher testnet create` uses without flags.
+func DefaultConfig() Config {
+	return Config{
+		Name:          "testnet",
+		ChainID:       "testnet-1",
+		Validators:    4,
+		SekaiImage:    types.SekaiImage + ":" + types.DefaultSekaiVersion,
+		BasePort:      36656,
+		HealthTimeout: 5 * time.Minute,
+		Readiness:     node.DefaultReadiness(),
+	}
+}
+
+// Validate checks the node counts and that the host ports fit the port range.
+func (c Config) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("testnet needs a name")
+	}
+	if c.Validators < 1 {
+		return fmt.Errorf("testnet needs at least one validator")
+	}
+	if c.Sentries < 0 {
+		return fmt.Errorf("number of sentries cannot be negative")
+	}
+	if last := c.BasePort + portStride*(c.Validators+c.Sentries); c.BasePort < 1024 || last > 65535 {
+		return fmt.Errorf("host ports %d-%d are outside 1024-65535", c.BasePort, last)
+	}
+	return nil
+}
+
+// Node is a node of a testnet.
+type Node struct {
+	Name string
+	Role string
+	// Container is the name of the container and the host name of the node on the network.
+	Container string
+	Moniker   string
+	P2PPort   int
+	RPCPort   int
+	GRPCPort  int
+}
+
+func (n Node) volume() string {
+	return n.Container
+}
+
+// toolboxHome is the home of the node inside the toolbox that mounts all nodes.
+func (n Node) toolboxHome() string {
+	return path.Join(toolboxRoot, n.Name)
+}
+
+// Nodes returns the validators followed by the sentries.
+func (c Config) Nodes() []Node {
+	var nodes []Node
+	add := func(role string, i int) {
+		name := fmt.Sprintf("%s-%d", role, i)
+		port := c.BasePort + portStride*len(nodes)
+		nodes = append(nodes, Node{
+			Name:      name,
+			Role:      role,
+			Container: c.Name + "-" + name,
+			Moniker:   strings.ToUpper(role) + " " + strconv.Itoa(i),
+			P2PPort:   port,
+			RPCPort:   port + 1,
+			GRPCPort:  port + 2,
+		})
+	}
+	for i := 1; i <= c.Validators; i++ {
+		add(RoleValidator, i)
+	}
+	for i := 1; i <= c.Sentries; i++ {
+		add(RoleSentry, i)
+	}
+	return nodes
+}
+
+func (c Config) labels() map[string]string {
+	return map[string]string{TestnetLabel: c.Name}
+}
+
+func (c Config) spec(n Node) docker.NodeSpec {
+	labels := c.labels()
+	labels[RoleLabel] = n.Role
+	return docker.NodeSpec{
+		Name:       n.Container,
+		Image:      c.SekaiImage,
+		Entrypoint: []string{"sekaid"},
+		Cmd:        []string{"start", "--home=" + sekaiHome, "--rpc.laddr=tcp://0.0.0.0:26657"},
+		Network:    c.Name,
+		Ports: []string{
+			fmt.Sprintf("%d:26656", n.P2PPort),
+			fmt.Sprintf("%d:26657", n.RPCPort),
+			fmt.Sprintf("%d:9090", n.GRPCPort),
+		},
+		Volumes: []docker.VolumeMount{{Name: n.volume(), Target: sekaiHome}},
+		Labels:  labels,
+		Healthcheck: &docker.Healthcheck{
+			Test:        "sekaid status --node=tcp://localhost:26657 > /dev/null",
+			Interval:    5 * time.Second,
+			Timeout:     5 * time.Second,
+			StartPeriod: 10 * time.Second,
+			Retries:     10,
+		},
+		Logging: docker.LogConfig{Driver: "json-file", MaxSize: "100m", MaxFile: 5},
+	}
+}
+
+// Inventory describes the testnet nodes with their RPC as published on the Docker host,
+// for `node status` and `node restart`.
+func (c Config) Inventory(dm *docker.DockerManager) *inventory.Inventory {
+	inv := &inventory.Inventory{}
+	for _, n := range c.Nodes() {
+		inv.Nodes = append(inv.Nodes, inventory.Node{
+			Name:      n.Name,
+			Role:      n.Role,
+			RPC:       "http://" + net.JoinHostPort(dm.DaemonHostname(), strconv.Itoa(n.RPCPort)),
+			Container: n.Container,
+		})
+	}
+	return inv
+}
+
+// Create generates the keys and the shared genesis of the testnet, then starts every node on
+// the testnet network and waits until all of them pass the readiness gates. All nodes are
+// started before the first wait, the validators need each other to reach consensus.
+// A testnet whose volumes already exist is refused, destroy it first.
+func Create(ctx context.Context, dm *docker.DockerManager, cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	nodes := cfg.Nodes()
+
+	existing, err := dm.ListLabeledVolumes(ctx, TestnetLabel, cfg.Name)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("testnet %s already exists with volumes %v, destroy it first", cfg.Name, existing)
+	}
+
+	log.Infof("Pulling image %s...", cfg.SekaiImage)
+	if err := dm.PullImage(ctx, cfg.SekaiImage); err != nil {
+		return err
+	}
+	if _, err := dm.EnsureNetwork(ctx, cfg.Name, cfg.labels()); err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err := dm.EnsureVolume(ctx, n.volume(), cfg.labels()); err != nil {
+			return err
+		}
+	}
+
+	if err := initNodes(ctx, dm, cfg, nodes); err != nil {
+		return fmt.Errorf("failed to initialise testnet: %w", err)
+	}
+
+	for _, n := range nodes {
+		log.Infof("Starting %s...", n.Container)
+		if _, err := dm.CreateNodeContainer(ctx, cfg.spec(n)); err != nil {
+			return err
+		}
+		if err := dm.StartContainer(ctx, n.Container); err != nil {
+			return err
+		}
+	}
+
+	readiness := cfg.Readiness
+	if len(nodes) == 1 {
+		readiness.MinPeers = 0
+	}
+	for _, n := range cfg.Inventory(dm).Nodes {
+		if err := node.WaitReady(ctx, n.Name, n.RPC, readiness, nil); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Testnet %s is up with %d validators and %d sentries", cfg.Name, cfg.Validators, cfg.Sentries)
+	return nil
+}
+
+// identity is what the peers and the genesis need to know about an initialised node.
+type identity struct {
+	nodeID string
+	pubKey string
+}
+
+// initNodes initialises the home of every node in a toolbox that mounts all node volumes,
+// builds the genesis in the home of the first validator, whose keyring then holds every
+// operator key, and distributes the genesis and the peer configuration.
+func initNodes(ctx context.Context, dm *docker.DockerManager, cfg Config, nodes []Node) error {
+	toolbox := cfg.Name + "-init"
+	var volumes []docker.VolumeMount
+	for _, n := range nodes {
+		volumes = append(volumes, docker.VolumeMount{Name: n.volume(), Target: n.toolboxHome()})
+	}
+	if err := dm.StartToolbox(ctx, toolbox, cfg.SekaiImage, volumes); err != nil {
+		return err
+	}
+	defer func() {
+		if err := dm.RemoveContainer(context.Background(), toolbox); err != nil {
+			log.Warnf("Failed to remove %s: %s", toolbox, err)
+		}
+	}()
+
+	ids := map[string]identity{}
+	for _, n := range nodes {
+		cli := sekai.NewCLI(dm, toolbox, n.toolboxHome())
+		log.Infof("Initialising %s...", n.Name)
+		if _, err := cli.Run(ctx, "init", n.Moniker, "--chain-id="+cfg.ChainID); err != nil {
+			return err
+		}
+		id, err := cli.Run(ctx, "tendermint", "show-node-id")
+		if err != nil {
+			return err
+		}
+		pubKey, err := cli.Run(ctx, "tendermint", "show-validator")
+		if err != nil {
+			return err
+		}
+		ids[n.Name] = identity{nodeID: strings.TrimSpace(id), pubKey: strings.TrimSpace(pubKey)}
+	}
+
+	spec := &genesis.Spec{ChainID: cfg.ChainID}
+	for _, n := range nodes {
+		if n.Role != RoleValidator {
+			continue
+		}
+		spec.Accounts = append(spec.Accounts, genesis.Account{Name: n.Name, Coins: "300000000000000ukex"})
+		spec.Validators = append(spec.Validators, genesis.Validator{Key: n.Name, Moniker: n.Moniker, PubKey: ids[n.Name].pubKey})
+	}
+	result, err := genesis.New(ctx, sekai.NewCLI(dm, toolbox, nodes[0].toolboxHome()), spec)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		cli := sekai.NewCLI(dm, toolbox, n.toolboxHome())
+		if err := dm.WriteFile(ctx, toolbox, cli.GenesisPath(), result.Genesis, 0644); err != nil {
+			return err
+		}
+		file := sekaiconfig.ContainerFile{DM: dm, Container: toolbox, Path: cli.ConfigPath(sekaiconfig.ConfigFile)}
+		edit, err := sekaiconfig.Prepare(ctx, file, peerPatches(n, nodes, ids))
+		if err != nil {
+			return err
+		}
+		if err := edit.Write(ctx); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Genesis of %s with %d validators created, sha256 %s", cfg.ChainID, len(spec.Validators), result.SHA256)
+	return nil
+}
+
+// peerPatches returns the config.toml values that wire n into the testnet topology.
+func peerPatches(n Node, nodes []Node, ids map[string]identity) []sekaiconfig.Patch {
+	hasSentries := nodes[len(nodes)-1].Role == RoleSentry
+
+	var peers, validatorIDs []string
+	for _, other := range nodes {
+		if other.Role == RoleValidator {
+			validatorIDs = append(validatorIDs, ids[other.Name].nodeID)
+		}
+		if other.Name == n.Name {
+			continue
+		}
+		// Behind sentries a validator only talks to the sentries.
+		if n.Role == RoleValidator && hasSentries && other.Role == RoleValidator {
+			continue
+		}
+		peers = append(peers, ids[other.Name].nodeID+"@"+net.JoinHostPort(other.Container, "26656"))
+	}
+
+	patches := []sekaiconfig.Patch{
+		{File: sekaiconfig.ConfigFile, Section: "p2p", Key: "persistent_peers", Value: strings.Join(peers, ",")},
+		{File: sekaiconfig.ConfigFile, Section: "p2p", Key: "addr_book_strict", Value: false},
+		{File: sekaiconfig.ConfigFile, Section: "p2p", Key: "allow_duplicate_ip", Value: true},
+	}
+	switch {
+	case n.Role == RoleValidator && hasSentries:
+		patches = append(patches, sekaiconfig.Patch{File: sekaiconfig.ConfigFile, Section: "p2p", Key: "pex", Value: false})
+	case n.Role == RoleSentry:
+		patches = append(patches, sekaiconfig.Patch{File: sekaiconfig.ConfigFile, Section: "p2p", Key: "private_peer_ids", Value: strings.Join(validatorIDs, ",")})
+	}
+	return patches
+}
+
+// Destroy removes the containers, volumes and network of a testnet. It only needs the name,
+// the parts of the testnet are found by their TestnetLabel.
+func Destroy(ctx context.Context, dm *docker.DockerManager, name string) error {
+	containers, err := dm.ListLabeledContainers(ctx, TestnetLabel, name)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := dm.RemoveContainer(ctx, c.ID); err != nil {
+			return err
+		}
+	}
+
+	volumes, err := dm.ListLabeledVolumes(ctx, TestnetLabel, name)
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		if err := dm.RemoveVolume(ctx, volume); err != nil {
+			return err
+		}
+	}
+	networks, err := dm.ListLabeledNetworks(ctx, TestnetLabel, name)
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if err := dm.RemoveNetwork(ctx, network); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Testnet %s destroyed", name)
+	return nil
+}
+
+// Fault is a chaos action on a single testnet node.
+type Fault string
+
+const (
+	// Kill sends SIGKILL, the node stops without a graceful shutdown.
+	Kill Fault = "kill"
+	// Pause freezes the node, it keeps its connections but stops answering.
+	Pause Fault = "pause"
+	// Resume undoes a pause or starts a killed or stopped node again.
+	Resume Fault = "resume"
+)
+
+// Inject applies fault to the node called nodeName of the testnet, e.g. `validator-2`.
+// Only containers carrying the TestnetLabel of the testnet are touched.
+func Inject(ctx context.Context, dm *docker.DockerManager, name, nodeName string, fault Fault) error {
+	container := name + "-" + nodeName
+	containers, err := dm.ListLabeledContainers(ctx, TestnetLabel, name)
+	if err != nil {
+		return err
+	}
+	var state string
+	found := false
+	for _, c := range containers {
+		for _, n := range c.Names {
+			if strings.TrimPrefix(n, "/") == container {
+				state, found = c.State, true
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("node %s is not part of testnet %s", nodeName, name)
+	}
+
+	switch fault {
+	case Kill:
+		return dm.KillContainer(ctx, container, "SIGKILL")
+	case Pause:
+		return dm.PauseContainer(ctx, container)
+	case Resume:
+		switch state {
+		case "paused":
+			return dm.UnpauseContainer(ctx, container)
+		case "running":
+			log.Infof("Node %s is already running", nodeName)
+			return nil
+		default:
+			return dm.StartContainer(ctx, container)
+		}
+	default:
+		return fmt.Errorf("unknown fault %q, use %s, %s or %s", fault, Kill, Pause, Resume)
+	}
+}
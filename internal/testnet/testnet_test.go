@@ -0,0 +1,238 @@
+package testnet
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+// newDaemon returns a fake daemon whose toolbox answers the sekaid commands of initNodes.
+func newDaemon() *fake.Client {
+	f := fake.New()
+	f.ExecHandler = func(containerName string, cmd []string) docker.ExecResult {
+		home := strings.TrimPrefix(cmd[len(cmd)-1], "--home=")
+		switch {
+		case len(cmd) < 3:
+		case cmd[1] == "init":
+			f.WriteFile(containerName, home+"/config/genesis.json", []byte(`{"chain_id":"testnet-1"}`))
+			f.WriteFile(containerName, home+"/config/config.toml", []byte("[p2p]\npersistent_peers = \"\"\npex = true\n"))
+		case cmd[1] == "tendermint" && cmd[2] == "show-node-id":
+			return docker.ExecResult{Stdout: "id-" + strings.TrimPrefix(home, toolboxRoot+"/") + "\n"}
+		case cmd[1] == "tendermint" && cmd[2] == "show-validator":
+			return docker.ExecResult{Stdout: `{"@type":"/cosmos.crypto.ed25519.PubKey","key":"cons"}` + "\n"}
+		case cmd[1] == "keys" && cmd[2] == "show":
+			return docker.ExecResult{Stderr: "key not found", ExitCode: 1}
+		case cmd[1] == "keys" && cmd[2] == "add":
+			return docker.ExecResult{Stderr: `{"name":"` + cmd[3] + `","address":"kira1` + cmd[3] + `","mnemonic":"words"}` + "\n"}
+		}
+		return docker.ExecResult{}
+	}
+	return f
+}
+
+// testConfig returns a testnet of one validator whose published RPC is a fake at height 5.
+func testConfig(t *testing.T, name string) Config {
+	rpc := tmfake.NewServer(tmfake.Node{})
+	rpc.Advance(5)
+	t.Cleanup(rpc.Close)
+	u, err := url.Parse(rpc.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpcPort, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Name = name
+	cfg.Validators = 1
+	cfg.BasePort = rpcPort - 1
+	cfg.Readiness.SyncTimeout = time.Second
+	cfg.Readiness.AdvanceTimeout = time.Second
+	cfg.Readiness.PeersTimeout = time.Second
+	cfg.Readiness.MinBlocks = 0
+	cfg.Readiness.Interval = 10 * time.Millisecond
+	return cfg
+}
+
+// addStack creates the network, volume and container of a launcher stack called name.
+func addStack(t *testing.T, dm *docker.DockerManager, name string) {
+	ctx := context.Background()
+	labels := map[string]string{docker.StackLabel: name}
+	if _, err := dm.EnsureNetwork(ctx, name+"-net", labels); err != nil {
+		t.Fatalf("EnsureNetwork() error: %v", err)
+	}
+	if err := dm.EnsureVolume(ctx, name+"-validator-1", labels); err != nil {
+		t.Fatalf("EnsureVolume() error: %v", err)
+	}
+	spec := docker.NodeSpec{Name: name + "-validator-1", Image: DefaultConfig().SekaiImage, Network: name + "-net", Labels: labels}
+	if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	if err := dm.StartContainer(ctx, spec.Name); err != nil {
+		t.Fatalf("StartContainer() error: %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+	f := newDaemon()
+	f.AddImage(DefaultConfig().SekaiImage)
+	dm := docker.NewDockerManagerWithClient(f)
+	cfg := testConfig(t, "qa")
+
+	if err := Create(ctx, dm, cfg); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	containers, err := dm.ListLabeledContainers(ctx, TestnetLabel, "qa")
+	if err != nil {
+		t.Fatalf("ListLabeledContainers() error: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Names[0] != "/qa-validator-1" || containers[0].Labels[RoleLabel] != RoleValidator {
+		t.Fatalf("testnet containers = %+v, want qa-validator-1 with the validator role", containers)
+	}
+	if _, ok := containers[0].Labels[docker.StackLabel]; ok {
+		t.Fatalf("testnet container labels = %v, want no %s", containers[0].Labels, docker.StackLabel)
+	}
+	if volumes, _ := dm.ListLabeledVolumes(ctx, TestnetLabel, "qa"); len(volumes) != 1 || volumes[0] != "qa-validator-1" {
+		t.Fatalf("testnet volumes = %v, want qa-validator-1", volumes)
+	}
+	if networks, _ := dm.ListLabeledNetworks(ctx, TestnetLabel, "qa"); len(networks) != 1 || networks[0] != "qa" {
+		t.Fatalf("testnet networks = %v, want qa", networks)
+	}
+	if err := Create(ctx, dm, cfg); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("second Create() = %v, want an error for the existing testnet", err)
+	}
+}
+
+func TestDestroyLeavesStacks(t *testing.T) {
+	ctx := context.Background()
+	f := newDaemon()
+	f.AddImage(DefaultConfig().SekaiImage)
+	dm := docker.NewDockerManagerWithClient(f)
+	if err := Create(ctx, dm, testConfig(t, "qa")); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	addStack(t, dm, "kira")
+	addStack(t, dm, "qa-stack")
+
+	if err := Destroy(ctx, dm, "qa"); err != nil {
+		t.Fatalf("Destroy() error: %v", err)
+	}
+	for _, label := range []string{TestnetLabel, docker.StackLabel} {
+		for _, name := range []string{"qa", "kira", "qa-stack"} {
+			containers, _ := dm.ListLabeledContainers(ctx, label, name)
+			volumes, _ := dm.ListLabeledVolumes(ctx, label, name)
+			networks, _ := dm.ListLabeledNetworks(ctx, label, name)
+			want := label == docker.StackLabel && name != "qa"
+			if got := len(containers) == 1 && len(volumes) == 1 && len(networks) == 1; got != want {
+				t.Fatalf("after Destroy() %s=%s has containers %d, volumes %v and networks %v", label, name, len(containers), volumes, networks)
+			}
+		}
+	}
+}
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name   string
+		node   string
+		faults []Fault
+		state  string
+		err    string
+	}{
+		{name: "kill", node: "validator-1", faults: []Fault{Kill}, state: "exited"},
+		{name: "pause", node: "validator-1", faults: []Fault{Pause}, state: "paused"},
+		{name: "resume paused", node: "validator-1", faults: []Fault{Pause, Resume}, state: "running"},
+		{name: "resume killed", node: "validator-1", faults: []Fault{Kill, Resume}, state: "running"},
+		{name: "resume running", node: "validator-1", faults: []Fault{Resume}, state: "running"},
+		{name: "unknown node", node: "validator-9", faults: []Fault{Kill}, err: "node validator-9 is not part of testnet qa"},
+		{name: "unknown fault", node: "validator-1", faults: []Fault{"reboot"}, err: `unknown fault "reboot"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newDaemon()
+			f.AddImage(DefaultConfig().SekaiImage)
+			dm := docker.NewDockerManagerWithClient(f)
+			if err := Create(ctx, dm, testConfig(t, "qa")); err != nil {
+				t.Fatalf("Create() error: %v", err)
+			}
+
+			var err error
+			for _, fault := range tt.faults {
+				if err = Inject(ctx, dm, "qa", tt.node, fault); err != nil {
+					break
+				}
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Inject() = %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Inject() error: %v", err)
+			}
+			containers, _ := dm.ListLabeledContainers(ctx, TestnetLabel, "qa")
+			if len(containers) != 1 || containers[0].State != tt.state {
+				t.Fatalf("containers = %+v, want qa-validator-1 %s", containers, tt.state)
+			}
+		})
+	}
+}
+
+func TestInjectRefusesStackContainers(t *testing.T) {
+	f := fake.New()
+	f.AddImage(DefaultConfig().SekaiImage)
+	dm := docker.NewDockerManagerWithClient(f)
+	// A stack named like the testnet has a container with the name of a testnet node.
+	addStack(t, dm, "qa")
+
+	err := Inject(context.Background(), dm, "qa", "validator-1", Kill)
+	if err == nil || !strings.Contains(err.Error(), "is not part of testnet qa") {
+		t.Fatalf("Inject() = %v, want a refusal", err)
+	}
+	if running, _ := dm.IsRunning(context.Background(), "qa-validator-1"); !running {
+		t.Fatal("Inject() killed a stack container")
+	}
+}
+
+func TestPeerPatches(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Validators, cfg.Sentries = 2, 1
+	nodes := cfg.Nodes()
+	ids := map[string]identity{}
+	for _, n := range nodes {
+		ids[n.Name] = identity{nodeID: "id-" + n.Name}
+	}
+
+	patches := map[string]map[string]interface{}{}
+	for _, n := range nodes {
+		patches[n.Name] = map[string]interface{}{}
+		for _, p := range peerPatches(n, nodes, ids) {
+			patches[n.Name][p.Key] = p.Value
+		}
+	}
+
+	if got := patches["validator-1"]["persistent_peers"]; got != "id-sentry-1@testnet-sentry-1:26656" {
+		t.Fatalf("peers of validator-1 = %v, want only the sentry", got)
+	}
+	if got := patches["validator-1"]["pex"]; got != false {
+		t.Fatalf("pex of validator-1 = %v, want false behind sentries", got)
+	}
+	if got := patches["sentry-1"]["persistent_peers"]; got != "id-validator-1@testnet-validator-1:26656,id-validator-2@testnet-validator-2:26656" {
+		t.Fatalf("peers of sentry-1 = %v, want both validators", got)
+	}
+	if got := patches["sentry-1"]["private_peer_ids"]; got != "id-validator-1,id-validator-2" {
+		t.Fatalf("private peers of sentry-1 = %v, want both validators", got)
+	}
+}
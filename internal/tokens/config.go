@@ -0,0 +1,195 @@
+package tokens
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/gov"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a YAML file of the token aliases and rates a network should have.
+//
+//	aliases:
+//	  - symbol: TEST
+//	    name: Test TestCoin
+//	    icon: https://example.com/test.svg
+//	    decimals: 8
+//	    denoms: [test]
+//	rates:
+//	  - denom: test
+//	    fee_rate: "0.1"
+//	    fee_payments: true
+//	    stake_cap: "0.1"
+//	    stake_min: "1"
+//	    stake_token: false
+//
+// Every entry that differs from the chain becomes one governance proposal.
+type Config struct {
+	Aliases []Alias `yaml:"aliases"`
+	Rates   []Rate  `yaml:"rates"`
+}
+
+// LoadConfig decodes and validates a Config.
+func LoadConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode token config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadConfigFile reads a Config from path.
+func LoadConfigFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return LoadConfig(f)
+}
+
+// Validate checks that every alias and rate is complete, and that no symbol or denom is set twice.
+func (c *Config) Validate() error {
+	if len(c.Aliases) == 0 && len(c.Rates) == 0 {
+		return fmt.Errorf("token config has no aliases and no rates")
+	}
+
+	symbols := map[string]bool{}
+	for _, a := range c.Aliases {
+		switch {
+		case a.Symbol == "":
+			return fmt.Errorf("token alias without symbol")
+		case symbols[a.Symbol]:
+			return fmt.Errorf("token alias %s is set twice", a.Symbol)
+		case a.Name == "":
+			return fmt.Errorf("token alias %s has no name", a.Symbol)
+		case len(a.Denoms) == 0:
+			return fmt.Errorf("token alias %s has no denoms", a.Symbol)
+		}
+		symbols[a.Symbol] = true
+	}
+
+	denoms := map[string]bool{}
+	for _, r := range c.Rates {
+		switch {
+		case r.Denom == "":
+			return fmt.Errorf("token rate without denom")
+		case denoms[r.Denom]:
+			return fmt.Errorf("token rate %s is set twice", r.Denom)
+		}
+		denoms[r.Denom] = true
+		if rat, ok := new(big.Rat).SetString(r.FeeRate); !ok || rat.Sign() <= 0 {
+			return fmt.Errorf("token rate %s has invalid fee_rate %q", r.Denom, r.FeeRate)
+		}
+		if r.StakeCap != "" {
+			if rat, ok := new(big.Rat).SetString(r.StakeCap); !ok || rat.Sign() < 0 || rat.Cmp(big.NewRat(1, 1)) > 0 {
+				return fmt.Errorf("token rate %s has invalid stake_cap %q, expected 0 to 1", r.Denom, r.StakeCap)
+			}
+		}
+		if r.StakeMin != "" {
+			if _, ok := new(big.Int).SetString(r.StakeMin, 10); !ok {
+				return fmt.Errorf("token rate %s has invalid stake_min %q", r.Denom, r.StakeMin)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Proposals returns the proposals bringing the aliases and rates of the chain to the config.
+// Entries the chain already has are skipped.
+func (c *Config) Proposals(aliases []Alias, rates []Rate) []gov.Proposal {
+	current := map[string]Alias{}
+	for _, a := range aliases {
+		current[a.Symbol] = a
+	}
+	currentRates := map[string]Rate{}
+	for _, r := range rates {
+		currentRates[r.Denom] = r
+	}
+
+	var proposals []gov.Proposal
+	for _, a := range c.Aliases {
+		if have, ok := current[a.Symbol]; ok && sameAlias(have, a) {
+			log.Infof("Token alias %s is up to date", a.Symbol)
+			continue
+		}
+		proposals = append(proposals, gov.Proposal{
+			Type:        "upsert-token-alias",
+			Title:       "Upsert token alias " + a.Symbol,
+			Description: fmt.Sprintf("Set %s (%s) with %d decimals for %s", a.Symbol, a.Name, a.Decimals, strings.Join(a.Denoms, ", ")),
+			Params: map[string]interface{}{
+				"symbol":      a.Symbol,
+				"name":        a.Name,
+				"icon":        a.Icon,
+				"decimals":    strconv.FormatUint(uint64(a.Decimals), 10),
+				"denoms":      strings.Join(a.Denoms, ","),
+				"invalidated": strconv.FormatBool(a.Invalidated),
+			},
+		})
+	}
+	for _, r := range c.Rates {
+		if have, ok := currentRates[r.Denom]; ok && sameRate(have, r) {
+			log.Infof("Token rate %s is up to date", r.Denom)
+			continue
+		}
+		params := map[string]interface{}{
+			"denom":        r.Denom,
+			"rate":         r.FeeRate,
+			"fee_payments": strconv.FormatBool(r.FeePayments),
+			"stake_token":  strconv.FormatBool(r.StakeToken),
+			"invalidated":  strconv.FormatBool(r.Invalidated),
+		}
+		if r.StakeCap != "" {
+			params["stake_cap"] = r.StakeCap
+		}
+		if r.StakeMin != "" {
+			params["stake_min"] = r.StakeMin
+		}
+		proposals = append(proposals, gov.Proposal{
+			Type:        "upsert-token-rate",
+			Title:       "Upsert token rate " + r.Denom,
+			Description: fmt.Sprintf("Set the fee rate of %s to %s", r.Denom, r.FeeRate),
+			Params:      params,
+		})
+	}
+
+	return proposals
+}
+
+func sameAlias(a, b Alias) bool {
+	return a.Name == b.Name && a.Icon == b.Icon && a.Decimals == b.Decimals && a.Invalidated == b.Invalidated &&
+		strings.Join(a.Denoms, ",") == strings.Join(b.Denoms, ",")
+}
+
+// sameRate compares the chain rate have with the configured rate want. Decimals are compared
+// by value and unset stake settings of want are not compared.
+func sameRate(have, want Rate) bool {
+	if have.FeePayments != want.FeePayments || have.StakeToken != want.StakeToken || have.Invalidated != want.Invalidated {
+		return false
+	}
+	if !sameDec(have.FeeRate, want.FeeRate) {
+		return false
+	}
+	if want.StakeCap != "" && !sameDec(have.StakeCap, want.StakeCap) {
+		return false
+	}
+	return want.StakeMin == "" || sameDec(have.StakeMin, want.StakeMin)
+}
+
+func sameDec(a, b string) bool {
+	x, okX := new(big.Rat).SetString(a)
+	y, okY := new(big.Rat).SetString(b)
+	return okX && okY && x.Cmp(y) == 0
+}
@@ -0,0 +1,144 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+aliases:
+  - symbol: TEST
+    name: Test TestCoin
+    icon: https://example.com/test.svg
+    decimals: 8
+    denoms: [test]
+rates:
+  - denom: test
+    fee_rate: "0.1"
+    fee_payments: true
+    stake_cap: "0.1"
+    stake_min: "1"
+`
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{name: "valid", config: testConfig},
+		{name: "empty", config: "aliases: []\n", err: "has no aliases and no rates"},
+		{name: "unknown field", config: "rates:\n  - denom: test\n    fee: \"1\"\n", err: "field fee not found"},
+		{name: "alias without symbol", config: "aliases:\n  - name: Test\n    denoms: [test]\n", err: "token alias without symbol"},
+		{name: "alias set twice", config: "aliases:\n  - {symbol: T, name: T, denoms: [t]}\n  - {symbol: T, name: T, denoms: [t]}\n", err: "token alias T is set twice"},
+		{name: "alias without name", config: "aliases:\n  - {symbol: T, denoms: [t]}\n", err: "token alias T has no name"},
+		{name: "alias without denoms", config: "aliases:\n  - {symbol: T, name: T}\n", err: "token alias T has no denoms"},
+		{name: "rate without denom", config: "rates:\n  - fee_rate: \"1\"\n", err: "token rate without denom"},
+		{name: "rate set twice", config: "rates:\n  - {denom: t, fee_rate: \"1\"}\n  - {denom: t, fee_rate: \"2\"}\n", err: "token rate t is set twice"},
+		{name: "zero fee rate", config: "rates:\n  - {denom: t, fee_rate: \"0\"}\n", err: `invalid fee_rate "0"`},
+		{name: "invalid fee rate", config: "rates:\n  - {denom: t, fee_rate: \"one\"}\n", err: `invalid fee_rate "one"`},
+		{name: "stake cap above 1", config: "rates:\n  - {denom: t, fee_rate: \"1\", stake_cap: \"1.5\"}\n", err: "expected 0 to 1"},
+		{name: "decimal stake min", config: "rates:\n  - {denom: t, fee_rate: \"1\", stake_min: \"0.5\"}\n", err: `invalid stake_min "0.5"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(strings.NewReader(tt.config))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("LoadConfig() = %+v, %v, want error containing %q", cfg, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProposals(t *testing.T) {
+	cfg, err := LoadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	alias := cfg.Aliases[0]
+	// The rate as sekaid prints it.
+	rate := Rate{Denom: "test", FeeRate: "0.100000000000000000", FeePayments: true, StakeCap: "0.100000000000000000", StakeMin: "1"}
+
+	tests := []struct {
+		name    string
+		aliases []Alias
+		rates   []Rate
+		types   []string
+	}{
+		{name: "new chain", types: []string{"upsert-token-alias", "upsert-token-rate"}},
+		{name: "up to date", aliases: []Alias{alias}, rates: []Rate{rate}},
+		{
+			name:    "changed alias",
+			aliases: []Alias{{Symbol: "TEST", Name: "Test TestCoin", Decimals: 6, Denoms: []string{"test"}}},
+			rates:   []Rate{rate},
+			types:   []string{"upsert-token-alias"},
+		},
+		{
+			name:    "changed rate",
+			aliases: []Alias{alias},
+			rates:   []Rate{{Denom: "test", FeeRate: "0.2", FeePayments: true, StakeCap: "0.1", StakeMin: "1"}},
+			types:   []string{"upsert-token-rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var types []string
+			for _, p := range cfg.Proposals(tt.aliases, tt.rates) {
+				if err := p.Validate(); err != nil {
+					t.Fatalf("proposal %s is invalid: %v", p.Title, err)
+				}
+				types = append(types, p.Type)
+			}
+			if strings.Join(types, " ") != strings.Join(tt.types, " ") {
+				t.Fatalf("proposal types = %q, want %q", types, tt.types)
+			}
+		})
+	}
+
+	proposals := cfg.Proposals(nil, nil)
+	if p := proposals[0].Params; p["decimals"] != "8" || p["denoms"] != "test" || p["invalidated"] != "false" {
+		t.Fatalf("alias proposal params = %v", p)
+	}
+	if p := proposals[1].Params; p["rate"] != "0.1" || p["stake_cap"] != "0.1" || p["stake_min"] != "1" || p["fee_payments"] != "true" {
+		t.Fatalf("rate proposal params = %v", p)
+	}
+	unset := Config{Rates: []Rate{{Denom: "test", FeeRate: "0.1"}}}
+	if p := unset.Proposals(nil, nil)[0].Params; p["stake_cap"] != nil || p["stake_min"] != nil {
+		t.Fatalf("rate proposal params = %v, want no unset stake settings", p)
+	}
+}
+
+func TestSameRate(t *testing.T) {
+	have := Rate{Denom: "test", FeeRate: "0.100000000000000000", FeePayments: true, StakeCap: "0.250000000000000000", StakeMin: "1000"}
+	tests := []struct {
+		name string
+		want Rate
+		same bool
+	}{
+		{name: "equal decimals", want: Rate{FeeRate: "0.1", FeePayments: true, StakeCap: "0.25", StakeMin: "1000"}, same: true},
+		{name: "unset stake settings", want: Rate{FeeRate: ".1", FeePayments: true}, same: true},
+		{name: "other fee rate", want: Rate{FeeRate: "0.2", FeePayments: true}},
+		{name: "other stake cap", want: Rate{FeeRate: "0.1", FeePayments: true, StakeCap: "0.3"}},
+		{name: "other stake min", want: Rate{FeeRate: "0.1", FeePayments: true, StakeMin: "999"}},
+		{name: "fee payments off", want: Rate{FeeRate: "0.1"}},
+		{name: "stake token", want: Rate{FeeRate: "0.1", FeePayments: true, StakeToken: true}},
+		{name: "invalidated", want: Rate{FeeRate: "0.1", FeePayments: true, Invalidated: true}},
+		{name: "invalid decimal", want: Rate{FeeRate: "ten", FeePayments: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameRate(have, tt.want); got != tt.same {
+				t.Fatalf("sameRate(%+v, %+v) = %t, want %t", have, tt.want, got, tt.same)
+			}
+		})
+	}
+}
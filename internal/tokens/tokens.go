@@ -0,0 +1,149 @@
+// Package tokens queries the token aliases, rates and black and white lists of the sekai
+// tokens module and proposes changes to them through governance.
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// Alias is the symbol, name and decimals of a token and the denoms it covers.
+type Alias struct {
+	Symbol      string   `json:"symbol" yaml:"symbol"`
+	Name        string   `json:"name" yaml:"name"`
+	Icon        string   `json:"icon" yaml:"icon"`
+	Decimals    uint32   `json:"decimals" yaml:"decimals"`
+	Denoms      []string `json:"denoms" yaml:"denoms"`
+	Invalidated bool     `json:"invalidated" yaml:"invalidated"`
+}
+
+// Rate is the fee rate and staking settings of a denom. Rates and caps are decimals kept as
+// the strings sekaid prints.
+type Rate struct {
+	Denom       string `json:"denom" yaml:"denom"`
+	FeeRate     string `json:"fee_rate" yaml:"fee_rate"`
+	FeePayments bool   `json:"fee_payments" yaml:"fee_payments"`
+	StakeCap    string `json:"stake_cap" yaml:"stake_cap"`
+	StakeMin    string `json:"stake_min" yaml:"stake_min"`
+	StakeToken  bool   `json:"stake_token" yaml:"stake_token"`
+	Invalidated bool   `json:"invalidated" yaml:"invalidated"`
+}
+
+// BlackWhites are the denoms whitelisted and blacklisted by the network.
+type BlackWhites struct {
+	Whitelisted []string `json:"whitelisted"`
+	Blacklisted []string `json:"blacklisted"`
+}
+
+// Aliases returns every token alias, sorted by symbol.
+func Aliases(ctx context.Context, cli *sekai.CLI) ([]Alias, error) {
+	var resp struct {
+		Data []Alias `json:"data"`
+	}
+	if err := cli.RunJSON(ctx, &resp, "query", "tokens", "all-aliases"); err != nil {
+		return nil, fmt.Errorf("failed to query token aliases: %w", err)
+	}
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Symbol < resp.Data[j].Symbol })
+	return resp.Data, nil
+}
+
+// AliasOf returns the alias of symbol.
+func AliasOf(ctx context.Context, cli *sekai.CLI, symbol string) (*Alias, error) {
+	var alias Alias
+	if err := cli.RunJSON(ctx, &alias, "query", "tokens", "alias", symbol); err != nil {
+		return nil, fmt.Errorf("failed to query token alias %s: %w", symbol, err)
+	}
+	if alias.Symbol == "" {
+		return nil, fmt.Errorf("token alias %s not found", symbol)
+	}
+	return &alias, nil
+}
+
+// Rates returns every token rate, sorted by denom.
+func Rates(ctx context.Context, cli *sekai.CLI) ([]Rate, error) {
+	var resp struct {
+		Data []Rate `json:"data"`
+	}
+	if err := cli.RunJSON(ctx, &resp, "query", "tokens", "all-rates"); err != nil {
+		return nil, fmt.Errorf("failed to query token rates: %w", err)
+	}
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Denom < resp.Data[j].Denom })
+	return resp.Data, nil
+}
+
+// RateOf returns the rate of denom.
+func RateOf(ctx context.Context, cli *sekai.CLI, denom string) (*Rate, error) {
+	var rate Rate
+	if err := cli.RunJSON(ctx, &rate, "query", "tokens", "rate", denom); err != nil {
+		return nil, fmt.Errorf("failed to query token rate %s: %w", denom, err)
+	}
+	if rate.Denom == "" {
+		return nil, fmt.Errorf("token rate %s not found", denom)
+	}
+	return &rate, nil
+}
+
+// QueryBlackWhites returns the whitelisted and blacklisted denoms.
+func QueryBlackWhites(ctx context.Context, cli *sekai.CLI) (*BlackWhites, error) {
+	var resp struct {
+		Data BlackWhites `json:"data"`
+	}
+	if err := cli.RunJSON(ctx, &resp, "query", "tokens", "token-black-whites"); err != nil {
+		return nil, fmt.Errorf("failed to query token black and white lists: %w", err)
+	}
+	sort.Strings(resp.Data.Whitelisted)
+	sort.Strings(resp.Data.Blacklisted)
+	return &resp.Data, nil
+}
+
+// FormatAliases returns the aliases as a table.
+func FormatAliases(aliases []Alias) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-10s %-24s %8s %-24s %-11s %s\n", "SYMBOL", "NAME", "DECIMALS", "DENOMS", "INVALIDATED", "ICON")
+	for _, a := range aliases {
+		fmt.Fprintf(&b, "%-10s %-24s %8d %-24s %-11t %s\n", a.Symbol, a.Name, a.Decimals, strings.Join(a.Denoms, ","), a.Invalidated, a.Icon)
+	}
+	return b.String()
+}
+
+// FormatRates returns the rates as a table.
+func FormatRates(rates []Rate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-12s %-14s %-12s %-12s %-10s %-11s %s\n", "DENOM", "FEE RATE", "FEE PAYMENTS", "STAKE CAP", "STAKE MIN", "STAKE TOKEN", "INVALIDATED")
+	for _, r := range rates {
+		fmt.Fprintf(&b, "%-12s %-14s %-12t %-12s %-10s %-11t %t\n", r.Denom, trimDec(r.FeeRate), r.FeePayments, trimDec(r.StakeCap), r.StakeMin, r.StakeToken, r.Invalidated)
+	}
+	return b.String()
+}
+
+// FormatBlackWhites returns the black and white lists as a table.
+func FormatBlackWhites(bw *BlackWhites) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-12s %s\n", "LIST", "DENOMS")
+	fmt.Fprintf(&b, "%-12s %s\n", "whitelisted", orNone(strings.Join(bw.Whitelisted, ",")))
+	fmt.Fprintf(&b, "%-12s %s\n", "blacklisted", orNone(strings.Join(bw.Blacklisted, ",")))
+	return b.String()
+}
+
+// trimDec drops the trailing zeros sekaid prints for decimals, `1.000000000000000000` is `1`.
+func trimDec(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
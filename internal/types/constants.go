@@ -1,3 +1,18 @@
 package types
 
 const KiraVersion = "v0.0.50"
+
+// Container images of the KIRA nodes and the versions the launcher deploys by default.
+const (
+	SekaiImage           = "ghcr.io/kiracore/sekai"
+	InterxImage          = "ghcr.io/kiracore/interx"
+	DefaultSekaiVersion  = "v0.3.46"
+	DefaultInterxVersion = "v0.3.16"
+)
+
+// DefaultStackName is the name of the stack `up` and `deploy --join` create without --name.
+// The containers of a stack are named after it, so its sekai container is DefaultSekaiContainer.
+const (
+	DefaultStackName      = "kira"
+	DefaultSekaiContainer = DefaultStackName + "-sekai"
+)
@@ -0,0 +1,304 @@
+// Package upgrade moves a sekai network to a new sekai version at a coordinated halt height.
+//
+// Every node is configured to halt at the same height. Once all of them have stopped, their
+// data directories are snapshotted, the containers are recreated from the new image and started
+// again. If the network does not produce blocks with the new version, every node is restored
+// from its snapshot and started with the old image.
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/logging"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/sekai"
+	"github.com/mrlutik/kira2.0/internal/sekaiconfig"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+)
+
+// log is the logger instance for this package.
+var log = logging.Log
+
+// SnapshotLabel marks the volumes that hold a pre-upgrade snapshot. Its value is the node name.
+const SnapshotLabel = "kira.snapshot"
+
+// Plan describes an upgrade.
+type Plan struct {
+	// HaltHeight is the last height the old version commits.
+	HaltHeight int64
+	// Image is the sekai image of the new version.
+	Image string
+	// Home is the sekaid home inside the node containers.
+	Home string
+	// HaltTimeout is how long the network gets to reach HaltHeight.
+	HaltTimeout time.Duration
+	// Readiness are the gates every node has to pass after the restart scheduling the halt and
+	// after the upgrade. The advancing gate is what proves block production resumed.
+	Readiness node.Readiness
+}
+
+// target is a node taking part in the upgrade.
+type target struct {
+	node     inventory.Node
+	dm       *docker.DockerManager
+	volume   string
+	snapshot string
+	oldImage string
+	swapped  bool
+}
+
+// Run upgrades the nodes according to plan. The new image is pulled onto every node before
+// any of them is scheduled to halt. It blocks until the network produces blocks with
+// the new image, or until the nodes have been rolled back after a failed start.
+func Run(ctx context.Context, nodes []inventory.Node, plan Plan) error {
+	if plan.Home == "" {
+		plan.Home = sekai.DefaultHome
+	}
+
+	targets := make([]*target, 0, len(nodes))
+	for _, n := range nodes {
+		dm, err := n.DockerManager()
+		if err != nil {
+			return err
+		}
+		t, err := newTarget(ctx, n, dm, plan)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+
+	return run(ctx, targets, plan)
+}
+
+func newTarget(ctx context.Context, n inventory.Node, dm *docker.DockerManager, plan Plan) (*target, error) {
+	volume, err := dm.VolumeAt(ctx, n.ContainerName(), plan.Home)
+	if err != nil {
+		return nil, err
+	}
+	return &target{
+		node:     n,
+		dm:       dm,
+		volume:   volume,
+		snapshot: volume + "-pre-" + strconv.FormatInt(plan.HaltHeight, 10),
+	}, nil
+}
+
+func run(ctx context.Context, targets []*target, plan Plan) error {
+	// The new image has to be on every daemon before any node is told to halt: the containers
+	// are only recreated once the whole network stopped, too late to find a mistyped version.
+	for _, t := range targets {
+		if err := pullImage(ctx, t, plan); err != nil {
+			return fmt.Errorf("image %s is not available for node %s, no node was scheduled to halt: %w", plan.Image, t.node.Name, err)
+		}
+	}
+
+	// The nodes are restarted one at a time, each has to pass the readiness gates before the
+	// next one goes down, so the network keeps its voting power during the rollout.
+	for i, t := range targets {
+		if err := schedule(ctx, t, plan); err != nil {
+			return fmt.Errorf("failed to schedule halt of node %s, rollout stopped with %v scheduled to halt at height %d: %w", t.node.Name, nodeNames(targets[:i+1]), plan.HaltHeight, err)
+		}
+	}
+	for _, t := range targets {
+		if err := waitHalted(ctx, t, plan); err != nil {
+			return err
+		}
+	}
+	for _, t := range targets {
+		if err := snapshot(ctx, t, plan); err != nil {
+			return fmt.Errorf("failed to snapshot node %s, the nodes stay halted at height %d: %w", t.node.Name, plan.HaltHeight, err)
+		}
+	}
+
+	err := swapAll(ctx, targets, plan)
+	if err == nil {
+		log.Infof("Upgrade to %s at height %d completed, snapshots are kept in volumes %s", plan.Image, plan.HaltHeight, snapshotNames(targets))
+		return nil
+	}
+
+	log.Errorf("Upgrade to %s failed, rolling back: %s", plan.Image, err)
+	for _, t := range targets {
+		if rbErr := rollback(context.Background(), t, plan); rbErr != nil {
+			return fmt.Errorf("upgrade failed: %w; rollback of node %s failed too: %s", err, t.node.Name, rbErr)
+		}
+	}
+	return fmt.Errorf("upgrade failed and was rolled back: %w", err)
+}
+
+// pullImage pulls the new image onto the daemon of a node. An image that cannot be pulled
+// but is present already, e.g. one built on the host, is used as is.
+func pullImage(ctx context.Context, t *target, plan Plan) error {
+	pullErr := t.dm.PullImage(ctx, plan.Image)
+	exists, err := t.dm.ImageExists(ctx, plan.Image)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if pullErr != nil {
+			return pullErr
+		}
+		return fmt.Errorf("image %s is missing after the pull", plan.Image)
+	}
+	if pullErr != nil {
+		log.Warnf("Failed to pull %s for node %s, using the local image: %s", plan.Image, t.node.Name, pullErr)
+	}
+	return nil
+}
+
+// schedule writes the halt height into app.toml, restarts the node so it takes effect and waits
+// until the node passes the readiness gates again.
+func schedule(ctx context.Context, t *target, plan Plan) error {
+	status, err := tendermint.NewClient(t.node.RPC).Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.SyncInfo.LatestBlockHeight >= plan.HaltHeight {
+		return fmt.Errorf("node is already at height %d, past the halt height %d", status.SyncInfo.LatestBlockHeight, plan.HaltHeight)
+	}
+	if status.SyncInfo.LatestBlockHeight+plan.Readiness.MinBlocks >= plan.HaltHeight {
+		return fmt.Errorf("node is at height %d, too close to the halt height %d to pass the readiness gates after its restart", status.SyncInfo.LatestBlockHeight, plan.HaltHeight)
+	}
+
+	if err := setHaltHeight(ctx, t, plan, plan.HaltHeight); err != nil {
+		return err
+	}
+	log.Infof("Node %s will halt at height %d (now at %d)", t.node.Name, plan.HaltHeight, status.SyncInfo.LatestBlockHeight)
+
+	if err := t.dm.RestartContainer(ctx, t.node.ContainerName(), 30*time.Second); err != nil {
+		return err
+	}
+	return node.WaitReady(ctx, t.node.Name, t.node.RPC, plan.Readiness, nil)
+}
+
+func setHaltHeight(ctx context.Context, t *target, plan Plan, height int64) error {
+	file := sekaiconfig.ContainerFile{DM: t.dm, Container: t.node.ContainerName(), Path: path.Join(plan.Home, "config", sekaiconfig.AppFile)}
+	edit, err := sekaiconfig.Prepare(ctx, file, []sekaiconfig.Patch{{File: sekaiconfig.AppFile, Key: "halt-height", Value: height}})
+	if err != nil {
+		return err
+	}
+	return edit.Write(ctx)
+}
+
+// waitHalted blocks until the node process has exited at the halt height.
+func waitHalted(ctx context.Context, t *target, plan Plan) error {
+	ctx, cancel := context.WithTimeout(ctx, plan.HaltTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	client := tendermint.NewClient(t.node.RPC)
+	var height int64
+	for {
+		running, err := t.dm.IsRunning(ctx, t.node.ContainerName())
+		if err != nil {
+			return err
+		}
+		if !running {
+			log.Infof("Node %s halted after height %d", t.node.Name, height)
+			return nil
+		}
+		if status, err := client.Status(ctx); err == nil {
+			height = status.SyncInfo.LatestBlockHeight
+			log.Infof("Node %s at height %d, halting at %d", t.node.Name, height, plan.HaltHeight)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("node %s did not halt within %s, last seen at height %d", t.node.Name, plan.HaltTimeout, height)
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot copies the data directory of the halted node into a new volume.
+func snapshot(ctx context.Context, t *target, plan Plan) error {
+	labels := map[string]string{SnapshotLabel: t.node.Name}
+	if err := t.dm.EnsureVolume(ctx, t.snapshot, labels); err != nil {
+		return err
+	}
+
+	log.Infof("Snapshotting data of node %s into volume %s...", t.node.Name, t.snapshot)
+	return copyData(ctx, t, plan, path.Join(plan.Home, "data"), "/snapshot/data")
+}
+
+// copyData replaces the directory to with a copy of from in a job container that runs the
+// current node image and mounts the node home and the snapshot volume.
+func copyData(ctx context.Context, t *target, plan Plan, from, to string) error {
+	image, err := t.dm.ContainerImage(ctx, t.node.ContainerName())
+	if err != nil {
+		return err
+	}
+
+	volumes := []docker.VolumeMount{{Name: t.volume, Target: plan.Home}, {Name: t.snapshot, Target: "/snapshot"}}
+	return t.dm.CopyDir(ctx, t.node.ContainerName()+"-upgrade-job", image, volumes, from, to)
+}
+
+// swapAll clears the halt height, recreates every node from the new image and waits until
+// the network produces blocks again.
+func swapAll(ctx context.Context, targets []*target, plan Plan) error {
+	for _, t := range targets {
+		if err := setHaltHeight(ctx, t, plan, 0); err != nil {
+			return err
+		}
+		oldImage, err := t.dm.RecreateContainer(ctx, t.node.ContainerName(), plan.Image)
+		if err != nil {
+			return err
+		}
+		t.oldImage, t.swapped = oldImage, true
+		if err := t.dm.StartContainer(ctx, t.node.ContainerName()); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range targets {
+		if err := node.WaitReady(ctx, t.node.Name, t.node.RPC, plan.Readiness, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores the snapshot and the old image of a node and starts it again.
+func rollback(ctx context.Context, t *target, plan Plan) error {
+	log.Warnf("Rolling back node %s...", t.node.Name)
+	if err := t.dm.StopContainer(ctx, t.node.ContainerName(), 30*time.Second); err != nil {
+		return err
+	}
+	if t.swapped {
+		if _, err := t.dm.RecreateContainer(ctx, t.node.ContainerName(), t.oldImage); err != nil {
+			return err
+		}
+	}
+	if err := copyData(ctx, t, plan, "/snapshot/data", path.Join(plan.Home, "data")); err != nil {
+		return err
+	}
+	if err := setHaltHeight(ctx, t, plan, 0); err != nil {
+		return err
+	}
+
+	return t.dm.StartContainer(ctx, t.node.ContainerName())
+}
+
+func snapshotNames(targets []*target) []string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.snapshot
+	}
+	return names
+}
+
+func nodeNames(targets []*target) []string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.node.Name
+	}
+	return names
+}
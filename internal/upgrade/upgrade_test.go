@@ -0,0 +1,175 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrlutik/kira2.0/internal/docker"
+	"github.com/mrlutik/kira2.0/internal/docker/fake"
+	"github.com/mrlutik/kira2.0/internal/inventory"
+	"github.com/mrlutik/kira2.0/internal/node"
+	"github.com/mrlutik/kira2.0/internal/tendermint"
+	tmfake "github.com/mrlutik/kira2.0/internal/tendermint/fake"
+)
+
+const (
+	oldImage = "ghcr.io/kiracore/sekai:v0.3.46"
+	newImage = "ghcr.io/kiracore/sekai:v0.3.47"
+	appFile  = "/sekai/config/app.toml"
+)
+
+func testPlan() Plan {
+	return Plan{
+		HaltHeight:  100,
+		Image:       newImage,
+		Home:        "/sekai",
+		HaltTimeout: time.Second,
+		Readiness: node.Readiness{
+			SyncTimeout:    100 * time.Millisecond,
+			AdvanceTimeout: 100 * time.Millisecond,
+			MinBlocks:      1,
+			PeersTimeout:   100 * time.Millisecond,
+			Interval:       10 * time.Millisecond,
+		},
+	}
+}
+
+// newTestTarget runs a sekai node container on a fake daemon with an RPC at height 10.
+// copies records the directories the upgrade jobs copy.
+func newTestTarget(t *testing.T, copies *[]string) (*fake.Client, *target) {
+	ctx := context.Background()
+	f := fake.New()
+	f.AddImage(oldImage)
+	f.RunHandler = func(containerName string, cmd []string) *docker.ExecResult {
+		if !strings.HasSuffix(containerName, "-upgrade-job") {
+			return nil
+		}
+		*copies = append(*copies, cmd[len(cmd)-1])
+		return &docker.ExecResult{}
+	}
+	dm := docker.NewDockerManagerWithClient(f)
+	spec := docker.NodeSpec{Name: "kira-sekai", Image: oldImage, Volumes: []docker.VolumeMount{{Name: "kira-sekai", Target: "/sekai"}}}
+	if _, err := dm.CreateNodeContainer(ctx, spec); err != nil {
+		t.Fatalf("CreateNodeContainer() error: %v", err)
+	}
+	if err := dm.StartContainer(ctx, "kira-sekai"); err != nil {
+		t.Fatalf("StartContainer() error: %v", err)
+	}
+	if err := f.WriteFile("kira-sekai", appFile, []byte("pruning = \"default\"\nhalt-height = 0\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	rpc := tmfake.NewServer(tmfake.Node{Status: tendermint.Status{SyncInfo: tendermint.SyncInfo{LatestBlockHeight: 10}}})
+	t.Cleanup(rpc.Close)
+	tg, err := newTarget(ctx, inventory.Node{Name: "validator", Container: "kira-sekai", RPC: rpc.URL()}, dm, testPlan())
+	if err != nil {
+		t.Fatalf("newTarget() error: %v", err)
+	}
+	if tg.volume != "kira-sekai" || tg.snapshot != "kira-sekai-pre-100" {
+		t.Fatalf("target volume %s and snapshot %s, want kira-sekai and kira-sekai-pre-100", tg.volume, tg.snapshot)
+	}
+	return f, tg
+}
+
+func TestRunRefusesUnavailableImage(t *testing.T) {
+	var copies []string
+	f, tg := newTestTarget(t, &copies)
+	f.PullErrors[newImage] = errors.New("manifest unknown")
+
+	err := run(context.Background(), []*target{tg}, testPlan())
+	if err == nil || !strings.Contains(err.Error(), "no node was scheduled to halt") {
+		t.Fatalf("run() = %v, want it to stop before scheduling the halt", err)
+	}
+	if app, _ := f.File("kira-sekai", appFile); !strings.Contains(string(app), "halt-height = 0") {
+		t.Fatalf("app.toml = %q, want no halt height", app)
+	}
+	if running, err := tg.dm.IsRunning(context.Background(), "kira-sekai"); err != nil || !running {
+		t.Fatalf("IsRunning() = %t, %v, want the node untouched", running, err)
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		pullErr error
+		local   bool
+		err     bool
+	}{
+		{name: "pulled"},
+		{name: "local image that cannot be pulled", pullErr: errors.New("denied"), local: true},
+		{name: "missing image", pullErr: errors.New("manifest unknown"), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var copies []string
+			f, tg := newTestTarget(t, &copies)
+			if tt.pullErr != nil {
+				f.PullErrors[newImage] = tt.pullErr
+			}
+			if tt.local {
+				f.AddImage(newImage)
+			}
+			if err := pullImage(context.Background(), tg, testPlan()); (err != nil) != tt.err {
+				t.Fatalf("pullImage() error = %v, want error %t", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSwapAllRollsBack(t *testing.T) {
+	ctx := context.Background()
+	var copies []string
+	f, tg := newTestTarget(t, &copies)
+	f.AddImage(newImage)
+	plan := testPlan()
+
+	// The node halted at the halt height.
+	if err := setHaltHeight(ctx, tg, plan, plan.HaltHeight); err != nil {
+		t.Fatalf("setHaltHeight() error: %v", err)
+	}
+	if err := f.Exit("kira-sekai", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot(ctx, tg, plan); err != nil {
+		t.Fatalf("snapshot() error: %v", err)
+	}
+
+	// The RPC never advances, so the new version does not pass the readiness gates.
+	err := swapAll(ctx, []*target{tg}, plan)
+	if err == nil {
+		t.Fatal("swapAll() succeeded on a network that produces no blocks")
+	}
+	if !tg.swapped || tg.oldImage != oldImage {
+		t.Fatalf("target swapped %t from %s, want swapped from %s", tg.swapped, tg.oldImage, oldImage)
+	}
+	if image, _ := tg.dm.ContainerImage(ctx, "kira-sekai"); image != newImage {
+		t.Fatalf("node runs %s after the swap, want %s", image, newImage)
+	}
+
+	if err := rollback(ctx, tg, plan); err != nil {
+		t.Fatalf("rollback() error: %v", err)
+	}
+	if image, _ := tg.dm.ContainerImage(ctx, "kira-sekai"); image != oldImage {
+		t.Fatalf("node runs %s after the rollback, want %s", image, oldImage)
+	}
+	if running, err := tg.dm.IsRunning(ctx, "kira-sekai"); err != nil || !running {
+		t.Fatalf("IsRunning() after the rollback = %t, %v", running, err)
+	}
+	if app, _ := f.File("kira-sekai", appFile); !strings.Contains(string(app), "halt-height = 0") || !strings.Contains(string(app), `pruning = "default"`) {
+		t.Fatalf("app.toml after the rollback = %q, want the halt height cleared", app)
+	}
+	want := []string{
+		"rm -rf '/snapshot/data' && cp -a '/sekai/data' '/snapshot/data'",
+		"rm -rf '/sekai/data' && cp -a '/snapshot/data' '/sekai/data'",
+	}
+	if strings.Join(copies, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("copies = %q, want the snapshot and its restore", copies)
+	}
+	if _, err := f.VolumeInspect(ctx, "kira-sekai-pre-100"); err != nil {
+		t.Fatalf("snapshot volume is missing: %v", err)
+	}
+}
@@ -1,3 +1,8 @@
 #!/usr/bin/env bash
+set -e
+set -x
 
-echo "Mocking test scritpt"
\ No newline at end of file
+echo "INFO: Running unit tests"
+
+go vet ./...
+go test -count=1 ./...